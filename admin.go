@@ -0,0 +1,172 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultPreviewRotations is the number of rotation times previewed by
+	// the schedule endpoint of AdminHandler if n is not given.
+	defaultPreviewRotations = 5
+	// maxPreviewRotations bounds the rotation times previewed at once.
+	maxPreviewRotations = 1000
+)
+
+// AdminStatus is the response of the status endpoint of AdminHandler.
+type AdminStatus struct {
+	Stats  Stats          `json:"stats"`
+	Active ActiveFileInfo `json:"active"`
+	// Schedule is the schedule as described by DescribeSchedule.
+	Schedule string `json:"schedule"`
+}
+
+// AdminHandler returns a handler to operate f remotely, meant to be mounted
+// with http.StripPrefix, such as under /debug/logfeller/. It serves:
+//
+//	GET  /status    AdminStatus as JSON
+//	GET  /backups   the backups from ListBackups as JSON
+//	GET  /schedule  the next n rotation times as JSON, ?n=5 by default
+//	POST /rotate    rotates as with ForceRotate, or Rotate with ?force=false
+//	POST /trim      removes backups beyond Backups, MaxAge and Retention
+//	POST /purge     purges the backups expired from the trash
+//
+// It does no authentication of its own, and must only be reachable by
+// trusted callers. A File with SingleWriter set is only used by its writer,
+// so every endpoint responds with 503 Service Unavailable for it.
+func (f *File) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.serveAdmin(w, r, strings.Trim(r.URL.Path, "/"))
+	})
+}
+
+func (f *File) serveAdmin(w http.ResponseWriter, r *http.Request, endpoint string) {
+	method := http.MethodPost
+	switch endpoint {
+	case "status", "backups", "schedule":
+		method = http.MethodGet
+	case "rotate", "trim", "purge":
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	if f.SingleWriter {
+		// serving the request would race the writer on the lock of f
+		http.Error(w, fmt.Sprintf("%s is single_writer and cannot be operated remotely", f.Filename), http.StatusServiceUnavailable)
+		return
+	}
+	if err := f.init(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var (
+		v   interface{}
+		err error
+	)
+	switch endpoint {
+	case "status":
+		v = AdminStatus{Stats: f.Stats(), Active: f.CurrentFileInfo(), Schedule: f.DescribeSchedule()}
+	case "backups":
+		v, err = f.ListBackups()
+	case "schedule":
+		n := defaultPreviewRotations
+		if s := r.URL.Query().Get("n"); s != "" {
+			if n, err = strconv.Atoi(s); err != nil || n < 1 || n > maxPreviewRotations {
+				http.Error(w, fmt.Sprintf("n must be a number between 1-%d", maxPreviewRotations), http.StatusBadRequest)
+				return
+			}
+		}
+		v = f.nextRotations(n)
+	case "rotate":
+		err = f.rotateNow(r.URL.Query().Get("force") != "false", TriggerAdmin)
+	case "trim":
+		err = f.trim()
+	case "purge":
+		f.trimMu.Lock()
+		err = f.purgeTrash()
+		f.trimMu.Unlock()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if v == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, v)
+}
+
+// nextRotations returns the next n rotation times of f.
+func (f *File) nextRotations(n int) []time.Time {
+	f.mu.Lock()
+	t := f.now()
+	f.mu.Unlock()
+	times := make([]time.Time, 0, n)
+	for len(times) < n {
+		_, next := f.calcRotationTimes(t)
+		times = append(times, next)
+		t = next
+	}
+	return times
+}
+
+// AdminHandler returns a handler to operate the files of m remotely, meant to
+// be mounted with http.StripPrefix as with File.AdminHandler. GET / lists the
+// names of the files, and the endpoints of File.AdminHandler are served for
+// each file under its name, such as /app/status.
+func (m *Manager) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(r.URL.Path, "/")
+		if path == "" {
+			if r.Method != http.MethodGet {
+				w.Header().Set("Allow", http.MethodGet)
+				http.Error(w, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+				return
+			}
+			m.mu.Lock()
+			names := make([]string, 0, len(m.Files))
+			for name := range m.Files {
+				names = append(names, name)
+			}
+			m.mu.Unlock()
+			sort.Strings(names)
+			writeJSON(w, names)
+			return
+		}
+		i := strings.LastIndex(path, "/")
+		if i < 0 {
+			http.NotFound(w, r)
+			return
+		}
+		m.mu.Lock()
+		f, ok := m.Files[path[:i]]
+		m.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		f.serveAdmin(w, r, path[i+1:])
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
@@ -0,0 +1,105 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_AdminHandler(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_AdminHandler")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+
+	f := &File{Filename: filepath.Join(dirname, "app.log"), When: "h", AuditLog: "audit.jsonl"}
+	defer f.Close()
+	f.setNowFunc(func() time.Time { return time.Date(2021, 3, 4, 10, 15, 0, 0, time.UTC) })
+	_, err = f.Write([]byte("line\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	m := &Manager{Files: map[string]*File{"app": f}}
+
+	tests := []struct {
+		name     string
+		h        http.Handler
+		method   string
+		target   string
+		wantCode int
+		check    func(t *testing.T, body []byte)
+	}{
+		{
+			name: "status", h: f.AdminHandler(), method: http.MethodGet, target: "/status", wantCode: http.StatusOK,
+			check: func(t *testing.T, body []byte) {
+				var s AdminStatus
+				err := json.Unmarshal(body, &s)
+				testutils.TrueOrError(t, err == nil && s.Stats.Bytes == 5 && s.Active.Open, "want 5 bytes written to the open file, got %+v, err = %v", s, err)
+			},
+		},
+		{
+			name: "schedule", h: f.AdminHandler(), method: http.MethodGet, target: "/schedule?n=2", wantCode: http.StatusOK,
+			check: func(t *testing.T, body []byte) {
+				var times []time.Time
+				err := json.Unmarshal(body, &times)
+				want := []time.Time{time.Date(2021, 3, 4, 11, 0, 0, 0, time.UTC), time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)}
+				testutils.TrueOrError(t, err == nil && len(times) == 2 && times[0].Equal(want[0]) && times[1].Equal(want[1]), "want %v, got %v, err = %v", want, times, err)
+			},
+		},
+		{name: "schedule_n_invalid", h: f.AdminHandler(), method: http.MethodGet, target: "/schedule?n=0", wantCode: http.StatusBadRequest},
+		{name: "rotate_get", h: f.AdminHandler(), method: http.MethodGet, target: "/rotate", wantCode: http.StatusMethodNotAllowed},
+		{name: "unknown", h: f.AdminHandler(), method: http.MethodGet, target: "/unknown", wantCode: http.StatusNotFound},
+		{
+			name: "single_writer", h: (&File{Filename: filepath.Join(dirname, "single.log"), SingleWriter: true}).AdminHandler(),
+			method: http.MethodGet, target: "/status", wantCode: http.StatusServiceUnavailable,
+		},
+		{
+			name: "rotate", h: f.AdminHandler(), method: http.MethodPost, target: "/rotate", wantCode: http.StatusNoContent,
+			check: func(t *testing.T, _ []byte) {
+				b, err := ioutil.ReadFile(filepath.Join(dirname, "audit.jsonl"))
+				testutils.TrueOrFatal(t, err == nil, "failed to read audit log: %v", err)
+				var e AuditEntry
+				err = json.Unmarshal(b, &e)
+				testutils.TrueOrError(t, err == nil && e.Action == AuditRotate && e.Trigger == TriggerAdmin, "want the rotation audited as triggered by the admin endpoint, got %s, err = %v", b, err)
+			},
+		},
+		{
+			name: "backups", h: f.AdminHandler(), method: http.MethodGet, target: "/backups", wantCode: http.StatusOK,
+			check: func(t *testing.T, body []byte) {
+				var backups []Backup
+				err := json.Unmarshal(body, &backups)
+				testutils.TrueOrError(t, err == nil && len(backups) == 1, "want the rotated backup, got %v, err = %v", backups, err)
+			},
+		},
+		{name: "trim", h: f.AdminHandler(), method: http.MethodPost, target: "/trim", wantCode: http.StatusNoContent},
+		{name: "purge", h: f.AdminHandler(), method: http.MethodPost, target: "/purge", wantCode: http.StatusNoContent},
+		{
+			name: "manager_files", h: m.AdminHandler(), method: http.MethodGet, target: "/", wantCode: http.StatusOK,
+			check: func(t *testing.T, body []byte) {
+				var names []string
+				err := json.Unmarshal(body, &names)
+				testutils.TrueOrError(t, err == nil && len(names) == 1 && names[0] == "app", "want [app], got %v, err = %v", names, err)
+			},
+		},
+		{name: "manager_status", h: m.AdminHandler(), method: http.MethodGet, target: "/app/status", wantCode: http.StatusOK},
+		{name: "manager_unknown_file", h: m.AdminHandler(), method: http.MethodGet, target: "/other/status", wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+			testutils.TrueOrFatal(t, rec.Code == tt.wantCode, "want status %d, got %d: %s", tt.wantCode, rec.Code, rec.Body)
+			if tt.check != nil {
+				tt.check(t, rec.Body.Bytes())
+			}
+		})
+	}
+}
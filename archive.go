@@ -0,0 +1,175 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Archiver stores backups away from the local disk, such as in an object
+// store. Backups are stored under the base names they have locally, so one
+// Archiver may hold the backups of several Files as long as their names do
+// not clash. Its methods may be called concurrently.
+type Archiver interface {
+	// Upload stores the backup read from r under name, replacing any
+	// backup already stored under it.
+	Upload(ctx context.Context, name string, r io.Reader) error
+	// List returns the names of the backups stored, in any order. It may
+	// return names other than those of backups, which are ignored.
+	List(ctx context.Context) ([]string, error)
+	// Open opens the backup stored under name for reading.
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
+// ArchiveDeleter is implemented by Archivers that can delete the backups
+// they store, which File.ArchiveRetention needs.
+type ArchiveDeleter interface {
+	// Delete deletes the backup stored under name.
+	Delete(ctx context.Context, name string) error
+}
+
+// remoteBackups returns the backups of f stored by its Archiver, in no
+// particular order.
+func (f *File) remoteBackups() ([]Backup, error) {
+	names, err := f.Archiver.List(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("cannot list archived backups: %v", err)
+	}
+	var backups []Backup
+	for _, name := range names {
+		filename, encoded := trimEncodedExts(name)
+		t, seq, ok := f.parseBackupName(filename)
+		if !ok {
+			continue
+		}
+		backups = append(backups, Backup{Name: name, Time: t, Seq: seq, Encoded: encoded, Remote: true})
+	}
+	return backups, nil
+}
+
+// openBackup opens b for reading, decoded as with OpenBackup.
+func (f *File) openBackup(b Backup) (io.ReadCloser, error) {
+	if !b.Remote {
+		return OpenBackup(b.Name)
+	}
+	rc, err := f.Archiver.Open(context.Background(), b.Name)
+	if err != nil {
+		return nil, err
+	}
+	return decode(rc)
+}
+
+// deleteBackupOf deletes b, from the Archiver if it is stored there.
+func (f *File) deleteBackupOf(b Backup) error {
+	if !b.Remote {
+		return deleteBackup(b.Name)
+	}
+	d, ok := f.Archiver.(ArchiveDeleter)
+	if !ok {
+		return fmt.Errorf("cannot delete archived backup %s, the archiver does not implement ArchiveDeleter", b.Name)
+	}
+	return d.Delete(context.Background(), b.Name)
+}
+
+// archiveBackups uploads the local backups of f to its Archiver, removing
+// them from the disk once they are stored. It must be called with trimMu
+// held.
+func (f *File) archiveBackups() error {
+	backups, err := f.localBackups()
+	if err != nil {
+		return err
+	}
+	var errs multipleErrors
+	for _, b := range backups {
+		err := f.archiveBackup(b.Name)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		f.audit(AuditEntry{Action: AuditArchive, Trigger: TriggerArchiver, Backup: b.Name, Error: errString(err)})
+	}
+	return errs.err()
+}
+
+// archiveBackup uploads the backup name, and deletes it along with its
+// sidecars once it is stored.
+func (f *File) archiveBackup(name string) error {
+	fh, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	err = f.Archiver.Upload(context.Background(), filepath.Base(name), fh)
+	fh.Close()
+	if err != nil {
+		return fmt.Errorf("unable to archive %s: %v", name, err)
+	}
+	return deleteBackup(name)
+}
+
+// archivedNames returns the base names, with their encoded extensions
+// trimmed, of the backups stored by the Archiver of f. It is nil without an
+// Archiver.
+func (f *File) archivedNames() (map[string]bool, error) {
+	if f.Archiver == nil {
+		return nil, nil
+	}
+	names, err := f.Archiver.List(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("cannot list archived backups: %v", err)
+	}
+	archived := make(map[string]bool, len(names))
+	for _, name := range names {
+		filename, _ := trimEncodedExts(name)
+		archived[filename] = true
+	}
+	return archived, nil
+}
+
+// restoreArchived downloads the backups stored by the Archiver of f under
+// the base name of dst, as is or with encoded extensions, back next to dst,
+// so that a rotation into dst finds them as it would local backups and
+// resolves the collision with OnBackupCollision, rather than replacing them
+// on the next upload. It must be called with trimMu held.
+func (f *File) restoreArchived(dst string) error {
+	if f.Archiver == nil {
+		return nil
+	}
+	names, err := f.Archiver.List(context.Background())
+	if err != nil {
+		return fmt.Errorf("cannot list archived backups: %v", err)
+	}
+	base := filepath.Base(dst)
+	for _, name := range names {
+		if filename, _ := trimEncodedExts(name); filename != base {
+			continue
+		}
+		if err := f.restoreBackup(name, filepath.Join(filepath.Dir(dst), name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreBackup downloads the archived backup name to dst as it is stored.
+func (f *File) restoreBackup(name, dst string) error {
+	rc, err := f.Archiver.Open(context.Background(), name)
+	if err != nil {
+		return fmt.Errorf("unable to open archived backup %s: %v", name, err)
+	}
+	defer rc.Close()
+	fh, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fileOpenMode)
+	if err != nil {
+		return fmt.Errorf("unable to restore archived backup %s: %v", name, err)
+	}
+	if _, err := io.CopyBuffer(fh, onlyReader{rc}, make([]byte, f.CopyBufferSize)); err != nil {
+		fh.Close()
+		os.Remove(dst)
+		return fmt.Errorf("unable to restore archived backup %s: %v", name, err)
+	}
+	return fh.Close()
+}
@@ -0,0 +1,151 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+// memArchiver is an Archiver keeping backups in memory.
+type memArchiver struct {
+	mu      sync.Mutex
+	backups map[string][]byte
+}
+
+func (a *memArchiver) Upload(_ context.Context, name string, r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.backups == nil {
+		a.backups = map[string][]byte{}
+	}
+	a.backups[name] = b
+	return nil
+}
+
+func (a *memArchiver) List(context.Context) ([]string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var names []string
+	for name := range a.backups {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (a *memArchiver) Open(_ context.Context, name string) (io.ReadCloser, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b, ok := a.backups[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (a *memArchiver) Delete(_ context.Context, name string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.backups[name]; !ok {
+		return os.ErrNotExist
+	}
+	delete(a.backups, name)
+	return nil
+}
+
+func TestFile_Archiver(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_Archiver")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+
+	newFile := func(name string, archiveRetention bool) *File {
+		f := &File{Filename: filepath.Join(dirname, name), When: "h", Backups: 2, Compress: true, NoGoroutines: true, Archiver: &memArchiver{}, ArchiveRetention: archiveRetention}
+		now := time.Date(2021, 3, 4, 10, 15, 0, 0, time.UTC)
+		f.setNowFunc(func() time.Time { return now })
+		for _, line := range []string{"one", "two", "three", "four"} {
+			_, err := f.Write([]byte(line + "\n"))
+			testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+			now = now.Add(time.Hour)
+		}
+		return f
+	}
+
+	kept := newFile("kept.log", false)
+	defer kept.Close()
+	backups, err := kept.ListBackups()
+	testutils.TrueOrFatal(t, err == nil && len(backups) == 3, "want every backup kept in the archive, got %v, err = %v", backups, err)
+
+	f := newFile("app.log", true)
+	defer f.Close()
+	local, err := f.localBackups()
+	testutils.TrueOrFatal(t, err == nil && len(local) == 0, "want no backups left on disk, got %v, err = %v", local, err)
+	backups, err = f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil && len(backups) == 2, "want the 2 backups kept by Backups, got %v, err = %v", backups, err)
+	for _, b := range backups {
+		testutils.TrueOrError(t, b.Remote && b.Encoded == compressExt, "want a remote compressed backup, got %+v", b)
+	}
+
+	r, err := f.NewReader(time.Time{})
+	testutils.TrueOrFatal(t, err == nil, "File.NewReader() error = %v", err)
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	testutils.TrueOrError(t, err == nil && string(b) == "two\nthree\nfour\n", "want the archived backups then the active file, got %q, err = %v", b, err)
+}
+
+func TestFile_Archiver_collision(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_Archiver_collision")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+
+	tests := []struct {
+		name     string
+		compress bool
+		policy   CollisionPolicy
+		want     []string
+	}{
+		{name: "append", want: []string{"first\nsecond\n"}},
+		{name: "append_compressed", compress: true, want: []string{"first\nsecond\n"}},
+		{name: "sequence", policy: CollisionSequence, want: []string{"first\n", "second\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &memArchiver{}
+			f := &File{Filename: filepath.Join(dirname, tt.name+".log"), When: "d", Compress: tt.compress, OnBackupCollision: tt.policy, NoGoroutines: true, Archiver: a}
+			defer f.Close()
+			now := time.Date(2021, 3, 4, 10, 15, 0, 0, time.UTC)
+			f.setNowFunc(func() time.Time { return now })
+			for _, line := range []string{"first", "second"} {
+				_, err := f.Write([]byte(line + "\n"))
+				testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+				testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+				now = now.Add(time.Minute)
+			}
+			local, err := f.localBackups()
+			testutils.TrueOrFatal(t, err == nil && len(local) == 0, "want no backups left on disk, got %v, err = %v", local, err)
+			backups, err := f.ListBackups()
+			testutils.TrueOrFatal(t, err == nil && len(backups) == len(tt.want), "want %d archived backups, got %v, err = %v", len(tt.want), backups, err)
+			for i, b := range backups {
+				r, err := f.openBackup(b)
+				testutils.TrueOrFatal(t, err == nil, "openBackup(%s) error = %v", b.Name, err)
+				got, err := ioutil.ReadAll(r)
+				r.Close()
+				testutils.TrueOrError(t, err == nil && string(got) == tt.want[i], "backup %s = %q, want %q, err = %v", b.Name, got, tt.want[i], err)
+			}
+		})
+	}
+}
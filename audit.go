@@ -0,0 +1,100 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// Actions recorded in the AuditLog.
+const (
+	AuditRotate  = "rotate"
+	AuditTrim    = "trim"
+	AuditPurge   = "purge"
+	AuditRemove  = "remove"
+	AuditArchive = "archive"
+)
+
+// Triggers of the actions recorded in the AuditLog.
+const (
+	// TriggerSchedule is a rotation on the rotation schedule.
+	TriggerSchedule = "schedule"
+	// TriggerClockRegression is a rotation after the clock went backwards
+	// with OnClockRegression "sequence".
+	TriggerClockRegression = "clock_regression"
+	// TriggerSize is a rotation as the file reached MaxSize.
+	TriggerSize = "size"
+	// TriggerRotate and TriggerForceRotate are rotations by Rotate and
+	// ForceRotate.
+	TriggerRotate      = "rotate"
+	TriggerForceRotate = "force_rotate"
+	// TriggerShutdown is a rotation by Shutdown.
+	TriggerShutdown = "shutdown"
+	// TriggerAdmin is a rotation requested through the AdminHandler.
+	TriggerAdmin = "admin"
+	// TriggerFileTouched is a rotation as TriggerFile appeared.
+	TriggerFileTouched = "trigger_file"
+	// TriggerQuota is a rotation as DailyQuotaBytes was exceeded with
+	// OnQuotaExceeded "rotate".
+	TriggerQuota = "quota"
+	// TriggerRetention is a backup trimmed by Backups, MaxAge or Retention,
+	// or purged after TrashRetention.
+	TriggerRetention = "retention"
+	// TriggerRemoveAll is a backup removed by RemoveAll.
+	TriggerRemoveAll = "remove_all"
+	// TriggerArchiver is a backup moved to the Archiver after it was
+	// rotated out.
+	TriggerArchiver = "archiver"
+)
+
+// AuditEntry is a line of the AuditLog.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Action is what was done, such as "rotate".
+	Action string `json:"action"`
+	// Trigger is what caused the action, such as "schedule".
+	Trigger string `json:"trigger"`
+	// Filename is the active file of File.
+	Filename string `json:"filename"`
+	// Backup is the backup rotated to, or the one removed.
+	Backup string `json:"backup,omitempty"`
+	// Error is why the action failed, empty if it succeeded.
+	Error string `json:"error,omitempty"`
+}
+
+// audit appends e to the AuditLog if there is one. Failing to do so does not
+// fail the action, it is reported with an EventWriteError.
+func (f *File) audit(e AuditEntry) {
+	if f.AuditLog == "" {
+		return
+	}
+	e.Time, e.Filename = f.nowFunc(), f.Filename
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	f.auditMu.Lock()
+	defer f.auditMu.Unlock()
+	fh, err := os.OpenFile(f.AuditLog, fileWriteCreateAppendFlag, fileOpenMode)
+	if err == nil {
+		_, err = fh.Write(append(b, '\n'))
+		if closeErr := fh.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		f.emit(Event{Type: EventWriteError, Filename: f.AuditLog, Message: "unable to write to audit log", Err: err})
+	}
+}
+
+// errString returns the message of err, empty if err is nil.
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,98 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_AuditLog(t *testing.T) {
+	dirname, err := testutils.MkTestDir("AuditLog")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), AuditLog: "audit.jsonl", Backups: 1, NoGoroutines: true}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+
+	_, err = f.Write([]byte("line\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	// nothing to back up, not recorded
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	testutils.TrueOrFatal(t, f.ForceRotate() == nil, "File.ForceRotate() should not fail")
+	now = now.Add(24 * time.Hour)
+	_, err = f.Write([]byte("line\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	now = now.Add(24 * time.Hour)
+	_, err = f.Write([]byte("line\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+
+	fh, err := os.Open(filepath.Join(dirname, "audit.jsonl"))
+	testutils.TrueOrFatal(t, err == nil, "failed to open audit log: %v", err)
+	defer fh.Close()
+	var got []string
+	for sc := bufio.NewScanner(fh); sc.Scan(); {
+		var e AuditEntry
+		testutils.TrueOrFatal(t, json.Unmarshal(sc.Bytes(), &e) == nil, "invalid audit entry %s", sc.Bytes())
+		testutils.TrueOrError(t, e.Filename == f.Filename && e.Error == "" && !e.Time.IsZero(), "audit entry = %+v", e)
+		got = append(got, e.Action+" "+e.Trigger+" "+filepath.Base(e.Backup))
+	}
+	want := []string{
+		"rotate rotate app.2021-03-04T0000-00.log",
+		"rotate force_rotate app.2021-03-04T0000-00_1.log",
+		"trim retention app.2021-03-04T0000-00.log",
+		"rotate schedule app.2021-03-05T0000-00.log",
+		"trim retention app.2021-03-04T0000-00_1.log",
+	}
+	testutils.TrueOrError(t, reflect.DeepEqual(got, want), "audit log = %v, want %v", got, want)
+}
+
+func TestFile_AuditLog_BackgroundBackup(t *testing.T) {
+	dirname, err := testutils.MkTestDir("AuditLog_BackgroundBackup")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{
+		Filename:          filepath.Join(dirname, "app.log"),
+		AuditLog:          filepath.Join(dirname, "audit.jsonl"),
+		OnBackupCollision: CollisionSequence,
+		BackgroundBackup:  true,
+	}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+
+	for i := 0; i < 2; i++ {
+		_, err = f.Write([]byte("line\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+		f.WaitBackups()
+	}
+
+	b, err := ioutil.ReadFile(f.AuditLog)
+	testutils.TrueOrFatal(t, err == nil, "failed to read audit log: %v", err)
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var e AuditEntry
+		testutils.TrueOrFatal(t, json.Unmarshal([]byte(line), &e) == nil, "invalid audit entry %s", line)
+		got = append(got, e.Action+" "+e.Trigger+" "+filepath.Base(e.Backup))
+	}
+	// recorded with the backups they ended up in once sequenced
+	want := []string{
+		"rotate rotate app.2021-03-04T0000-00.log",
+		"rotate rotate app.2021-03-04T0000-00_1.log",
+	}
+	testutils.TrueOrError(t, reflect.DeepEqual(got, want), "audit log = %v, want %v", got, want)
+}
@@ -0,0 +1,62 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// autoSync commits writes to stable storage every SyncInterval. It is
+// allocated on its own to keep synced aligned for atomic access.
+type autoSync struct {
+	// synced is the time of the last write that was synced, as recorded by
+	// liveness, it is accessed atomically.
+	synced int64
+	// checks runs syncWrites if goroutines are used.
+	checks *periodic
+}
+
+// startAutoSync starts syncing every SyncInterval if it is set.
+func (f *File) startAutoSync() {
+	if f.SyncInterval <= 0 {
+		return
+	}
+	s := &autoSync{}
+	f.autoSync = s
+	if f.NoGoroutines {
+		return
+	}
+	interval := time.Duration(f.SyncInterval)
+	s.checks = startPeriodic(interval, func() time.Duration {
+		f.syncWrites()
+		return interval
+	})
+}
+
+// stopAutoSync stops the syncs started by startAutoSync.
+func (f *File) stopAutoSync() {
+	if f.autoSync != nil {
+		f.autoSync.checks.stop()
+	}
+}
+
+// syncWrites syncs the file if it was written to since the last time, so
+// that an idle file is not synced over and over.
+func (f *File) syncWrites() {
+	s := f.autoSync
+	if s == nil {
+		return
+	}
+	last := atomic.LoadInt64(&f.liveness.lastWrite)
+	if last == 0 || last == atomic.LoadInt64(&s.synced) {
+		return
+	}
+	if err := f.Sync(); err != nil {
+		f.emit(Event{Type: EventWriteError, Filename: f.Filename, Message: "unable to sync writes", Err: err})
+		return
+	}
+	atomic.StoreInt64(&s.synced, last)
+}
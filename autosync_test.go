@@ -0,0 +1,64 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_SyncInterval(t *testing.T) {
+	for _, noGoroutines := range []bool{false, true} {
+		dirname, err := testutils.MkTestDir(fmt.Sprintf("File_SyncInterval_%v", noGoroutines))
+		testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+		defer os.RemoveAll(dirname)
+		filename := filepath.Join(dirname, "app.log")
+		// syncing flushes the buffer, which shows in the file
+		f := &File{Filename: filename, BufferSize: 4096, SyncInterval: Duration(10 * time.Millisecond), NoGoroutines: noGoroutines}
+
+		_, err = f.Write([]byte("line\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		if noGoroutines {
+			testutils.TrueOrFatal(t, f.Maintain() == nil, "File.Maintain() should not fail")
+		}
+		var b []byte
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			if b, err = ioutil.ReadFile(filename); err == nil && len(b) > 0 {
+				break
+			}
+		}
+		testutils.TrueOrError(t, string(b) == "line\n", "noGoroutines = %v, want the write synced, got %q, err = %v", noGoroutines, b, err)
+		testutils.TrueOrError(t, f.Close() == nil, "File.Close() should not fail")
+	}
+}
+
+func TestFile_SyncInterval_afterClose(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_SyncInterval_afterClose")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	filename := filepath.Join(dirname, "app.log")
+	f := &File{Filename: filename, BufferSize: 4096, SyncInterval: Duration(10 * time.Millisecond)}
+	_, err = f.Write([]byte("line\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+
+	// the syncs stopped by Close resume with the file
+	_, err = f.Write([]byte("again\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	var b []byte
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if b, err = ioutil.ReadFile(filename); err == nil && string(b) == "line\nagain\n" {
+			break
+		}
+	}
+	testutils.TrueOrError(t, string(b) == "line\nagain\n", "want the write after Close synced, got %q, err = %v", b, err)
+	testutils.TrueOrError(t, f.Close() == nil, "File.Close() should not fail")
+}
@@ -0,0 +1,173 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stagingSep separates a staged file's backup filename from its sequence
+// number, see BackgroundBackup.
+const stagingSep = ".rotating-"
+
+// backupJobQueueSize is the number of rotated files that can wait for their
+// backup before rotation blocks.
+const backupJobQueueSize = 64
+
+// backupJob is the backup of a rotated file.
+type backupJob struct {
+	// src is the file to back up.
+	src string
+	// dst is the backup filename for period, before collisions are handled.
+	dst       string
+	period    time.Time
+	regressed bool
+	force     bool
+	mode      os.FileMode
+
+	// wasOpen, ended and at are the state of the file when it was rotated.
+	wasOpen bool
+	ended   Stats
+	at      time.Time
+	// rotation is the number of the rotation, see RotationCounter, and
+	// trigger is what caused it, as recorded in the AuditLog.
+	rotation uint64
+	trigger  string
+	// periodOver is true if the period of the file was over when it was
+	// rotated, so that its backup is complete once backed up.
+	periodOver bool
+
+	// backup is the backup src ended up in, and appended is true if it was
+	// appended to an existing one.
+	backup   string
+	appended bool
+}
+
+// stageBackup moves job.src out of the way to a staging file next to its
+// backup, which is a rename and so does not depend on the size of the file.
+func (f *File) stageBackup(job *backupJob) error {
+	for n := 1; ; n++ {
+		staged := job.dst + stagingSep + strconv.Itoa(n)
+		if _, err := os.Stat(staged); !os.IsNotExist(err) {
+			continue
+		}
+		if err := f.moveActive(job.src, staged); err != nil {
+			return fmt.Errorf("unable to stage file %s to %s with err: %v", job.src, staged, err)
+		}
+		if err := renameIndex(job.src, staged); err != nil {
+			f.emit(Event{Type: EventIndexError, Filename: IndexFilename(staged), Message: "unable to move time index", Err: err})
+		}
+		job.src = staged
+		return nil
+	}
+}
+
+// startBackups starts the goroutine that backs up staged files in the order
+// they were rotated if BackgroundBackup is set, after queueing the files a
+// previous run staged but did not get to back up.
+func (f *File) startBackups() {
+	if !f.BackgroundBackup {
+		return
+	}
+	f.backupJobs = make(chan *backupJob, backupJobQueueSize)
+	staged := f.stagedBackups()
+	f.backupWG.Add(len(staged))
+	go func() {
+		for _, job := range staged {
+			f.runBackup(job)
+		}
+		for job := range f.backupJobs {
+			f.runBackup(job)
+		}
+	}()
+}
+
+// runBackup backs up a staged file.
+func (f *File) runBackup(job *backupJob) {
+	defer f.backupWG.Done()
+	if err := f.backup(job); err != nil {
+		f.emit(Event{Type: EventBackupError, Filename: job.src, Message: "unable to back up rotated file", Err: err})
+		f.audit(AuditEntry{Action: AuditRotate, Trigger: job.trigger, Error: err.Error()})
+		return
+	}
+	f.rotated(job)
+	_ = f.triggerTrim()
+}
+
+// stagedBackups returns jobs for the staged files left in the directory, in
+// the order they were staged: by period, then by their sequence number, so
+// that files staged into the same backup are appended in the order they were
+// rotated.
+func (f *File) stagedBackups() []*backupJob {
+	entries, err := ioutil.ReadDir(f.backupDirectory)
+	if err != nil {
+		return nil
+	}
+	var jobs []*backupJob
+	var seqs []int
+	for _, e := range entries {
+		i := strings.LastIndex(e.Name(), stagingSep)
+		if i < 0 || !e.Mode().IsRegular() {
+			continue
+		}
+		n, err := strconv.Atoi(e.Name()[i+len(stagingSep):])
+		if err != nil {
+			continue
+		}
+		t, seq, ok := f.parseBackupName(e.Name()[:i])
+		if !ok || seq != 0 {
+			continue
+		}
+		jobs = append(jobs, &backupJob{
+			src:    filepath.Join(f.backupDirectory, e.Name()),
+			dst:    filepath.Join(f.backupDirectory, e.Name()[:i]),
+			period: t,
+			mode:   e.Mode(),
+			at:     e.ModTime(),
+		})
+		seqs = append(seqs, n)
+	}
+	sort.Sort(stagedJobs{jobs: jobs, seqs: seqs})
+	return jobs
+}
+
+// stagedJobs sorts staged backup jobs by period, then by sequence number.
+type stagedJobs struct {
+	jobs []*backupJob
+	seqs []int
+}
+
+func (s stagedJobs) Len() int { return len(s.jobs) }
+
+func (s stagedJobs) Less(i, j int) bool {
+	if !s.jobs[i].period.Equal(s.jobs[j].period) {
+		return s.jobs[i].period.Before(s.jobs[j].period)
+	}
+	return s.seqs[i] < s.seqs[j]
+}
+
+func (s stagedJobs) Swap(i, j int) {
+	s.jobs[i], s.jobs[j] = s.jobs[j], s.jobs[i]
+	s.seqs[i], s.seqs[j] = s.seqs[j], s.seqs[i]
+}
+
+// queueBackup queues job for the background backup.
+func (f *File) queueBackup(job *backupJob) {
+	f.backupWG.Add(1)
+	f.backupJobs <- job
+}
+
+// WaitBackups waits for the backups of rotated files queued so far to be
+// done. It returns immediately unless BackgroundBackup is set.
+func (f *File) WaitBackups() {
+	f.backupWG.Wait()
+}
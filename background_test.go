@@ -0,0 +1,107 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_BackgroundBackup(t *testing.T) {
+	dirname, err := testutils.MkTestDir("BackgroundBackup")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	var rotations []string
+	f := &File{
+		Filename:         filepath.Join(dirname, "app.log"),
+		BackgroundBackup: true,
+		OnEvent: func(e Event) {
+			if e.Type == EventRotation {
+				mu.Lock()
+				rotations = append(rotations, filepath.Base(e.Filename))
+				mu.Unlock()
+			}
+		},
+	}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+
+	_, err = f.Write([]byte("one\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	_, err = f.Write([]byte("two\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	// the second rotation in the period is appended to the first backup
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	f.WaitBackups()
+
+	backup := filepath.Join(dirname, "app.2021-03-04T0000-00.log")
+	b, err := ioutil.ReadFile(backup)
+	testutils.TrueOrFatal(t, err == nil, "failed to read backup: %v", err)
+	testutils.TrueOrError(t, string(b) == "one\ntwo\n", "backup content = %q, want %q", b, "one\ntwo\n")
+	entries, err := ioutil.ReadDir(dirname)
+	testutils.TrueOrFatal(t, err == nil, "failed to read dir: %v", err)
+	testutils.TrueOrError(t, len(entries) == 2, "entries = %v, want only app.log and its backup", entries)
+	mu.Lock()
+	defer mu.Unlock()
+	testutils.TrueOrError(t, len(rotations) == 2 && rotations[0] == filepath.Base(backup) && rotations[1] == filepath.Base(backup),
+		"rotations = %v, want 2 into %s", rotations, filepath.Base(backup))
+}
+
+func TestFile_BackgroundBackup_staged(t *testing.T) {
+	dirname, err := testutils.MkTestDir("BackgroundBackup_staged")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	// left by a run that died before backing it up
+	staged := filepath.Join(dirname, "app.2021-03-03T0000-00.log"+stagingSep+"1")
+	testutils.TrueOrFatal(t, ioutil.WriteFile(staged, []byte("staged\n"), 0600) == nil, "failed to write %s", staged)
+
+	f := &File{Filename: filepath.Join(dirname, "app.log"), BackgroundBackup: true}
+	_, err = f.Write([]byte("new\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+
+	b, err := ioutil.ReadFile(filepath.Join(dirname, "app.2021-03-03T0000-00.log"))
+	testutils.TrueOrError(t, err == nil && string(b) == "staged\n", "backup content = %q, %v, want %q", b, err, "staged\n")
+	_, err = os.Stat(staged)
+	testutils.TrueOrError(t, os.IsNotExist(err), "staged file should be gone, stat error = %v", err)
+}
+
+func TestFile_BackgroundBackup_stagedOrder(t *testing.T) {
+	dirname, err := testutils.MkTestDir("BackgroundBackup_stagedOrder")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	// left by a run that rotated into the same backups many times before
+	// dying; .rotating-10 sorts before .rotating-2 by name
+	var want [2]string
+	for p, backup := range []string{"app.2021-03-02T0000-00.log", "app.2021-03-03T0000-00.log"} {
+		for n := 12; n >= 1; n-- {
+			staged := filepath.Join(dirname, backup+stagingSep+strconv.Itoa(n))
+			line := fmt.Sprintf("%s %d\n", backup, n)
+			testutils.TrueOrFatal(t, ioutil.WriteFile(staged, []byte(line), 0600) == nil, "failed to write %s", staged)
+			want[p] = line + want[p]
+		}
+	}
+
+	f := &File{Filename: filepath.Join(dirname, "app.log"), BackgroundBackup: true}
+	_, err = f.Write([]byte("new\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+
+	for p, backup := range []string{"app.2021-03-02T0000-00.log", "app.2021-03-03T0000-00.log"} {
+		b, err := ioutil.ReadFile(filepath.Join(dirname, backup))
+		testutils.TrueOrError(t, err == nil && string(b) == want[p], "%s content = %q, %v, want %q", backup, b, err, want[p])
+	}
+}
@@ -0,0 +1,255 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FormatCheck decides what happens when BackupTimeFormat does not produce
+// lexically sortable backup filenames.
+type FormatCheck string
+
+const (
+	FormatCheckWarn    FormatCheck = "warn"
+	FormatCheckEnforce FormatCheck = "enforce"
+	FormatCheckOff     FormatCheck = "off"
+)
+
+func (c FormatCheck) lower() FormatCheck { return FormatCheck(strings.ToLower(string(c))) }
+
+// valid returns an error if its not valid
+func (c FormatCheck) valid() error {
+	switch c {
+	case FormatCheckWarn, FormatCheckEnforce, FormatCheckOff:
+		return nil
+	default:
+		return fmt.Errorf("invalid backup format check specified: %s, accepted values are %v",
+			c, []FormatCheck{FormatCheckWarn, FormatCheckEnforce, FormatCheckOff})
+	}
+}
+
+// BackupNaming decides which times of the period a backup holds are in its
+// filename.
+type BackupNaming string
+
+const (
+	BackupNamingStart  BackupNaming = "start"
+	BackupNamingPeriod BackupNaming = "period"
+)
+
+func (n BackupNaming) lower() BackupNaming { return BackupNaming(strings.ToLower(string(n))) }
+
+// valid returns an error if its not valid
+func (n BackupNaming) valid() error {
+	switch n {
+	case BackupNamingStart, BackupNamingPeriod:
+		return nil
+	default:
+		return fmt.Errorf("invalid backup naming specified: %s, accepted values are %v",
+			n, []BackupNaming{BackupNamingStart, BackupNamingPeriod})
+	}
+}
+
+// timeUnit is a component of a timestamp, ordered from the least to the
+// most precise.
+type timeUnit int
+
+const (
+	unitNone timeUnit = iota
+	unitYear
+	unitMonth
+	unitDay
+	unitHour
+	unitMinute
+	unitSecond
+	unitFraction
+	unitZone
+)
+
+var timeUnitNames = [...]string{"none", "year", "month", "day", "hour", "minute", "second", "fractional second", "time zone"}
+
+func (u timeUnit) String() string { return timeUnitNames[u] }
+
+// layoutToken is a chunk of a time layout that formats a timestamp component.
+type layoutToken struct {
+	chunk string
+	unit  timeUnit
+	// problem is why the chunk does not sort lexically, empty if it does.
+	problem string
+}
+
+// layoutTokens lists the chunks of time layouts, longer chunks sharing a
+// prefix with shorter ones come first.
+var layoutTokens = []layoutToken{
+	{chunk: "January", unit: unitMonth, problem: "month names do not sort in calendar order"},
+	{chunk: "Jan", unit: unitMonth, problem: "month names do not sort in calendar order"},
+	{chunk: "Monday", unit: unitNone, problem: "weekday names do not sort in calendar order"},
+	{chunk: "Mon", unit: unitNone, problem: "weekday names do not sort in calendar order"},
+	{chunk: "MST", unit: unitZone},
+	{chunk: "2006", unit: unitYear},
+	{chunk: "002", unit: unitDay},
+	{chunk: "01", unit: unitMonth},
+	{chunk: "02", unit: unitDay},
+	{chunk: "03", unit: unitHour, problem: "12-hour clocks do not sort in time order"},
+	{chunk: "04", unit: unitMinute},
+	{chunk: "05", unit: unitSecond},
+	{chunk: "06", unit: unitYear, problem: "two-digit years do not sort across centuries"},
+	{chunk: "15", unit: unitHour},
+	{chunk: "__2", unit: unitDay},
+	{chunk: "_2", unit: unitDay},
+	{chunk: "1", unit: unitMonth, problem: "unpadded numbers do not sort lexically"},
+	{chunk: "2", unit: unitDay, problem: "unpadded numbers do not sort lexically"},
+	{chunk: "3", unit: unitHour, problem: "12-hour clocks do not sort in time order"},
+	{chunk: "4", unit: unitMinute, problem: "unpadded numbers do not sort lexically"},
+	{chunk: "5", unit: unitSecond, problem: "unpadded numbers do not sort lexically"},
+	{chunk: "PM", unit: unitNone, problem: "12-hour clocks do not sort in time order"},
+	{chunk: "pm", unit: unitNone, problem: "12-hour clocks do not sort in time order"},
+	{chunk: "Z07:00:00", unit: unitZone},
+	{chunk: "Z070000", unit: unitZone},
+	{chunk: "Z07:00", unit: unitZone},
+	{chunk: "Z0700", unit: unitZone},
+	{chunk: "Z07", unit: unitZone},
+	{chunk: "-07:00:00", unit: unitZone},
+	{chunk: "-070000", unit: unitZone},
+	{chunk: "-07:00", unit: unitZone},
+	{chunk: "-0700", unit: unitZone},
+	{chunk: "-07", unit: unitZone},
+}
+
+// nextLayoutToken returns the token at the start of layout, and the length
+// of layout consumed. ok is false if layout starts with a literal.
+func nextLayoutToken(layout string) (tok layoutToken, n int, ok bool) {
+	if len(layout) >= 2 && (layout[0] == '.' || layout[0] == ',') && (layout[1] == '0' || layout[1] == '9') {
+		j := 1
+		for j < len(layout) && layout[j] == layout[1] {
+			j++
+		}
+		if j == len(layout) || layout[j] < '0' || layout[j] > '9' {
+			tok = layoutToken{chunk: layout[:j], unit: unitFraction}
+			if layout[1] == '9' {
+				tok.problem = "fractional seconds with trailing zeros removed vary in length"
+			}
+			return tok, j, true
+		}
+	}
+	if strings.HasPrefix(layout, "_2006") {
+		// like the time package, this is a literal _ followed by the year
+		return layoutToken{}, 1, false
+	}
+	for _, tok := range layoutTokens {
+		if strings.HasPrefix(layout, tok.chunk) {
+			return tok, len(tok.chunk), true
+		}
+	}
+	return layoutToken{}, 1, false
+}
+
+// sortableFormatProblems returns the reasons backup filenames formatted with
+// layout would not be lexically sortable and unambiguous down to precision.
+func sortableFormatProblems(layout string, precision timeUnit) []string {
+	var problems []string
+	var last, zone timeUnit
+	seen := map[timeUnit]bool{}
+	for rest := layout; rest != ""; {
+		tok, n, ok := nextLayoutToken(rest)
+		rest = rest[n:]
+		if !ok {
+			continue
+		}
+		if tok.problem != "" {
+			problems = append(problems, fmt.Sprintf("%q: %s", tok.chunk, tok.problem))
+		}
+		switch {
+		case tok.unit == unitZone:
+			zone = unitZone
+			continue
+		case tok.unit == unitNone:
+			continue
+		case zone == unitZone:
+			problems = append(problems, fmt.Sprintf("%q: time zones must come after every other component", tok.chunk))
+		case tok.unit <= last:
+			problems = append(problems, fmt.Sprintf("%q: %s must come after %s", tok.chunk, tok.unit, last))
+		}
+		if tok.chunk == "002" {
+			// day of the year covers the month too
+			seen[unitMonth] = true
+		}
+		seen[tok.unit] = true
+		last = tok.unit
+	}
+	for u := unitYear; u <= precision; u++ {
+		if !seen[u] {
+			problems = append(problems, fmt.Sprintf("missing %s, which is needed to tell rotations apart", u))
+		}
+	}
+	return problems
+}
+
+// backupPrecision returns the most precise timestamp component needed to
+// tell f's backups apart.
+func (f *File) backupPrecision() timeUnit {
+	if f.AnchorToCreation {
+		return unitSecond
+	}
+	if f.Every > 0 {
+		every := time.Duration(f.Every)
+		switch {
+		case every%oneDay == 0:
+			return unitDay
+		case every%time.Hour == 0:
+			return unitHour
+		case every%time.Minute == 0:
+			return unitMinute
+		case every%time.Second == 0:
+			return unitSecond
+		default:
+			return unitFraction
+		}
+	}
+	precision := f.When.precision()
+	for _, g := range f.extraSchedules {
+		if p := g.when.precision(); p > precision {
+			precision = p
+		}
+	}
+	return precision
+}
+
+// precision returns the timestamp component that tells the periods of r
+// apart.
+func (r WhenRotate) precision() timeUnit {
+	switch r {
+	case Hour:
+		return unitHour
+	case Day, Week:
+		return unitDay
+	case Month, Quarter:
+		return unitMonth
+	default:
+		return unitYear
+	}
+}
+
+// checkBackupTimeFormat checks if BackupTimeFormat gives lexically sortable
+// backup filenames, and warns or errors based on BackupFormatCheck.
+func (f *File) checkBackupTimeFormat() error {
+	if f.BackupFormatCheck == FormatCheckOff {
+		return nil
+	}
+	problems := sortableFormatProblems(f.BackupTimeFormat, f.backupPrecision())
+	if len(problems) == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("backup time format \"%s\" does not give lexically sortable backup filenames: %s",
+		f.BackupTimeFormat, strings.Join(problems, "; "))
+	if f.BackupFormatCheck == FormatCheckEnforce {
+		return fmt.Errorf("%s", msg)
+	}
+	f.emit(Event{Type: EventConfigWarning, Filename: f.Filename, Message: msg})
+	return nil
+}
@@ -0,0 +1,61 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_sortableFormatProblems(t *testing.T) {
+	tests := []struct {
+		name         string
+		layout       string
+		precision    timeUnit
+		wantProblems int
+	}{
+		{name: "default_format", layout: defaultBackupTimeFormat, precision: unitSecond},
+		{name: "date_only_daily", layout: ".2006-01-02", precision: unitDay},
+		{name: "date_only_hourly", layout: ".2006-01-02", precision: unitHour, wantProblems: 1},
+		{name: "day_of_year", layout: ".2006.002", precision: unitDay},
+		{name: "fractional_seconds", layout: ".20060102T150405.000", precision: unitFraction},
+		{name: "trimmed_fractional_seconds", layout: ".20060102T150405.999", precision: unitSecond, wantProblems: 1},
+		{name: "trailing_zone", layout: ".2006-01-02T15Z0700", precision: unitHour},
+		{name: "leading_zone", layout: ".-0700_2006-01-02", precision: unitDay, wantProblems: 3},
+		{name: "month_names", layout: "Jan _2 15:04:05", precision: unitSecond, wantProblems: 2},
+		{name: "day_first", layout: ".02-01-2006", precision: unitDay, wantProblems: 2},
+		{name: "twelve_hour_clock", layout: ".2006-01-02T03PM", precision: unitHour, wantProblems: 2},
+		{name: "two_digit_year", layout: ".060102", precision: unitDay, wantProblems: 1},
+		{name: "unpadded", layout: ".2006-1-2", precision: unitDay, wantProblems: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sortableFormatProblems(tt.layout, tt.precision); len(got) != tt.wantProblems {
+				t.Errorf("sortableFormatProblems() = %q, want %d problems", got, tt.wantProblems)
+			}
+		})
+	}
+}
+
+func TestFile_checkBackupTimeFormat(t *testing.T) {
+	var events []Event
+	f := &File{When: "h", BackupTimeFormat: ".2006-01-02", OnEvent: func(e Event) { events = append(events, e) }}
+	if err := f.init(); err != nil {
+		t.Fatalf("File.init() error = %v", err)
+	}
+	if len(events) != 1 || events[0].Type != EventConfigWarning {
+		t.Errorf("File.init() events = %v, want 1 %s event", events, EventConfigWarning)
+	}
+
+	f = &File{When: "h", BackupTimeFormat: ".2006-01-02", BackupFormatCheck: "Enforce"}
+	if err := f.init(); err == nil {
+		t.Errorf("File.init() should fail enforcing the backup format check")
+	}
+
+	f = &File{Every: Duration(90 * time.Second), BackupTimeFormat: ".2006-01-02T1504", BackupFormatCheck: "enforce"}
+	if err := f.init(); err == nil {
+		t.Errorf("File.init() should fail enforcing the backup format check for sub-minute intervals")
+	}
+}
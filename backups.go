@@ -0,0 +1,193 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Backup describes a backup file of File.
+type Backup struct {
+	// Name is the path of the backup, or its name in the Archiver if it is
+	// Remote.
+	Name string
+	// Time is the time encoded in the backup filename, which is the start of
+	// the period it holds. It is the modification time of the backup if the
+	// name could not be parsed, see File.ModTimeFallback.
+	Time time.Time
+	// Seq is the sequence number of the backup if it has one, 0 otherwise.
+	Seq int
+	// Size is the size of the backup on disk, zero if it is Remote.
+	Size int64
+	// ModTime is the modification time of the backup, zero if it is Remote.
+	ModTime time.Time
+	// Encoded holds the extensions the backup has for the formats it was
+	// compressed or encrypted to, such as ".gz", see RegisterDecoder.
+	Encoded string
+	// Remote is set for backups stored by File.Archiver rather than on the
+	// local disk.
+	Remote bool
+}
+
+// ListBackups returns the backups of f, from the oldest to the newest.
+func (f *File) ListBackups() ([]Backup, error) {
+	if err := f.init(); err != nil {
+		return nil, err
+	}
+	return f.backups()
+}
+
+// backups returns the backups of f, from the oldest to the newest, along
+// with those stored by its Archiver if it has one.
+func (f *File) backups() ([]Backup, error) {
+	backups, err := f.localBackups()
+	if err != nil || f.Archiver == nil {
+		return backups, err
+	}
+	remote, err := f.remoteBackups()
+	if err != nil {
+		return nil, err
+	}
+	backups = append(backups, remote...)
+	sortBackups(backups)
+	return backups, nil
+}
+
+// localBackups returns the backups in f.backupDirectory, from the oldest to
+// the newest.
+func (f *File) localBackups() ([]Backup, error) {
+	dirEntries, err := ioutil.ReadDir(f.backupDirectory)
+	if os.IsNotExist(err) && f.backupDirectory != f.directory {
+		// nothing was rotated into BackupDir yet
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read log file directory %s: %v", f.backupDirectory, err)
+	}
+	var backups []Backup
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() {
+			continue
+		}
+		filename, encoded := trimEncodedExts(dirEntry.Name())
+		t, seq, ok := f.parseBackupName(filename)
+		if !ok && f.ModTimeFallback && f.namedLikeBackup(filename) {
+			t, ok = dirEntry.ModTime(), true
+		}
+		if !ok {
+			continue
+		}
+		backups = append(backups, Backup{
+			Name:    filepath.Join(f.backupDirectory, dirEntry.Name()),
+			Time:    t,
+			Seq:     seq,
+			Size:    dirEntry.Size(),
+			ModTime: dirEntry.ModTime(),
+			Encoded: encoded,
+		})
+	}
+	sortBackups(backups)
+	return backups, nil
+}
+
+// sortBackups sorts backups from the oldest to the newest.
+func sortBackups(backups []Backup) {
+	sort.SliceStable(backups, func(i, j int) bool {
+		if backups[i].Time.Equal(backups[j].Time) {
+			return backups[i].Seq < backups[j].Seq
+		}
+		return backups[i].Time.Before(backups[j].Time)
+	})
+}
+
+// BackupsBetween returns the backups whose periods intersect the range from
+// from to to, from the oldest to the newest. Either bound may be zero for
+// no bound. A backup's period runs from its Time to the Time of the next
+// backup, and the last one to the active file's period start. Backups of
+// the same Time, such as those sequenced by ForceRotate or MaxSize, share
+// their period and are returned together.
+func (f *File) BackupsBetween(from, to time.Time) ([]Backup, error) {
+	backups, err := f.ListBackups()
+	if err != nil {
+		return nil, err
+	}
+	start := 0
+	if !from.IsZero() {
+		for i, b := range backups {
+			if b.Time.After(from) {
+				break
+			}
+			if i == 0 || !b.Time.Equal(backups[i-1].Time) {
+				start = i
+			}
+		}
+		last := len(backups) > 0 && backups[start].Time.Equal(backups[len(backups)-1].Time)
+		if periodStart := f.Stats().PeriodStart; last && backups[start].Time.Before(periodStart) && !from.Before(periodStart) {
+			// the period of the last backups ended before from, which is
+			// within the active file
+			start = len(backups)
+		}
+	}
+	end := len(backups)
+	for i := start; !to.IsZero() && i < len(backups); i++ {
+		if backups[i].Time.After(to) {
+			end = i
+			break
+		}
+	}
+	if start == end {
+		return nil, nil
+	}
+	return backups[start:end], nil
+}
+
+// parseBackupName returns the time and sequence number encoded in the backup
+// filename, trying BackupNameParsers if it is not named by f. It reports
+// false if filename is not a backup.
+func (f *File) parseBackupName(filename string) (t time.Time, seq int, ok bool) {
+	if strings.HasPrefix(filename, f.fileBase) && strings.HasSuffix(filename, f.ext) {
+		// get time from filename
+		timestamp := strings.TrimSuffix(strings.TrimPrefix(filename, f.fileBase), f.ext)
+		if t, seq, err := f.parseBackupTimestamp(timestamp); err == nil {
+			return t, seq, true
+		}
+	}
+	if filename == filepath.Base(f.Filename) ||
+		strings.HasSuffix(filename, metadataSuffix) || strings.HasSuffix(filename, indexSuffix) {
+		return t, 0, false
+	}
+	for _, parse := range f.BackupNameParsers {
+		if t, ok := parse(filename); ok {
+			return t, 0, true
+		}
+	}
+	return t, 0, false
+}
+
+// namedLikeBackup reports if filename has the name and extension of the
+// active file while not being one of the files kept next to it.
+func (f *File) namedLikeBackup(filename string) bool {
+	if strings.HasSuffix(filename, metadataSuffix) || strings.HasSuffix(filename, indexSuffix) ||
+		filename == filepath.Base(CurrentLinkFilename(f.Filename)) {
+		return false
+	}
+	return len(filename) > len(f.fileBase)+len(f.ext) &&
+		strings.HasPrefix(filename, f.fileBase) && strings.HasSuffix(filename, f.ext)
+}
+
+// rotatedAt returns when b was rotated out, from its metadata sidecar if it
+// has one, and its modification time otherwise.
+func (b Backup) rotatedAt() time.Time {
+	if md, err := ReadBackupMetadata(b.Name); err == nil && !md.RotatedAt.IsZero() {
+		return md.RotatedAt
+	}
+	return b.ModTime
+}
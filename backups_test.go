@@ -0,0 +1,293 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_BackupNameParsers(t *testing.T) {
+	dirname, err := testutils.MkTestDir("BackupNameParsers")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	for _, name := range []string{"app-20210301.log", "app-20210302.log.gz", "app.2021-03-03T0000-00.log", "app.log", "unrelated.txt"} {
+		testutils.TrueOrFatal(t, ioutil.WriteFile(filepath.Join(dirname, name), []byte("x\n"), 0600) == nil, "failed to write %s", name)
+	}
+	f := &File{
+		Filename: filepath.Join(dirname, "app.log"),
+		BackupNameParsers: []func(string) (time.Time, bool){
+			func(name string) (time.Time, bool) {
+				if !strings.HasPrefix(name, "app-") || !strings.HasSuffix(name, ".log") {
+					return time.Time{}, false
+				}
+				t, err := time.Parse("20060102", strings.TrimSuffix(strings.TrimPrefix(name, "app-"), ".log"))
+				return t, err == nil
+			},
+		},
+	}
+	backups, err := f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil, "File.ListBackups() error = %v", err)
+	var got []string
+	for _, b := range backups {
+		got = append(got, filepath.Base(b.Name))
+	}
+	want := []string{"app-20210301.log", "app-20210302.log.gz", "app.2021-03-03T0000-00.log"}
+	testutils.TrueOrError(t, reflect.DeepEqual(got, want), "File.ListBackups() = %v, want %v", got, want)
+
+	f.Backups = 1
+	testutils.TrueOrFatal(t, f.trim() == nil, "File.trim() should not fail")
+	_, err = os.Stat(filepath.Join(dirname, "app-20210301.log"))
+	testutils.TrueOrError(t, os.IsNotExist(err), "adopted backup should have been trimmed, err = %v", err)
+}
+
+func TestFile_ListBackups_localTime(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("SGT", 8*60*60)
+	defer func() { time.Local = local }()
+	dirname, err := testutils.MkTestDir("ListBackups_localTime")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+
+	now := time.Date(2021, time.March, 4, 10, 15, 0, 0, time.Local)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), When: "h", UseLocal: true}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+	_, err = f.Write([]byte("line\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+
+	backups, err := f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil, "File.ListBackups() error = %v", err)
+	want := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.Local)
+	testutils.TrueOrFatal(t, len(backups) == 1, "File.ListBackups() = %v, want 1 backup", backups)
+	testutils.TrueOrError(t, backups[0].Time.Equal(want), "Backup.Time = %s, want %s", backups[0].Time, want)
+}
+
+func TestFile_MaxBackupsPerPeriod(t *testing.T) {
+	dirname, err := testutils.MkTestDir("MaxBackupsPerPeriod")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), OnBackupCollision: CollisionSequence, MaxBackupsPerPeriod: 2}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+	for _, line := range []string{"one", "two", "three", "four"} {
+		_, err := f.Write([]byte(line + "\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	}
+	backups, err := f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil, "File.ListBackups() error = %v", err)
+	testutils.TrueOrFatal(t, len(backups) == 2, "File.ListBackups() = %v, want 2 backups", backups)
+	b, err := ioutil.ReadFile(backups[1].Name)
+	testutils.TrueOrFatal(t, err == nil, "failed to read backup: %v", err)
+	testutils.TrueOrError(t, string(b) == "two\nthree\nfour\n", "latest backup content = %q, want %q", b, "two\nthree\nfour\n")
+}
+
+func TestFile_RetentionGrace(t *testing.T) {
+	dirname, err := testutils.MkTestDir("RetentionGrace")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	rotatedAgo := map[string]time.Duration{
+		"app.2021-03-01T0000-00.log": 72 * time.Hour,
+		"app.2021-03-02T0000-00.log": time.Hour,
+		"app.2021-03-03T0000-00.log": 2 * time.Hour,
+	}
+	for name, ago := range rotatedAgo {
+		name = filepath.Join(dirname, name)
+		testutils.TrueOrFatal(t, ioutil.WriteFile(name, []byte("x\n"), 0600) == nil, "failed to write %s", name)
+		testutils.TrueOrFatal(t, os.Chtimes(name, now.Add(-ago), now.Add(-ago)) == nil, "failed to set times of %s", name)
+	}
+	f := &File{Filename: filepath.Join(dirname, "app.log"), Backups: 1, RetentionGrace: Duration(6 * time.Hour)}
+	f.setNowFunc(func() time.Time { return now })
+	testutils.TrueOrFatal(t, f.init() == nil, "File.init() should not fail")
+	testutils.TrueOrFatal(t, f.trim() == nil, "File.trim() should not fail")
+	backups, err := f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil, "File.ListBackups() error = %v", err)
+	var got []string
+	for _, b := range backups {
+		got = append(got, filepath.Base(b.Name))
+	}
+	want := []string{"app.2021-03-02T0000-00.log", "app.2021-03-03T0000-00.log"}
+	testutils.TrueOrError(t, reflect.DeepEqual(got, want), "backups after trim = %v, want %v", got, want)
+}
+
+func TestFile_trimEncoded(t *testing.T) {
+	dirname, err := testutils.MkTestDir("trimEncoded")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	for _, name := range []string{
+		"app.2021-03-01T0000-00.log.zst",
+		"app.2021-03-02T0000-00.log.gz",
+		"app.2021-03-03T0000-00.log.gz.enc",
+		"app.2021-03-04T0000-00.log",
+	} {
+		name = filepath.Join(dirname, name)
+		testutils.TrueOrFatal(t, ioutil.WriteFile(name, []byte("x\n"), 0600) == nil, "failed to write %s", name)
+	}
+	f := &File{Filename: filepath.Join(dirname, "app.log"), Backups: 2}
+	testutils.TrueOrFatal(t, f.Maintain() == nil, "File.Maintain() should not fail")
+	backups, err := f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil, "File.ListBackups() error = %v", err)
+	var got []string
+	for _, b := range backups {
+		got = append(got, filepath.Base(b.Name)+" "+b.Encoded)
+	}
+	want := []string{"app.2021-03-03T0000-00.log.gz.enc .gz.enc", "app.2021-03-04T0000-00.log "}
+	testutils.TrueOrError(t, reflect.DeepEqual(got, want), "backups after trim = %v, want %v", got, want)
+}
+
+func TestFile_ModTimeFallback(t *testing.T) {
+	dirname, err := testutils.MkTestDir("ModTimeFallback")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	modifiedAgo := map[string]time.Duration{
+		"app.old.log":                72 * time.Hour,
+		"app.renamed-by-hand.log.gz": 30 * time.Hour,
+		"app.2021-03-04T0000-00.log": time.Hour,
+		"app.current.log":            100 * time.Hour,
+		"other.log":                  100 * time.Hour,
+	}
+	for name, ago := range modifiedAgo {
+		name = filepath.Join(dirname, name)
+		testutils.TrueOrFatal(t, ioutil.WriteFile(name, []byte("x\n"), 0600) == nil, "failed to write %s", name)
+		testutils.TrueOrFatal(t, os.Chtimes(name, now.Add(-ago), now.Add(-ago)) == nil, "failed to set times of %s", name)
+	}
+	f := &File{Filename: filepath.Join(dirname, "app.log"), MaxAge: Duration(48 * time.Hour), ModTimeFallback: true, CurrentLink: true}
+	f.setNowFunc(func() time.Time { return now })
+	testutils.TrueOrFatal(t, f.Maintain() == nil, "File.Maintain() should not fail")
+	infos, err := ioutil.ReadDir(dirname)
+	testutils.TrueOrFatal(t, err == nil, "failed to read dir: %v", err)
+	var got []string
+	for _, info := range infos {
+		got = append(got, info.Name())
+	}
+	want := []string{"app.2021-03-04T0000-00.log", "app.current.log", "app.renamed-by-hand.log.gz", "other.log"}
+	testutils.TrueOrError(t, reflect.DeepEqual(got, want), "files after trim = %v, want %v", got, want)
+}
+
+func TestFile_BackupsBetween(t *testing.T) {
+	dirname, err := testutils.MkTestDir("BackupsBetween")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	for _, name := range []string{
+		"app.2021-03-01T0000-00.log",
+		"app.2021-03-02T0000-00.log",
+		"app.2021-03-04T0000-00.log",
+		"app.2021-03-04T0000-00_1.log",
+	} {
+		name = filepath.Join(dirname, name)
+		testutils.TrueOrFatal(t, ioutil.WriteFile(name, []byte("x\n"), 0600) == nil, "failed to write %s", name)
+	}
+	f := &File{Filename: filepath.Join(dirname, "app.log")}
+	day := func(d, h int) time.Time { return time.Date(2021, time.March, d, h, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		from, to time.Time
+		want     []string
+	}{
+		{time.Time{}, time.Time{}, []string{"app.2021-03-01T0000-00.log", "app.2021-03-02T0000-00.log", "app.2021-03-04T0000-00.log", "app.2021-03-04T0000-00_1.log"}},
+		// the backup of the 2nd holds the 3rd as well
+		{day(3, 5), day(3, 6), []string{"app.2021-03-02T0000-00.log"}},
+		{day(1, 12), day(2, 12), []string{"app.2021-03-01T0000-00.log", "app.2021-03-02T0000-00.log"}},
+		{day(3, 0), time.Time{}, []string{"app.2021-03-02T0000-00.log", "app.2021-03-04T0000-00.log", "app.2021-03-04T0000-00_1.log"}},
+		// sequenced backups share the period
+		{day(4, 5), time.Time{}, []string{"app.2021-03-04T0000-00.log", "app.2021-03-04T0000-00_1.log"}},
+		{time.Time{}, day(1, 23), []string{"app.2021-03-01T0000-00.log"}},
+		{time.Time{}, day(1, 0).Add(-time.Hour), nil},
+	}
+	for _, tt := range tests {
+		backups, err := f.BackupsBetween(tt.from, tt.to)
+		testutils.TrueOrFatal(t, err == nil, "File.BackupsBetween() error = %v", err)
+		var got []string
+		for _, b := range backups {
+			got = append(got, filepath.Base(b.Name))
+		}
+		testutils.TrueOrError(t, reflect.DeepEqual(got, tt.want), "File.BackupsBetween(%v, %v) = %v, want %v", tt.from, tt.to, got, tt.want)
+	}
+}
+
+func TestFile_BackupsBetween_activePeriod(t *testing.T) {
+	dirname, err := testutils.MkTestDir("BackupsBetween_activePeriod")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), When: "h"}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+
+	var want string
+	for i := 0; i < 3; i++ {
+		line := fmt.Sprintf("line %d\n", i)
+		_, err = f.Write([]byte(line))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		want += line
+		if i < 2 {
+			now = now.Add(10 * time.Minute)
+			testutils.TrueOrFatal(t, f.ForceRotate() == nil, "File.ForceRotate() should not fail")
+		}
+	}
+	backups, err := f.BackupsBetween(now, time.Time{})
+	testutils.TrueOrFatal(t, err == nil, "File.BackupsBetween() error = %v", err)
+	testutils.TrueOrError(t, len(backups) == 2, "File.BackupsBetween() = %v, want the 2 backups of the active period", backups)
+
+	rc, err := f.NewReader(now.Add(-time.Minute))
+	testutils.TrueOrFatal(t, err == nil, "File.NewReader() error = %v", err)
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	testutils.TrueOrError(t, err == nil && string(b) == want, "read %q, err = %v, want %q", b, err, want)
+}
+
+func TestFile_BackupDir(t *testing.T) {
+	dirname, err := testutils.MkTestDir("BackupDir")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), BackupDir: "old", Backups: 1, NoGoroutines: true}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+	backups, err := f.ListBackups()
+	testutils.TrueOrError(t, err == nil && len(backups) == 0, "File.ListBackups() before the first rotation = %v, %v, want none", backups, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := f.Write([]byte("line\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		now = now.Add(24 * time.Hour)
+	}
+	backups, err = f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil && len(backups) == 1, "File.ListBackups() = %v, %v, want 1 backup", backups, err)
+	want := filepath.Join(dirname, "old", "app.2021-03-05T0000-00.log")
+	testutils.TrueOrError(t, backups[0].Name == want, "backup = %s, want %s", backups[0].Name, want)
+}
+
+func TestFile_BackupNamingPeriod(t *testing.T) {
+	dirname, err := testutils.MkTestDir("BackupNamingPeriod")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2024, time.June, 11, 4, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), When: "d", RotationSchedule: []string{"0000:00", "0600:00"}, BackupTimeFormat: ".20060102T1504", BackupNaming: "Period"}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+	for _, line := range []string{"one", "two"} {
+		_, err := f.Write([]byte(line + "\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		now = now.Add(4 * time.Hour)
+	}
+	backups, err := f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil && len(backups) == 1, "File.ListBackups() = %v, error = %v, want 1 backup", backups, err)
+	want := filepath.Join(dirname, "app.20240611T0000-20240611T0600.log")
+	testutils.TrueOrError(t, backups[0].Name == want, "backup = %s, want %s", backups[0].Name, want)
+	testutils.TrueOrError(t, backups[0].Time.Equal(time.Date(2024, time.June, 11, 0, 0, 0, 0, time.UTC)), "backup time = %v, want the start of its period", backups[0].Time)
+}
@@ -0,0 +1,65 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"bytes"
+	"context"
+)
+
+// WriteBatch writes each of ps, in order, as a single write. Rotation is only
+// checked once for the whole batch, so it always ends up in the same file.
+// Where the platform supports it, ps are written with a single writev call
+// instead of being copied into one buffer first. It returns the number of
+// bytes written from all of ps.
+func (f *File) WriteBatch(ps [][]byte) (int, error) {
+	return f.WriteBatchContext(context.Background(), ps)
+}
+
+// WriteBatchContext is like WriteBatch, but gives up and returns ctx.Err() if
+// ctx is done while waiting, like WriteContext.
+func (f *File) WriteBatchContext(ctx context.Context, ps [][]byte) (int, error) {
+	return f.writeAll(ctx, ps)
+}
+
+// writeBatch writes ps to the current file and counts them.
+func (f *File) writeBatch(ps [][]byte) (n int, err error) {
+	f.checkpoint()
+	if f.buf != nil {
+		// buffered writes are coalesced by the buffer already
+		for _, p := range ps {
+			var m int
+			m, err = f.bufWrite(p)
+			n += m
+			if err != nil {
+				break
+			}
+		}
+	} else {
+		n, err = f.writev(ps)
+	}
+	if err == nil && n > 0 {
+		f.liveness.wrote(f.nowFunc())
+	}
+	f.fileOffset += int64(n)
+	f.fileBytes += int64(n)
+	left := n
+	for _, p := range ps {
+		if left <= 0 {
+			break
+		}
+		if len(p) > left {
+			p = p[:left]
+		}
+		f.fileLines += int64(bytes.Count(p, []byte{'\n'}))
+		f.hashContent(p)
+		f.tee(p)
+		left -= len(p)
+	}
+	if err == nil {
+		err = f.syncWrite()
+	}
+	return n, err
+}
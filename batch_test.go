@@ -0,0 +1,85 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_WriteBatch(t *testing.T) {
+	dirname, err := testutils.MkTestDir("WriteBatch")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+
+	// more lines than a single writev call takes
+	var ps [][]byte
+	var want strings.Builder
+	for i := 0; i < 2500; i++ {
+		line := fmt.Sprintf("line %d\n", i)
+		ps = append(ps, []byte(line), nil)
+		want.WriteString(line)
+	}
+	tests := []struct {
+		name       string
+		bufferSize int
+		shards     int
+	}{
+		{"unbuffered", 0, 0},
+		{"buffered", 4096, 0},
+		{"sharded", 0, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &File{Filename: filepath.Join(dirname, tt.name+".log"), BufferSize: tt.bufferSize, Shards: tt.shards}
+			n, err := f.WriteBatch(ps)
+			testutils.TrueOrFatal(t, err == nil, "File.WriteBatch() error = %v", err)
+			testutils.TrueOrError(t, n == want.Len(), "File.WriteBatch() = %d, want %d", n, want.Len())
+			testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+			b, err := ioutil.ReadFile(f.Filename)
+			testutils.TrueOrFatal(t, err == nil, "failed to read file: %v", err)
+			testutils.TrueOrError(t, string(b) == want.String(), "file content differs from the batch, got %d bytes", len(b))
+			if tt.shards == 0 {
+				testutils.TrueOrError(t, f.fileLines == 2500, "fileLines = %d, want 2500", f.fileLines)
+			}
+		})
+	}
+}
+
+func BenchmarkFile_WriteBatch(b *testing.B) {
+	dirname, err := testutils.MkTestDir("BenchmarkWriteBatch")
+	testutils.TrueOrFatal(b, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	line := []byte("2021-03-04T10:00:00Z INFO a typical log line of moderate length\n")
+	ps := make([][]byte, 64)
+	for i := range ps {
+		ps[i] = line
+	}
+
+	b.Run("Write", func(b *testing.B) {
+		f := &File{Filename: filepath.Join(dirname, "write.log")}
+		defer f.Close()
+		b.SetBytes(int64(len(line) * len(ps)))
+		for i := 0; i < b.N; i++ {
+			for _, p := range ps {
+				_, _ = f.Write(p)
+			}
+		}
+	})
+	b.Run("WriteBatch", func(b *testing.B) {
+		f := &File{Filename: filepath.Join(dirname, "batch.log")}
+		defer f.Close()
+		b.SetBytes(int64(len(line) * len(ps)))
+		for i := 0; i < b.N; i++ {
+			_, _ = f.WriteBatch(ps)
+		}
+	})
+}
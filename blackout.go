@@ -0,0 +1,62 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// blackoutWindow is a daily window of time where rotations are deferred.
+// The window may wrap around midnight, in which case start is after end.
+type blackoutWindow struct {
+	start timeSchedule
+	end   timeSchedule
+}
+
+// parseBlackoutWindow parses a window of format "1504:05-1504:05", that is
+// HHMM:SS-HHMM:SS.
+func parseBlackoutWindow(window string) (blackoutWindow, error) {
+	parts := strings.Split(window, "-")
+	if len(parts) != 2 {
+		return blackoutWindow{}, fmt.Errorf(`invalid blackout window, expected value of format "1504:05-1504:05" (HHMM:SS-HHMM:SS), got '%s'`, window)
+	}
+	start, err := Day.parseTimeSchedule(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return blackoutWindow{}, fmt.Errorf("invalid blackout window start: %v", err)
+	}
+	end, err := Day.parseTimeSchedule(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return blackoutWindow{}, fmt.Errorf("invalid blackout window end: %v", err)
+	}
+	if start == end {
+		return blackoutWindow{}, fmt.Errorf("blackout window '%s' is empty", window)
+	}
+	return blackoutWindow{start: start, end: end}, nil
+}
+
+// contains reports if t falls within the window. The start of the window is
+// inclusive while the end is exclusive.
+func (w blackoutWindow) contains(t time.Time) bool {
+	timeOfDay := t.Sub(Day.periodStart(t))
+	start, end := w.start.approxDuration(), w.end.approxDuration()
+	if start < end {
+		return timeOfDay >= start && timeOfDay < end
+	}
+	// window wraps around midnight
+	return timeOfDay >= start || timeOfDay < end
+}
+
+// inBlackout reports if t falls within any of f's blackout windows.
+func (f *File) inBlackout(t time.Time) bool {
+	t = f.time(t)
+	for _, w := range f.blackoutWindows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_parseBlackoutWindow(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  string
+		want    blackoutWindow
+		wantErr bool
+	}{
+		{
+			name:   "same_day",
+			window: "0100:00-0300:00",
+			want:   blackoutWindow{start: timeSchedule{hour: 1}, end: timeSchedule{hour: 3}},
+		},
+		{
+			name:   "wrap_midnight_with_spaces",
+			window: "2330:15 - 0015:00",
+			want:   blackoutWindow{start: timeSchedule{hour: 23, minute: 30, second: 15}, end: timeSchedule{minute: 15}},
+		},
+		{name: "missing_end", window: "0100:00", wantErr: true},
+		{name: "invalid_start", window: "2500:00-0300:00", wantErr: true},
+		{name: "invalid_end", window: "0100:00-03:00", wantErr: true},
+		{name: "empty_window", window: "0100:00-0100:00", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBlackoutWindow(tt.window)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseBlackoutWindow() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseBlackoutWindow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_blackoutWindow_contains(t *testing.T) {
+	sameDay := blackoutWindow{start: timeSchedule{hour: 1}, end: timeSchedule{hour: 3}}
+	wrapped := blackoutWindow{start: timeSchedule{hour: 23}, end: timeSchedule{hour: 1}}
+	tests := []struct {
+		name string
+		w    blackoutWindow
+		t    time.Time
+		want bool
+	}{
+		{name: "same_day_before", w: sameDay, t: time.Date(2020, 8, 10, 0, 59, 59, 0, time.UTC)},
+		{name: "same_day_start", w: sameDay, t: time.Date(2020, 8, 10, 1, 0, 0, 0, time.UTC), want: true},
+		{name: "same_day_within", w: sameDay, t: time.Date(2020, 8, 10, 2, 30, 0, 0, time.UTC), want: true},
+		{name: "same_day_end", w: sameDay, t: time.Date(2020, 8, 10, 3, 0, 0, 0, time.UTC)},
+		{name: "wrapped_before_midnight", w: wrapped, t: time.Date(2020, 8, 10, 23, 30, 0, 0, time.UTC), want: true},
+		{name: "wrapped_after_midnight", w: wrapped, t: time.Date(2020, 8, 10, 0, 30, 0, 0, time.UTC), want: true},
+		{name: "wrapped_outside", w: wrapped, t: time.Date(2020, 8, 10, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.w.contains(tt.t); got != tt.want {
+				t.Errorf("blackoutWindow.contains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxMissedRotations bounds the scheduled rotations counted as missed at
+// once, so that a very long sleep on a short schedule is not walked through
+// one rotation at a time.
+const maxMissedRotations = 10000
+
+// checkCadence counts and reports the rotation that was just made by trigger
+// if it deviates from the schedule, when RotationAnomalies is set. It must be
+// called with f.mu held, before the next rotation time is worked out.
+func (f *File) checkCadence(trigger string) {
+	if !f.RotationAnomalies {
+		return
+	}
+	switch trigger {
+	case TriggerSchedule:
+		missed, last := f.countMissedRotations(f.now())
+		if missed == 0 {
+			return
+		}
+		f.missedRotations += uint64(missed)
+		suffix := ""
+		if missed == maxMissedRotations {
+			suffix = " or more"
+		}
+		f.emit(Event{
+			Type:     EventRotationAnomaly,
+			Filename: f.Filename,
+			Message: fmt.Sprintf("missed %d%s scheduled rotations of %s after the one due at %s, up to %s; was the process asleep or the file not written to?",
+				missed, suffix, f.Filename, f.rotateAt.Format(time.RFC3339), last.Format(time.RFC3339)),
+		})
+	case TriggerRotate, TriggerForceRotate, TriggerFileTouched, TriggerAdmin:
+		if f.lastBackupJob == nil {
+			// nothing was rotated
+			return
+		}
+		f.extraRotations++
+		f.emit(Event{
+			Type:     EventRotationAnomaly,
+			Filename: f.Filename,
+			Message:  fmt.Sprintf("extra rotation of %s to %s off its schedule, triggered by %s", f.Filename, f.lastBackup, trigger),
+		})
+	}
+}
+
+// countMissedRotations returns how many scheduled rotations after the one due
+// at f.rotateAt were due by now, and the last of them.
+func (f *File) countMissedRotations(now time.Time) (missed int, last time.Time) {
+	t := f.rotateAt
+	for missed < maxMissedRotations {
+		_, next := f.calcRotationTimes(t)
+		if !next.After(t) || next.After(f.time(now)) {
+			break
+		}
+		missed++
+		t, last = next, next
+	}
+	return missed, last
+}
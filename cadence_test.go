@@ -0,0 +1,55 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_RotationAnomalies(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_RotationAnomalies")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+
+	var anomalies []Event
+	f := &File{
+		Filename:          filepath.Join(dirname, "app.log"),
+		When:              "h",
+		RotationAnomalies: true,
+		NoGoroutines:      true,
+		OnEvent: func(e Event) {
+			if e.Type == EventRotationAnomaly {
+				anomalies = append(anomalies, e)
+			}
+		},
+	}
+	defer f.Close()
+	now := time.Date(2021, 3, 4, 10, 15, 0, 0, time.UTC)
+	f.setNowFunc(func() time.Time { return now })
+	write := func() {
+		_, err := f.Write([]byte("line\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	}
+
+	write()
+	now = now.Add(time.Hour)
+	write()
+	testutils.TrueOrFatal(t, len(anomalies) == 0, "want no anomaly for a rotation on time, got %v", anomalies)
+
+	// the rotation due at 12:00 comes at 14:15, missing 13:00 and 14:00
+	now = now.Add(3 * time.Hour)
+	write()
+	testutils.TrueOrFatal(t, len(anomalies) == 1, "want an anomaly for the missed rotations, got %v", anomalies)
+	testutils.TrueOrError(t, f.Stats().MissedRotations == 2, "want 2 missed rotations, got %d", f.Stats().MissedRotations)
+
+	testutils.TrueOrFatal(t, f.ForceRotate() == nil, "File.ForceRotate() should not fail")
+	testutils.TrueOrFatal(t, len(anomalies) == 2, "want an anomaly for the forced rotation, got %v", anomalies)
+	testutils.TrueOrError(t, f.Stats().ExtraRotations == 1, "want 1 extra rotation, got %d", f.Stats().ExtraRotations)
+}
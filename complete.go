@@ -0,0 +1,75 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// periodsOver records that the periods starting at starts are over, so that
+// their backups are reported with EventPeriodComplete by the next trim once
+// they are final, if NotifyPeriodComplete is set.
+func (f *File) periodsOver(starts ...time.Time) {
+	if !f.NotifyPeriodComplete {
+		return
+	}
+	f.trimMu.Lock()
+	defer f.trimMu.Unlock()
+	f.overPeriods = append(f.overPeriods, starts...)
+}
+
+// reportComplete emits an EventPeriodComplete for the backups of the periods
+// that are over once all of them are final, oldest period first. Periods
+// left without backups, which were trimmed already, are dropped. It must be
+// called with trimMu held.
+func (f *File) reportComplete() error {
+	if len(f.overPeriods) == 0 {
+		return nil
+	}
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+	sort.Slice(f.overPeriods, func(i, j int) bool {
+		return f.overPeriods[i].Before(f.overPeriods[j])
+	})
+	pending := f.overPeriods[:0]
+	for _, start := range f.overPeriods {
+		var complete []Backup
+		final := true
+		for _, b := range backups {
+			if b.Time.Equal(start) {
+				complete = append(complete, b)
+				final = final && f.finalBackup(b)
+			}
+		}
+		if !final {
+			pending = append(pending, start)
+			continue
+		}
+		for _, b := range complete {
+			f.emit(Event{
+				Type:     EventPeriodComplete,
+				Filename: b.Name,
+				Period:   start,
+				Message:  fmt.Sprintf("backup %s of the period from %s is complete", b.Name, start.Format(time.RFC3339)),
+			})
+		}
+	}
+	f.overPeriods = pending
+	return nil
+}
+
+// finalBackup reports if b is in its final form, with nothing left for trim
+// to do to it. Backups are not checksummed, so there is no checksum to wait
+// for.
+func (f *File) finalBackup(b Backup) bool {
+	if f.Archiver != nil {
+		return b.Remote
+	}
+	return !f.Compress || b.Encoded != ""
+}
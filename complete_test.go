@@ -0,0 +1,93 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_EventPeriodComplete(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_EventPeriodComplete")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+
+	var complete []Event
+	f := &File{
+		Filename:             filepath.Join(dirname, "app.log"),
+		When:                 "h",
+		Compress:             true,
+		NoGoroutines:         true,
+		NotifyPeriodComplete: true,
+		OnEvent: func(e Event) {
+			if e.Type == EventPeriodComplete {
+				complete = append(complete, e)
+			}
+		},
+	}
+	defer f.Close()
+	now := time.Date(2021, 3, 4, 10, 15, 0, 0, time.UTC)
+	f.setNowFunc(func() time.Time { return now })
+	write := func() {
+		_, err := f.Write([]byte("line\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	}
+
+	write()
+	testutils.TrueOrFatal(t, f.ForceRotate() == nil, "File.ForceRotate() should not fail")
+	write()
+	testutils.TrueOrFatal(t, len(complete) == 0, "want no event before the period is over, got %v", complete)
+
+	now = now.Add(time.Hour)
+	write()
+	// the rest of the period is appended to the backup made by ForceRotate
+	testutils.TrueOrFatal(t, len(complete) == 1, "want an event for the backup of the period, got %v", complete)
+	period := time.Date(2021, 3, 4, 10, 0, 0, 0, time.UTC)
+	for _, e := range complete {
+		_, err := os.Stat(e.Filename)
+		testutils.TrueOrError(t, err == nil && strings.HasSuffix(e.Filename, compressExt) && e.Period.Equal(period),
+			"want the compressed backup of %s, got %+v, err = %v", period, e, err)
+	}
+}
+
+func TestFile_EventPeriodComplete_idlePeriods(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_EventPeriodComplete_idlePeriods")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+
+	var periods []time.Time
+	f := &File{
+		Filename:             filepath.Join(dirname, "app.log"),
+		When:                 "h",
+		OneFilePerPeriod:     true,
+		NoGoroutines:         true,
+		NotifyPeriodComplete: true,
+		OnEvent: func(e Event) {
+			if e.Type == EventPeriodComplete {
+				periods = append(periods, e.Period)
+			}
+		},
+	}
+	defer f.Close()
+	now := time.Date(2021, 3, 4, 10, 15, 0, 0, time.UTC)
+	f.setNowFunc(func() time.Time { return now })
+
+	_, err = f.Write([]byte("line\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	now = now.Add(3 * time.Hour)
+	_, err = f.Write([]byte("line\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+
+	testutils.TrueOrFatal(t, len(periods) == 3, "want an event for each of the 3 periods over, got %v", periods)
+	for i, p := range periods {
+		want := time.Date(2021, 3, 4, 10+i, 0, 0, 0, time.UTC)
+		testutils.TrueOrError(t, p.Equal(want), "event %d: want the period of %s, got %s", i, want, p)
+	}
+}
@@ -0,0 +1,126 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	// compressExt is appended to backups compressed by Compress.
+	compressExt = ".gz"
+	// compressTmpExt is appended to a backup being compressed.
+	compressTmpExt = ".tmp"
+)
+
+// compressedExists reports if Compress is set and name has a compressed
+// backup.
+func (f *File) compressedExists(name string) bool {
+	if !f.Compress {
+		return false
+	}
+	_, err := os.Stat(name + compressExt)
+	return err == nil
+}
+
+// compressBackup compresses the backup name to name.gz, appending it as
+// another gzip member if name.gz exists already. The backup is compressed to
+// a temporary file first, so that a failure does not leave a partial backup.
+func (f *File) compressBackup(name string) error {
+	dst := name + compressExt
+	src, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("unable to open backup %s to compress: %v", name, err)
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to stat backup %s to compress: %v", name, err)
+	}
+	// the compressed backup takes at most about as much as the backup, and
+	// as much again to be appended to an existing one
+	need := info.Size()
+	if _, err := os.Stat(dst); err == nil {
+		need *= 2
+	}
+	if !f.hasSpaceFor(dst, need, "compress "+name) {
+		// compressed on a later trim instead of failing part way
+		return nil
+	}
+	tmp := dst + compressTmpExt
+	if err := gzipTo(tmp, src, info.Mode(), f.CopyBufferSize); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("unable to compress backup %s: %v", name, err)
+	}
+	if _, err := os.Stat(dst); err == nil {
+		err := appendFile(dst, tmp, f.CopyBufferSize)
+		os.Remove(tmp)
+		if err != nil {
+			return fmt.Errorf("unable to append compressed backup %s to %s: %v", name, dst, err)
+		}
+	} else if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("unable to rename compressed backup %s to %s: %v", tmp, dst, err)
+	}
+	src.Close()
+	if err := os.Remove(name); err != nil {
+		return fmt.Errorf("unable to remove compressed backup %s: %v", name, err)
+	}
+	// the time index does not apply to the compressed backup
+	var errs multipleErrors
+	if err := removeIndex(name); err != nil {
+		errs = append(errs, err)
+	}
+	err = os.Rename(MetadataFilename(name), MetadataFilename(dst))
+	if err != nil && !os.IsNotExist(err) {
+		errs = append(errs, err)
+	}
+	return errs.err()
+}
+
+// gzipTo writes r compressed to the file name, copying through a buffer of
+// bufSize bytes.
+func gzipTo(name string, r io.Reader, mode os.FileMode, bufSize int) error {
+	fh, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(fh)
+	if _, err := io.CopyBuffer(zw, onlyReader{r}, make([]byte, bufSize)); err != nil {
+		fh.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		fh.Close()
+		return err
+	}
+	if err := fh.Sync(); err != nil {
+		fh.Close()
+		return err
+	}
+	return fh.Close()
+}
+
+// appendFile appends the content of the file src to the file dst, see
+// copyFile for bufSize.
+func appendFile(dst, src string, bufSize int) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, fileWriteCopyTo, fileOpenMode)
+	if err != nil {
+		return err
+	}
+	if _, err := copyFile(out, in, bufSize); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
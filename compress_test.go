@@ -0,0 +1,102 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_Compress(t *testing.T) {
+	dirname, err := testutils.MkTestDir("Compress")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), Compress: true, Backups: 2, NoGoroutines: true, BackupMetadata: true}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+	write := func(line string) {
+		_, err := f.Write([]byte(line))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	}
+
+	write("one\n")
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	// appended to the compressed backup of the period
+	write("two\n")
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	for i := 0; i < 2; i++ {
+		now = now.Add(24 * time.Hour)
+		write("day\n")
+	}
+	now = now.Add(24 * time.Hour)
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+
+	backups, err := f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil, "File.ListBackups() error = %v", err)
+	var got []string
+	for _, b := range backups {
+		got = append(got, filepath.Base(b.Name))
+	}
+	// the first backup is trimmed, compressed backups count towards Backups
+	want := []string{"app.2021-03-05T0000-00.log.gz", "app.2021-03-06T0000-00.log.gz"}
+	testutils.TrueOrFatal(t, len(got) == len(want) && got[0] == want[0] && got[1] == want[1], "backups = %v, want %v", got, want)
+	_, err = ReadBackupMetadata(backups[1].Name)
+	testutils.TrueOrError(t, err == nil, "metadata of the compressed backup should be moved along, error = %v", err)
+	entries, err := ioutil.ReadDir(dirname)
+	testutils.TrueOrFatal(t, err == nil, "failed to read dir: %v", err)
+	testutils.TrueOrError(t, len(entries) == 5, "entries = %v, want app.log and 2 backups with their metadata", entries)
+}
+
+func TestFile_Compress_appended(t *testing.T) {
+	dirname, err := testutils.MkTestDir("Compress_appended")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), Compress: true, NoGoroutines: true}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+	for _, line := range []string{"one\n", "two\n"} {
+		_, err := f.Write([]byte(line))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	}
+	rc, err := OpenBackup(filepath.Join(dirname, "app.2021-03-04T0000-00.log.gz"))
+	testutils.TrueOrFatal(t, err == nil, "OpenBackup() error = %v", err)
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	testutils.TrueOrError(t, err == nil && string(b) == "one\ntwo\n", "backup content = %q, %v, want %q", b, err, "one\ntwo\n")
+}
+
+func TestFile_CompressAfter(t *testing.T) {
+	dirname, err := testutils.MkTestDir("CompressAfter")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), Compress: true, CompressAfter: 2, NoGoroutines: true}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+
+	for i := 0; i < 3; i++ {
+		_, err := f.Write([]byte("day\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		now = now.Add(24 * time.Hour)
+		testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	}
+	backups, err := f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil, "File.ListBackups() error = %v", err)
+	var got []string
+	for _, b := range backups {
+		got = append(got, filepath.Base(b.Name))
+	}
+	// only the oldest backup is compressed
+	want := []string{"app.2021-03-04T0000-00.log.gz", "app.2021-03-05T0000-00.log", "app.2021-03-06T0000-00.log"}
+	testutils.TrueOrFatal(t, len(got) == len(want) && got[0] == want[0] && got[1] == want[1] && got[2] == want[2], "backups = %v, want %v", got, want)
+}
@@ -0,0 +1,313 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// maxIncludeDepth bounds how deeply configuration files may include others,
+// which also catches include cycles.
+const maxIncludeDepth = 16
+
+// ConfigDecoder decodes a configuration file to maps, as JSON would be.
+type ConfigDecoder func(data []byte) (map[string]interface{}, error)
+
+var (
+	configFormatsMu sync.RWMutex
+	// configFormats are the formats registered with RegisterConfigFormat,
+	// by extension.
+	configFormats = map[string]ConfigDecoder{}
+)
+
+// RegisterConfigFormat registers a ConfigDecoder for configuration files
+// ending in ext, such as ".hcl", so that LoadConfig can read them. Packages
+// providing formats usually register them when they are imported, such as
+// the hclconfig package:
+//
+//	import _ "github.com/lohvht/logfeller/hclconfig"
+func RegisterConfigFormat(ext string, d ConfigDecoder) {
+	configFormatsMu.Lock()
+	defer configFormatsMu.Unlock()
+	configFormats[strings.ToLower(ext)] = d
+}
+
+// LoadConfig reads the configuration of a Manager from the file name, and
+// returns the Manager with all its Files validated and initialised. The format
+// is taken from the extension of name: ".json", ".yaml", ".yml", ".toml" or
+// one registered with RegisterConfigFormat. The configuration has the fields
+// of Manager, with the fields of each File under "files" by name. Keys may be
+// written with either the JSON or YAML names of fields, such as "backup_dir"
+// or "backup-dir".
+//
+// A top level "include" lists configuration files, relative to the one
+// including them, to use as a base for shared settings. They are merged in
+// order and the including file is merged over them, so a file only sets
+// the fields it changes:
+//
+//	include: [common.yaml]
+//	files:
+//	  app:
+//	    filename: /var/log/app/app.log
+func LoadConfig(name string) (*Manager, error) {
+	return loadConfig(osConfigFS{}, name)
+}
+
+// LoadConfigFS is like LoadConfig, but reads the configuration file name and
+// its includes from fsys, such as files embedded with go:embed. Names are
+// slash separated as with fs.FS, includes are resolved against the directory
+// of the file including them, or against the root of fsys if they start with
+// "/".
+func LoadConfigFS(fsys fs.FS, name string) (*Manager, error) {
+	return loadConfig(ioConfigFS{fsys: fsys}, name)
+}
+
+// configFS reads configuration files and resolves their includes.
+type configFS interface {
+	readFile(name string) ([]byte, error)
+	// include returns the name of the file included by the configuration
+	// file name.
+	include(name, include string) (string, error)
+}
+
+// osConfigFS reads configuration files from the OS filesystem.
+type osConfigFS struct{}
+
+func (osConfigFS) readFile(name string) ([]byte, error) { return ioutil.ReadFile(name) }
+
+func (osConfigFS) include(name, include string) (string, error) {
+	include, err := expandPath(include)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(include) {
+		include = filepath.Join(filepath.Dir(name), include)
+	}
+	return include, nil
+}
+
+// ioConfigFS reads configuration files from an fs.FS.
+type ioConfigFS struct {
+	fsys fs.FS
+}
+
+func (c ioConfigFS) readFile(name string) ([]byte, error) { return fs.ReadFile(c.fsys, name) }
+
+func (ioConfigFS) include(name, include string) (string, error) {
+	if strings.HasPrefix(include, "/") {
+		include = path.Clean(strings.TrimLeft(include, "/"))
+	} else {
+		include = path.Join(path.Dir(name), include)
+	}
+	if !fs.ValidPath(include) {
+		return "", fmt.Errorf("include is outside of the filesystem")
+	}
+	return include, nil
+}
+
+func loadConfig(cfs configFS, name string) (*Manager, error) {
+	raw, err := loadRawConfig(cfs, name, 0)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %v", name, err)
+	}
+	m := &Manager{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %v", name, err)
+	}
+	return m, nil
+}
+
+// loadRawConfig reads the configuration file name with its includes merged,
+// depth is how deeply name is included.
+func loadRawConfig(cfs configFS, name string, depth int) (map[string]interface{}, error) {
+	if depth > maxIncludeDepth {
+		return nil, fmt.Errorf("config %s: includes nested deeper than %d, there may be a cycle", name, maxIncludeDepth)
+	}
+	raw, err := decodeRawConfig(cfs, name)
+	if err != nil {
+		return nil, err
+	}
+	normalizeConfigKeys(raw)
+	includes, err := configIncludes(cfs, name, raw["include"])
+	if err != nil {
+		return nil, err
+	}
+	delete(raw, "include")
+	merged := map[string]interface{}{}
+	for _, include := range includes {
+		included, err := loadRawConfig(cfs, include, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		mergeConfig(merged, included)
+	}
+	mergeConfig(merged, raw)
+	return merged, nil
+}
+
+// decodeRawConfig decodes the file name based on its extension.
+func decodeRawConfig(cfs configFS, name string) (map[string]interface{}, error) {
+	b, err := cfs.readFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config: %v", err)
+	}
+	raw := map[string]interface{}{}
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".json":
+		err = json.Unmarshal(b, &raw)
+	case ".yaml", ".yml":
+		var v map[interface{}]interface{}
+		if err = yaml.Unmarshal(b, &v); err == nil {
+			raw = stringKeys(v)
+		}
+	case ".toml":
+		err = toml.Unmarshal(b, &raw)
+	default:
+		configFormatsMu.RLock()
+		decode, ok := configFormats[ext]
+		configFormatsMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("config %s: unsupported format %q, expected one of %s", name, ext, strings.Join(configExts(), ", "))
+		}
+		raw, err = decode(b)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %v", name, err)
+	}
+	return raw, nil
+}
+
+// configExts returns the extensions of the configuration formats supported.
+func configExts() []string {
+	exts := []string{".json", ".yaml", ".yml", ".toml"}
+	configFormatsMu.RLock()
+	defer configFormatsMu.RUnlock()
+	registered := make([]string, 0, len(configFormats))
+	for ext := range configFormats {
+		registered = append(registered, ext)
+	}
+	sort.Strings(registered)
+	return append(exts, registered...)
+}
+
+// stringKeys converts the maps decoded from YAML to maps with string keys,
+// so they can be encoded to JSON.
+func stringKeys(v map[interface{}]interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(v))
+	for k, val := range v {
+		m[fmt.Sprint(k)] = stringKeysValue(val)
+	}
+	return m
+}
+
+func stringKeysValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		return stringKeys(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = stringKeysValue(v[i])
+		}
+	}
+	return v
+}
+
+// normalizeConfigKeys renames the keys of the Manager and its Files, along
+// with their ExtraSchedules, from their YAML names to their JSON names. The
+// names of Files are kept as is.
+func normalizeConfigKeys(raw map[string]interface{}) {
+	renameKeys(raw)
+	files, ok := raw["files"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, f := range files {
+		fields, ok := f.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		renameKeys(fields)
+		switch groups := fields["extra_schedules"].(type) {
+		case []interface{}:
+			for _, g := range groups {
+				if group, ok := g.(map[string]interface{}); ok {
+					renameKeys(group)
+				}
+			}
+		case []map[string]interface{}:
+			// arrays of tables in TOML
+			for _, group := range groups {
+				renameKeys(group)
+			}
+		}
+	}
+}
+
+func renameKeys(m map[string]interface{}) {
+	for k, v := range m {
+		if jsonKey := strings.ReplaceAll(k, "-", "_"); jsonKey != k {
+			delete(m, k)
+			m[jsonKey] = v
+		}
+	}
+}
+
+// configIncludes returns the files listed in the include value of the
+// configuration file name, resolved against its directory.
+func configIncludes(cfs configFS, name string, include interface{}) ([]string, error) {
+	var includes []string
+	switch include := include.(type) {
+	case nil:
+	case string:
+		includes = []string{include}
+	case []interface{}:
+		for _, v := range include {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("config %s: include must be a list of filenames", name)
+			}
+			includes = append(includes, s)
+		}
+	default:
+		return nil, fmt.Errorf("config %s: include must be a list of filenames", name)
+	}
+	for i, include := range includes {
+		include, err := cfs.include(name, include)
+		if err != nil {
+			return nil, fmt.Errorf("config %s: invalid include %s: %v", name, includes[i], err)
+		}
+		includes[i] = include
+	}
+	return includes, nil
+}
+
+// mergeConfig merges src into dst, maps are merged key by key while other
+// values in src replace those in dst.
+func mergeConfig(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcMap, srcOK := v.(map[string]interface{})
+		dstMap, dstOK := dst[k].(map[string]interface{})
+		if srcOK && dstOK {
+			mergeConfig(dstMap, srcMap)
+			continue
+		}
+		dst[k] = v
+	}
+}
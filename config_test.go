@@ -0,0 +1,111 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dirname, err := testutils.MkTestDir("LoadConfig")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	write := func(name, content string) string {
+		name = filepath.Join(dirname, name)
+		testutils.TrueOrFatal(t, ioutil.WriteFile(name, []byte(content), 0600) == nil, "failed to write %s", name)
+		return name
+	}
+	write("common.yaml", `
+max-open: 10
+files:
+  app:
+    when: h
+    backups: 3
+    min-rotation-interval: 1m
+`)
+	configs := map[string]string{
+		"app.yaml": `
+include: [common.yaml]
+files:
+  app:
+    filename: app.log
+    backups: 5
+  audit-trail:
+    filename: audit.log
+`,
+		"app.json": `{
+  "include": ["common.yaml"],
+  "files": {
+    "app": {"filename": "app.log", "backups": 5},
+    "audit-trail": {"filename": "audit.log"}
+  }
+}`,
+		"app.toml": `
+include = ["common.yaml"]
+
+[files.app]
+filename = "app.log"
+backups = 5
+
+[files.audit-trail]
+filename = "audit.log"
+`,
+	}
+	for config, content := range configs {
+		m, err := LoadConfig(write(config, content))
+		testutils.TrueOrFatal(t, err == nil, "LoadConfig(%s) error = %v", config, err)
+		app, other := m.Files["app"], m.Files["audit-trail"]
+		testutils.TrueOrFatal(t, len(m.Files) == 2 && app != nil && other != nil, "LoadConfig(%s) files = %v", config, m.Files)
+		testutils.TrueOrError(t, m.MaxOpen == 10, "LoadConfig(%s) MaxOpen = %d, want 10 from the include", config, m.MaxOpen)
+		testutils.TrueOrError(t, app.Backups == 5 && app.When == Hour && app.MinRotationInterval == Duration(time.Minute),
+			"LoadConfig(%s) app = %#v, want settings merged over the include", config, app)
+		testutils.TrueOrError(t, other.When == Day && other.Backups == 0, "LoadConfig(%s) audit-trail = %#v, want defaults", config, other)
+	}
+
+	for name, content := range map[string]string{
+		"extra.yaml": "files:\n  app:\n    filename: app.log\n    extra-schedules:\n      - when: d\n        rotation-schedule: [\"0130:00\"]\n",
+		"extra.toml": "[files.app]\nfilename = \"app.log\"\n\n[[files.app.extra-schedules]]\nwhen = \"d\"\nrotation-schedule = [\"0130:00\"]\n",
+	} {
+		m, err := LoadConfig(write(name, content))
+		testutils.TrueOrFatal(t, err == nil, "LoadConfig(%s) error = %v", name, err)
+		groups := m.Files["app"].ExtraSchedules
+		testutils.TrueOrError(t, len(groups) == 1 && groups[0].When == Day && len(groups[0].RotationSchedule) == 1 && groups[0].RotationSchedule[0] == "0130:00",
+			"LoadConfig(%s) ExtraSchedules = %#v, want the nested keys loaded", name, groups)
+	}
+
+	_, err = LoadConfig(write("invalid.yaml", "files:\n  app:\n    when: x\n"))
+	testutils.TrueOrError(t, err != nil && strings.Contains(err.Error(), "when"), "LoadConfig() of an invalid File should fail validation, got %v", err)
+	_, err = LoadConfig(write("cycle.yaml", "include: [cycle.yaml]\n"))
+	testutils.TrueOrError(t, err != nil, "LoadConfig() should fail on include cycles")
+	_, err = LoadConfig(write("app.ini", "[files]\n"))
+	testutils.TrueOrError(t, err != nil, "LoadConfig() should fail on unsupported formats")
+}
+
+func TestLoadConfigFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"common.yaml":      {Data: []byte("files:\n  app:\n    when: h\n    backups: 3\n")},
+		"conf/app.yaml":    {Data: []byte("include: [/common.yaml, ../conf/local.json]\nfiles:\n  app:\n    filename: app.log\n")},
+		"conf/local.json":  {Data: []byte(`{"files": {"app": {"backups": 5}}}`)},
+		"conf/escape.yaml": {Data: []byte("include: [../../common.yaml]\n")},
+	}
+	m, err := LoadConfigFS(fsys, "conf/app.yaml")
+	testutils.TrueOrFatal(t, err == nil, "LoadConfigFS() error = %v", err)
+	app := m.Files["app"]
+	testutils.TrueOrFatal(t, app != nil, "LoadConfigFS() files = %v", m.Files)
+	testutils.TrueOrError(t, app.When == Hour && app.Backups == 5, "LoadConfigFS() app = %#v, want settings merged over the includes", app)
+
+	_, err = LoadConfigFS(fsys, "conf/escape.yaml")
+	testutils.TrueOrError(t, err != nil, "LoadConfigFS() should fail on includes outside of the filesystem")
+	_, err = LoadConfigFS(fsys, "missing.yaml")
+	testutils.TrueOrError(t, err != nil, "LoadConfigFS() should fail on missing files")
+}
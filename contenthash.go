@@ -0,0 +1,47 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// resetContentHash starts the ContentHash of a new file or period.
+func (f *File) resetContentHash() {
+	if !f.ContentHash {
+		return
+	}
+	if f.contentHash == nil {
+		f.contentHash = sha256.New()
+	}
+	f.contentHash.Reset()
+}
+
+// hashContent adds p, which was written to the file, to the ContentHash.
+func (f *File) hashContent(p []byte) {
+	if f.contentHash != nil {
+		f.contentHash.Write(p)
+	}
+}
+
+// contentHashString returns the ContentHash so far in hex, empty if it is
+// not set.
+func (f *File) contentHashString() string {
+	if f.contentHash == nil {
+		return ""
+	}
+	return hex.EncodeToString(f.contentHash.Sum(nil))
+}
+
+// chainContentHash returns the ChainedContentHash of a backup whose hash was
+// prev, appended to with content hashed to next, as the hash of both hashes.
+func chainContentHash(prev, next string) string {
+	if prev == "" || next == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(prev + next))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,58 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_ContentHash(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_ContentHash")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	hashOf := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+
+	f := &File{Filename: filepath.Join(dirname, "app.log"), When: "h", ContentHash: true, BackupMetadata: true}
+	defer f.Close()
+	now := time.Date(2021, 3, 4, 10, 15, 0, 0, time.UTC)
+	f.setNowFunc(func() time.Time { return now })
+	_, err = f.Write([]byte("one\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	_, err = f.WriteBatch([][]byte{[]byte("two\n"), []byte("three\n")})
+	testutils.TrueOrFatal(t, err == nil, "File.WriteBatch() error = %v", err)
+	want := hashOf("one\ntwo\nthree\n")
+	testutils.TrueOrError(t, f.Stats().ContentHash == want, "want the hash of the period so far %s, got %s", want, f.Stats().ContentHash)
+
+	now = now.Add(time.Hour)
+	_, err = f.Write([]byte("four\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrError(t, f.Stats().ContentHash == hashOf("four\n"), "want the hash to start over for the new period, got %s", f.Stats().ContentHash)
+	backups, err := f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil && len(backups) == 1, "want 1 backup, got %v, err = %v", backups, err)
+	md, err := ReadBackupMetadata(backups[0].Name)
+	testutils.TrueOrError(t, err == nil && md.ContentHash == want, "want the hash of the period in the metadata %s, got %+v, err = %v", want, md, err)
+
+	// the rest of the period is appended to the backup of its first part
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	_, err = f.Write([]byte("five\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	backups, err = f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil && len(backups) == 2, "want 2 backups, got %v, err = %v", backups, err)
+	md, err = ReadBackupMetadata(backups[1].Name)
+	want = hashOf(hashOf("four\n") + hashOf("five\n"))
+	testutils.TrueOrError(t, err == nil && md.ContentHash == "" && md.ChainedContentHash == want,
+		"want the chained hash of the parts %s in place of the content hash, got %+v, err = %v", want, md, err)
+}
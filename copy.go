@@ -0,0 +1,11 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import "io"
+
+// onlyReader hides any io.WriterTo of the reader it wraps, so that
+// io.CopyBuffer uses the buffer given to it.
+type onlyReader struct{ io.Reader }
@@ -0,0 +1,21 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"io"
+	"os"
+)
+
+// copyFile copies src to the end of dst, which must not be opened with
+// O_APPEND. On Linux, the copy is left to (*os.File).ReadFrom, which has the
+// kernel copy the data with copy_file_range or splice, so bufSize is not
+// used. The kernel does neither for a dst opened with O_APPEND.
+func copyFile(dst, src *os.File, _ int) (int64, error) {
+	if _, err := dst.Seek(0, io.SeekEnd); err != nil {
+		return 0, err
+	}
+	return dst.ReadFrom(src)
+}
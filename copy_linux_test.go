@@ -0,0 +1,62 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+// readSyscalls returns the number of read syscalls made by the process, as
+// counted in /proc/self/io, which a kernel copy counts once.
+func readSyscalls(t *testing.T) int64 {
+	b, err := ioutil.ReadFile("/proc/self/io")
+	if err != nil {
+		t.Skipf("cannot read /proc/self/io: %v", err)
+	}
+	var n int64
+	i := bytes.Index(b, []byte("syscr:"))
+	if i < 0 {
+		t.Skip("no syscr in /proc/self/io")
+	}
+	if _, err := fmt.Sscanf(string(b[i:]), "syscr: %d", &n); err != nil {
+		t.Skipf("cannot parse /proc/self/io: %v", err)
+	}
+	return n
+}
+
+func Test_copyFile_kernel(t *testing.T) {
+	dirname, err := testutils.MkTestDir("copyFile_kernel")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	content := bytes.Repeat([]byte("0123456789abcdef"), 512*1024)
+	srcName, dstName := filepath.Join(dirname, "src.log"), filepath.Join(dirname, "dst.log")
+	testutils.TrueOrFatal(t, ioutil.WriteFile(srcName, content, 0600) == nil, "failed to write %s", srcName)
+	testutils.TrueOrFatal(t, ioutil.WriteFile(dstName, []byte("head\n"), 0600) == nil, "failed to write %s", dstName)
+
+	src, err := os.Open(srcName)
+	testutils.TrueOrFatal(t, err == nil, "os.Open() error = %v", err)
+	defer src.Close()
+	dst, err := os.OpenFile(dstName, fileWriteCopyTo, 0600)
+	testutils.TrueOrFatal(t, err == nil, "os.OpenFile() error = %v", err)
+	defer dst.Close()
+
+	// copied through a 4KB buffer, it would take 2048 reads
+	before := readSyscalls(t)
+	n, err := copyFile(dst, src, 4096)
+	reads := readSyscalls(t) - before
+	testutils.TrueOrFatal(t, err == nil && n == int64(len(content)), "copyFile() = %d, %v, want %d", n, err, len(content))
+	testutils.TrueOrError(t, reads < 64, "want the kernel to copy the file, took %d read syscalls", reads)
+
+	got, err := ioutil.ReadFile(dstName)
+	testutils.TrueOrFatal(t, err == nil, "ioutil.ReadFile() error = %v", err)
+	testutils.TrueOrError(t, bytes.Equal(got, append([]byte("head\n"), content...)), "want the copy after the existing content, got %d bytes", len(got))
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+// +build !linux
+
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"io"
+	"os"
+)
+
+// onlyWriter hides any io.ReaderFrom of the writer it wraps, so that
+// io.CopyBuffer uses the buffer given to it.
+type onlyWriter struct{ io.Writer }
+
+// copyFile copies src to the end of dst through a buffer of bufSize bytes.
+func copyFile(dst, src *os.File, bufSize int) (int64, error) {
+	if _, err := dst.Seek(0, io.SeekEnd); err != nil {
+		return 0, err
+	}
+	return io.CopyBuffer(onlyWriter{dst}, onlyReader{src}, make([]byte, bufSize))
+}
@@ -0,0 +1,62 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// rotationsSuffix is appended to the name of the file the RotationCounter
+// is kept in.
+const rotationsSuffix = ".rotations"
+
+// rotationsFilename returns the file the RotationCounter of f is kept in, it
+// is hidden so that it is not taken for a backup.
+func (f *File) rotationsFilename() string {
+	return filepath.Join(f.backupDirectory, "."+f.fileBase+f.ext+rotationsSuffix)
+}
+
+// loadRotations reads the RotationCounter of f. A counter that cannot be read
+// is reported with an EventBackupError, and counted from zero again.
+func (f *File) loadRotations() {
+	b, err := ioutil.ReadFile(f.rotationsFilename())
+	if os.IsNotExist(err) {
+		return
+	}
+	if err == nil {
+		f.rotations, err = strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	}
+	if err != nil {
+		f.emit(Event{Type: EventBackupError, Filename: f.rotationsFilename(), Message: "unable to read rotation counter, counting from 0", Err: err})
+	}
+}
+
+// countRotation adds a rotation to the RotationCounter of f if it is set,
+// and returns its number. Rotations counted by someone else in between are
+// skipped over. The counter is written to a temporary file first,
+// so that a crash does not leave it partly written.
+func (f *File) countRotation() uint64 {
+	if !f.RotationCounter {
+		return 0
+	}
+	f.checkForeignCount()
+	f.rotations++
+	name := f.rotationsFilename()
+	tmp := name + compressTmpExt
+	err := ioutil.WriteFile(tmp, []byte(strconv.FormatUint(f.rotations, 10)+"\n"), fileOpenMode)
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		f.emit(Event{Type: EventBackupError, Filename: name, Message: fmt.Sprintf("unable to save rotation counter at %d", f.rotations), Err: err})
+	}
+	return f.rotations
+}
@@ -0,0 +1,62 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_RotationCounter(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_RotationCounter")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	var rotated []Event
+	onEvent := func(e Event) {
+		if e.Type == EventRotation {
+			rotated = append(rotated, e)
+		}
+	}
+	newFile := func() *File {
+		f := &File{Filename: filepath.Join(dirname, "app.log"), RotationCounter: true, BackupMetadata: true, Footer: "# rotation {rotation}", NoGoroutines: true, OnEvent: onEvent}
+		f.setNowFunc(func() time.Time { return now })
+		return f
+	}
+	rotate := func(f *File) {
+		_, err := f.Write([]byte("line\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		testutils.TrueOrFatal(t, f.ForceRotate() == nil, "File.ForceRotate() should not fail")
+	}
+
+	f := newFile()
+	rotate(f)
+	rotate(f)
+	testutils.TrueOrError(t, f.Stats().Rotations == 2, "Stats().Rotations = %d, want 2", f.Stats().Rotations)
+	testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+	// the count carries on in a new File
+	f = newFile()
+	defer f.Close()
+	rotate(f)
+
+	testutils.TrueOrFatal(t, len(rotated) == 3, "want 3 rotations, got %v", rotated)
+	for i, e := range rotated {
+		want := uint64(i + 1)
+		md, err := ReadBackupMetadata(e.Filename)
+		testutils.TrueOrError(t, e.Rotation == want && err == nil && md.Rotation == want, "%s rotation = %d, metadata = %d, error = %v, want %d", e.Filename, e.Rotation, md.Rotation, err, want)
+		content, err := ioutil.ReadFile(e.Filename)
+		wantFooter := fmt.Sprintf("# rotation %d\n", want)
+		testutils.TrueOrError(t, err == nil && strings.HasSuffix(string(content), wantFooter), "%s = %q, want footer %q", e.Filename, content, wantFooter)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dirname, ".app.log.rotations"))
+	testutils.TrueOrError(t, err == nil && string(content) == "3\n", "rotation counter = %q, error = %v, want 3", content, err)
+}
@@ -0,0 +1,157 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// maxDecodeLayers bounds the number of decoders applied to a single backup,
+// such as decrypting and then decompressing it.
+const maxDecodeLayers = 4
+
+// Decoder decodes r, which starts with the magic bytes of the decoder's
+// format, such as to decompress or decrypt it.
+type Decoder func(r io.Reader) (io.ReadCloser, error)
+
+type decoderFormat struct {
+	ext    string
+	magic  []byte
+	decode Decoder
+}
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = []decoderFormat{
+		{ext: ".gz", magic: []byte{0x1f, 0x8b}, decode: decodeGzip},
+		// written by ActiveCompression
+		{ext: ".sz", magic: []byte(snappyMagic), decode: decodeSnappy},
+		// commonly added by tools that post-process backups, they are
+		// recognised in backup filenames but not decoded until a Decoder is
+		// registered for them
+		{ext: ".zst"},
+		{ext: ".enc"},
+	}
+)
+
+func decodeGzip(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) }
+
+// RegisterDecoder registers a Decoder for backups that were compressed or
+// encrypted, usually outside of logfeller, so that OpenBackup, NewReader and
+// Follow can read them transparently. ext is the extension appended to such
+// backups, such as ".zst", and magic the leading bytes that identify them,
+// such as 28 b5 2f fd for zstd. gzip and snappy are registered by default.
+// Backups ending in ".zst" and ".enc" are recognised without a Decoder, but
+// cannot be read until one is registered.
+//
+// Decoders for encrypted backups usually close over the keys needed, for
+// example with the age format:
+//
+//	logfeller.RegisterDecoder(".age", []byte("age-encryption.org/"), func(r io.Reader) (io.ReadCloser, error) {
+//		dr, err := age.Decrypt(r, identity)
+//		return ioutil.NopCloser(dr), err
+//	})
+func RegisterDecoder(ext string, magic []byte, d Decoder) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	format := decoderFormat{ext: ext, magic: append([]byte(nil), magic...), decode: d}
+	for i := range decoders {
+		if decoders[i].ext == ext {
+			decoders[i] = format
+			return
+		}
+	}
+	decoders = append(decoders, format)
+}
+
+// trimEncodedExts returns name without any trailing registered decoder
+// extensions or ones recognised without a decoder, and the extensions
+// trimmed.
+func trimEncodedExts(name string) (trimmed, exts string) {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+	trimmed = name
+	for found := true; found; {
+		found = false
+		for _, d := range decoders {
+			if d.ext != "" && strings.HasSuffix(trimmed, d.ext) {
+				trimmed = strings.TrimSuffix(trimmed, d.ext)
+				found = true
+			}
+		}
+	}
+	return trimmed, name[len(trimmed):]
+}
+
+// decoderFor returns the decoder whose magic bytes r starts with, if any.
+func decoderFor(r *bufio.Reader) (Decoder, bool) {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+	for _, d := range decoders {
+		head, _ := r.Peek(len(d.magic))
+		if len(d.magic) > 0 && bytes.Equal(head, d.magic) {
+			return d.decode, true
+		}
+	}
+	return nil, false
+}
+
+// OpenBackup opens the backup name for reading. Backups that were compressed
+// or encrypted with a registered Decoder are decoded transparently, based on
+// their content rather than their extension.
+func OpenBackup(name string) (io.ReadCloser, error) {
+	fh, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return decode(fh)
+}
+
+// decode applies decoders to rc for as long as its content starts with the
+// magic bytes of a registered Decoder.
+func decode(rc io.ReadCloser) (io.ReadCloser, error) {
+	layers := multiCloser{rc}
+	var r io.Reader = rc
+	for i := 0; i < maxDecodeLayers; i++ {
+		br := bufio.NewReader(r)
+		r = br
+		d, ok := decoderFor(br)
+		if !ok {
+			break
+		}
+		dr, err := d(br)
+		if err != nil {
+			layers.Close()
+			return nil, err
+		}
+		layers = append(layers, dr)
+		r = dr
+	}
+	return readCloser{Reader: r, Closer: layers}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// multiCloser closes its closers from the last to the first.
+type multiCloser []io.Closer
+
+func (mc multiCloser) Close() error {
+	var errs multipleErrors
+	for i := len(mc) - 1; i >= 0; i-- {
+		if err := mc[i].Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.err()
+}
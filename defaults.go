@@ -0,0 +1,60 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"reflect"
+	"sync"
+)
+
+var (
+	defaultsMu sync.RWMutex
+	// defaults holds the configuration set with SetDefaults, nil if none.
+	defaults *File
+)
+
+// SetDefaults sets the configuration Files inherit. Every configuration field
+// of d that is not zero is used by Files that leave it zero, except for
+// Filename. Files take the defaults set when they are initialised, on their
+// first use or when they are decoded, and are not affected by later calls.
+// Since booleans are inherited when false, a File cannot turn off an option
+// that is turned on by default. A nil d clears the defaults.
+func SetDefaults(d *File) {
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
+	if d == nil {
+		defaults = nil
+		return
+	}
+	defaults = &File{}
+	inheritFields(defaults, d)
+}
+
+// applyDefaults fills in the zero configuration fields of f from the
+// defaults set with SetDefaults.
+func (f *File) applyDefaults() {
+	defaultsMu.RLock()
+	defer defaultsMu.RUnlock()
+	if defaults != nil {
+		inheritFields(f, defaults)
+	}
+}
+
+// inheritFields sets every exported field of dst that is zero to the value in
+// src, except for Filename.
+func inheritFields(dst, src *File) {
+	dstv, srcv := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	typ := dstv.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" || field.Name == "Filename" {
+			// unexported or not inherited
+			continue
+		}
+		if v := srcv.Field(i); !v.IsZero() && dstv.Field(i).IsZero() {
+			dstv.Field(i).Set(v)
+		}
+	}
+}
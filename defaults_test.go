@@ -0,0 +1,28 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"testing"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestSetDefaults(t *testing.T) {
+	SetDefaults(&File{Filename: "default.log", When: Hour, Backups: 5, BackupTimeFormat: "2006-01-02T15", UseLocal: true})
+	defer SetDefaults(nil)
+
+	f := &File{Filename: "app.log", Backups: 2}
+	testutils.TrueOrFatal(t, f.init() == nil, "File.init() should not fail")
+	testutils.TrueOrError(t, f.Filename != "default.log", "Filename should not be inherited, got %s", f.Filename)
+	testutils.TrueOrError(t, f.Backups == 2, "Backups set on the file should be kept, got %d", f.Backups)
+	testutils.TrueOrError(t, f.When == Hour && f.BackupTimeFormat == "2006-01-02T15" && f.UseLocal,
+		"zero fields should be inherited, got When = %s, BackupTimeFormat = %s, UseLocal = %v", f.When, f.BackupTimeFormat, f.UseLocal)
+
+	SetDefaults(nil)
+	f = &File{Filename: "app.log"}
+	testutils.TrueOrFatal(t, f.init() == nil, "File.init() should not fail")
+	testutils.TrueOrError(t, f.When == Day && f.Backups == 0, "cleared defaults should not be inherited, got When = %s, Backups = %d", f.When, f.Backups)
+}
@@ -0,0 +1,51 @@
+//go:build go1.21
+// +build go1.21
+
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"context"
+	"log/slog"
+)
+
+// WithDiagnostics has f report its own activity, such as rotations, write
+// errors and recoveries, to l as well as OnEvent, and returns f. Problems are
+// logged at the error level, events that are likely a mistake at the warning
+// level and the rest at the info level. By default nothing is logged. It must
+// be called before f is used, and is only available when built with Go 1.21
+// or later.
+func (f *File) WithDiagnostics(l *slog.Logger) *File {
+	if l == nil {
+		f.diagnostics = nil
+		return f
+	}
+	f.diagnostics = func(e Event) {
+		attrs := []slog.Attr{slog.String("event", string(e.Type)), slog.String("filename", e.Filename)}
+		if e.Err != nil {
+			attrs = append(attrs, slog.Any("error", e.Err))
+		}
+		if e.Type == EventRotation {
+			attrs = append(attrs, slog.Int64("bytes", e.Bytes), slog.Int64("lines", e.Lines))
+		}
+		l.LogAttrs(context.Background(), diagnosticLevel(e), e.Message, attrs...)
+	}
+	return f
+}
+
+// diagnosticLevel returns the level e is logged at by WithDiagnostics.
+func diagnosticLevel(e Event) slog.Level {
+	switch {
+	case e.Err != nil:
+		return slog.LevelError
+	case e.Type == EventWriteError || e.Type == EventBackupError || e.Type == EventIndexError || e.Type == EventLinkError:
+		return slog.LevelError
+	case e.Type == EventConfigWarning || e.Type == EventBackupCollision || e.Type == EventRotationThrottled || e.Type == EventStale || e.Type == EventLowDiskSpace || e.Type == EventQuotaExceeded || e.Type == EventForeignRotation || e.Type == EventRotationAnomaly || e.Type == EventPressure:
+		return slog.LevelWarn
+	default:
+		return slog.LevelInfo
+	}
+}
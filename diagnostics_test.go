@@ -0,0 +1,41 @@
+//go:build go1.21
+// +build go1.21
+
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_WithDiagnostics(t *testing.T) {
+	dirname, err := testutils.MkTestDir("WithDiagnostics")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	var logged bytes.Buffer
+	var events int
+	f := (&File{Filename: filepath.Join(dirname, "app.log"), OnEvent: func(Event) { events++ }}).
+		WithDiagnostics(slog.New(slog.NewTextHandler(&logged, nil)))
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+	_, err = f.Write([]byte("line\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+
+	out := logged.String()
+	testutils.TrueOrError(t, strings.Contains(out, "level=INFO") && strings.Contains(out, "event=rotation") && strings.Contains(out, "bytes=5"),
+		"diagnostics should log the rotation, got %q", out)
+	testutils.TrueOrError(t, events == 1, "OnEvent should still be called, got %d events", events)
+}
@@ -0,0 +1,29 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// diskFree is freeSpace, replaced in tests.
+var diskFree = freeSpace
+
+// hasSpaceFor reports if the filesystem that name is on has room for n more
+// bytes, emitting an EventLowDiskSpace about doing what if not. It is true if
+// the free space cannot be told.
+func (f *File) hasSpaceFor(name string, n int64, what string) bool {
+	free, err := diskFree(filepath.Dir(name))
+	if err != nil || n <= 0 || uint64(n) <= free {
+		return true
+	}
+	f.emit(Event{
+		Type:     EventLowDiskSpace,
+		Filename: name,
+		Message:  fmt.Sprintf("not enough space to %s, %d bytes free of %d needed", what, free, n),
+	})
+	return false
+}
@@ -0,0 +1,55 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_LowDiskSpace(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_LowDiskSpace")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	free := uint64(0)
+	diskFree = func(dir string) (uint64, error) { return free, nil }
+	defer func() { diskFree = freeSpace }()
+
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	filename := filepath.Join(dirname, "app.log")
+	var lowSpace int
+	f := &File{Filename: filename, Compress: true, NoGoroutines: true, OnEvent: func(e Event) {
+		if e.Type == EventLowDiskSpace {
+			lowSpace++
+		}
+	}}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+	for _, line := range []string{"first\n", "second\n"} {
+		_, err = f.Write([]byte(line))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	}
+	backup := filepath.Join(dirname, "app.2021-03-04T0000-00.log")
+	// compression is left for later, and the second rotation is kept apart
+	// as there is no room to append it
+	for name, want := range map[string]string{backup: "first\n", filepath.Join(dirname, "app.2021-03-04T0000-00_1.log"): "second\n"} {
+		b, err := ioutil.ReadFile(name)
+		testutils.TrueOrError(t, err == nil && string(b) == want, "%s = %q, want %q, err = %v", name, b, want, err)
+	}
+	testutils.TrueOrError(t, lowSpace > 0, "want an EventLowDiskSpace")
+
+	free = 1 << 30
+	testutils.TrueOrFatal(t, f.Maintain() == nil, "File.Maintain() should not fail")
+	_, err = os.Stat(backup + compressExt)
+	testutils.TrueOrError(t, err == nil, "backup should be compressed once there is room, err = %v", err)
+	_, err = os.Stat(backup)
+	testutils.TrueOrError(t, os.IsNotExist(err), "compressed backup should be removed, err = %v", err)
+}
@@ -0,0 +1,54 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// syncRotated commits the current file to stable storage before it is
+// rotated, if Durability asks for it.
+func (f *File) syncRotated() error {
+	if f.Durability == DurabilityNone || f.file == nil || f.fifo {
+		return nil
+	}
+	if err := f.flush(); err != nil {
+		return err
+	}
+	return f.syncFile()
+}
+
+// syncWrite commits a write to stable storage if Durability is "write".
+func (f *File) syncWrite() error {
+	if f.Durability != DurabilityWrite || f.file == nil || f.fifo {
+		return nil
+	}
+	if err := f.flush(); err != nil {
+		return err
+	}
+	return f.syncFile()
+}
+
+// syncDirs commits the entries of the directories of names to stable
+// storage if Durability asks for it, such as after a rename between them.
+// Failures are reported with an EventWriteError, the files themselves are in
+// place by then.
+func (f *File) syncDirs(names ...string) {
+	if f.Durability == DurabilityNone {
+		return
+	}
+	synced := make(map[string]bool, len(names))
+	for _, name := range names {
+		dir := filepath.Dir(name)
+		if synced[dir] {
+			continue
+		}
+		synced[dir] = true
+		if err := syncDir(dir); err != nil {
+			f.emit(Event{Type: EventWriteError, Filename: dir, Message: fmt.Sprintf("unable to sync directory %s", dir), Err: err})
+		}
+	}
+}
@@ -0,0 +1,45 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_Durability(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_Durability")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	filename := filepath.Join(dirname, "app.log")
+	var events []Event
+	f := &File{Filename: filename, Durability: "Write", BufferSize: 4096, OnEvent: func(e Event) {
+		if e.Type == EventWriteError {
+			events = append(events, e)
+		}
+	}}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+
+	_, err = f.Write([]byte("first\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	b, err := ioutil.ReadFile(filename)
+	testutils.TrueOrError(t, err == nil && string(b) == "first\n", "write durability should not leave writes buffered, got %q, err = %v", b, err)
+
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	_, err = f.Write([]byte("second\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	// the collision is appended to
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	b, err = ioutil.ReadFile(filepath.Join(dirname, "app.2021-03-04T0000-00.log"))
+	testutils.TrueOrError(t, err == nil && string(b) == "first\nsecond\n", "backup = %q, err = %v", b, err)
+	testutils.TrueOrError(t, len(events) == 0, "syncing directories should not fail, got %v", events)
+}
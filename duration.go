@@ -0,0 +1,86 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Duration is a time.Duration that can be unmarshalled from either a Go
+// duration string such as "6h30m", or an ISO-8601 duration such as "PT6H30M".
+// ISO-8601 durations may only use weeks, days, hours, minutes and seconds,
+// where a day is always 24 hours.
+type Duration time.Duration
+
+var isoDurationRegex = regexp.MustCompile(`^P(?:(?P<weeks>\d+)W)?(?:(?P<days>\d+)D)?(?:T(?:(?P<hours>\d+)H)?(?:(?P<minutes>\d+)M)?(?:(?P<seconds>\d+(?:\.\d+)?)S)?)?$`)
+
+// ParseDuration parses a Go duration string or an ISO-8601 duration.
+func ParseDuration(s string) (Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if s[0] != 'P' {
+		d, err := time.ParseDuration(s)
+		return Duration(d), err
+	}
+	match := isoDurationRegex.FindStringSubmatch(s)
+	if match == nil || s == "P" || s[len(s)-1] == 'T' {
+		return 0, fmt.Errorf("invalid ISO-8601 duration '%s', expected value of format PnWnDTnHnMnS", s)
+	}
+	units := map[string]time.Duration{
+		"weeks":   7 * oneDay,
+		"days":    oneDay,
+		"hours":   time.Hour,
+		"minutes": time.Minute,
+		"seconds": time.Second,
+	}
+	var d time.Duration
+	for i, name := range isoDurationRegex.SubexpNames() {
+		if i == 0 || match[i] == "" {
+			continue
+		}
+		// Ignore the error here, the regex should have handled it properly here
+		n, _ := strconv.ParseFloat(match[i], 64)
+		d += time.Duration(n * float64(units[name]))
+	}
+	return Duration(d), nil
+}
+
+// String returns the duration formatted like time.Duration.
+func (d Duration) String() string { return time.Duration(d).String() }
+
+func (d Duration) MarshalJSON() ([]byte, error) { return json.Marshal(d.String()) }
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) { return d.String(), nil }
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	parsed, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
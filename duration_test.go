@@ -0,0 +1,66 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    Duration
+		wantErr bool
+	}{
+		{name: "empty", s: ""},
+		{name: "go_duration", s: "6h30m", want: Duration(6*time.Hour + 30*time.Minute)},
+		{name: "iso_hours", s: "PT6H", want: Duration(6 * time.Hour)},
+		{name: "iso_all_units", s: "P1W2DT3H4M5S", want: Duration(9*oneDay + 3*time.Hour + 4*time.Minute + 5*time.Second)},
+		{name: "iso_fractional_seconds", s: "PT0.5S", want: Duration(time.Second / 2)},
+		{name: "iso_days", s: "P1D", want: Duration(oneDay)},
+		{name: "iso_months_unsupported", s: "P1M", wantErr: true},
+		{name: "iso_empty", s: "P", wantErr: true},
+		{name: "iso_empty_time", s: "P1DT", wantErr: true},
+		{name: "go_invalid", s: "6 hours", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDuration(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseDuration() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDuration_Unmarshal(t *testing.T) {
+	var fromJSON struct {
+		Every Duration `json:"every"`
+	}
+	err := json.Unmarshal([]byte(`{"every": "PT6H"}`), &fromJSON)
+	if err != nil || fromJSON.Every != Duration(6*time.Hour) {
+		t.Errorf("Duration.UnmarshalJSON() = %v, err = %v, want %v", fromJSON.Every, err, 6*time.Hour)
+	}
+	var fromYAML struct {
+		Every Duration `yaml:"every"`
+	}
+	err = yaml.Unmarshal([]byte(`every: 90m`), &fromYAML)
+	if err != nil || fromYAML.Every != Duration(90*time.Minute) {
+		t.Errorf("Duration.UnmarshalYAML() = %v, err = %v, want %v", fromYAML.Every, err, 90*time.Minute)
+	}
+	b, err := json.Marshal(fromYAML)
+	if err != nil || string(b) != `{"Every":"1h30m0s"}` {
+		t.Errorf("Duration.MarshalJSON() = %s, err = %v", b, err)
+	}
+}
@@ -0,0 +1,57 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// placeholderFormat is the format of the record written to files with no
+// output in their period with OnEmptyRotation "placeholder".
+const placeholderFormat = "--- logfeller: no output from %s to %s ---\n"
+
+// EmptyRotationPolicy decides what a scheduled rotation does with an active
+// file that was not written to in its period.
+type EmptyRotationPolicy string
+
+const (
+	EmptyRotationReuse       EmptyRotationPolicy = "reuse"
+	EmptyRotationBackup      EmptyRotationPolicy = "backup"
+	EmptyRotationPlaceholder EmptyRotationPolicy = "placeholder"
+)
+
+func (p EmptyRotationPolicy) lower() EmptyRotationPolicy {
+	return EmptyRotationPolicy(strings.ToLower(string(p)))
+}
+
+// valid returns an error if its not valid
+func (p EmptyRotationPolicy) valid() error {
+	switch p {
+	case EmptyRotationReuse, EmptyRotationBackup, EmptyRotationPlaceholder:
+		return nil
+	default:
+		return fmt.Errorf("invalid empty rotation policy specified: %s, accepted values are %v",
+			p, []EmptyRotationPolicy{EmptyRotationReuse, EmptyRotationBackup, EmptyRotationPlaceholder})
+	}
+}
+
+// prepareEmptyRotation applies OnEmptyRotation to the active file before a
+// scheduled rotation, and reports if the rotation must be forced to back up
+// an empty file. It must be called with f.mu held.
+func (f *File) prepareEmptyRotation() (force bool, err error) {
+	if f.OnEmptyRotation == EmptyRotationReuse || f.file == nil || f.hasOutput() {
+		return false, nil
+	}
+	if f.OnEmptyRotation == EmptyRotationBackup {
+		return true, nil
+	}
+	placeholder := fmt.Sprintf(placeholderFormat, f.prevRotateAt.Format(time.RFC3339), f.rotateAt.Format(time.RFC3339))
+	if _, err := f.writeRaw([]byte(placeholder)); err != nil {
+		return false, fmt.Errorf("rotate placeholder error: %v", err)
+	}
+	return false, nil
+}
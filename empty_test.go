@@ -0,0 +1,55 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_OnEmptyRotation(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      EmptyRotationPolicy
+		wantBackups int
+		wantContent string
+	}{
+		{name: "reuse", policy: "", wantBackups: 0},
+		{name: "backup", policy: EmptyRotationBackup, wantBackups: 1, wantContent: ""},
+		{name: "placeholder", policy: "Placeholder", wantBackups: 1, wantContent: "--- logfeller: no output from 2021-03-04T10:00:00Z to 2021-03-04T11:00:00Z ---\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dirname, err := testutils.MkTestDir("File_OnEmptyRotation")
+			testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+			defer os.RemoveAll(dirname)
+
+			f := &File{Filename: filepath.Join(dirname, "app.log"), When: "h", BackupTimeFormat: ".2006-01-02T15", OnEmptyRotation: tt.policy}
+			defer f.Close()
+			now := time.Date(2021, 3, 4, 10, 15, 0, 0, time.UTC)
+			f.setNowFunc(func() time.Time { return now })
+			_, err = f.Write([]byte("line\n"))
+			testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+			testutils.TrueOrFatal(t, f.TruncateCurrent() == nil, "File.TruncateCurrent() should not fail")
+
+			now = now.Add(time.Hour)
+			_, err = f.Write([]byte("next\n"))
+			testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+			backups, err := f.ListBackups()
+			testutils.TrueOrFatal(t, err == nil && len(backups) == tt.wantBackups, "want %d backups, got %v, err = %v", tt.wantBackups, backups, err)
+			if tt.wantBackups > 0 {
+				b, err := ioutil.ReadFile(backups[0].Name)
+				testutils.TrueOrError(t, err == nil && string(b) == tt.wantContent, "want backup content %q, got %q, err = %v", tt.wantContent, b, err)
+			}
+			b, err := ioutil.ReadFile(f.Filename)
+			testutils.TrueOrError(t, err == nil && string(b) == "next\n", "want only the next period in the active file, got %q, err = %v", b, err)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ConfigError is returned when File is misconfigured. It holds every problem
+// found so they can all be fixed in a single pass.
+type ConfigError struct {
+	Errors []*FieldError
+}
+
+func (e *ConfigError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Error())
+	}
+	return "logfeller: invalid configuration: " + strings.Join(msgs, "; ")
+}
+
+// add records err against field, value is the offending value if any.
+func (e *ConfigError) add(field, value string, err error) {
+	e.Errors = append(e.Errors, &FieldError{Field: field, Value: value, Err: err})
+}
+
+// err returns e if it has any errors, nil otherwise.
+func (e *ConfigError) err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// FieldError is a problem with a single configuration field.
+type FieldError struct {
+	// Field is the JSON name of the field, with the index for entries of
+	// list fields such as "rotation_schedule[1]".
+	Field string
+	// Value is the offending value, if any.
+	Value string
+	// Line and Column are the position of the field in the YAML it was
+	// decoded from with the yamlnode package, zero otherwise.
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	var pos string
+	if e.Line > 0 {
+		pos = fmt.Sprintf("line %d, column %d: ", e.Line, e.Column)
+	}
+	if e.Value == "" {
+		return fmt.Sprintf("%s%s: %v", pos, e.Field, e.Err)
+	}
+	return fmt.Sprintf("%s%s \"%s\": %v", pos, e.Field, e.Value, e.Err)
+}
+
+func (e *FieldError) Unwrap() error { return e.Err }
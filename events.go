@@ -0,0 +1,116 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import "time"
+
+// EventType identifies the kind of Event.
+type EventType string
+
+const (
+	// EventBackupCollision is emitted when the backup filename of a
+	// rotation already exists.
+	EventBackupCollision EventType = "backup_collision"
+	// EventConfigWarning is emitted on init for configuration that works
+	// but is likely a mistake.
+	EventConfigWarning EventType = "config_warning"
+	// EventRotation is emitted after a file is rotated out, Filename is the
+	// backup it was rotated to.
+	EventRotation EventType = "rotation"
+	// EventIndexError is emitted when a time index checkpoint cannot be
+	// recorded or moved, the write or rotation itself is not affected.
+	EventIndexError EventType = "index_error"
+	// EventTruncate is emitted when the active file is emptied by
+	// TruncateCurrent.
+	EventTruncate EventType = "truncate"
+	// EventWriteError is emitted when writes made earlier cannot be written
+	// out, such as those held by Shards.
+	EventWriteError EventType = "write_error"
+	// EventBackupError is emitted when a rotated file cannot be backed up by
+	// BackgroundBackup, it is left in its staging file. It is also emitted
+	// for corrupt backups repaired by VerifyBackups.
+	EventBackupError EventType = "backup_error"
+	// EventRotationThrottled is emitted when a rotation is deferred or
+	// skipped as it comes within MinRotationInterval of the last one.
+	EventRotationThrottled EventType = "rotation_throttled"
+	// EventWriteAheadReplay is emitted when writes left in the write-ahead
+	// file by a previous run are replayed into the active file.
+	EventWriteAheadReplay EventType = "write_ahead_replay"
+	// EventLinkError is emitted when the CurrentLink cannot be updated, the
+	// write or rotation itself is not affected.
+	EventLinkError EventType = "link_error"
+	// EventStale is emitted when there were no writes for StaleAfter.
+	EventStale EventType = "stale"
+	// EventLowDiskSpace is emitted when there is not enough free space to
+	// compress a backup, which is left for a later trim, or to append to
+	// one, which is then kept apart with a sequence suffix.
+	EventLowDiskSpace EventType = "low_disk_space"
+	// EventQuotaExceeded is emitted when DailyQuotaBytes is exceeded.
+	EventQuotaExceeded EventType = "quota_exceeded"
+	// EventForeignRotation is emitted when the active file was rotated by
+	// something other than this File, such as another process writing to
+	// the same file, which likely needs a lock or a single owner.
+	EventForeignRotation EventType = "foreign_rotation"
+	// EventRotationAnomaly is emitted when rotations deviate from the
+	// schedule, see File.RotationAnomalies.
+	EventRotationAnomaly EventType = "rotation_anomaly"
+	// EventPeriodComplete is emitted for each backup of a period once the
+	// period is over and the backup is in its final form: backed up, merged,
+	// compressed if Compress is set, and moved to the Archiver if there is
+	// one, see File.NotifyPeriodComplete. Filename is where it ends up,
+	// downstream jobs can pick it up from there right away.
+	EventPeriodComplete EventType = "period_complete"
+	// EventPressure is emitted when File.Pressure crosses one of
+	// File.PressureThresholds.
+	EventPressure EventType = "pressure"
+)
+
+// Event describes something noteworthy that happened within File, and is
+// passed to File.OnEvent.
+type Event struct {
+	Type EventType
+	// Time is when the event happened.
+	Time time.Time
+	// Filename is the file the event is about.
+	Filename string
+	// Message is a human readable description of the event.
+	Message string
+	// Err is the error that caused the event, if any.
+	Err error
+	// Bytes and Lines are the number of bytes and lines written in the
+	// period that ended, for EventRotation. They are zero if the file was
+	// not written to by this File before it was rotated.
+	Bytes int64
+	Lines int64
+	// Rotation is the number of the rotation for EventRotation, if
+	// RotationCounter is set.
+	Rotation uint64
+	// Period is the start of the period whose backup is complete, for
+	// EventPeriodComplete.
+	Period time.Time
+	// Pressure is the Pressure of File as it crossed a threshold, for
+	// EventPressure.
+	Pressure float64
+}
+
+// emit sends e to f.OnEvent and the diagnostics logger if they are set,
+// filling in e.Time if it is empty. Events are sent one at a time, whichever
+// goroutine they come from.
+func (f *File) emit(e Event) {
+	if f.OnEvent == nil && f.diagnostics == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = f.nowFunc()
+	}
+	f.eventMu.Lock()
+	defer f.eventMu.Unlock()
+	if f.diagnostics != nil {
+		f.diagnostics(e)
+	}
+	if f.OnEvent != nil {
+		f.OnEvent(e)
+	}
+}
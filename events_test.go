@@ -0,0 +1,43 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_emit_serialised(t *testing.T) {
+	var inside, overlaps int32
+	var events []Event
+	f := &File{OnEvent: func(e Event) {
+		if atomic.AddInt32(&inside, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		time.Sleep(time.Millisecond)
+		events = append(events, e)
+		atomic.AddInt32(&inside, -1)
+	}}
+	f.setNowFunc(time.Now)
+
+	// as from writers, the StaleAfter timer and BackgroundBackup at once
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				f.emit(Event{Type: EventPressure})
+			}
+		}()
+	}
+	wg.Wait()
+	testutils.TrueOrError(t, overlaps == 0, "OnEvent was called concurrently %d times", overlaps)
+	testutils.TrueOrError(t, len(events) == 40, "OnEvent got %d events, want 40", len(events))
+}
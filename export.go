@@ -0,0 +1,130 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ExportArchive writes a tar.gz archive to w holding the backups of f with
+// data written from from until to, either of which may be zero for no
+// bound, and the part of the active file in that range as narrowed down by
+// its time index. Backups are decoded as with OpenBackup and are stored
+// under their names without the extensions of their encodings. Backups stored
+// by the Archiver are left out.
+func (f *File) ExportArchive(ctx context.Context, from, to time.Time, w io.Writer) error {
+	if err := f.Flush(); err != nil {
+		return err
+	}
+	backups, err := f.BackupsBetween(from, to)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	for _, b := range backups {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if b.Remote {
+			// already stored away by the Archiver
+			continue
+		}
+		rc, err := OpenBackup(b.Name)
+		if os.IsNotExist(err) {
+			// trimmed in the meantime
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.Base(b.Name), b.Encoded)
+		err = addArchiveEntry(ctx, tw, name, b.Name, rc, b.Encoded == "")
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if active := f.readActive(from, to, len(backups) == 0); active != nil {
+		rc, err := active()
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return err
+		default:
+			err = addArchiveEntry(ctx, tw, filepath.Base(f.Filename), f.Filename, rc, false)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// addArchiveEntry adds the content of r to tw as name, with the mode and
+// modification time of the file src. If sized is false, the size of the
+// content is not known and it is spooled to a temporary file first.
+func addArchiveEntry(ctx context.Context, tw *tar.Writer, name, src string, r io.Reader, sized bool) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if !sized {
+		tmp, err := ioutil.TempFile("", "logfeller-export-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		if size, err = io.Copy(tmp, ctxReader{ctx: ctx, r: r}); err != nil {
+			return fmt.Errorf("unable to spool %s for export: %v", src, err)
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		r = tmp
+	}
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(info.Mode().Perm()),
+		Size:     size,
+		ModTime:  info.ModTime(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(tw, ctxReader{ctx: ctx, r: r}, size); err != nil {
+		return fmt.Errorf("unable to export %s: %v", src, err)
+	}
+	return nil
+}
+
+// ctxReader reads from r until ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
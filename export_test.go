@@ -0,0 +1,62 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_ExportArchive(t *testing.T) {
+	dirname, err := testutils.MkTestDir("ExportArchive")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), IndexInterval: Duration(time.Minute), BufferSize: 1024}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+	for _, line := range []string{"one", "two", "three", "four", "five"} {
+		_, err := f.Write([]byte(line + "\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		now = now.Add(12 * time.Hour)
+	}
+	// backups of one and two, three and four, the active file holds five
+	gzipFile(t, filepath.Join(dirname, "app.2021-03-04T0000-00.log"))
+
+	var buf bytes.Buffer
+	from := time.Date(2021, time.March, 4, 12, 0, 0, 0, time.UTC)
+	testutils.TrueOrFatal(t, f.ExportArchive(context.Background(), from, time.Time{}, &buf) == nil, "File.ExportArchive() should not fail")
+	zr, err := gzip.NewReader(&buf)
+	testutils.TrueOrFatal(t, err == nil, "archive should be gzipped: %v", err)
+	tr := tar.NewReader(zr)
+	got := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		testutils.TrueOrFatal(t, err == nil, "invalid archive: %v", err)
+		b, err := ioutil.ReadAll(tr)
+		testutils.TrueOrFatal(t, err == nil, "invalid archive entry %s: %v", hdr.Name, err)
+		got[hdr.Name] = string(b)
+	}
+	want := map[string]string{
+		"app.2021-03-04T0000-00.log": "one\ntwo\n",
+		"app.2021-03-05T0000-00.log": "three\nfour\n",
+		"app.log":                    "five\n",
+	}
+	testutils.TrueOrError(t, reflect.DeepEqual(got, want), "File.ExportArchive() entries = %v, want %v", got, want)
+}
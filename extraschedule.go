@@ -0,0 +1,62 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// ScheduleGroup is a rotation schedule with a When of its own, see
+// ExtraSchedules. RotationSchedule is as with File, and defaults the same
+// way if it is empty.
+type ScheduleGroup struct {
+	When             WhenRotate `json:"when" yaml:"when" mapstructure:"when"`
+	RotationSchedule []string   `json:"rotation_schedule" yaml:"rotation-schedule" mapstructure:"rotation_schedule"`
+}
+
+// scheduleGroup is a parsed ScheduleGroup.
+type scheduleGroup struct {
+	when WhenRotate
+	// times are sorted.
+	times []timeSchedule
+}
+
+// initExtraSchedules parses ExtraSchedules, adding the problems found to
+// errs.
+func (f *File) initExtraSchedules(errs *ConfigError) {
+	f.extraSchedules = make([]scheduleGroup, 0, len(f.ExtraSchedules))
+	if len(f.ExtraSchedules) > 0 && (f.Every > 0 || f.AnchorToCreation) {
+		errs.add("extra_schedules", strconv.Itoa(len(f.ExtraSchedules)), fmt.Errorf("extra schedules cannot be used with every or anchor_to_creation"))
+		return
+	}
+	for i, g := range f.ExtraSchedules {
+		field := fmt.Sprintf("extra_schedules[%d]", i)
+		when := g.When.lower()
+		if err := when.valid(); err != nil {
+			errs.add(field+".when", string(g.When), err)
+			continue
+		}
+		group := scheduleGroup{when: when, times: make([]timeSchedule, 0, len(g.RotationSchedule))}
+		for j, schedule := range g.RotationSchedule {
+			sch, err := when.parseTimeSchedule(schedule)
+			if err == nil && f.DayOverflow == DayOverflowError {
+				err = when.scheduleAlwaysExists(sch)
+			}
+			if err != nil {
+				errs.add(fmt.Sprintf("%s.rotation_schedule[%d]", field, j), schedule, err)
+				continue
+			}
+			group.times = append(group.times, sch)
+		}
+		if len(g.RotationSchedule) == 0 {
+			group.times = append(group.times, when.baseRotateTime())
+		}
+		sort.Sort(timeSchedules(group.times))
+		f.ExtraSchedules[i].When = when
+		f.extraSchedules = append(f.extraSchedules, group)
+	}
+}
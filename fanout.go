@@ -0,0 +1,85 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Fanout duplicates every write to each of its Files, such as a local debug
+// file rotated hourly alongside a daily archive on NFS. Each File rotates,
+// trims and fails on its own: a File failing a write does not keep it from
+// the others.
+type Fanout struct {
+	// Files are the destinations of the writes, written to in order.
+	Files []*File `json:"files" yaml:"files" mapstructure:"files"`
+	// BestEffort, if true, makes a write succeed as long as one of Files
+	// took it. The Files that failed it report it with an EventWriteError
+	// instead. Otherwise a write fails with a FanoutError if any of them
+	// failed it.
+	BestEffort bool `json:"best_effort" yaml:"best-effort" mapstructure:"best_effort"`
+}
+
+// FanoutError is returned by Fanout when some of its Files failed a write,
+// the others have it written.
+type FanoutError struct {
+	// Failed are the Files that failed, with their errors at the same index
+	// in Errors.
+	Failed []*File
+	Errors []error
+}
+
+func (e *FanoutError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", e.Failed[i].Filename, err))
+	}
+	return fmt.Sprintf("logfeller: write failed for %d files: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Write writes p to each of the Files.
+func (o *Fanout) Write(p []byte) (int, error) {
+	return o.WriteContext(context.Background(), p)
+}
+
+// WriteContext is like Write, but gives up on a File if ctx is done before
+// the file is free to write to, see File.WriteContext.
+func (o *Fanout) WriteContext(ctx context.Context, p []byte) (int, error) {
+	var ferr FanoutError
+	written := len(p)
+	for _, f := range o.Files {
+		n, err := f.WriteContext(ctx, p)
+		if err == nil {
+			continue
+		}
+		ferr.Failed, ferr.Errors = append(ferr.Failed, f), append(ferr.Errors, err)
+		if n < written {
+			written = n
+		}
+	}
+	if len(ferr.Errors) == 0 {
+		return len(p), nil
+	}
+	if o.BestEffort && len(ferr.Errors) < len(o.Files) {
+		for i, f := range ferr.Failed {
+			f.emit(Event{Type: EventWriteError, Filename: f.Filename, Message: "unable to write fanout write", Err: ferr.Errors[i]})
+		}
+		return len(p), nil
+	}
+	return written, &ferr
+}
+
+// Close closes each of the Files.
+func (o *Fanout) Close() error {
+	var errs multipleErrors
+	for _, f := range o.Files {
+		if err := f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.err()
+}
@@ -0,0 +1,59 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFanout(t *testing.T) {
+	dirname, err := testutils.MkTestDir("Fanout")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+
+	now := time.Date(2021, 3, 4, 10, 15, 0, 0, time.UTC)
+	hourly := &File{Filename: filepath.Join(dirname, "debug.log"), When: "h"}
+	daily := &File{Filename: filepath.Join(dirname, "archive.log"), When: "d"}
+	for _, f := range []*File{hourly, daily} {
+		f.setNowFunc(func() time.Time { return now })
+	}
+	o := &Fanout{Files: []*File{hourly, daily}}
+	defer o.Close()
+	for i := 0; i < 2; i++ {
+		n, err := o.Write([]byte("line\n"))
+		testutils.TrueOrFatal(t, err == nil && n == 5, "Fanout.Write() = %d, %v", n, err)
+		now = now.Add(time.Hour)
+	}
+	for _, tt := range []struct {
+		f           *File
+		wantBackups int
+	}{{hourly, 1}, {daily, 0}} {
+		backups, err := tt.f.ListBackups()
+		testutils.TrueOrError(t, err == nil && len(backups) == tt.wantBackups, "want %d backups of %s, got %v, err = %v", tt.wantBackups, tt.f.Filename, backups, err)
+	}
+
+	// a file in the way of its directory fails every write
+	blocker := filepath.Join(dirname, "blocker")
+	testutils.TrueOrFatal(t, ioutil.WriteFile(blocker, nil, 0644) == nil, "should not fail at creating %s", blocker)
+	var events []Event
+	broken := &File{Filename: filepath.Join(blocker, "app.log"), OnEvent: func(e Event) { events = append(events, e) }}
+	o.Files = append(o.Files, broken)
+	_, err = o.Write([]byte("line\n"))
+	ferr, ok := err.(*FanoutError)
+	testutils.TrueOrFatal(t, ok && len(ferr.Failed) == 1 && ferr.Failed[0] == broken, "want a FanoutError for the broken file, got %v", err)
+
+	o.BestEffort = true
+	n, err := o.Write([]byte("line\n"))
+	testutils.TrueOrError(t, err == nil && n == 5, "want the write to succeed on the other files, got %d, %v", n, err)
+	testutils.TrueOrError(t, len(events) == 1 && events[0].Type == EventWriteError, "want an EventWriteError from the broken file, got %v", events)
+	b, err := ioutil.ReadFile(daily.Filename)
+	testutils.TrueOrError(t, err == nil && string(b) == "line\nline\nline\nline\n", "want every write in the daily file, got %q, err = %v", b, err)
+}
@@ -0,0 +1,46 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// openFIFO opens Filename, which is a named pipe, for writing. It is opened
+// without blocking for a reader, and fails if there is none.
+func (f *File) openFIFO() error {
+	fh, err := os.OpenFile(f.Filename, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if errors.Is(err, syscall.ENXIO) {
+		return fmt.Errorf("no reader on named pipe %s", f.Filename)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to open named pipe %s: %v", f.Filename, err)
+	}
+	f.fifo = true
+	f.setFile(fh)
+	return nil
+}
+
+// checkFIFO closes a named pipe that lost its reader after a write or flush
+// failed with err, so that the next write opens it again for a new reader.
+func (f *File) checkFIFO(err error) {
+	if !f.fifo || !errors.Is(err, syscall.EPIPE) {
+		return
+	}
+	if f.buf != nil {
+		// what is left in the buffer is lost with the reader
+		f.buf.Reset(f.file)
+		f.resetWriteAhead()
+	}
+	_ = f.file.Close()
+	f.file = nil
+	f.emit(Event{Type: EventWriteError, Filename: f.Filename, Message: "reader of named pipe went away, reopening on the next write", Err: err})
+}
+
+// isFIFO reports if info is of a named pipe.
+func isFIFO(info os.FileInfo) bool { return info.Mode()&os.ModeNamedPipe != 0 }
@@ -0,0 +1,62 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_FIFO(t *testing.T) {
+	dirname, err := testutils.MkTestDir("FIFO")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	filename := filepath.Join(dirname, "app.log")
+	testutils.TrueOrFatal(t, syscall.Mkfifo(filename, 0600) == nil, "should not fail at creating named pipe")
+
+	f := &File{Filename: filename, When: "h", IndexBytes: 1}
+	defer f.Close()
+	_, err = f.Write([]byte("nobody\n"))
+	testutils.TrueOrFatal(t, err != nil && strings.Contains(err.Error(), "no reader"), "File.Write() without a reader should fail, err = %v", err)
+
+	read := func(want string) {
+		r, err := os.OpenFile(filename, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+		testutils.TrueOrFatal(t, err == nil, "failed to open reader: %v", err)
+		defer r.Close()
+		_, err = f.Write([]byte(want))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		testutils.TrueOrError(t, f.ForceRotate() == nil, "File.ForceRotate() should be a no-op")
+		b := make([]byte, 64)
+		n, err := r.Read(b)
+		testutils.TrueOrFatal(t, err == nil && string(b[:n]) == want, "read %q, err = %v, want %q", b[:n], err, want)
+	}
+	read("first\n")
+	// the reader went away, the next write fails and the one after that
+	// reaches the new reader
+	_, err = f.Write([]byte("lost\n"))
+	testutils.TrueOrError(t, err != nil, "File.Write() after the reader went away should fail")
+	read("second\n")
+	// batches reopen it just the same
+	_, err = f.WriteBatch([][]byte{[]byte("lost\n"), []byte("too\n")})
+	testutils.TrueOrError(t, err != nil, "File.WriteBatch() after the reader went away should fail")
+	read("third\n")
+
+	infos, err := ioutil.ReadDir(dirname)
+	testutils.TrueOrFatal(t, err == nil, "failed to read dir: %v", err)
+	testutils.TrueOrError(t, len(infos) == 1 && infos[0].Name() == "app.log", "named pipe should not be rotated, got %d files", len(infos))
+
+	testutils.TrueOrFatal(t, f.RemoveAll() == nil, "File.RemoveAll() should not fail")
+	info, err := os.Stat(filename)
+	testutils.TrueOrError(t, err == nil && isFIFO(info), "named pipe should be left by RemoveAll, err = %v", err)
+}
@@ -0,0 +1,57 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// foreignRotationHint is appended to the messages of EventForeignRotation.
+const foreignRotationHint = "; is another process or logrotate rotating the same file? Only one should own its rotation, or they must share a lock"
+
+// checkForeignRotation emits an EventForeignRotation if the active file was
+// moved away or replaced since f opened it, which happens when another
+// process rotates the same file. It must be called with f.mu held, before f
+// rotates the file itself.
+func (f *File) checkForeignRotation() {
+	if f.file == nil {
+		return
+	}
+	fdInfo, err := f.file.Stat()
+	if err != nil {
+		return
+	}
+	pathInfo, err := os.Stat(f.Filename)
+	switch {
+	case os.IsNotExist(err):
+		f.emitForeignRotation(fmt.Sprintf("%s was moved away while it was open", f.Filename))
+	case err == nil && !os.SameFile(fdInfo, pathInfo):
+		f.emitForeignRotation(fmt.Sprintf("%s was replaced by another file while it was open", f.Filename))
+	}
+}
+
+// checkForeignCount emits an EventForeignRotation if the RotationCounter
+// was advanced by someone else since f last counted a rotation, and carries
+// on from the count on disk so that the counter stays monotonic.
+func (f *File) checkForeignCount() {
+	b, err := ioutil.ReadFile(f.rotationsFilename())
+	if err != nil {
+		return
+	}
+	onDisk, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil || onDisk <= f.rotations {
+		return
+	}
+	f.emitForeignRotation(fmt.Sprintf("%d rotations of %s were counted by someone else", onDisk-f.rotations, f.Filename))
+	f.rotations = onDisk
+}
+
+func (f *File) emitForeignRotation(msg string) {
+	f.emit(Event{Type: EventForeignRotation, Filename: f.Filename, Message: msg + foreignRotationHint})
+}
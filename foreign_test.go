@@ -0,0 +1,58 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_ForeignRotation(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_ForeignRotation")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	var foreign []Event
+	newFile := func() *File {
+		f := &File{Filename: filepath.Join(dirname, "app.log"), RotationCounter: true, NoGoroutines: true, OnEvent: func(e Event) {
+			if e.Type == EventForeignRotation {
+				foreign = append(foreign, e)
+			}
+		}}
+		f.setNowFunc(func() time.Time { return now })
+		return f
+	}
+	write := func(f *File) {
+		_, err := f.Write([]byte("line\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	}
+
+	a, b := newFile(), newFile()
+	defer a.Close()
+	defer b.Close()
+	write(a)
+	write(b)
+	testutils.TrueOrFatal(t, a.ForceRotate() == nil, "File.ForceRotate() should not fail")
+	testutils.TrueOrError(t, len(foreign) == 0, "want no foreign rotation for the first rotation, got %v", foreign)
+
+	testutils.TrueOrFatal(t, b.ForceRotate() == nil, "File.ForceRotate() should not fail")
+	testutils.TrueOrFatal(t, len(foreign) == 2, "want the file replaced and the counter advanced to be reported, got %v", foreign)
+	testutils.TrueOrError(t, strings.Contains(foreign[0].Message, "replaced"), "want the active file replaced, got %q", foreign[0].Message)
+	testutils.TrueOrError(t, strings.Contains(foreign[1].Message, "1 rotations"), "want a rotation counted by someone else, got %q", foreign[1].Message)
+	testutils.TrueOrError(t, b.Stats().Rotations == 2, "Stats().Rotations = %d, want 2 as the counter carries on from the other File", b.Stats().Rotations)
+
+	// as logrotate would, without creating a new file
+	foreign = nil
+	write(a)
+	err = os.Rename(a.Filename, a.Filename+".1")
+	testutils.TrueOrFatal(t, err == nil, "failed to move the active file: %v", err)
+	testutils.TrueOrFatal(t, a.ForceRotate() == nil, "File.ForceRotate() should not fail")
+	testutils.TrueOrError(t, len(foreign) == 2 && strings.Contains(foreign[0].Message, "moved away"), "want the active file moved away to be reported, got %v", foreign)
+}
@@ -2,4 +2,11 @@ module github.com/lohvht/logfeller
 
 go 1.16
 
-require gopkg.in/yaml.v2 v2.4.0
+require (
+	github.com/BurntSushi/toml v1.2.1
+	github.com/golang/snappy v0.0.4
+	github.com/hashicorp/hcl v1.0.0
+	github.com/mitchellh/mapstructure v1.5.0
+	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
+)
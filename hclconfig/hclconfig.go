@@ -0,0 +1,138 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+// Package hclconfig decodes logfeller configuration from HCL. Importing it
+// registers the ".hcl" format with logfeller.LoadConfig, where each File is a
+// block labelled with its name:
+//
+//	max_open = 10
+//	files "app" {
+//	  filename = "/var/log/app/app.log"
+//	}
+//
+// It is kept apart from logfeller so that only its users depend on HCL.
+package hclconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/lohvht/logfeller"
+)
+
+func init() {
+	logfeller.RegisterConfigFormat(".hcl", decodeHCL)
+}
+
+// Unmarshal decodes f from the HCL in data and initialises it, as
+// File.UnmarshalJSON and File.UnmarshalYAML do. Fields are set with
+// attributes named with either the JSON or YAML names of fields, and extra
+// schedules with a list of objects:
+//
+//	filename = "/var/log/app/app.log"
+//	when     = "h"
+//	extra_schedules = [{ when = "d" }]
+func Unmarshal(data []byte, f *logfeller.File) error {
+	raw, err := decodeHCL(data)
+	if err != nil {
+		return err
+	}
+	renameKeys(raw)
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, f)
+}
+
+// decodeHCL decodes the HCL in data to maps, as JSON would be. Blocks are
+// objects nested under each of their labels, and blocks and attributes of
+// the same name are merged.
+func decodeHCL(data []byte) (map[string]interface{}, error) {
+	file, err := hcl.ParseBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := file.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("invalid HCL: expected a list of attributes and blocks")
+	}
+	return hclObject(list)
+}
+
+func hclObject(list *ast.ObjectList) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	for _, item := range list.Items {
+		v, err := hclValue(item.Val)
+		if err != nil {
+			return nil, err
+		}
+		// blocks with labels nest the value under each of them
+		for i := len(item.Keys) - 1; i > 0; i-- {
+			v = map[string]interface{}{hclKey(item.Keys[i]): v}
+		}
+		key := hclKey(item.Keys[0])
+		dst, dstOK := m[key].(map[string]interface{})
+		src, srcOK := v.(map[string]interface{})
+		if dstOK && srcOK {
+			mergeConfig(dst, src)
+			continue
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+func hclKey(k *ast.ObjectKey) string {
+	return fmt.Sprint(k.Token.Value())
+}
+
+func hclValue(n ast.Node) (interface{}, error) {
+	switch n := n.(type) {
+	case *ast.LiteralType:
+		return n.Token.Value(), nil
+	case *ast.ObjectType:
+		return hclObject(n.List)
+	case *ast.ListType:
+		l := make([]interface{}, 0, len(n.List))
+		for _, elem := range n.List {
+			v, err := hclValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, v)
+		}
+		return l, nil
+	default:
+		return nil, fmt.Errorf("invalid HCL: unsupported value at %s", n.Pos())
+	}
+}
+
+// renameKeys renames the keys of m from the YAML names of fields to their
+// JSON names.
+func renameKeys(m map[string]interface{}) {
+	for k, v := range m {
+		if jsonKey := strings.ReplaceAll(k, "-", "_"); jsonKey != k {
+			delete(m, k)
+			m[jsonKey] = v
+		}
+	}
+}
+
+// mergeConfig merges src into dst, maps are merged key by key while other
+// values in src replace those in dst.
+func mergeConfig(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcMap, srcOK := v.(map[string]interface{})
+		dstMap, dstOK := dst[k].(map[string]interface{})
+		if srcOK && dstOK {
+			mergeConfig(dstMap, srcMap)
+			continue
+		}
+		dst[k] = v
+	}
+}
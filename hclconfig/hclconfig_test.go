@@ -0,0 +1,70 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package hclconfig
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller"
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestUnmarshal(t *testing.T) {
+	f := &logfeller.File{}
+	err := Unmarshal([]byte(`
+filename = "app.log"
+when = "h"
+rotation-schedule = ["30:00"]
+extra_schedules = [{ when = "d" }]
+min_rotation_interval = "1m"
+backups = 3
+compress = true
+`), f)
+	testutils.TrueOrFatal(t, err == nil, "Unmarshal() error = %v", err)
+	testutils.TrueOrError(t, f.When == logfeller.Hour && len(f.RotationSchedule) == 1 && len(f.ExtraSchedules) == 1,
+		"Unmarshal() schedules = %v, extra = %v", f.RotationSchedule, f.ExtraSchedules)
+	testutils.TrueOrError(t, f.MinRotationInterval == logfeller.Duration(time.Minute) && f.Backups == 3 && f.Compress,
+		"Unmarshal() = %#v", f)
+
+	err = Unmarshal([]byte(`when = "x"`), &logfeller.File{})
+	testutils.TrueOrError(t, err != nil && strings.Contains(err.Error(), "when"), "Unmarshal() should fail validation, got %v", err)
+	err = Unmarshal([]byte(`when = "h`), &logfeller.File{})
+	testutils.TrueOrError(t, err != nil, "Unmarshal() should fail on invalid HCL")
+}
+
+func TestLoadConfig(t *testing.T) {
+	dirname, err := testutils.MkTestDir("hclconfig_LoadConfig")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	write := func(name, content string) string {
+		name = filepath.Join(dirname, name)
+		testutils.TrueOrFatal(t, ioutil.WriteFile(name, []byte(content), 0600) == nil, "failed to write %s", name)
+		return name
+	}
+	write("common.yaml", "max-open: 10\nfiles:\n  app:\n    when: h\n    backups: 3\n")
+	m, err := logfeller.LoadConfig(write("app.hcl", `
+include = ["common.yaml"]
+
+files "app" {
+  filename = "app.log"
+  backups  = 5
+}
+
+files "audit-trail" {
+  filename = "audit.log"
+}
+`))
+	testutils.TrueOrFatal(t, err == nil, "LoadConfig() error = %v", err)
+	app, other := m.Files["app"], m.Files["audit-trail"]
+	testutils.TrueOrFatal(t, len(m.Files) == 2 && app != nil && other != nil, "LoadConfig() files = %v", m.Files)
+	testutils.TrueOrError(t, m.MaxOpen == 10 && app.Backups == 5 && app.When == logfeller.Hour,
+		"LoadConfig() MaxOpen = %d, app = %#v, want settings merged over the include", m.MaxOpen, app)
+	testutils.TrueOrError(t, other.When == logfeller.Day && other.Backups == 0, "LoadConfig() audit-trail = %#v, want defaults", other)
+}
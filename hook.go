@@ -0,0 +1,101 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+)
+
+// WriteHook is a stage of the WriteHooks of a File. It is given a write and
+// returns what is written instead, which is passed on to the next stage. A
+// write is dropped if a stage returns nothing, and fails with the error a
+// stage returns. p must not be modified, stages that change it return a new
+// slice. Stages are called concurrently by concurrent writes.
+type WriteHook func(ctx context.Context, p []byte) ([]byte, error)
+
+// runHooks passes p through the hooks of f, returning nil if it is dropped.
+func (f *File) runHooks(ctx context.Context, p []byte) ([]byte, error) {
+	for _, hook := range f.hooks {
+		var err error
+		if p, err = hook(ctx, p); err != nil || len(p) == 0 {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// runBatchHooks passes each of ps through the hooks of f, leaving out those
+// that are dropped.
+func (f *File) runBatchHooks(ctx context.Context, ps [][]byte) ([][]byte, error) {
+	if len(f.hooks) == 0 {
+		return ps, nil
+	}
+	kept := make([][]byte, 0, len(ps))
+	for _, p := range ps {
+		p, err := f.runHooks(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			kept = append(kept, p)
+		}
+	}
+	return kept, nil
+}
+
+// FilterHook returns a WriteHook that drops the writes keep reports false
+// for.
+func FilterHook(keep func(p []byte) bool) WriteHook {
+	return func(_ context.Context, p []byte) ([]byte, error) {
+		if !keep(p) {
+			return nil, nil
+		}
+		return p, nil
+	}
+}
+
+// PrefixHook returns a WriteHook that adds prefix to the start of every line
+// of a write, such as the name of the host or service.
+func PrefixHook(prefix string) WriteHook {
+	return func(_ context.Context, p []byte) ([]byte, error) {
+		lines := bytes.Count(p, []byte{'\n'})
+		if len(p) > 0 && p[len(p)-1] != '\n' {
+			lines++
+		}
+		b := make([]byte, 0, len(p)+lines*len(prefix))
+		for len(p) > 0 {
+			i := bytes.IndexByte(p, '\n') + 1
+			if i == 0 {
+				i = len(p)
+			}
+			b = append(append(b, prefix...), p[:i]...)
+			p = p[i:]
+		}
+		return b, nil
+	}
+}
+
+// RedactHook returns a WriteHook that replaces the matches of re in a write
+// with repl, as with regexp.Regexp.ReplaceAll, such as to mask secrets.
+func RedactHook(re *regexp.Regexp, repl string) WriteHook {
+	replacement := []byte(repl)
+	return func(_ context.Context, p []byte) ([]byte, error) {
+		if !re.Match(p) {
+			return p, nil
+		}
+		return re.ReplaceAll(p, replacement), nil
+	}
+}
+
+// ObserveHook returns a WriteHook that passes writes to observe and on as
+// they are, such as to count them in metrics.
+func ObserveHook(observe func(p []byte)) WriteHook {
+	return func(_ context.Context, p []byte) ([]byte, error) {
+		observe(p)
+		return p, nil
+	}
+}
@@ -0,0 +1,59 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_WriteHooks(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_WriteHooks")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+
+	var observed int
+	errRejected := errors.New("rejected")
+	f := &File{
+		Filename: filepath.Join(dirname, "app.log"),
+		WriteHooks: []WriteHook{
+			FilterHook(func(p []byte) bool { return !bytes.HasPrefix(p, []byte("debug")) }),
+			func(_ context.Context, p []byte) ([]byte, error) {
+				if bytes.HasPrefix(p, []byte("reject")) {
+					return nil, errRejected
+				}
+				return p, nil
+			},
+			RedactHook(regexp.MustCompile(`password=\S+`), "password=***"),
+			PrefixHook("host1 "),
+			ObserveHook(func(p []byte) { observed += len(p) }),
+		},
+	}
+	defer f.Close()
+
+	for _, line := range []string{"debug noise\n", "login password=hunter2\n", "two\nlines"} {
+		n, err := f.Write([]byte(line))
+		testutils.TrueOrFatal(t, err == nil && n == len(line), "File.Write() = %d, error = %v, want %d", n, err, len(line))
+	}
+	n, err := f.Write([]byte("reject this\n"))
+	testutils.TrueOrError(t, n == 0 && err == errRejected, "File.Write() = %d, error = %v, want the error of the hook", n, err)
+	batch := [][]byte{[]byte("debug more\n"), []byte("\nbatched\n")}
+	n, err = f.WriteBatch(batch)
+	testutils.TrueOrFatal(t, err == nil && n == 20, "File.WriteBatch() = %d, error = %v, want 20", n, err)
+
+	want := "host1 login password=***\nhost1 two\nhost1 lines" + "host1 \nhost1 batched\n"
+	b, err := ioutil.ReadFile(f.Filename)
+	testutils.TrueOrFatal(t, err == nil, "failed to read file: %v", err)
+	testutils.TrueOrError(t, string(b) == want, "file = %q, want %q", b, want)
+	testutils.TrueOrError(t, observed == len(want), "observed %d bytes, want %d", observed, len(want))
+}
@@ -0,0 +1,158 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// indexSuffix is appended to a filename to get the filename of its time
+// index sidecar.
+const indexSuffix = ".idx"
+
+// IndexCheckpoint records that the data at Offset onwards was written at or
+// after Time, and everything before Offset was written before Time.
+type IndexCheckpoint struct {
+	Offset int64     `json:"offset"`
+	Time   time.Time `json:"time"`
+}
+
+// IndexFilename returns the filename of the time index sidecar of name, which
+// may be the active file or a backup.
+func IndexFilename(name string) string { return name + indexSuffix }
+
+// ReadTimeIndex reads the checkpoints in the time index sidecar of name, in
+// the order they were written.
+func ReadTimeIndex(name string) ([]IndexCheckpoint, error) {
+	fh, err := os.Open(IndexFilename(name))
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	var index []IndexCheckpoint
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		var c IndexCheckpoint
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			return index, fmt.Errorf("invalid time index %s: %v", IndexFilename(name), err)
+		}
+		index = append(index, c)
+	}
+	return index, scanner.Err()
+}
+
+// IndexOffset returns the offset to start reading from to find data written
+// at or after t, which is the offset of the last checkpoint at or before t.
+// It returns 0 if there is no such checkpoint.
+func IndexOffset(index []IndexCheckpoint, t time.Time) int64 {
+	i := sort.Search(len(index), func(i int) bool { return index[i].Time.After(t) })
+	if i == 0 {
+		return 0
+	}
+	return index[i-1].Offset
+}
+
+// indexing reports if f records time index checkpoints.
+func (f *File) indexing() bool { return (f.IndexInterval > 0 || f.IndexBytes > 0) && !f.fifo }
+
+// checkpoint records an index checkpoint at the current offset if one is due.
+// Failing to record a checkpoint does not fail the write, it is reported with
+// an EventIndexError instead.
+func (f *File) checkpoint() {
+	if !f.indexing() {
+		return
+	}
+	now := f.time(f.nowFunc())
+	if !f.lastCheckpoint.IsZero() {
+		bytesDue := f.IndexBytes > 0 && f.fileOffset-f.lastCheckpointOffset >= f.IndexBytes
+		timeDue := f.IndexInterval > 0 && f.fileOffset > f.lastCheckpointOffset &&
+			now.Sub(f.lastCheckpoint) >= time.Duration(f.IndexInterval)
+		if !bytesDue && !timeDue {
+			return
+		}
+	}
+	f.lastCheckpoint, f.lastCheckpointOffset = now, f.fileOffset
+	if err := appendIndex(f.Filename, []IndexCheckpoint{{Offset: f.fileOffset, Time: now}}, 0); err != nil {
+		f.emit(Event{Type: EventIndexError, Filename: IndexFilename(f.Filename), Message: "unable to record time index checkpoint", Err: err})
+	}
+}
+
+// appendIndex appends checkpoints to the time index of name, with their
+// offsets shifted by shift.
+func appendIndex(name string, checkpoints []IndexCheckpoint, shift int64) error {
+	fh, err := os.OpenFile(IndexFilename(name), fileWriteCreateAppendFlag, fileOpenMode)
+	if err != nil {
+		return err
+	}
+	var b []byte
+	for _, c := range checkpoints {
+		c.Offset += shift
+		line, err := json.Marshal(c)
+		if err != nil {
+			fh.Close()
+			return err
+		}
+		b = append(append(b, line...), '\n')
+	}
+	if _, err := fh.Write(b); err != nil {
+		fh.Close()
+		return err
+	}
+	return fh.Close()
+}
+
+// renameIndex moves the time index of src to that of dst,
+// replacing any existing one.
+func renameIndex(src, dst string) error {
+	err := os.Rename(IndexFilename(src), IndexFilename(dst))
+	if os.IsNotExist(err) {
+		return removeIndex(dst)
+	}
+	return err
+}
+
+// appendIndexTo appends the time index of src to that of dst, where src was
+// appended to dst at offset shift.
+func appendIndexTo(src, dst string, shift int64) error {
+	index, err := ReadTimeIndex(src)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := appendIndex(dst, index, shift); err != nil {
+		return err
+	}
+	return removeIndex(src)
+}
+
+// removeIndex removes the time index of name if there is one.
+func removeIndex(name string) error {
+	err := os.Remove(IndexFilename(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// resetIndex resets the checkpoint state for a newly opened file of size.
+func (f *File) resetIndex(size int64) {
+	f.fileOffset = size
+	f.lastCheckpoint, f.lastCheckpointOffset = time.Time{}, 0
+	if !f.indexing() {
+		return
+	}
+	// continue from the last checkpoint of an existing file
+	if index, err := ReadTimeIndex(f.Filename); err == nil && len(index) > 0 {
+		last := index[len(index)-1]
+		f.lastCheckpoint, f.lastCheckpointOffset = last.Time, last.Offset
+	}
+}
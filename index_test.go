@@ -0,0 +1,79 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestIndexOffset(t *testing.T) {
+	base := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	index := []IndexCheckpoint{
+		{Offset: 0, Time: base},
+		{Offset: 100, Time: base.Add(time.Minute)},
+		{Offset: 250, Time: base.Add(2 * time.Minute)},
+	}
+	tests := []struct {
+		name string
+		t    time.Time
+		want int64
+	}{
+		{name: "before_first", t: base.Add(-time.Second), want: 0},
+		{name: "on_first", t: base, want: 0},
+		{name: "between", t: base.Add(90 * time.Second), want: 100},
+		{name: "on_checkpoint", t: base.Add(2 * time.Minute), want: 250},
+		{name: "after_last", t: base.Add(time.Hour), want: 250},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IndexOffset(index, tt.t); got != tt.want {
+				t.Errorf("IndexOffset() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFile_timeIndex(t *testing.T) {
+	dirname, err := testutils.MkTestDir("timeIndex")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), IndexBytes: 8, IndexInterval: Duration(time.Hour)}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+
+	write := func(s string) {
+		_, err := f.Write([]byte(s))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		now = now.Add(time.Minute)
+	}
+	write("aaaa\n") // first write, checkpoint at 0
+	write("bbbb\n") // 5 bytes since checkpoint, none
+	write("cccc\n") // 10 bytes since checkpoint, checkpoint at 10
+	now = now.Add(time.Hour)
+	write("dddd\n") // an hour since checkpoint, checkpoint at 15
+	want := []IndexCheckpoint{
+		{Offset: 0, Time: time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)},
+		{Offset: 10, Time: time.Date(2021, time.March, 4, 10, 2, 0, 0, time.UTC)},
+		{Offset: 15, Time: time.Date(2021, time.March, 4, 11, 3, 0, 0, time.UTC)},
+	}
+	got, err := ReadTimeIndex(f.Filename)
+	testutils.TrueOrFatal(t, err == nil, "ReadTimeIndex() error = %v", err)
+	testutils.TrueOrError(t, reflect.DeepEqual(got, want), "ReadTimeIndex() = %v, want %v", got, want)
+
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	backup := filepath.Join(dirname, "app.2021-03-04T0000-00.log")
+	got, err = ReadTimeIndex(backup)
+	testutils.TrueOrFatal(t, err == nil, "ReadTimeIndex() of backup error = %v", err)
+	testutils.TrueOrError(t, reflect.DeepEqual(got, want), "ReadTimeIndex() of backup = %v, want %v", got, want)
+	_, err = os.Stat(IndexFilename(f.Filename))
+	testutils.TrueOrError(t, os.IsNotExist(err), "time index of the active file should have moved, err = %v", err)
+}
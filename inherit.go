@@ -0,0 +1,63 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"os"
+)
+
+// NewFromFile returns f with fh as its active file, for log files opened by a
+// supervisor such as systemd or daemontools and handed down to the process.
+// If f.Filename is empty, it is taken from the name of fh. f writes to fh
+// until the first rotation, which moves Filename into its backup and opens a
+// new file at Filename as usual, so Filename must be the path fh was opened
+// at for what was written to fh to end up in the backup, and fh should be
+// opened for appending. Pipes are written to without rotating, as with
+// named pipes. f must not have been written to yet.
+func NewFromFile(fh *os.File, f *File) (*File, error) {
+	if f.Filename == "" {
+		f.Filename = fh.Name()
+	}
+	if err := f.init(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file != nil {
+		return nil, fmt.Errorf("unable to use inherited file, %s is open already", f.Filename)
+	}
+	info, err := fh.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("unable to use inherited file: %v", err)
+	}
+	f.fifo = isFIFO(info)
+	if !f.fifo {
+		if err := f.openWriteAhead(); err != nil {
+			return nil, err
+		}
+		if err := f.triggerTrim(); err != nil {
+			return nil, err
+		}
+		at := f.now()
+		if info.Size() > 0 {
+			at = info.ModTime()
+		}
+		f.updateRotateAt(f.calcRotationTimes(at))
+	}
+	f.setFile(fh)
+	return f, nil
+}
+
+// NewFromFD is like NewFromFile, for the file descriptor fd, such as one
+// passed with systemd socket activation or the descriptor 1 of a process
+// whose stdout is a log file.
+func NewFromFD(fd uintptr, f *File) (*File, error) {
+	fh := os.NewFile(fd, f.Filename)
+	if fh == nil {
+		return nil, fmt.Errorf("unable to use inherited file, invalid file descriptor %d", fd)
+	}
+	return NewFromFile(fh, f)
+}
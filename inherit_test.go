@@ -0,0 +1,50 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestNewFromFile(t *testing.T) {
+	dirname, err := testutils.MkTestDir("NewFromFile")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	name := filepath.Join(dirname, "app.log")
+	fh, err := os.OpenFile(name, fileWriteCreateAppendFlag, fileOpenMode)
+	testutils.TrueOrFatal(t, err == nil, "failed to open inherited file: %v", err)
+	_, err = fh.WriteString("from the supervisor\n")
+	testutils.TrueOrFatal(t, err == nil, "failed to write inherited file: %v", err)
+
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	cfg := &File{}
+	cfg.setNowFunc(func() time.Time { return now })
+	f, err := NewFromFile(fh, cfg)
+	testutils.TrueOrFatal(t, err == nil && f.Filename == name, "NewFromFile() Filename = %s, error = %v, want %s", f.Filename, err, name)
+	defer f.Close()
+	_, err = f.Write([]byte("from logfeller\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	_, err = f.Write([]byte("after rotation\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+
+	backups, err := f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil && len(backups) == 1, "File.ListBackups() = %v, error = %v, want 1 backup", backups, err)
+	b, err := ioutil.ReadFile(backups[0].Name)
+	testutils.TrueOrError(t, err == nil && string(b) == "from the supervisor\nfrom logfeller\n", "backup = %q, error = %v, want the inherited file", b, err)
+	b, err = ioutil.ReadFile(name)
+	testutils.TrueOrError(t, err == nil && string(b) == "after rotation\n", "file = %q, error = %v, want a new file at the path", b, err)
+
+	_, err = NewFromFile(fh, f)
+	testutils.TrueOrError(t, err != nil, "NewFromFile() should fail for a File that is open already")
+	_, err = NewFromFD(^uintptr(0), &File{Filename: name})
+	testutils.TrueOrError(t, err != nil, "NewFromFD() should fail for an invalid file descriptor")
+}
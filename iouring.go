@@ -0,0 +1,93 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// uringEntries is the number of submissions the io_uring of a File holds.
+const uringEntries = 64
+
+// startURing sets up the io_uring if IOUring is set, falling back to the
+// usual writes if it is not available.
+func (f *File) startURing() {
+	if !f.IOUring {
+		return
+	}
+	r, err := newURing(uringEntries)
+	if err != nil {
+		f.emit(Event{Type: EventConfigWarning, Filename: f.Filename, Message: fmt.Sprintf("io_uring is not available, writing to %s without it", f.Filename), Err: err})
+		return
+	}
+	f.uring = r
+}
+
+// stopURing tears down the io_uring, later writes are made without it until
+// resumeURing sets it up again.
+func (f *File) stopURing() error {
+	if f.uring == nil {
+		return nil
+	}
+	err := f.uring.close()
+	f.uring, f.uringStopped = nil, true
+	return err
+}
+
+// resumeURing sets up the io_uring torn down by stopURing again.
+func (f *File) resumeURing() {
+	if !f.uringStopped {
+		return
+	}
+	f.uringStopped = false
+	f.startURing()
+}
+
+// uringFile writes to fh through r, so that it can be wrapped in a
+// bufio.Writer.
+type uringFile struct {
+	r  *uring
+	fh *os.File
+}
+
+func (u uringFile) Write(p []byte) (int, error) { return u.r.writev(u.fh, [][]byte{p}) }
+
+// fileWriter returns the writer to write fh with, which compresses writes if
+// ActiveCompression is set.
+func (f *File) fileWriter(fh *os.File) io.Writer {
+	if f.stream != nil {
+		return f.stream
+	}
+	return f.rawFileWriter(fh)
+}
+
+// rawFileWriter returns the writer to write fh with as is.
+func (f *File) rawFileWriter(fh *os.File) io.Writer {
+	if f.uring == nil || f.fifo {
+		return fh
+	}
+	return uringFile{r: f.uring, fh: fh}
+}
+
+// writev writes ps to the current file with as few writes as possible.
+func (f *File) writev(ps [][]byte) (int, error) {
+	if f.stream != nil {
+		return f.writeFrames(ps)
+	}
+	if f.uring == nil || f.fifo {
+		return writev(f.file, ps)
+	}
+	return f.uring.writev(f.file, ps)
+}
+
+// syncFile commits the current file to stable storage.
+func (f *File) syncFile() error {
+	if f.uring == nil || f.fifo {
+		return f.file.Sync()
+	}
+	return f.uring.fsync(f.file)
+}
@@ -0,0 +1,328 @@
+//go:build logfeller_iouring
+// +build logfeller_iouring
+
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// io_uring syscalls, they have the same numbers on every architecture.
+const (
+	sysIOURingSetup = 425
+	sysIOURingEnter = 426
+)
+
+// io_uring constants from linux/io_uring.h.
+const (
+	uringOffSQRing = 0
+	uringOffCQRing = 0x8000000
+	uringOffSQEs   = 0x10000000
+
+	uringOpWritev = 2
+	uringOpFsync  = 3
+
+	uringEnterGetEvents = 1
+
+	uringSQESize = 64
+	uringCQESize = 16
+)
+
+// uringParams is struct io_uring_params.
+type uringParams struct {
+	sqEntries    uint32
+	cqEntries    uint32
+	flags        uint32
+	sqThreadCPU  uint32
+	sqThreadIdle uint32
+	features     uint32
+	wqFD         uint32
+	resv         [3]uint32
+	sqOff        uringSQOffsets
+	cqOff        uringCQOffsets
+}
+
+// uringSQOffsets is struct io_sqring_offsets.
+type uringSQOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+// uringCQOffsets is struct io_cqring_offsets.
+type uringCQOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+// uringSQE is struct io_uring_sqe, with the fields that are used.
+type uringSQE struct {
+	opcode   uint8
+	flags    uint8
+	ioprio   uint16
+	fd       int32
+	off      uint64
+	addr     uint64
+	len      uint32
+	opFlags  uint32
+	userData uint64
+	pad      [3]uint64
+}
+
+// uringCQE is struct io_uring_cqe.
+type uringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// uringReq is a write or sync waiting on the reactor of a uring. The buffers
+// it points the kernel to are kept alive by it until it is done.
+type uringReq struct {
+	op   uint8
+	fd   int32
+	iovs []syscall.Iovec
+	res  int32
+	err  error
+	done chan struct{}
+}
+
+// uring submits writes and syncs through an io_uring, from a single reactor
+// goroutine that waits for their completion and hands back their results.
+type uring struct {
+	fd int
+
+	sqRing, cqRing, sqes []byte
+	sqHead, sqTail       *uint32
+	sqMask               uint32
+	sqArray              []uint32
+	cqHead, cqTail       *uint32
+	cqMask               uint32
+	cqes                 []byte
+	entries              uint32
+
+	reqs    chan *uringReq
+	stopped chan struct{}
+	// broken is set once the ring fails, requests fail right away after.
+	broken error
+}
+
+// newURing sets up an io_uring of entries submissions and starts its
+// reactor.
+func newURing(entries uint32) (*uring, error) {
+	var p uringParams
+	fd, _, errno := syscall.Syscall(sysIOURingSetup, uintptr(entries), uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, os.NewSyscallError("io_uring_setup", errno)
+	}
+	r := &uring{fd: int(fd), entries: p.sqEntries}
+	if err := r.mmap(&p); err != nil {
+		r.unmap()
+		syscall.Close(r.fd)
+		return nil, err
+	}
+	r.reqs, r.stopped = make(chan *uringReq, p.sqEntries), make(chan struct{})
+	go r.run()
+	return r, nil
+}
+
+// mmap maps the rings set up by io_uring_setup, separately so that it works
+// on kernels without IORING_FEAT_SINGLE_MMAP.
+func (r *uring) mmap(p *uringParams) error {
+	var err error
+	prot, flags := syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE
+	sqSize := int(p.sqOff.array + p.sqEntries*4)
+	if r.sqRing, err = syscall.Mmap(r.fd, uringOffSQRing, sqSize, prot, flags); err != nil {
+		return os.NewSyscallError("mmap", err)
+	}
+	cqSize := int(p.cqOff.cqes + p.cqEntries*uringCQESize)
+	if r.cqRing, err = syscall.Mmap(r.fd, uringOffCQRing, cqSize, prot, flags); err != nil {
+		return os.NewSyscallError("mmap", err)
+	}
+	if r.sqes, err = syscall.Mmap(r.fd, uringOffSQEs, int(p.sqEntries*uringSQESize), prot, flags); err != nil {
+		return os.NewSyscallError("mmap", err)
+	}
+	r.sqHead = (*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.head]))
+	r.sqTail = (*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.tail]))
+	r.sqMask = *(*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.ringMask]))
+	r.sqArray = (*[1 << 20]uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.array]))[:p.sqEntries:p.sqEntries]
+	r.cqHead = (*uint32)(unsafe.Pointer(&r.cqRing[p.cqOff.head]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&r.cqRing[p.cqOff.tail]))
+	r.cqMask = *(*uint32)(unsafe.Pointer(&r.cqRing[p.cqOff.ringMask]))
+	r.cqes = r.cqRing[p.cqOff.cqes:]
+	return nil
+}
+
+func (r *uring) unmap() {
+	for _, b := range [][]byte{r.sqRing, r.cqRing, r.sqes} {
+		if b != nil {
+			_ = syscall.Munmap(b)
+		}
+	}
+}
+
+// close stops the reactor once the requests queued are done, and tears down
+// the ring. It must not be called while requests are being made.
+func (r *uring) close() error {
+	close(r.reqs)
+	<-r.stopped
+	r.unmap()
+	return syscall.Close(r.fd)
+}
+
+// writev writes ps to fh, which is opened with O_APPEND so that writes go to
+// its end whatever their offset.
+func (r *uring) writev(fh *os.File, ps [][]byte) (int, error) {
+	// ps is trimmed as it is written
+	ps = append([][]byte(nil), ps...)
+	var total int
+	for {
+		iovs := make([]syscall.Iovec, 0, len(ps))
+		for _, p := range ps {
+			if len(iovs) == maxIovecs {
+				break
+			}
+			if len(p) == 0 {
+				continue
+			}
+			iov := syscall.Iovec{Base: &p[0]}
+			iov.SetLen(len(p))
+			iovs = append(iovs, iov)
+		}
+		if len(iovs) == 0 {
+			return total, nil
+		}
+		req := &uringReq{op: uringOpWritev, fd: int32(fh.Fd()), iovs: iovs}
+		n, err := r.do(req)
+		runtime.KeepAlive(fh)
+		if err != nil {
+			return total, &os.PathError{Op: "writev", Path: fh.Name(), Err: err}
+		}
+		if n == 0 {
+			return total, io.ErrShortWrite
+		}
+		total += n
+		// drop what was written
+		for len(ps) > 0 && n >= len(ps[0]) {
+			n -= len(ps[0])
+			ps = ps[1:]
+		}
+		if len(ps) > 0 {
+			ps[0] = ps[0][n:]
+		}
+	}
+}
+
+// fsync commits fh to stable storage.
+func (r *uring) fsync(fh *os.File) error {
+	_, err := r.do(&uringReq{op: uringOpFsync, fd: int32(fh.Fd())})
+	runtime.KeepAlive(fh)
+	if err != nil {
+		return &os.PathError{Op: "fsync", Path: fh.Name(), Err: err}
+	}
+	return nil
+}
+
+// do hands req to the reactor and waits for its result.
+func (r *uring) do(req *uringReq) (int, error) {
+	req.done = make(chan struct{})
+	r.reqs <- req
+	<-req.done
+	if req.err != nil {
+		return 0, req.err
+	}
+	if req.res < 0 {
+		return 0, syscall.Errno(-req.res)
+	}
+	return int(req.res), nil
+}
+
+// run is the reactor, it submits the requests queued at once and waits for
+// them to complete.
+func (r *uring) run() {
+	defer close(r.stopped)
+	batch := make([]*uringReq, 0, r.entries)
+	for req := range r.reqs {
+		batch = append(batch[:0], req)
+	more:
+		for len(batch) < int(r.entries) {
+			select {
+			case req, ok := <-r.reqs:
+				if !ok {
+					break more
+				}
+				batch = append(batch, req)
+			default:
+				break more
+			}
+		}
+		r.submit(batch)
+		for _, req := range batch {
+			close(req.done)
+		}
+	}
+}
+
+// submit queues batch on the ring, and waits for all of it to complete.
+func (r *uring) submit(batch []*uringReq) {
+	if r.broken != nil {
+		for _, req := range batch {
+			req.err = r.broken
+		}
+		return
+	}
+	tail := atomic.LoadUint32(r.sqTail)
+	for i, req := range batch {
+		idx := tail & r.sqMask
+		sqe := (*uringSQE)(unsafe.Pointer(&r.sqes[idx*uringSQESize]))
+		*sqe = uringSQE{opcode: req.op, fd: req.fd, userData: uint64(i)}
+		if len(req.iovs) > 0 {
+			sqe.addr = uint64(uintptr(unsafe.Pointer(&req.iovs[0])))
+			sqe.len = uint32(len(req.iovs))
+		}
+		r.sqArray[idx] = idx
+		tail++
+	}
+	atomic.StoreUint32(r.sqTail, tail)
+	for done := 0; done < len(batch); {
+		// the kernel moves the head past what it took, even if interrupted
+		pending := tail - atomic.LoadUint32(r.sqHead)
+		_, _, errno := syscall.Syscall6(sysIOURingEnter, uintptr(r.fd), uintptr(pending), 1, uringEnterGetEvents, 0, 0)
+		if errno != 0 && errno != syscall.EINTR && errno != syscall.EAGAIN && errno != syscall.EBUSY {
+			r.broken = os.NewSyscallError("io_uring_enter", errno)
+			for _, req := range batch {
+				if req.err == nil && req.res == 0 {
+					req.err = r.broken
+				}
+			}
+			return
+		}
+		done += r.reap(batch)
+	}
+	for _, req := range batch {
+		runtime.KeepAlive(req.iovs)
+	}
+}
+
+// reap records the results of the completions of batch, returning how many
+// there were.
+func (r *uring) reap(batch []*uringReq) int {
+	head, tail := atomic.LoadUint32(r.cqHead), atomic.LoadUint32(r.cqTail)
+	n := int(tail - head)
+	for ; head != tail; head++ {
+		cqe := (*uringCQE)(unsafe.Pointer(&r.cqes[(head&r.cqMask)*uringCQESize]))
+		if i := int(cqe.userData); i < len(batch) {
+			batch[i].res = cqe.res
+		}
+	}
+	atomic.StoreUint32(r.cqHead, tail)
+	return n
+}
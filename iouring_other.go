@@ -0,0 +1,26 @@
+//go:build !linux || !logfeller_iouring
+// +build !linux !logfeller_iouring
+
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"errors"
+	"os"
+)
+
+var errURingUnsupported = errors.New("io_uring support is only built on linux with the logfeller_iouring build tag")
+
+// uring is not available in this build, newURing always fails.
+type uring struct{}
+
+func newURing(entries uint32) (*uring, error) { return nil, errURingUnsupported }
+
+func (r *uring) writev(fh *os.File, ps [][]byte) (int, error) { return 0, errURingUnsupported }
+
+func (r *uring) fsync(fh *os.File) error { return errURingUnsupported }
+
+func (r *uring) close() error { return nil }
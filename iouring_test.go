@@ -0,0 +1,52 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_IOUring(t *testing.T) {
+	for _, bufferSize := range []int{0, 8} {
+		dirname, err := testutils.MkTestDir(fmt.Sprintf("File_IOUring_%d", bufferSize))
+		testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+		defer os.RemoveAll(dirname)
+		now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+		filename := filepath.Join(dirname, "app.log")
+		var warned bool
+		f := &File{Filename: filename, IOUring: true, BufferSize: bufferSize, Durability: DurabilityWrite, OnEvent: func(e Event) {
+			warned = warned || e.Type == EventConfigWarning
+		}}
+		f.setNowFunc(func() time.Time { return now })
+
+		_, err = f.Write([]byte("first line\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		testutils.TrueOrError(t, (f.uring == nil) == warned, "bufferSize = %d, want a warning only if io_uring is not used, uring = %v, warned = %v", bufferSize, f.uring, warned)
+		_, err = f.WriteBatch([][]byte{[]byte("second "), []byte("line\n")})
+		testutils.TrueOrFatal(t, err == nil, "File.WriteBatch() error = %v", err)
+		testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+		_, err = f.Write([]byte("third line\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+		testutils.TrueOrError(t, f.uring == nil, "io_uring should be torn down on Close")
+		// set up again for writes after Close, if it was available
+		_, err = f.Write([]byte("fourth line\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		testutils.TrueOrError(t, (f.uring == nil) == warned, "bufferSize = %d, want io_uring used again after Close, uring = %v, warned = %v", bufferSize, f.uring, warned)
+		testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+
+		b, err := ioutil.ReadFile(filepath.Join(dirname, "app.2021-03-04T0000-00.log"))
+		testutils.TrueOrError(t, err == nil && string(b) == "first line\nsecond line\n", "bufferSize = %d, backup = %q, err = %v", bufferSize, b, err)
+		b, err = ioutil.ReadFile(filename)
+		testutils.TrueOrError(t, err == nil && string(b) == "third line\nfourth line\n", "bufferSize = %d, active file = %q, err = %v", bufferSize, b, err)
+	}
+}
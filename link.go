@@ -0,0 +1,51 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// currentLinkSuffix is inserted before the extension of the active file to
+// get the filename of its CurrentLink.
+const currentLinkSuffix = ".current"
+
+// CurrentLinkFilename returns the filename of the link to the active file
+// filename kept with File.CurrentLink, such as "app.current.log" for
+// "app.log".
+func CurrentLinkFilename(filename string) string {
+	ext := filepath.Ext(filename)
+	return filename[:len(filename)-len(ext)] + currentLinkSuffix + ext
+}
+
+// updateCurrentLink points the CurrentLink at the active file, replacing the
+// link to the file that was rotated out. Failing to do so does not fail the
+// write or rotation, it is reported with an EventLinkError.
+func (f *File) updateCurrentLink() {
+	if !f.CurrentLink || f.fifo {
+		return
+	}
+	link := CurrentLinkFilename(f.Filename)
+	if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+		f.emit(Event{Type: EventLinkError, Filename: link, Message: "unable to remove link to the previous file", Err: err})
+		return
+	}
+	if err := linkFile(f.Filename, link); err != nil {
+		f.emit(Event{Type: EventLinkError, Filename: link, Message: "unable to link to the active file", Err: err})
+	}
+}
+
+// removeCurrentLink removes the CurrentLink if there is one.
+func (f *File) removeCurrentLink() error {
+	if !f.CurrentLink {
+		return nil
+	}
+	err := os.Remove(CurrentLinkFilename(f.Filename))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
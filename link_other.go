@@ -0,0 +1,13 @@
+//go:build !windows
+// +build !windows
+
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import "os"
+
+// linkFile makes link a hard link to name.
+func linkFile(name, link string) error { return os.Link(name, link) }
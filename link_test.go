@@ -0,0 +1,51 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestCurrentLinkFilename(t *testing.T) {
+	for name, want := range map[string]string{
+		"/var/log/app.log": "/var/log/app.current.log",
+		"app":              "app.current",
+		"app.1.txt":        "app.1.current.txt",
+	} {
+		got := CurrentLinkFilename(name)
+		testutils.TrueOrError(t, got == want, "CurrentLinkFilename(%s) = %s, want %s", name, got, want)
+	}
+}
+
+func TestFile_CurrentLink(t *testing.T) {
+	dirname, err := testutils.MkTestDir("CurrentLink")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), CurrentLink: true}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+	link := filepath.Join(dirname, "app.current.log")
+
+	for _, line := range []string{"first\n", "second\n"} {
+		_, err := f.Write([]byte(line))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		b, err := ioutil.ReadFile(link)
+		testutils.TrueOrError(t, err == nil && string(b) == line, "link content = %q, want %q, err = %v", b, line, err)
+		now = now.Add(24 * time.Hour)
+	}
+	backups, err := f.ListBackups()
+	testutils.TrueOrError(t, err == nil && len(backups) == 1, "the link should not be listed as a backup, File.ListBackups() = %v, %v", backups, err)
+
+	testutils.TrueOrFatal(t, f.RemoveAll() == nil, "File.RemoveAll() should not fail")
+	_, err = os.Lstat(link)
+	testutils.TrueOrError(t, os.IsNotExist(err), "File.RemoveAll() should remove the link, stat error = %v", err)
+}
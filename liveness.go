@@ -0,0 +1,85 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// liveness tracks when File was last written to. The times and stale are
+// accessed atomically, as they are read without holding the lock of File. It
+// is allocated on its own to keep the times aligned for atomic access.
+type liveness struct {
+	// lastWrite is the time of the last successful write in unix
+	// nanoseconds, zero if there was none.
+	lastWrite int64
+	// since is when the time without writes is counted from if there was no
+	// write, in unix nanoseconds.
+	since int64
+	// stale is 1 once EventStale is emitted, until the next write.
+	stale int32
+	// checks runs checkStale when StaleAfter is set and goroutines are used.
+	checks *periodic
+}
+
+// wrote records a successful write at t.
+func (l *liveness) wrote(t time.Time) {
+	atomic.StoreInt64(&l.lastWrite, t.UnixNano())
+	atomic.StoreInt32(&l.stale, 0)
+}
+
+// last returns the time of the last successful write, zero if there was
+// none.
+func (l *liveness) last() time.Time {
+	if l == nil {
+		// not initialised yet
+		return time.Time{}
+	}
+	ns := atomic.LoadInt64(&l.lastWrite)
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns).UTC()
+}
+
+// startLiveness starts checking for StaleAfter without writes.
+func (f *File) startLiveness() {
+	l := &liveness{since: f.nowFunc().UnixNano()}
+	f.liveness = l
+	if f.StaleAfter <= 0 || f.NoGoroutines {
+		return
+	}
+	l.checks = startPeriodic(time.Duration(f.StaleAfter), f.checkStale)
+}
+
+// stopLiveness stops the checks started by startLiveness.
+func (f *File) stopLiveness() {
+	if f.liveness != nil {
+		f.liveness.checks.stop()
+	}
+}
+
+// checkStale emits an EventStale if there were no writes for StaleAfter, and
+// returns how long until the next check is due.
+func (f *File) checkStale() time.Duration {
+	staleAfter := time.Duration(f.StaleAfter)
+	if staleAfter <= 0 {
+		return 0
+	}
+	last := atomic.LoadInt64(&f.liveness.lastWrite)
+	if last == 0 {
+		last = atomic.LoadInt64(&f.liveness.since)
+	}
+	idle := f.nowFunc().Sub(time.Unix(0, last))
+	if idle < staleAfter {
+		return staleAfter - idle
+	}
+	if atomic.CompareAndSwapInt32(&f.liveness.stale, 0, 1) {
+		f.emit(Event{Type: EventStale, Filename: f.Filename, Message: fmt.Sprintf("no writes to %s for %s", f.Filename, idle.Round(time.Second))})
+	}
+	return staleAfter
+}
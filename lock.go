@@ -0,0 +1,76 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// ctxMutex is a mutual exclusion lock that can be waited on with a context.
+// The zero value is an unlocked mutex.
+type ctxMutex struct {
+	once sync.Once
+	ch   chan struct{}
+	// single, if set, makes m only check that it is not used concurrently,
+	// locking m while it is locked panics instead of waiting.
+	single bool
+	busy   int32
+}
+
+func (m *ctxMutex) sem() chan struct{} {
+	m.once.Do(func() { m.ch = make(chan struct{}, 1) })
+	return m.ch
+}
+
+// Lock locks m, blocking until it is available.
+func (m *ctxMutex) Lock() {
+	if m.single {
+		m.acquire()
+		return
+	}
+	m.sem() <- struct{}{}
+}
+
+// acquire locks m if single is set.
+func (m *ctxMutex) acquire() {
+	if !atomic.CompareAndSwapInt32(&m.busy, 0, 1) {
+		panic("logfeller: concurrent use of a File with SingleWriter set")
+	}
+}
+
+// LockContext locks m, or returns ctx.Err() if ctx is done before m is
+// available.
+func (m *ctxMutex) LockContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if m.single {
+		m.acquire()
+		return nil
+	}
+	select {
+	case m.sem() <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Unlock unlocks m. It panics if m is not locked.
+func (m *ctxMutex) Unlock() {
+	if m.single {
+		if !atomic.CompareAndSwapInt32(&m.busy, 1, 0) {
+			panic("logfeller: unlock of unlocked mutex")
+		}
+		return
+	}
+	select {
+	case <-m.sem():
+	default:
+		panic("logfeller: unlock of unlocked mutex")
+	}
+}
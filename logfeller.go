@@ -10,13 +10,17 @@
 package logfeller
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"hash"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -27,63 +31,684 @@ import (
 type File struct {
 	// Filename is the filename to write to. If empty, uses the filename
 	// `<cmdname>-logfeller.log` within os.TempDir()
-	Filename string `json:"filename" yaml:"filename"`
+	// If Filename is a named pipe, it is written to but never rotated, for
+	// log shippers that read from one. Writes fail while there is no reader,
+	// and the pipe is opened again once a reader that went away is back.
+	// A leading "~" is expanded to the user's home directory and environment
+	// variables such as "$LOG_DIR" or "${LOG_DIR}" are expanded on init.
+	Filename string `json:"filename" yaml:"filename" mapstructure:"filename"`
+	// BaseDir is the directory a relative Filename is resolved against. If
+	// empty, relative filenames are resolved against the working directory
+	// at the time of each file operation. BaseDir must be an absolute path
+	// after expanding "~" and environment variables as with Filename.
+	BaseDir string `json:"base_dir" yaml:"base-dir" mapstructure:"base_dir"`
+	// BackupDir is the directory backups are kept in. A relative BackupDir is
+	// resolved against the directory of Filename, and "~" and environment
+	// variables are expanded as with Filename. It has to be on the same
+	// filesystem as Filename, as backups are moved there by renaming them.
+	// If empty, backups are kept next to Filename.
+	BackupDir string `json:"backup_dir" yaml:"backup-dir" mapstructure:"backup_dir"`
 	// When tells the logger to rotate the file, it is case insensitive.
 	// Currently supported values are
 	// 	"h" - hour
 	// 	"d" - day
+	// 	"w" - week, ISO weeks which start on Monday
 	// 	"m" - month
+	// 	"q" - quarter
 	// 	"y" - year
-	When WhenRotate `json:"when" yaml:"when"`
+	When WhenRotate `json:"when" yaml:"when" mapstructure:"when"`
 	// RotationSchedule defines the when the rotation should be occur.
 	// The values that should be passed into depends on the When field.
 	// If When is:
 	// 	"h" - pass in strings of format "04:05" (MM:SS)
 	// 	"d" - pass in strings of format "1504:05" (HHMM:SS)
+	// 	"w" - pass in strings of format "1 1504:05" (D HHMM:SS)
 	// 	"m" - pass in strings of format "02 1504:05" (DD HHMM:SS)
+	// 	"q" - pass in strings of format "0102 1504:05" (mmDD HHMM:SS)
 	// 	"y" - pass in strings of format "0102 1504:05" (mmDD HHMM:SS)
 	// where mm, DD, HH, MM, SS represents month, day, hour, minute
-	// and seconds respectively.
+	// and seconds respectively. D is the ISO weekday, 1 for Monday to 7
+	// for Sunday. For "q", mm is the month of the quarter
+	// between 01-03. Seconds may have a fractional part of up to
+	// nanosecond precision, such as "04:05.250".
+	// A schedule may also be an offset from the start of the period, a "+"
+	// followed by a duration such as "+6h" or "+30m". For "m", "q" and "y"
+	// the offset is from the start of the first day of the period, and must
+	// be within 28 days, the length of the shortest month, so that it falls
+	// on the same day in every period. For "w" it is from the start of
+	// Monday.
+	// Duplicate schedules, and schedules that BackupTimeFormat cannot tell
+	// apart from an earlier one, are dropped with an EventConfigWarning.
 	// If RotationSchedule is empty, a sensible default is depending on `When`
 	// will be used instead.
 	// If When is:
 	// 	"h" - "00:00" will be used (rotate on the 0th minute, 0th second of the hour)
 	// 	"d" - "0000:00" will be used (rotate at 12am daily)
+	// 	"w" - "1 0000:00" will be used (rotate on Monday at 12am weekly)
 	// 	"m" - "01 0000:00" will be used (rotate on the 1st day at 12am monthly)
+	// 	"q" - "0101 0000:00" will be used (rotate on the 1st day of the quarter at 12am)
 	// 	"y" - "0101 0000:00" will be used (rotate on 1st Jan at 12am every year)
-	RotationSchedule []string `json:"rotation_schedule" yaml:"rotation-schedule"`
+	RotationSchedule []string `json:"rotation_schedule" yaml:"rotation-schedule" mapstructure:"rotation_schedule"`
+	// ExtraSchedules are more rotation schedules, each with a When of its
+	// own, that the file also rotates on, so that granularities can be
+	// mixed. For example, a When of "h" with a RotationSchedule of
+	// ["30:00"], and an extra schedule with a When of "d" and a
+	// RotationSchedule of ["0000:00"], rotates at half past every hour and
+	// at midnight. They cannot be used with Every or AnchorToCreation.
+	ExtraSchedules []ScheduleGroup `json:"extra_schedules" yaml:"extra-schedules" mapstructure:"extra_schedules"`
+	// Every rotates the file at a fixed interval such as "6h" or "PT6H"
+	// (ISO-8601) instead of following RotationSchedule, and cannot be used
+	// together with it. Rotations happen at EveryAnchor plus multiples of
+	// Every.
+	Every Duration `json:"every" yaml:"every" mapstructure:"every"`
+	// EveryAnchor is the time intervals of Every are counted from. Defaults
+	// to midnight on 1st Jan 1970 if empty, in UTC or local time depending
+	// on UseLocal.
+	EveryAnchor time.Time `json:"every_anchor" yaml:"every-anchor" mapstructure:"every_anchor"`
+	// AnchorToCreation rotates the file once it is one When interval (or
+	// Every, if set) old, counting from when the file was created instead
+	// of following RotationSchedule. This produces files of a fixed length
+	// regardless of when the process started. Backups are named after the
+	// time their file was created. The creation time of a file that
+	// existed before the process started is taken to be its modified time,
+	// as file creation times are not available on every platform.
+	AnchorToCreation bool `json:"anchor_to_creation" yaml:"anchor-to-creation" mapstructure:"anchor_to_creation"`
 	// UseLocal determines if the time used to rotate is based on the system's
 	// local time
-	UseLocal bool `json:"use_local" yaml:"use-local"`
+	UseLocal bool `json:"use_local" yaml:"use-local" mapstructure:"use_local"`
 	// Backups maintains the number of backups to keep. If this is empty, do
 	// not delete backups.
-	Backups int `json:"backups" yaml:"backups"`
+	Backups int `json:"backups" yaml:"backups" mapstructure:"backups"`
+	// MaxAge is how long backups are kept after they were rotated out, when
+	// that is is taken from their BackupMetadata sidecar if they have one,
+	// and their modification time otherwise. It applies along with Backups.
+	// If this is empty, backups are not removed based on their age.
+	MaxAge Duration `json:"max_age" yaml:"max-age" mapstructure:"max_age"`
+	// Retention, if set, decides which backups to remove along with Backups
+	// and MaxAge, such as a TieredRetention. It is given the backups kept by
+	// Backups.
+	Retention RetentionPolicy `json:"-" yaml:"-" mapstructure:"-"`
+	// Compress, if true, compresses backups with gzip after they are rotated
+	// out, adding ".gz" to their names. Compressed backups count towards
+	// Backups and MaxAge. A backup that is appended to after it was
+	// compressed gets another gzip member, which gzip readers read through.
+	Compress bool `json:"compress" yaml:"compress" mapstructure:"compress"`
+	// CompressAfter keeps the newest CompressAfter backups uncompressed when
+	// Compress is set, so that recent backups can be grepped and tailed as
+	// is, as with the delaycompress of logrotate. They are compressed once
+	// newer backups take their place.
+	CompressAfter int `json:"compress_after" yaml:"compress-after" mapstructure:"compress_after"`
+	// ActiveCompression compresses the active file itself as it is
+	// written, for logs so verbose that even the active file is too big
+	// uncompressed. It is case insensitive. Defaults to "none" if empty.
+	// Currently supported values are
+	// 	"none" - write the active file as is
+	// 	"snappy" - write the active file in the snappy framing format
+	// Each write is compressed into frames of its own, so that the file can
+	// be read up to its last write, set BufferSize for writes to be
+	// compressed together. The file and its backups are decompressed by
+	// OpenBackup and NewReader, but cannot be tailed by Follow. It cannot
+	// be used with Compress, IndexInterval, IndexBytes or WriteAhead.
+	ActiveCompression ActiveCompression `json:"active_compression" yaml:"active-compression" mapstructure:"active_compression"`
+	// RepairBackups, if true, runs VerifyBackups when File is initialised,
+	// to repair compressed backups left corrupt by a crash. It runs in the
+	// background unless NoGoroutines is set.
+	RepairBackups bool `json:"repair_backups" yaml:"repair-backups" mapstructure:"repair_backups"`
+	// RotationCounter, if true, numbers rotations with a counter that only
+	// increases, kept in a hidden file next to the backups so that it carries
+	// on across restarts, such as ".app.log.rotations". Downstream systems can
+	// tell from gaps in it that a backup went missing, even when timestamps
+	// repeat after the clock went backwards. The number of each rotation is
+	// in its EventRotation, its BackupMetadata and the "{rotation}" of
+	// Footer, and the count so far is in Stats. Rotations counted by another
+	// process sharing the counter are reported with EventForeignRotation.
+	RotationCounter bool `json:"rotation_counter" yaml:"rotation-counter" mapstructure:"rotation_counter"`
+	// RetentionGrace keeps backups rotated out less than RetentionGrace ago
+	// even if they are in excess of Backups, such as for a slow uploader to
+	// ship them first. When a backup was rotated out is taken from its
+	// BackupMetadata sidecar if it has one, and its modification time
+	// otherwise.
+	RetentionGrace Duration `json:"retention_grace" yaml:"retention-grace" mapstructure:"retention_grace"`
+	// BufferSize is the size in bytes of an in-memory buffer for writes. If
+	// 0, writes go straight to the file. Buffered writes reach the file when
+	// the buffer is full, and on Flush, Sync, rotation and Close.
+	BufferSize int `json:"buffer_size" yaml:"buffer-size" mapstructure:"buffer_size"`
+	// CopyBufferSize is the size in bytes of the buffer used to copy a file
+	// onto the end of an existing backup, and to compress backups. On Linux,
+	// files are copied by the kernel where possible and the buffer is only
+	// used for compression. Defaults to 1MB if 0.
+	CopyBufferSize int `json:"copy_buffer_size" yaml:"copy-buffer-size" mapstructure:"copy_buffer_size"`
+	// WriteAhead, if true, mirrors the write buffer into a memory-mapped
+	// file next to Filename, see WriteAheadFilename. Buffered writes left in
+	// it when the process dies are appended to Filename on the next open, so
+	// they are not lost even without a Sync per write. A crash right after a
+	// flush may replay writes that already reached the file. It requires
+	// BufferSize to be set, cannot be used with ActiveCompression, and does
+	// not cover writes still held by Shards.
+	WriteAhead bool `json:"write_ahead" yaml:"write-ahead" mapstructure:"write_ahead"`
+	// BackgroundBackup, if true, keeps rotation off the write path: the
+	// rotated file is only renamed to a staging file next to its backup, and
+	// writes continue in a new file right away. Moving it to its backup,
+	// which may mean appending it to an existing one, its sidecars, the
+	// EventRotation and trimming are done after that in the background, in
+	// the order files were rotated. ListBackups and readers do not see a
+	// staged file until it is backed up, use WaitBackups to wait for that,
+	// which Close also does. RotationMarkers name the backup filename before
+	// collisions are handled. Staged files left by a previous run are backed
+	// up on init.
+	BackgroundBackup bool `json:"background_backup" yaml:"background-backup" mapstructure:"background_backup"`
+	// NoGoroutines, if true, keeps File from starting any goroutines of its
+	// own. Trimming backups is done inline after a rotation instead, and can
+	// be run at any time with Maintain. Shards, BackgroundBackup and IOUring
+	// need a goroutine, and cannot be used with it.
+	NoGoroutines bool `json:"no_goroutines" yaml:"no-goroutines" mapstructure:"no_goroutines"`
+	// IOUring, if true, makes writes and syncs through io_uring on Linux,
+	// submitted by a single goroutine of File that also handles their
+	// completion. It is experimental, and only built in with the
+	// logfeller_iouring build tag. Without it, on other platforms, or where
+	// io_uring is not available, such as on kernels older than 5.1 or where
+	// seccomp blocks it, an EventConfigWarning is emitted on init and writes
+	// are made as usual.
+	IOUring bool `json:"io_uring" yaml:"io-uring" mapstructure:"io_uring"`
+	// CurrentLink, if true, keeps a link named as with CurrentLinkFilename,
+	// such as "app.current.log" for "app.log", to the active file. It is a
+	// hard link, or a symbolic link on Windows, and is replaced whenever a new
+	// file is opened.
+	CurrentLink bool `json:"current_link" yaml:"current-link" mapstructure:"current_link"`
+	// SingleWriter asserts that File is only used from one goroutine at a
+	// time, which skips waiting on its lock on every write. Concurrent use is
+	// not waited on but panics. Shards need a goroutine to write to the
+	// file, and cannot be used with it, nor can SyncInterval or TriggerFile
+	// unless NoGoroutines is set. Shutdown runs on the calling goroutine,
+	// and ShutdownOnTermination and AdminHandler refuse such a File.
+	SingleWriter bool `json:"single_writer" yaml:"single-writer" mapstructure:"single_writer"`
+	// Shards, if set, spreads writes over Shards buffers with their own locks
+	// instead of taking a single lock per write, for very high write rates
+	// from many goroutines. Writes are written out in the order they were
+	// made by a single flusher every ShardFlushInterval (100ms if not set),
+	// or sooner if a shard fills up, and on Flush, Sync, Rotate and Close.
+	// Write errors are then reported with an EventWriteError instead of
+	// being returned from Write. The writes held are counted in Stats.
+	Shards             int      `json:"shards" yaml:"shards" mapstructure:"shards"`
+	ShardFlushInterval Duration `json:"shard_flush_interval" yaml:"shard-flush-interval" mapstructure:"shard_flush_interval"`
+	// ShardMaxBytes, if set, bounds the bytes held by Shards. A write that
+	// would go over it writes out those held first, so memory stays around
+	// ShardMaxBytes, plus a write for each concurrent writer, at the cost
+	// of that write waiting on the file.
+	ShardMaxBytes int `json:"shard_max_bytes" yaml:"shard-max-bytes" mapstructure:"shard_max_bytes"`
+	// SampleAbove, if set, sheds load during log storms: once there are
+	// more than SampleAbove writes in a second, only one in SampleEvery (10
+	// if not set) of the writes over it is kept for the rest of that second.
+	// The others are dropped, though reported as written, and accounted for
+	// by a line such as "sampled: dropped 120 records between <time> and
+	// <time>" written after the second is over, so at most once a second,
+	// or on Close. It is the first stage of WriteHooks, see SampleHook, so
+	// each write of WriteBatch counts on its own.
+	SampleAbove int `json:"sample_above" yaml:"sample-above" mapstructure:"sample_above"`
+	SampleEvery int `json:"sample_every" yaml:"sample-every" mapstructure:"sample_every"`
+	// DailyQuotaBytes, if set, is the most bytes written each day, in the
+	// time zone of UseLocal. The first write over it emits an
+	// EventQuotaExceeded, and OnQuotaExceeded decides what happens to it,
+	// it is case insensitive. Defaults to "drop" if empty.
+	// Currently supported values are
+	// 	"drop" - drop writes until the next day, reporting them as written
+	// 	         and counting them in Stats
+	// 	"block" - block writes until the next day, or until the context of
+	// 	          WriteContext is done
+	// 	"rotate" - force a rotation and continue, with the quota counted
+	// 	           again for the new file
+	DailyQuotaBytes int64       `json:"daily_quota_bytes" yaml:"daily-quota-bytes" mapstructure:"daily_quota_bytes"`
+	OnQuotaExceeded QuotaPolicy `json:"on_quota_exceeded" yaml:"on-quota-exceeded" mapstructure:"on_quota_exceeded"`
+	// Footer, if set, is written as the last line of the file when it is
+	// rotated out or closed, so incomplete files can be told apart. The
+	// following placeholders are replaced:
+	// 	"{time}" - the current time in RFC3339
+	// 	"{reason}" - "rotated" or "closed"
+	// 	"{bytes}" - the number of bytes written since the file was opened
+	// 	"{lines}" - the number of lines written since the file was opened
+	// 	"{rotation}" - the number the file is rotated out as, see
+	// 	RotationCounter
+	// For example "=== {reason} at {time}, {bytes} bytes, {lines} lines ===".
+	Footer string `json:"footer" yaml:"footer" mapstructure:"footer"`
+	// RotationMarkers, if true, writes a marker line at the end of each file
+	// rotated out naming the file that continues it, and at the top of each
+	// new file naming the backup it continues from. Markers are written
+	// before Footer.
+	RotationMarkers bool `json:"rotation_markers" yaml:"rotation-markers" mapstructure:"rotation_markers"`
+	// BackupMetadata, if true, writes a JSON sidecar named
+	// "<backup>.meta.json" next to each backup with the period it covers and
+	// the bytes and lines written in it. See ReadBackupMetadata.
+	BackupMetadata bool `json:"backup_metadata" yaml:"backup-metadata" mapstructure:"backup_metadata"`
+	// ContentHash, if true, keeps a SHA-256 of the bytes written in each
+	// period as they are written, without reading the file back. It is
+	// part of Stats and of the BackupMetadata, so that duplicate periods
+	// and uploads can be told apart downstream by their hashes alone. A
+	// backup appended to gets a chained digest of its parts instead, see
+	// BackupMetadata.ChainedContentHash.
+	ContentHash bool `json:"content_hash" yaml:"content-hash" mapstructure:"content_hash"`
+	// IndexInterval and IndexBytes, if either is set, record a time index
+	// checkpoint in a sidecar named "<file>.idx" on the first write, and then
+	// on the first write after IndexInterval has passed or IndexBytes have
+	// been written since the last checkpoint. The index moves with the file
+	// when it is rotated, see ReadTimeIndex and IndexOffset.
+	IndexInterval Duration `json:"index_interval" yaml:"index-interval" mapstructure:"index_interval"`
+	IndexBytes    int64    `json:"index_bytes" yaml:"index-bytes" mapstructure:"index_bytes"`
+	// MaxBackupsPerPeriod caps the number of backups kept for a single
+	// rotation period, such as those made by Rotate or by OnBackupCollision
+	// "sequence". Once the cap is reached, further rotations in the period
+	// are appended to its latest backup. If 0, there is no cap.
+	MaxBackupsPerPeriod int `json:"max_backups_per_period" yaml:"max-backups-per-period" mapstructure:"max_backups_per_period"`
+	// TrashRetention, if set, moves backups removed by Backups into a
+	// ".trash" directory next to the file instead of deleting them, and only
+	// deletes them from there once they have been in the trash for
+	// TrashRetention, giving an undo window for misconfigured retention.
+	TrashRetention Duration `json:"trash_retention" yaml:"trash-retention" mapstructure:"trash_retention"`
+	// Archiver, if set, keeps backups only remotely: each backup is uploaded
+	// to it after it is rotated out, trimmed and compressed, and deleted from
+	// the disk once stored, along with its sidecars. ListBackups lists the
+	// backups it stores as Remote, and readers fetch them from it. They are
+	// kept for as long as the Archiver keeps them, unless ArchiveRetention
+	// is set. A rotation into a backup it stores is resolved with
+	// OnBackupCollision as for a local one, downloading the backup to append
+	// to it. BackgroundBackup cannot be used with it.
+	Archiver Archiver `json:"-" yaml:"-" mapstructure:"-"`
+	// ArchiveRetention, if true, applies Backups, MaxAge and Retention to the
+	// backups stored by the Archiver as well, deleting those that expire
+	// from it, so that the remote storage does not grow without bounds. The
+	// Archiver must implement ArchiveDeleter.
+	ArchiveRetention bool `json:"archive_retention" yaml:"archive-retention" mapstructure:"archive_retention"`
+	// AuditLog, if set, is a file a JSON line is appended to for every
+	// rotation, and every backup trimmed, purged from the trash or removed,
+	// recording what triggered it, when, and whether it failed, see
+	// AuditEntry. A relative AuditLog is resolved against the directory of
+	// Filename, and "~" and environment variables are expanded as with
+	// Filename.
+	AuditLog string `json:"audit_log" yaml:"audit-log" mapstructure:"audit_log"`
+	// BackupNameParsers recognise backups named by other tools, such as
+	// "app.log.1" from a previous rotator, so they are listed and trimmed
+	// along with the backups named by File. Each is given the name of a file
+	// in the same directory, without extensions such as ".gz" or ".enc",
+	// and returns the start of the period it holds and true if it is a
+	// backup. They are tried in order for files not named by File.
+	BackupNameParsers []func(name string) (time.Time, bool) `json:"-" yaml:"-" mapstructure:"-"`
+	// ModTimeFallback, if true, treats files named like backups whose
+	// timestamp cannot be parsed, such as "app.old.log" for "app.log", as
+	// backups of the time they were last modified, so they are trimmed by
+	// Backups and MaxAge instead of being kept forever. Any file in the
+	// backup directory with the name and extension of Filename is taken as
+	// a backup, so other logs such as "app-error.log" must not be kept
+	// there when this is set.
+	ModTimeFallback bool `json:"mod_time_fallback" yaml:"mod-time-fallback" mapstructure:"mod_time_fallback"`
 	// BackupTimeFormat is time format used for the backup file's encoded timestamp.
 	// Defaults to ".2006-01-02T1504-05" if empty.
+	// The format must be precise enough to tell apart every entry in
+	// RotationSchedule, for sub-second schedules include fractional
+	// seconds, such as ".2006-01-02T1504-05.000".
 	// See the golang `time` package for more example formats
 	// https://golang.org/pkg/time/#Time.Format
-	BackupTimeFormat string `json:"backup_time_format" yaml:"backup-time-format"`
+	// A strftime pattern such as "-%Y%m%d_%H%M" may be used instead, it is
+	// converted to a Go layout on init, see StrftimeLayout.
+	BackupTimeFormat string `json:"backup_time_format" yaml:"backup-time-format" mapstructure:"backup_time_format"`
+	// BackupFormatCheck decides what happens when BackupTimeFormat does not
+	// give lexically sortable and unambiguous backup filenames for When,
+	// which retention, log shippers and humans all rely on. It is case
+	// insensitive. Defaults to "warn" if empty.
+	// Currently supported values are
+	// 	"warn" - emit an EventConfigWarning on init
+	// 	"enforce" - fail init
+	// 	"off" - do not check
+	BackupFormatCheck FormatCheck `json:"backup_format_check" yaml:"backup-format-check" mapstructure:"backup_format_check"`
+	// BackupTimeZone is the time zone of the timestamp in backup filenames,
+	// such as "UTC", "Local" or an IANA time zone name like "Asia/Singapore".
+	// Defaults to the time zone rotations are scheduled in if empty, see
+	// UseLocal. Using "UTC" keeps filenames sorting consistently across
+	// hosts in different regions.
+	BackupTimeZone string `json:"backup_time_zone" yaml:"backup-time-zone" mapstructure:"backup_time_zone"`
+	// BackupNaming decides which times of the period a backup holds are in
+	// its filename. It is case insensitive. Defaults to "start" if empty.
+	// Currently supported values are
+	// 	"start" - the start of the period, such as "app.2024-06-11T0000-00.log"
+	// 	"period" - the start and the end of the period separated by "-",
+	// 	such as "app.20240611T0000-20240611T0600.log" with a
+	// 	BackupTimeFormat of ".20060102T1504". The end is formatted without
+	// 	the leading separators of BackupTimeFormat.
+	// The end is when the period is scheduled to end, backups rotated out
+	// early by Rotate are named after the full period too. Backups named
+	// with "start" are still recognised with "period", so it can be turned
+	// on for existing backups.
+	BackupNaming BackupNaming `json:"backup_naming" yaml:"backup-naming" mapstructure:"backup_naming"`
+	// MinSize is the size in bytes the file has to reach before a scheduled
+	// rotation happens. Rotations of smaller files are deferred to the next
+	// scheduled rotation, and the backup is named after the time the
+	// first deferred rotation was scheduled. This avoids piling up near
+	// empty backups from quiet services. If this is empty, only empty files
+	// are not rotated. Rotate is not affected by MinSize.
+	MinSize int64 `json:"min_size" yaml:"min-size" mapstructure:"min_size"`
+	// MaxSize is the size in bytes the file may grow to before it is rotated
+	// regardless of the schedule. The write that would take the file past
+	// MaxSize goes to a new file, whose backup is kept apart from the others
+	// of the period with a sequence suffix as with OnBackupCollision
+	// "sequence". A single write larger than MaxSize is not split. If this is
+	// empty, the file is only rotated on schedule.
+	MaxSize int64 `json:"max_size" yaml:"max-size" mapstructure:"max_size"`
+	// MinRotationInterval is the least time between two rotations, to keep
+	// clock jumps, repeated Rotate calls or a misconfigured schedule from
+	// creating a storm of backups. A scheduled rotation that comes too soon
+	// is deferred until the interval has passed, and its backup is named
+	// after the time it was scheduled. Rotate and ForceRotate do nothing when
+	// called too soon. Both emit an EventRotationThrottled. The interval is
+	// measured on the monotonic clock where there is one, so jumps of the
+	// wall clock do not affect it. If this is empty, rotations are not
+	// throttled.
+	MinRotationInterval Duration `json:"min_rotation_interval" yaml:"min-rotation-interval" mapstructure:"min_rotation_interval"`
+	// StaleAfter, if set, emits an EventStale once there were no writes for
+	// this long since the last write, or since File was first used. It is
+	// emitted again only after writes resume and stop once more. The check
+	// runs on a timer until Close, or on Maintain with NoGoroutines.
+	StaleAfter Duration `json:"stale_after" yaml:"stale-after" mapstructure:"stale_after"`
+	// RotationAnomalies, if true, emits an EventRotationAnomaly when the
+	// rotations deviate from the schedule: when a scheduled rotation comes
+	// after later ones were due as well, as the process slept or the file
+	// was not written to, and for every rotation off the schedule by Rotate,
+	// ForceRotate or TriggerFile. They are counted in Stats.
+	RotationAnomalies bool `json:"rotation_anomalies" yaml:"rotation-anomalies" mapstructure:"rotation_anomalies"`
+	// PressureThresholds, if set, emits an EventPressure whenever Pressure
+	// crosses one of them, rising or falling, as checked on every write.
+	// They must be between 0 and 1, such as 0.5 and 0.9 to cut down on debug
+	// output at the first and on everything but errors at the second.
+	PressureThresholds []float64 `json:"pressure_thresholds" yaml:"pressure-thresholds" mapstructure:"pressure_thresholds"`
+	// PressureFreeSpace, if set, counts the free disk space below it
+	// towards Pressure, which reaches 1 as the disk fills up.
+	PressureFreeSpace int64 `json:"pressure_free_space" yaml:"pressure-free-space" mapstructure:"pressure_free_space"`
+	// SyncInterval, if set, commits writes to stable storage this often, if
+	// there were any since the last time, as a middle ground between leaving
+	// it to the OS and a Durability of "write". Syncs run on a timer until
+	// Close, or on Maintain with NoGoroutines. Failures are reported with an
+	// EventWriteError.
+	SyncInterval Duration `json:"sync_interval" yaml:"sync-interval" mapstructure:"sync_interval"`
+	// TriggerFile, if set, is a file whose appearance rotates the file right
+	// away as with Rotate, after which it is removed. It lets other
+	// processes ask for a rotation where signals are awkward, such as in
+	// containers or on Windows, with "touch app.log.rotate". A relative
+	// TriggerFile is resolved against the directory of Filename, and "~" and
+	// environment variables are expanded as with Filename. It is checked for
+	// every TriggerInterval until Close, or on Maintain with NoGoroutines.
+	// Failures are reported with an EventBackupError.
+	TriggerFile string `json:"trigger_file" yaml:"trigger-file" mapstructure:"trigger_file"`
+	// TriggerInterval is how often TriggerFile is checked for, defaults to
+	// 1s if TriggerFile is set.
+	TriggerInterval Duration `json:"trigger_interval" yaml:"trigger-interval" mapstructure:"trigger_interval"`
+	// OnClockRegression decides what happens when the wall clock is observed
+	// to step backwards (NTP corrections, VM resumes etc.), it is case
+	// insensitive. Defaults to "freeze" if empty.
+	// Currently supported values are
+	// 	"freeze" - keep using the latest time observed for rotation until the
+	// 	           wall clock catches up again
+	// 	"sequence" - follow the wall clock and rotate immediately, backups
+	// 	             whose names collide get a "_<n>" sequence suffix
+	OnClockRegression ClockRegressionPolicy `json:"on_clock_regression" yaml:"on-clock-regression" mapstructure:"on_clock_regression"`
+	// OnBackupCollision decides what happens when a rotation's backup
+	// filename already exists, it is case insensitive. An EventBackupCollision
+	// is emitted whenever this happens as it usually points to clock or
+	// configuration problems. Defaults to "append" if empty.
+	// Currently supported values are
+	// 	"append" - append the file's content to the existing backup
+	// 	"sequence" - backup to a new file with a "_<n>" sequence suffix
+	// 	"overwrite" - replace the existing backup
+	// 	"error" - fail the rotation
+	OnBackupCollision CollisionPolicy `json:"on_backup_collision" yaml:"on-backup-collision" mapstructure:"on_backup_collision"`
+	// OnEmptyRotation decides what a scheduled rotation does with an active
+	// file that was not written to in its period, it is case insensitive.
+	// Defaults to "reuse" if empty.
+	// Currently supported values are
+	// 	"reuse" - keep writing to the empty file in the next period
+	// 	"backup" - back it up as an empty backup, so that there is a backup
+	// 	           for every period the file was open in
+	// 	"placeholder" - write a record saying there was no output in the
+	// 	                period, and back it up
+	// Periods in which the file was not open, such as while the process was
+	// not running, get no backup either way.
+	OnEmptyRotation EmptyRotationPolicy `json:"on_empty_rotation" yaml:"on-empty-rotation" mapstructure:"on_empty_rotation"`
+	// OneFilePerPeriod, if true, keeps exactly one backup for every period
+	// of the schedule, as pipelines keyed on period files expect. Rotations
+	// within a period, such as by ForceRotate or MaxSize, are merged into
+	// its backup, empty files are backed up as with OnEmptyRotation
+	// "backup", and the file is rotated as each period is over, creating
+	// empty backups for the periods that passed without any, or at the
+	// next write if NoGoroutines or SingleWriter is set. A backup that
+	// cannot be appended to for lack of disk space fails the rotation
+	// rather than being kept apart. OnEmptyRotation may be "placeholder"
+	// instead. It cannot be used with OnBackupCollision other than
+	// "append", nor with MaxBackupsPerPeriod above 1, nor with MinSize,
+	// MinRotationInterval or BlackoutWindows, which would defer rotations
+	// into the next period.
+	OneFilePerPeriod bool `json:"one_file_per_period" yaml:"one-file-per-period" mapstructure:"one_file_per_period"`
+	// NotifyPeriodComplete, if true, emits an EventPeriodComplete for each
+	// backup of a period once the period is over and the backup is final,
+	// so that downstream jobs can pick it up without polling. Periods are
+	// reported oldest first by the trim that follows the rotation, from its
+	// goroutine unless NoGoroutines is set. Backups carry no checksum, so
+	// final means compressed if Compress is set and archived if there is an
+	// Archiver.
+	NotifyPeriodComplete bool `json:"notify_period_complete" yaml:"notify-period-complete" mapstructure:"notify_period_complete"`
+	// RotationMethod decides how the active file is moved to its backup on
+	// rotation, it is case insensitive. Defaults to "rename" if empty.
+	// Currently supported values are
+	// 	"rename" - rename the file to the backup, then create a new file
+	// 	"link" - hard link the file to the backup, then replace it with a
+	// 	         new file, so Filename always exists for external watchers
+	RotationMethod RotationMethod `json:"rotation_method" yaml:"rotation-method" mapstructure:"rotation_method"`
+	// Durability decides how much File commits to stable storage on its own,
+	// it is case insensitive. Defaults to "none" if empty.
+	// Currently supported values are
+	// 	"none" - leave it to the OS, except on Sync and Close
+	// 	"rotate" - also commit the rotated file before it is backed up, and
+	// 	           its directory after the file is renamed or created, so
+	// 	           rotations survive power loss
+	// 	"write" - as with "rotate", and commit every write, which flushes
+	// 	          BufferSize on every write
+	// Commits are made as with Sync, see there for their cost on macOS.
+	Durability Durability `json:"durability" yaml:"durability" mapstructure:"durability"`
+	// OnEvent is called with events such as backup collisions that happen
+	// within File. It is called synchronously with one event at a time, from
+	// the goroutine of a write or of File's background work such as
+	// StaleAfter and BackgroundBackup, and often while File is locked, so it
+	// must not call File's methods.
+	OnEvent func(Event) `json:"-" yaml:"-" mapstructure:"-"`
+	// TeeWriter, if set, is also written everything written to File, such as
+	// os.Stdout to see the output in the console during development. It is
+	// written after the file, while File is locked, and its errors are
+	// reported with an EventWriteError rather than failing the write.
+	TeeWriter io.Writer `json:"-" yaml:"-" mapstructure:"-"`
+	// WriteHooks are stages every write passes through in order before it
+	// is written, to filter, prefix, redact or observe it, see FilterHook,
+	// PrefixHook, RedactHook, SampleHook and ObserveHook. SampleAbove is
+	// run as a stage before them. They run before DailyQuotaBytes, which
+	// counts the writes as they come out of them. Each write of WriteBatch
+	// passes through them on its own.
+	WriteHooks []WriteHook `json:"-" yaml:"-" mapstructure:"-"`
+	// RecentFile, if set, is a ring file that always holds the last
+	// RecentSize bytes written, whatever rotations happened, so that crash
+	// dump collectors can grab the last moments before a crash from one
+	// small file. It has a short header followed by the window, which wraps
+	// around once full, read it with ReadRecent. It is written along with
+	// the file, and its errors are reported with an EventWriteError. A
+	// relative RecentFile is resolved against the directory of Filename,
+	// and "~" and environment variables are expanded. It must not be named
+	// like a backup of Filename.
+	RecentFile string `json:"recent_file" yaml:"recent-file" mapstructure:"recent_file"`
+	// RecentSize is the size in bytes of the window of RecentFile, defaults
+	// to 10MB if RecentFile is set.
+	RecentSize int64 `json:"recent_size" yaml:"recent-size" mapstructure:"recent_size"`
+	// DayOverflow decides what happens to schedules whose day does not exist
+	// in every month, such as "31 0000:00" when When is "m" or
+	// "0229 0000:00" when When is "y". It is case insensitive.
+	// Defaults to "clamp" if empty.
+	// Currently supported values are
+	// 	"clamp" - rotate on the last day of months that are too short
+	// 	"skip" - do not rotate in months that are too short
+	// 	"error" - reject such schedules on init
+	DayOverflow DayOverflowPolicy `json:"day_overflow" yaml:"day-overflow" mapstructure:"day_overflow"`
+	// BlackoutWindows are daily windows of time where rotation is deferred
+	// until the window ends, for pipelines that cannot tolerate the file
+	// switching mid-job. Windows are of the format "1504:05-1504:05"
+	// (HHMM:SS-HHMM:SS) and may wrap around midnight, such as
+	// "2300:00-0100:00". The start of a window is inclusive and the end is
+	// exclusive. Writes within a window stay in the current file, which is
+	// backed up with the timestamp of the deferred rotation once the
+	// window ends.
+	BlackoutWindows []string `json:"blackout_windows" yaml:"blackout-windows" mapstructure:"blackout_windows"`
+	// WeekdaysOnly skips rotations scheduled on Saturdays and Sundays, so
+	// with daily rotation, Friday's file is only rotated on Monday.
+	WeekdaysOnly bool `json:"weekdays_only" yaml:"weekdays-only" mapstructure:"weekdays_only"`
+	// WeekParity restricts rotations to ISO weeks with an "even" or "odd"
+	// week number, such as for bi-weekly rotation with a When of "w". It
+	// defaults to "any". Years with 53 ISO weeks have two odd weeks in a
+	// row, week 53 and week 1.
+	WeekParity WeekParity `json:"week_parity" yaml:"week-parity" mapstructure:"week_parity"`
+	// IsRotationDay is an optional calendar hook that reports if rotations
+	// scheduled on the day of t may happen, such as to skip public holidays.
+	// It is called with the scheduled rotation time, and works together with
+	// WeekdaysOnly.
+	IsRotationDay func(t time.Time) bool `json:"-" yaml:"-" mapstructure:"-"`
 
 	// timeRotationSchedule stores the parsed rotational schedule.
 	// These offsets are sorted.
 	// This field is populated on init()
 	timeRotationSchedule []timeSchedule
+	// extraSchedules are the parsed ExtraSchedules.
+	// This field is populated on init()
+	extraSchedules []scheduleGroup
+	// backupLocation is the loaded BackupTimeZone, nil if it is empty.
+	// This field is populated on init()
+	backupLocation *time.Location
+	// blackoutWindows stores the parsed BlackoutWindows.
+	// This field is populated on init()
+	blackoutWindows []blackoutWindow
 	// directory is the directory of the current Filename
 	// This field is populated on init()
 	directory string
+	// backupDirectory is the directory backups are kept in, see BackupDir.
+	// This field is populated on init()
+	backupDirectory string
 	// fileBase is the base name of the file without extension
 	// This field is populated on init()
 	fileBase string
 	// ext is the file's extension.
 	// This field is populated on init()
-	ext    string
-	trimCh chan struct{}
+	ext string
+	// backupPrefix is the directory and fileBase that backup filenames
+	// start with.
+	// This field is populated on init()
+	backupPrefix string
+	trimCh       chan struct{}
+	// maintenance tracks the trims requested through trimCh.
+	maintenance maintenance
+	// pressure tracks the Pressure for PressureThresholds.
+	pressure pressure
+	// trimMu keeps trims from running concurrently with each other and with
+	// backups.
+	trimMu sync.Mutex
+	// overPeriods are the periods that are over whose backups are not
+	// reported with EventPeriodComplete yet, protected by trimMu.
+	overPeriods []time.Time
 
 	// mu protects the following fields below
-	mu           sync.Mutex
+	mu           ctxMutex
 	rotateAt     time.Time
 	prevRotateAt time.Time
 	file         *os.File
+	// buf buffers writes to file if BufferSize is set.
+	buf *bufio.Writer
+	// openedAt is when file was opened.
+	openedAt time.Time
+	// fileBytes and fileLines count what was written since file was opened.
+	fileBytes int64
+	fileLines int64
+	// contentHash hashes what was written since file was opened if
+	// ContentHash is set.
+	contentHash hash.Hash
+	// lastBackup is the backup filename of the last file rotated out.
+	lastBackup string
+	// lastBackupJob is the backup of the last file rotated out.
+	lastBackupJob *backupJob
+	// rotations is the RotationCounter.
+	rotations uint64
+	// missedRotations and extraRotations count the rotations that deviated
+	// from the schedule, see RotationAnomalies.
+	missedRotations uint64
+	extraRotations  uint64
+	// lastRotated is when a file was last rotated out, as given by nowFunc.
+	lastRotated time.Time
+	// diagnostics reports events to the logger set with WithDiagnostics.
+	diagnostics func(Event)
+	// eventMu serialises emitting events.
+	eventMu sync.Mutex
+	// auditMu serialises appending to the AuditLog.
+	auditMu sync.Mutex
+	// fifo is true if file is a named pipe.
+	fifo bool
+	// quota is set if DailyQuotaBytes is.
+	quota *quota
+	// sampler is set if SampleAbove is.
+	sampler *sampler
+	// hooks are the WriteHooks writes pass through, after the sampling of
+	// SampleAbove if it is set.
+	hooks []WriteHook
+	// autoSync is set if SyncInterval is.
+	autoSync *autoSync
+	// trigger is set if TriggerFile is.
+	trigger *triggerWatch
+	// periodChecks rotates the file as each period is over if
+	// OneFilePerPeriod is set and goroutines are used.
+	periodChecks *periodic
+	// liveness tracks the last write for Stats and StaleAfter.
+	liveness *liveness
+	// fileOffset is the size of file including buffered writes.
+	fileOffset int64
+	// markerBytes is the size of the start marker at the top of file, which
+	// is not output.
+	markerBytes int64
+	// lastCheckpoint and lastCheckpointOffset are the time and offset of the
+	// last time index checkpoint of file.
+	lastCheckpoint       time.Time
+	lastCheckpointOffset int64
+	// highWater is the latest time observed from nowFunc, it retains the
+	// monotonic clock reading if there is one.
+	highWater time.Time
+	// regressed is true while the wall clock is behind highWater.
+	regressed bool
+	// regressionRotate is set when a clock regression is detected under
+	// ClockRegressionSequence and a rotation is owed.
+	regressionRotate bool
+	// backupNameAt and backupName cache the last filenameWithTimestamp.
+	backupNameAt time.Time
+	backupName   string
+
+	// backupJobs queues backups if BackgroundBackup is set, backupWG
+	// tracks those that are not done yet.
+	backupJobs chan *backupJob
+	backupWG   sync.WaitGroup
+
+	// uring makes writes and syncs if IOUring is set and io_uring is
+	// available, it is nil otherwise and once File is closed.
+	uring *uring
+	// uringStopped is set once Close tore down uring, until it is set up
+	// again.
+	uringStopped bool
+
+	// recent is the RecentFile window, once it is first written to.
+	recent *recentWindow
+
+	// stream compresses the writes to the active file if ActiveCompression
+	// is set, once the file is first opened.
+	stream *snappyFrames
+
+	// writeAhead is set if WriteAhead is, once the file is first opened.
+	writeAhead *writeAhead
+
+	// shards is set if Shards is.
+	shards *shardedWriter
 
 	initOnce sync.Once
 	initErr  error
@@ -95,67 +720,616 @@ const (
 	fileOpenMode              os.FileMode = 0644
 	dirCreateMode             os.FileMode = 0755
 	fileWriteCreateAppendFlag             = os.O_WRONLY | os.O_CREATE | os.O_APPEND
-	fileWriteAppend                       = os.O_WRONLY | os.O_APPEND
-	oneMB                                 = 1024 * 1024
+	// fileWriteCopyTo opens files copied onto the end of by copyFile,
+	// without O_APPEND, which keeps the kernel from copying to them.
+	fileWriteCopyTo = os.O_WRONLY
+	oneMB           = 1024 * 1024
+	// sequenceSep separates the backup timestamp from its sequence number.
+	sequenceSep = "_"
+	// periodSep separates the start and the end of the period in backup
+	// filenames with a BackupNaming of "period".
+	periodSep = "-"
+	// periodEndTrim are the leading separators of BackupTimeFormat left
+	// out of the end of the period.
+	periodEndTrim = ".-_"
+	// maxPeriodSearchSpan is the number of periods on either side of the
+	// current one calcRotationTimes looks at for a scheduled time. This is
+	// enough to get past 8 years without a leap day, or a year's worth of
+	// days that are not rotation days.
+	maxPeriodSearchSpan = 400
+)
+
+// ClockRegressionPolicy decides how File reacts to the wall clock stepping
+// backwards.
+type ClockRegressionPolicy string
+
+const (
+	ClockRegressionFreeze   ClockRegressionPolicy = "freeze"
+	ClockRegressionSequence ClockRegressionPolicy = "sequence"
+)
+
+func (p ClockRegressionPolicy) lower() ClockRegressionPolicy {
+	return ClockRegressionPolicy(strings.ToLower(string(p)))
+}
+
+// valid returns an error if its not valid
+func (p ClockRegressionPolicy) valid() error {
+	switch p {
+	case ClockRegressionFreeze, ClockRegressionSequence:
+		return nil
+	default:
+		return fmt.Errorf("invalid clock regression policy specified: %s, accepted values are %v",
+			p, []ClockRegressionPolicy{ClockRegressionFreeze, ClockRegressionSequence})
+	}
+}
+
+// CollisionPolicy decides how an existing backup with the same filename is
+// handled on rotation.
+type CollisionPolicy string
+
+const (
+	CollisionAppend    CollisionPolicy = "append"
+	CollisionSequence  CollisionPolicy = "sequence"
+	CollisionOverwrite CollisionPolicy = "overwrite"
+	CollisionError     CollisionPolicy = "error"
+)
+
+func (p CollisionPolicy) lower() CollisionPolicy { return CollisionPolicy(strings.ToLower(string(p))) }
+
+// valid returns an error if its not valid
+func (p CollisionPolicy) valid() error {
+	switch p {
+	case CollisionAppend, CollisionSequence, CollisionOverwrite, CollisionError:
+		return nil
+	default:
+		return fmt.Errorf("invalid backup collision policy specified: %s, accepted values are %v",
+			p, []CollisionPolicy{CollisionAppend, CollisionSequence, CollisionOverwrite, CollisionError})
+	}
+}
+
+// RotationMethod decides how the active file is moved to its backup.
+type RotationMethod string
+
+const (
+	RotationRename RotationMethod = "rename"
+	RotationLink   RotationMethod = "link"
 )
 
+func (m RotationMethod) lower() RotationMethod { return RotationMethod(strings.ToLower(string(m))) }
+
+// valid returns an error if its not valid
+func (m RotationMethod) valid() error {
+	switch m {
+	case RotationRename, RotationLink:
+		return nil
+	default:
+		return fmt.Errorf("invalid rotation method specified: %s, accepted values are %v",
+			m, []RotationMethod{RotationRename, RotationLink})
+	}
+}
+
+// Durability decides how much File commits to stable storage on its own.
+type Durability string
+
+const (
+	DurabilityNone   Durability = "none"
+	DurabilityRotate Durability = "rotate"
+	DurabilityWrite  Durability = "write"
+)
+
+func (d Durability) lower() Durability { return Durability(strings.ToLower(string(d))) }
+
+// valid returns an error if its not valid
+func (d Durability) valid() error {
+	switch d {
+	case DurabilityNone, DurabilityRotate, DurabilityWrite:
+		return nil
+	default:
+		return fmt.Errorf("invalid durability specified: %s, accepted values are %v",
+			d, []Durability{DurabilityNone, DurabilityRotate, DurabilityWrite})
+	}
+}
+
 func (f *File) init() error {
 	f.initOnce.Do(func() {
-		if f.Filename == "" {
-			basename := filepath.Base(os.Args[0])
-			trimmedCmdName := strings.TrimSuffix(basename, filepath.Ext(basename))
-			name := trimmedCmdName + "-logfeller.log"
-			f.Filename = filepath.Join(os.TempDir(), name)
-		}
-		baseFilename := filepath.Base(f.Filename)
-		f.directory = filepath.Dir(f.Filename)
-		f.ext = filepath.Ext(baseFilename)
-		// get the base file name without extensions
-		f.fileBase = baseFilename[:len(baseFilename)-len(f.ext)]
-		if f.When == "" {
-			f.When = Day
-		} else {
-			f.When = f.When.lower()
+		if f.nowFunc == nil {
+			f.setNowFunc(time.Now)
 		}
-		if errInner := f.When.valid(); errInner != nil {
-			f.initErr = fmt.Errorf("logfeller: init failed, %v", errInner)
+		f.applyDefaults()
+		if f.initErr = f.configure(); f.initErr != nil {
 			return
 		}
-		// Populate the rotation schedule offsets
-		f.timeRotationSchedule = make([]timeSchedule, 0, len(f.RotationSchedule))
-		for _, schedule := range f.RotationSchedule {
-			sch, errInner := f.When.parseTimeSchedule(schedule)
-			if errInner != nil {
-				f.initErr = fmt.Errorf("logfeller: failed to parse rotation schedule \"%s\": %v", schedule, errInner)
-				return
-			}
-			f.timeRotationSchedule = append(f.timeRotationSchedule, sch)
+		f.mu.single = f.SingleWriter
+		if f.RotationCounter {
+			f.loadRotations()
 		}
-		if len(f.RotationSchedule) == 0 {
-			f.timeRotationSchedule = append(f.timeRotationSchedule, f.When.baseRotateTime())
+		f.startSampling()
+		if f.DailyQuotaBytes > 0 {
+			f.quota = &quota{}
 		}
-		sort.Sort(timeSchedules(f.timeRotationSchedule))
-		if f.BackupTimeFormat == "" {
-			f.BackupTimeFormat = defaultBackupTimeFormat
+		if f.NoGoroutines && f.RepairBackups {
+			f.repairBackups()
 		}
-		f.trimCh = make(chan struct{}, 1)
-		go func() {
-			for range f.trimCh {
-				_ = f.trim()
+		if !f.NoGoroutines {
+			f.trimCh = make(chan struct{}, 1)
+			if f.RepairBackups {
+				f.maintenance.request()
 			}
-		}()
-		if f.nowFunc == nil {
-			f.setNowFunc(time.Now)
+			go func() {
+				if f.RepairBackups {
+					f.maintenance.run(f.repairBackups)
+				}
+				for range f.trimCh {
+					f.maintenance.run(func() { _ = f.trim() })
+				}
+			}()
 		}
+		f.startShards()
+		f.startBackups()
+		f.startLiveness()
+		f.startAutoSync()
+		f.startTrigger()
+		f.startPeriodChecks()
+		f.startURing()
 	})
 	return f.initErr
 }
 
+// configure fills in defaults and validates the configuration of f, returning
+// a *ConfigError with every problem found.
+func (f *File) configure() error { //nolint:gocyclo,funlen // flat list of independent checks
+	var errs ConfigError
+	if f.Filename == "" {
+		basename := filepath.Base(os.Args[0])
+		trimmedCmdName := strings.TrimSuffix(basename, filepath.Ext(basename))
+		name := trimmedCmdName + "-logfeller.log"
+		f.Filename = filepath.Join(os.TempDir(), name)
+	} else if filename, err := expandPath(f.Filename); err != nil {
+		errs.add("filename", f.Filename, err)
+	} else {
+		f.Filename = filename
+	}
+	if f.BaseDir != "" {
+		baseDir, err := expandPath(f.BaseDir)
+		switch {
+		case err != nil:
+			errs.add("base_dir", f.BaseDir, err)
+		case !filepath.IsAbs(baseDir):
+			errs.add("base_dir", f.BaseDir, fmt.Errorf("base dir must be an absolute path"))
+		default:
+			f.BaseDir = baseDir
+			if !filepath.IsAbs(f.Filename) {
+				f.Filename = filepath.Join(f.BaseDir, f.Filename)
+			}
+		}
+	}
+	baseFilename := filepath.Base(f.Filename)
+	f.directory = filepath.Dir(f.Filename)
+	f.ext = filepath.Ext(baseFilename)
+	// get the base file name without extensions
+	f.fileBase = baseFilename[:len(baseFilename)-len(f.ext)]
+	f.backupDirectory = f.directory
+	if f.BackupDir != "" {
+		if backupDir, err := expandPath(f.BackupDir); err != nil {
+			errs.add("backup_dir", f.BackupDir, err)
+		} else if filepath.IsAbs(backupDir) {
+			f.backupDirectory = filepath.Clean(backupDir)
+		} else {
+			f.backupDirectory = filepath.Join(f.directory, backupDir)
+		}
+	}
+	if f.AuditLog != "" {
+		if auditLog, err := expandPath(f.AuditLog); err != nil {
+			errs.add("audit_log", f.AuditLog, err)
+		} else if !filepath.IsAbs(auditLog) {
+			f.AuditLog = filepath.Join(f.directory, auditLog)
+		} else {
+			f.AuditLog = auditLog
+		}
+	}
+	if f.TriggerFile != "" {
+		if triggerFile, err := expandPath(f.TriggerFile); err != nil {
+			errs.add("trigger_file", f.TriggerFile, err)
+		} else if !filepath.IsAbs(triggerFile) {
+			f.TriggerFile = filepath.Join(f.directory, triggerFile)
+		} else {
+			f.TriggerFile = triggerFile
+		}
+	}
+	if f.RecentFile != "" {
+		if recentFile, err := expandPath(f.RecentFile); err != nil {
+			errs.add("recent_file", f.RecentFile, err)
+		} else if !filepath.IsAbs(recentFile) {
+			f.RecentFile = filepath.Join(f.directory, recentFile)
+		} else {
+			f.RecentFile = recentFile
+		}
+		if f.RecentSize == 0 {
+			f.RecentSize = defaultRecentSize
+		}
+	}
+	if f.RecentSize < 0 {
+		errs.add("recent_size", strconv.FormatInt(f.RecentSize, 10), fmt.Errorf("recent size must not be negative"))
+	}
+	// join a placeholder to get the separator filepath.Join would add
+	f.backupPrefix = filepath.Join(f.backupDirectory, "_")
+	f.backupPrefix = f.backupPrefix[:len(f.backupPrefix)-1] + f.fileBase
+	if f.When == "" {
+		f.When = Day
+	} else {
+		f.When = f.When.lower()
+	}
+	whenErr := f.When.valid()
+	if whenErr != nil {
+		errs.add("when", "", whenErr)
+	}
+	if f.OnBackupCollision == "" {
+		f.OnBackupCollision = CollisionAppend
+	} else {
+		f.OnBackupCollision = f.OnBackupCollision.lower()
+	}
+	if err := f.OnBackupCollision.valid(); err != nil {
+		errs.add("on_backup_collision", "", err)
+	}
+	if f.RotationMethod == "" {
+		f.RotationMethod = RotationRename
+	} else {
+		f.RotationMethod = f.RotationMethod.lower()
+	}
+	if err := f.RotationMethod.valid(); err != nil {
+		errs.add("rotation_method", "", err)
+	}
+	if f.Durability == "" {
+		f.Durability = DurabilityNone
+	} else {
+		f.Durability = f.Durability.lower()
+	}
+	if err := f.Durability.valid(); err != nil {
+		errs.add("durability", "", err)
+	}
+	if f.DayOverflow == "" {
+		f.DayOverflow = DayOverflowClamp
+	} else {
+		f.DayOverflow = f.DayOverflow.lower()
+	}
+	if err := f.DayOverflow.valid(); err != nil {
+		errs.add("day_overflow", "", err)
+	}
+	if f.WeekParity == "" {
+		f.WeekParity = WeekParityAny
+	} else {
+		f.WeekParity = f.WeekParity.lower()
+	}
+	if err := f.WeekParity.valid(); err != nil {
+		errs.add("week_parity", "", err)
+	}
+	// Populate the rotation schedule offsets, they cannot be parsed without
+	// a valid When.
+	f.timeRotationSchedule = make([]timeSchedule, 0, len(f.RotationSchedule))
+	for i, schedule := range f.RotationSchedule {
+		if whenErr != nil {
+			break
+		}
+		sch, err := f.When.parseTimeSchedule(schedule)
+		if err == nil && f.DayOverflow == DayOverflowError {
+			err = f.When.scheduleAlwaysExists(sch)
+		}
+		if err != nil {
+			errs.add(fmt.Sprintf("rotation_schedule[%d]", i), schedule, err)
+			continue
+		}
+		f.timeRotationSchedule = append(f.timeRotationSchedule, sch)
+	}
+	if len(f.RotationSchedule) == 0 {
+		f.timeRotationSchedule = append(f.timeRotationSchedule, f.When.baseRotateTime())
+	}
+	if err := f.initEvery(); err != nil {
+		errs.add("every", f.Every.String(), err)
+	}
+	sort.Sort(timeSchedules(f.timeRotationSchedule))
+	f.initExtraSchedules(&errs)
+	f.blackoutWindows = make([]blackoutWindow, 0, len(f.BlackoutWindows))
+	for i, window := range f.BlackoutWindows {
+		w, err := parseBlackoutWindow(window)
+		if err != nil {
+			errs.add(fmt.Sprintf("blackout_windows[%d]", i), window, err)
+			continue
+		}
+		f.blackoutWindows = append(f.blackoutWindows, w)
+	}
+	if f.BackupTimeFormat == "" {
+		f.BackupTimeFormat = defaultBackupTimeFormat
+	} else if strings.Contains(f.BackupTimeFormat, "%") {
+		if layout, err := StrftimeLayout(f.BackupTimeFormat); err != nil {
+			errs.add("backup_time_format", f.BackupTimeFormat, err)
+		} else {
+			f.BackupTimeFormat = layout
+		}
+	}
+	if f.BackupTimeZone != "" {
+		loc, err := time.LoadLocation(f.BackupTimeZone)
+		if err != nil {
+			errs.add("backup_time_zone", f.BackupTimeZone, err)
+		}
+		f.backupLocation = loc
+	}
+	if f.OnClockRegression == "" {
+		f.OnClockRegression = ClockRegressionFreeze
+	} else {
+		f.OnClockRegression = f.OnClockRegression.lower()
+	}
+	if f.IndexInterval < 0 {
+		errs.add("index_interval", f.IndexInterval.String(), fmt.Errorf("index interval must not be negative"))
+	}
+	if f.IndexBytes < 0 {
+		errs.add("index_bytes", strconv.FormatInt(f.IndexBytes, 10), fmt.Errorf("index bytes must not be negative"))
+	}
+	if f.RetentionGrace < 0 {
+		errs.add("retention_grace", f.RetentionGrace.String(), fmt.Errorf("retention grace must not be negative"))
+	}
+	if f.TrashRetention < 0 {
+		errs.add("trash_retention", f.TrashRetention.String(), fmt.Errorf("trash retention must not be negative"))
+	}
+	if f.MaxSize < 0 {
+		errs.add("max_size", strconv.FormatInt(f.MaxSize, 10), fmt.Errorf("max size must not be negative"))
+	}
+	if f.CompressAfter < 0 {
+		errs.add("compress_after", strconv.Itoa(f.CompressAfter), fmt.Errorf("compress after must not be negative"))
+	}
+	if f.MaxAge < 0 {
+		errs.add("max_age", f.MaxAge.String(), fmt.Errorf("max age must not be negative"))
+	}
+	if f.StaleAfter < 0 {
+		errs.add("stale_after", f.StaleAfter.String(), fmt.Errorf("stale after must not be negative"))
+	}
+	if f.SyncInterval < 0 {
+		errs.add("sync_interval", f.SyncInterval.String(), fmt.Errorf("sync interval must not be negative"))
+	}
+	if f.TriggerInterval < 0 {
+		errs.add("trigger_interval", f.TriggerInterval.String(), fmt.Errorf("trigger interval must not be negative"))
+	} else if f.TriggerInterval == 0 && f.TriggerFile != "" {
+		f.TriggerInterval = Duration(defaultTriggerInterval)
+	}
+	if f.MinRotationInterval < 0 {
+		errs.add("min_rotation_interval", f.MinRotationInterval.String(), fmt.Errorf("min rotation interval must not be negative"))
+	}
+	if f.MaxBackupsPerPeriod < 0 {
+		errs.add("max_backups_per_period", strconv.Itoa(f.MaxBackupsPerPeriod), fmt.Errorf("max backups per period must not be negative"))
+	}
+	if f.Shards < 0 {
+		errs.add("shards", strconv.Itoa(f.Shards), fmt.Errorf("shards must not be negative"))
+	}
+	if f.SampleAbove < 0 {
+		errs.add("sample_above", strconv.Itoa(f.SampleAbove), fmt.Errorf("sample above must not be negative"))
+	}
+	if f.SampleEvery == 0 && f.SampleAbove > 0 {
+		f.SampleEvery = defaultSampleEvery
+	} else if f.SampleEvery < 0 {
+		errs.add("sample_every", strconv.Itoa(f.SampleEvery), fmt.Errorf("sample every must not be negative"))
+	}
+	if f.DailyQuotaBytes < 0 {
+		errs.add("daily_quota_bytes", strconv.FormatInt(f.DailyQuotaBytes, 10), fmt.Errorf("daily quota bytes must not be negative"))
+	}
+	if f.OnQuotaExceeded == "" {
+		f.OnQuotaExceeded = QuotaDrop
+	} else {
+		f.OnQuotaExceeded = f.OnQuotaExceeded.lower()
+	}
+	if err := f.OnQuotaExceeded.valid(); err != nil {
+		errs.add("on_quota_exceeded", "", err)
+	}
+	for _, t := range f.PressureThresholds {
+		if t <= 0 || t > 1 {
+			errs.add("pressure_thresholds", strconv.FormatFloat(t, 'g', -1, 64), fmt.Errorf("pressure thresholds must be above 0 and at most 1"))
+		}
+	}
+	if f.PressureFreeSpace < 0 {
+		errs.add("pressure_free_space", strconv.FormatInt(f.PressureFreeSpace, 10), fmt.Errorf("pressure free space must not be negative"))
+	}
+	if f.ShardMaxBytes < 0 {
+		errs.add("shard_max_bytes", strconv.Itoa(f.ShardMaxBytes), fmt.Errorf("shard max bytes must not be negative"))
+	}
+	if f.BufferSize < 0 {
+		errs.add("buffer_size", strconv.Itoa(f.BufferSize), fmt.Errorf("buffer size must not be negative"))
+	}
+	if f.CopyBufferSize == 0 {
+		f.CopyBufferSize = oneMB
+	} else if f.CopyBufferSize < 0 {
+		errs.add("copy_buffer_size", strconv.Itoa(f.CopyBufferSize), fmt.Errorf("copy buffer size must not be negative"))
+	}
+	if f.NoGoroutines && f.Shards > 0 {
+		errs.add("shards", strconv.Itoa(f.Shards), fmt.Errorf("shards cannot be used with no_goroutines"))
+	}
+	if f.SingleWriter && f.Shards > 0 {
+		errs.add("shards", strconv.Itoa(f.Shards), fmt.Errorf("shards cannot be used with single_writer"))
+	}
+	if f.SingleWriter && f.SyncInterval > 0 && !f.NoGoroutines {
+		errs.add("sync_interval", f.SyncInterval.String(), fmt.Errorf("sync interval cannot be used with single_writer unless no_goroutines is set"))
+	}
+	if f.SingleWriter && f.TriggerFile != "" && !f.NoGoroutines {
+		errs.add("trigger_file", f.TriggerFile, fmt.Errorf("trigger file cannot be used with single_writer unless no_goroutines is set"))
+	}
+	if f.NoGoroutines && f.BackgroundBackup {
+		errs.add("background_backup", "true", fmt.Errorf("background backup cannot be used with no_goroutines"))
+	}
+	if f.Archiver != nil && f.BackgroundBackup {
+		errs.add("background_backup", "true", fmt.Errorf("background backup cannot be used with an archiver"))
+	}
+	if f.ArchiveRetention {
+		if f.Archiver == nil {
+			errs.add("archive_retention", "true", fmt.Errorf("archive retention requires an archiver"))
+		} else if _, ok := f.Archiver.(ArchiveDeleter); !ok {
+			errs.add("archive_retention", "true", fmt.Errorf("archive retention requires the archiver to implement ArchiveDeleter"))
+		}
+	}
+	if f.NoGoroutines && f.IOUring {
+		errs.add("io_uring", "true", fmt.Errorf("io_uring cannot be used with no_goroutines"))
+	}
+	if f.ActiveCompression == "" {
+		f.ActiveCompression = ActiveCompressionNone
+	} else {
+		f.ActiveCompression = f.ActiveCompression.lower()
+	}
+	if err := f.ActiveCompression.valid(); err != nil {
+		errs.add("active_compression", "", err)
+	} else if f.ActiveCompression != ActiveCompressionNone {
+		if f.Compress {
+			errs.add("active_compression", string(f.ActiveCompression), fmt.Errorf("active compression cannot be used with compress"))
+		}
+		if f.IndexInterval > 0 || f.IndexBytes > 0 {
+			errs.add("active_compression", string(f.ActiveCompression), fmt.Errorf("active compression cannot be used with a time index"))
+		}
+		if f.WriteAhead {
+			// the write-ahead file mirrors the buffer before it is compressed
+			errs.add("active_compression", string(f.ActiveCompression), fmt.Errorf("active compression cannot be used with write ahead"))
+		}
+	}
+	if f.WriteAhead && f.BufferSize <= 0 {
+		errs.add("write_ahead", "true", fmt.Errorf("write ahead requires buffer_size to be set"))
+	}
+	if err := f.OnClockRegression.valid(); err != nil {
+		errs.add("on_clock_regression", "", err)
+	}
+	if f.OnEmptyRotation == "" && f.OneFilePerPeriod {
+		f.OnEmptyRotation = EmptyRotationBackup
+	} else if f.OnEmptyRotation == "" {
+		f.OnEmptyRotation = EmptyRotationReuse
+	} else {
+		f.OnEmptyRotation = f.OnEmptyRotation.lower()
+	}
+	if err := f.OnEmptyRotation.valid(); err != nil {
+		errs.add("on_empty_rotation", "", err)
+	}
+	if f.OneFilePerPeriod {
+		if f.OnEmptyRotation == EmptyRotationReuse {
+			errs.add("on_empty_rotation", string(f.OnEmptyRotation), fmt.Errorf("empty rotation reuse cannot be used with one_file_per_period"))
+		}
+		if f.OnBackupCollision != CollisionAppend {
+			errs.add("on_backup_collision", string(f.OnBackupCollision), fmt.Errorf("backup collision %s cannot be used with one_file_per_period", f.OnBackupCollision))
+		}
+		if f.MaxBackupsPerPeriod > 1 {
+			errs.add("max_backups_per_period", strconv.Itoa(f.MaxBackupsPerPeriod), fmt.Errorf("max backups per period cannot be used with one_file_per_period"))
+		}
+		// deferring a rotation leaves two periods in one file
+		if f.MinSize > 0 {
+			errs.add("min_size", strconv.FormatInt(f.MinSize, 10), fmt.Errorf("min size cannot be used with one_file_per_period"))
+		}
+		if f.MinRotationInterval > 0 {
+			errs.add("min_rotation_interval", f.MinRotationInterval.String(), fmt.Errorf("min rotation interval cannot be used with one_file_per_period"))
+		}
+		if len(f.BlackoutWindows) > 0 {
+			errs.add("blackout_windows", strings.Join(f.BlackoutWindows, ","), fmt.Errorf("blackout windows cannot be used with one_file_per_period"))
+		}
+	}
+	if f.BackupFormatCheck == "" {
+		f.BackupFormatCheck = FormatCheckWarn
+	} else {
+		f.BackupFormatCheck = f.BackupFormatCheck.lower()
+	}
+	if err := f.BackupFormatCheck.valid(); err != nil {
+		errs.add("backup_format_check", "", err)
+	}
+	if f.BackupNaming == "" {
+		f.BackupNaming = BackupNamingStart
+	} else {
+		f.BackupNaming = f.BackupNaming.lower()
+	}
+	if err := f.BackupNaming.valid(); err != nil {
+		errs.add("backup_naming", "", err)
+	}
+	if len(errs.Errors) > 0 {
+		// the checks below assume everything else is valid
+		return errs.err()
+	}
+	f.dedupeSchedules()
+	if err := f.validateBackupTimeFormat(); err != nil {
+		errs.add("backup_time_format", f.BackupTimeFormat, err)
+	}
+	if err := f.checkBackupTimeFormat(); err != nil {
+		errs.add("backup_time_format", f.BackupTimeFormat, err)
+	}
+	return errs.err()
+}
+
+// initEvery validates Every and defaults EveryAnchor.
+func (f *File) initEvery() error {
+	if f.Every < 0 {
+		return fmt.Errorf("every must not be negative, got %s", f.Every)
+	}
+	if f.Every == 0 {
+		return nil
+	}
+	if len(f.RotationSchedule) > 0 {
+		return fmt.Errorf("every and rotation schedule cannot be used together")
+	}
+	if f.EveryAnchor.IsZero() {
+		loc := time.UTC
+		if f.UseLocal {
+			loc = time.Local
+		}
+		f.EveryAnchor = time.Date(1970, time.January, 1, 0, 0, 0, 0, loc)
+	}
+	return nil
+}
+
+// validateBackupTimeFormat returns an error if BackupTimeFormat would give
+// consecutive Every rotations the same backup filename.
+func (f *File) validateBackupTimeFormat() error {
+	if f.Every <= 0 {
+		return nil
+	}
+	next := f.EveryAnchor.Add(time.Duration(f.Every))
+	if f.EveryAnchor.Format(f.BackupTimeFormat) == next.Format(f.BackupTimeFormat) {
+		return fmt.Errorf("backup time format \"%s\" is not precise enough for rotations every %s", f.BackupTimeFormat, f.Every)
+	}
+	return nil
+}
+
+// dedupeSchedules drops schedules that repeat an earlier one, or that fall
+// within the same backup timestamp as an earlier one and so would write to the
+// same backup file, emitting an EventConfigWarning for each schedule dropped.
+// f.timeRotationSchedule must already be sorted.
+func (f *File) dedupeSchedules() {
+	if len(f.timeRotationSchedule) < 2 {
+		return
+	}
+	// 2001 has no leap day, every schedule lands on its own day.
+	ref := f.When.periodStart(time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC))
+	kept := f.timeRotationSchedule[:1]
+	for _, curr := range f.timeRotationSchedule[1:] {
+		prev := kept[len(kept)-1]
+		var msg string
+		if prev == curr {
+			msg = fmt.Sprintf("duplicate rotation schedule %s ignored", curr.describe(f.When))
+		} else {
+			prevT, currT := f.When.nearestScheduledTime(ref, prev), f.When.nearestScheduledTime(ref, curr)
+			if prevT.Format(f.BackupTimeFormat) == currT.Format(f.BackupTimeFormat) {
+				msg = fmt.Sprintf("rotation schedule %s ignored, backup time format \"%s\" cannot tell it apart from %s",
+					curr.describe(f.When), f.BackupTimeFormat, prev.describe(f.When))
+			}
+		}
+		if msg != "" {
+			f.emit(Event{Type: EventConfigWarning, Filename: f.Filename, Message: msg})
+			continue
+		}
+		kept = append(kept, curr)
+	}
+	f.timeRotationSchedule = kept
+}
+
 // setNowFunc sets the nowFunc f uses to determine filenames, rotation times
 // etc. This function is used to mock out the time function used such that
 // we can have control over it in tests.
 func (f *File) setNowFunc(nf func() time.Time) { f.nowFunc = nf }
 
+// Validate initialises f, and returns the problems with its configuration as
+// a ConfigError. Files are initialised on their first use or when they are
+// decoded from JSON or YAML, Validate reports problems earlier for Files
+// configured otherwise, such as in code or with mapstructurehook.
+func (f *File) Validate() error {
+	return f.init()
+}
+
 func (f *File) UnmarshalJSON(data []byte) error {
 	type alias File
 	// Replace f with tmp and unmarshal there to prevent infinite loops
@@ -181,11 +1355,82 @@ func (f *File) UnmarshalYAML(unmarshal func(interface{}) error) error {
 // Write implements io.Writer, Write checks if *File should rotate first
 // before writing.
 func (f *File) Write(p []byte) (int, error) {
+	return f.WriteContext(context.Background(), p)
+}
+
+// WriteContext is like Write, but gives up and returns ctx.Err() if ctx is
+// done while waiting for another write, rotation or Close to finish. Once the
+// write has started it is not interrupted.
+func (f *File) WriteContext(ctx context.Context, p []byte) (int, error) {
+	return f.writeAll(ctx, [][]byte{p})
+}
+
+// writeAll is the pipeline of WriteContext and WriteBatchContext. ps are
+// passed through the hooks, sampling first, checked against the quota and then
+// written to the shards or the file as a single write. It returns the number
+// of bytes of ps written, which are taken as written in full if they were
+// dropped or changed along the way.
+func (f *File) writeAll(ctx context.Context, ps [][]byte) (int, error) {
 	if err := f.init(); err != nil {
 		return 0, err
 	}
-	f.mu.Lock()
+	var total int
+	for _, p := range ps {
+		total += len(p)
+	}
+	kept, err := f.runBatchHooks(ctx, ps)
+	if err != nil {
+		return 0, err
+	}
+	if len(kept) == 0 && len(ps) > 0 {
+		return total, nil
+	}
+	ps = kept
+	f.checkPressure()
+	var n int
+	for _, p := range ps {
+		n += len(p)
+	}
+	if keep, err := f.checkQuota(ctx, n); err != nil || !keep {
+		if err != nil {
+			return 0, err
+		}
+		return total, nil
+	}
+	if f.shards != nil {
+		if len(ps) == 1 {
+			f.writeShards(ps[0])
+		} else {
+			// keep the batch together in a single shard write
+			f.writeShards(bytes.Join(ps, nil))
+		}
+		return total, nil
+	}
+	if err := f.mu.LockContext(ctx); err != nil {
+		return 0, err
+	}
 	defer f.mu.Unlock()
+	written, err := f.writeBatchLocked(ps)
+	if err == nil {
+		// WriteHooks may have changed the length of the writes
+		return total, nil
+	}
+	if written > total {
+		written = total
+	}
+	return written, err
+}
+
+// writeLocked opens or rotates the file as needed, and writes p to it. It
+// must be called with f.mu held.
+func (f *File) writeLocked(p []byte) (int, error) {
+	return f.writeBatchLocked([][]byte{p})
+}
+
+// writeBatchLocked opens or rotates the file as needed, and writes ps to it.
+// Rotation is only checked once, so they all end up in the same file. It
+// must be called with f.mu held.
+func (f *File) writeBatchLocked(ps [][]byte) (int, error) {
 	if f.file == nil {
 		if err := f.openExistingOrNew(); err != nil {
 			return 0, err
@@ -194,60 +1439,406 @@ func (f *File) Write(p []byte) (int, error) {
 	if err := f.checkAndRotate(); err != nil {
 		return 0, err
 	}
-	return f.file.Write(p)
+	var n int
+	for _, p := range ps {
+		n += len(p)
+	}
+	if err := f.checkSize(n); err != nil {
+		return 0, err
+	}
+	var err error
+	if len(ps) == 1 {
+		n, err = f.write(ps[0])
+	} else {
+		n, err = f.writeBatch(ps)
+	}
+	f.checkFIFO(err)
+	return n, err
+}
+
+// Flush writes any buffered data to the current file without committing it
+// to stable storage. It is a no-op if BufferSize is not set.
+func (f *File) Flush() error {
+	if err := f.drainShards(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	err := f.flush()
+	f.checkFIFO(err)
+	return err
+}
+
+func (f *File) flush() error {
+	if f.buf == nil || f.file == nil {
+		return nil
+	}
+	if err := f.buf.Flush(); err != nil {
+		return err
+	}
+	f.resetWriteAhead()
+	return nil
 }
 
-// Sync commits the current file content to stable storage.
+// Sync flushes any buffered data and commits the current file content to
+// stable storage. On macOS, where fsync only hands the data to the drive,
+// commits are made with F_FULLFSYNC so that they survive power loss. It
+// flushes the drive's whole write cache, and can take tens of milliseconds
+// where fsync takes well under one, which is worth keeping in mind with a
+// Durability of "write".
 func (f *File) Sync() error {
+	if err := f.drainShards(); err != nil {
+		return err
+	}
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	if f.file == nil {
 		return nil
 	}
-	return f.file.Sync()
+	if err := f.flush(); err != nil {
+		return err
+	}
+	return f.syncFile()
 }
 
-// Close implements io.Closer, and closes the current file.
+// Close implements io.Closer. It flushes any buffered data, commits the file
+// content to stable storage and closes the current file, in that order, after
+// stopping the flusher of Shards and waiting for any BackgroundBackup.
 func (f *File) Close() error {
+	var errs multipleErrors
+	f.stopShards()
+	if err := f.drainShards(); err != nil {
+		errs = append(errs, fmt.Errorf("shard drain error: %v", err))
+	}
+	f.WaitBackups()
+	f.stopLiveness()
+	f.stopAutoSync()
+	f.stopTrigger()
+	f.periodChecks.stop()
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	return f.close()
+	if f.file == nil {
+		if err := f.closeWriteAhead(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := f.closeRecent(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := f.stopURing(); err != nil {
+			errs = append(errs, err)
+		}
+		return errs.err()
+	}
+	if notice := f.pendingSampleNotice(); notice != nil {
+		if _, err := f.write(notice); err != nil {
+			errs = append(errs, fmt.Errorf("sampling notice error: %v", err))
+		}
+	}
+	if err := f.writeFooter(footerReasonClosed); err != nil {
+		errs = append(errs, fmt.Errorf("footer error: %v", err))
+	}
+	if err := f.flush(); err != nil {
+		errs = append(errs, fmt.Errorf("flush error: %v", err))
+	} else if err := f.syncFile(); err != nil {
+		errs = append(errs, fmt.Errorf("sync error: %v", err))
+	}
+	if err := f.close(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := f.closeWriteAhead(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := f.closeRecent(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := f.stopURing(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs.err()
+}
+
+// resume restarts the background work stopped by Close when the file is
+// opened again after it, it does nothing for work that is running.
+func (f *File) resume() {
+	if f.liveness != nil {
+		f.liveness.checks.start()
+	}
+	if f.autoSync != nil {
+		f.autoSync.checks.start()
+	}
+	if f.trigger != nil {
+		f.trigger.checks.start()
+	}
+	f.periodChecks.start()
+	f.resumeURing()
 }
 
-// close closes the file if it is open.
+// close flushes any buffered data and closes the file if it is open.
 // sets file to nil.
 func (f *File) close() error {
 	if f.file == nil {
 		return nil
 	}
+	flushErr := f.flush()
 	err := f.file.Close()
 	f.file = nil
+	if flushErr != nil {
+		return flushErr
+	}
 	return err
 }
 
-// rotate closes the file and rotates it after that.
-func (f *File) rotate() error {
-	if err := f.close(); err != nil {
-		return fmt.Errorf("rotate close error: %v", err)
+// setFile sets fh as the file to write to.
+func (f *File) setFile(fh *os.File) {
+	f.resume()
+	f.file = fh
+	f.openedAt = f.nowFunc()
+	f.fileBytes, f.fileLines, f.markerBytes = 0, 0, 0
+	f.resetContentHash()
+	var size int64
+	if info, err := fh.Stat(); err == nil {
+		size = info.Size()
+	}
+	f.resetIndex(size)
+	f.updateCurrentLink()
+	f.resetStream(fh)
+	if f.BufferSize <= 0 {
+		return
+	}
+	if f.buf == nil {
+		f.buf = bufio.NewWriterSize(f.fileWriter(fh), f.BufferSize)
+		return
+	}
+	f.buf.Reset(f.fileWriter(fh))
+	f.resetWriteAhead()
+}
+
+// rotate closes the file and rotates it after that. If force is true, the
+// file is backed up even if it is empty, see ForceRotate. trigger is what
+// caused the rotation, as recorded in the AuditLog.
+func (f *File) rotate(force bool, trigger string) error {
+	if err := f.rotateOut(force, trigger); err != nil {
+		f.audit(AuditEntry{Action: AuditRotate, Trigger: trigger, Error: err.Error()})
+		return err
+	}
+	f.checkCadence(trigger)
+	return f.triggerTrim()
+}
+
+// rotateOut does the rotation of rotate, without trimming backups after.
+func (f *File) rotateOut(force bool, trigger string) error {
+	wasOpen, ended := f.file != nil, f.stats()
+	// decided before the markers and footer are written
+	empty := wasOpen && !f.hasOutput()
+	f.checkForeignRotation()
+	if err := f.writeEndMarker(); err != nil {
+		return fmt.Errorf("rotate marker error: %v", err)
+	}
+	if err := f.writeFooter(footerReasonRotated); err != nil {
+		return fmt.Errorf("rotate footer error: %v", err)
+	}
+	if err := f.syncRotated(); err != nil {
+		return fmt.Errorf("rotate sync error: %v", err)
+	}
+	if err := f.close(); err != nil {
+		return fmt.Errorf("rotate close error: %v", err)
+	}
+	if err := f.rotateOpen(force, empty); err != nil {
+		return fmt.Errorf("rotate open error: %v", err)
+	}
+	if job := f.lastBackupJob; job != nil {
+		f.lastRotated = f.nowFunc()
+		job.wasOpen, job.ended, job.at = wasOpen, ended, f.nowFunc()
+		job.rotation, job.trigger = f.countRotation(), trigger
+		// the period is over, rather than the file being rotated out part
+		// way through it
+		job.periodOver = trigger == TriggerSchedule
+		if f.BackgroundBackup {
+			f.queueBackup(job)
+		} else {
+			f.rotated(job)
+		}
+	}
+	return nil
+}
+
+// rotated records the rotation of the file into job.backup. Counts are only
+// known if the file was open.
+func (f *File) rotated(job *backupJob) {
+	e := Event{Type: EventRotation, Time: job.at, Filename: job.backup, Bytes: job.ended.Bytes, Lines: job.ended.Lines, Rotation: job.rotation}
+	e.Message = fmt.Sprintf("rotated %s to %s, %d bytes, %d lines", f.Filename, job.backup, job.ended.Bytes, job.ended.Lines)
+	if !job.wasOpen {
+		e.Message = fmt.Sprintf("rotated %s to %s", f.Filename, job.backup)
+	}
+	if f.BackupMetadata && job.wasOpen {
+		if err := f.writeMetadata(job.backup, job.ended, job.at, job.appended, job.rotation); err != nil {
+			e.Err = fmt.Errorf("unable to write backup metadata: %v", err)
+		}
+	}
+	f.emit(e)
+	f.audit(AuditEntry{Action: AuditRotate, Trigger: job.trigger, Backup: job.backup})
+	if job.periodOver {
+		f.periodsOver(job.period)
+	}
+}
+
+// Rotate closes the existing log file and flushes its content to backup.
+// new one. This is a helper function for applications to flush logs to backup.
+func (f *File) Rotate() error {
+	return f.rotateNow(false, TriggerRotate)
+}
+
+// ForceRotate is like Rotate, but always starts a new backup: an empty file
+// is backed up as an empty backup, and a backup that already exists for the
+// period is kept apart with a sequence suffix as with OnBackupCollision
+// "sequence". MaxBackupsPerPeriod still applies.
+func (f *File) ForceRotate() error {
+	return f.rotateNow(true, TriggerForceRotate)
+}
+
+func (f *File) rotateNow(force bool, trigger string) error {
+	if err := f.init(); err != nil {
+		return err
+	}
+	if err := f.drainShards(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fifo {
+		// named pipes are not rotated
+		return nil
+	}
+	if until, throttled := f.rotationThrottled(); throttled {
+		f.emitThrottled(until)
+		return nil
+	}
+	if f.rotateAt.IsZero() {
+		// nothing was written yet, name the backup after the current period
+		f.updateRotateAt(f.calcRotationTimes(f.now()))
+	}
+	if err := f.rotate(force, trigger); err != nil {
+		return err
+	}
+	if f.AnchorToCreation {
+		f.updateRotateAt(f.calcRotationTimes(f.now()))
+	}
+	return nil
+}
+
+// TruncateCurrent empties the active file in place without backing it up,
+// discarding any buffered data and writes held by Shards, and emits an
+// EventTruncate.
+func (f *File) TruncateCurrent() error {
+	if err := f.init(); err != nil {
+		return err
 	}
-	if err := f.rotateOpen(); err != nil {
-		return fmt.Errorf("rotate open error: %v", err)
+	if f.shards != nil {
+		// keep the flusher from writing out held writes after the truncation
+		f.shards.drainMu.Lock()
+		defer f.shards.drainMu.Unlock()
 	}
-	if err := f.triggerTrim(); err != nil {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.discardShards()
+	var err error
+	if f.file == nil {
+		err = os.Truncate(f.Filename, 0)
+		if os.IsNotExist(err) {
+			return nil
+		}
+	} else {
+		err = f.file.Truncate(0)
+		f.resetStream(f.file)
+		if f.buf != nil {
+			f.buf.Reset(f.fileWriter(f.file))
+			f.resetWriteAhead()
+		}
+		// the start marker is gone with the rest
+		f.fileBytes, f.fileLines, f.markerBytes = 0, 0, 0
+		f.resetContentHash()
+		f.resetIndex(0)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to truncate %s: %v", f.Filename, err)
+	}
+	if err := removeIndex(f.Filename); err != nil {
 		return err
 	}
+	f.emit(Event{Type: EventTruncate, Filename: f.Filename, Message: fmt.Sprintf("truncated %s", f.Filename)})
 	return nil
 }
 
-// Rotate closes the existing log file and flushes its content to backup.
-// new one. This is a helper function for applications to flush logs to backup.
-func (f *File) Rotate() error {
+// RemoveAll closes the active file and deletes it along with all backups of
+// f, their sidecars, any of them in the trash directory, its write-ahead file
+// and its RotationCounter. Backups stored by the Archiver are deleted from it
+// if it is an ArchiveDeleter. f can be written to again afterwards, starting
+// a new file.
+func (f *File) RemoveAll() error {
+	if err := f.init(); err != nil {
+		return err
+	}
+	f.WaitBackups()
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	return f.rotate()
+	var errs multipleErrors
+	if err := f.close(); err != nil {
+		errs = append(errs, err)
+	}
+	f.updateRotateAt(time.Time{}, time.Time{})
+	f.highWater, f.regressed, f.regressionRotate = time.Time{}, false, false
+	f.lastRotated = time.Time{}
+	backups, err := f.backups()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, b := range backups {
+		if _, ok := f.Archiver.(ArchiveDeleter); b.Remote && !ok {
+			// the archive keeps it
+			continue
+		}
+		err := f.deleteBackupOf(b)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		f.audit(AuditEntry{Action: AuditRemove, Trigger: TriggerRemoveAll, Backup: b.Name, Error: errString(err)})
+	}
+	if err := f.removeTrash(time.Time{}); err != nil {
+		errs = append(errs, err)
+	}
+	// a named pipe or the like belongs to its reader, it is left as is
+	if info, err := os.Stat(f.Filename); err != nil || info.Mode().IsRegular() {
+		if err := os.Remove(f.Filename); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	if err := removeIndex(f.Filename); err != nil {
+		errs = append(errs, err)
+	}
+	if err := f.closeWriteAhead(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := os.Remove(WriteAheadFilename(f.Filename)); err != nil && !os.IsNotExist(err) {
+		errs = append(errs, err)
+	}
+	f.rotations = 0
+	if err := os.Remove(f.rotationsFilename()); err != nil && !os.IsNotExist(err) {
+		errs = append(errs, err)
+	}
+	if err := f.removeCurrentLink(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs.err()
 }
 
 func (f *File) openExistingOrNew() error {
+	if info, err := os.Stat(f.Filename); err == nil && isFIFO(info) {
+		return f.openFIFO()
+	}
+	f.fifo = false
+	if err := f.openWriteAhead(); err != nil {
+		return err
+	}
 	if err := f.triggerTrim(); err != nil {
 		return err
 	}
@@ -255,8 +1846,8 @@ func (f *File) openExistingOrNew() error {
 	if os.IsNotExist(err) {
 		// If opening something new that previously didnt exist, we rotate
 		// based on current time.
-		f.updateRotateAt(f.calcRotationTimes(f.nowFunc()))
-		return f.rotateOpen()
+		f.updateRotateAt(f.calcRotationTimes(f.now()))
+		return f.rotateOpen(false, false)
 	}
 	if err != nil {
 		return fmt.Errorf("error getting file info: %v", err)
@@ -271,9 +1862,9 @@ func (f *File) openExistingOrNew() error {
 	fh, err := os.OpenFile(f.Filename, fileWriteCreateAppendFlag, fileOpenMode)
 	if err != nil {
 		// last resort
-		return f.rotateOpen()
+		return f.rotateOpen(false, false)
 	}
-	f.file = fh
+	f.setFile(fh)
 	return nil
 }
 
@@ -285,71 +1876,367 @@ func (f *File) time(t time.Time) time.Time {
 	return t
 }
 
-func (f *File) shouldRotate() bool {
-	return f.time(f.nowFunc()).After(f.rotateAt)
+// backupTime converts t to the time zone used in backup filenames.
+func (f *File) backupTime(t time.Time) time.Time {
+	if f.backupLocation != nil {
+		return t.In(f.backupLocation)
+	}
+	return f.time(t)
+}
+
+// backupLocationOrDefault returns the time zone of backup filenames, which
+// is BackupTimeZone if set, else the local time zone if UseLocal is set, and
+// UTC otherwise.
+func (f *File) backupLocationOrDefault() *time.Location {
+	if f.backupLocation != nil {
+		return f.backupLocation
+	}
+	if f.UseLocal {
+		return time.Local
+	}
+	return time.UTC
+}
+
+func (f *File) shouldRotate(now time.Time) bool {
+	due := f.regressionRotate || f.time(now).After(f.rotateAt)
+	return due && !f.inBlackout(now)
 }
 
 func (f *File) checkAndRotate() error {
-	if f.shouldRotate() {
-		err := f.rotate()
-		f.updateRotateAt(f.calcRotationTimes(f.nowFunc()))
+	if f.fifo {
+		return nil
+	}
+	now := f.now()
+	if f.shouldRotate(now) {
+		if f.belowMinSize() {
+			// defer to the next schedule, the backup keeps its name
+			_, f.rotateAt = f.calcRotationTimes(now)
+			return nil
+		}
+		if until, throttled := f.rotationThrottled(); throttled {
+			// defer until the interval has passed, the backup keeps its name
+			if !f.rotateAt.Equal(until) {
+				f.rotateAt = until
+				f.emitThrottled(until)
+			}
+			return nil
+		}
+		trigger := TriggerSchedule
+		if f.regressionRotate {
+			trigger = TriggerClockRegression
+		}
+		f.regressionRotate = false
+		force, err := f.prepareEmptyRotation()
+		if err == nil {
+			err = f.fillIdlePeriods(now)
+		}
+		if err == nil {
+			err = f.rotate(force, trigger)
+		}
+		f.updateRotateAt(f.calcRotationTimes(now))
 		return err
 	}
 	return nil
 }
 
+// checkSize rotates the file if writing n more bytes would take it past
+// MaxSize.
+func (f *File) checkSize(n int) error {
+	if f.fifo || f.MaxSize <= 0 || f.fileOffset == 0 || f.fileOffset+int64(n) <= f.MaxSize {
+		return nil
+	}
+	return f.rotate(true, TriggerSize)
+}
+
+// rotationThrottled reports if the file was rotated less than
+// MinRotationInterval ago, and returns when it may be rotated again if so.
+func (f *File) rotationThrottled() (until time.Time, throttled bool) {
+	if f.MinRotationInterval <= 0 || f.lastRotated.IsZero() {
+		return time.Time{}, false
+	}
+	interval := time.Duration(f.MinRotationInterval)
+	if f.nowFunc().Sub(f.lastRotated) >= interval {
+		return time.Time{}, false
+	}
+	return f.time(f.lastRotated.Add(interval)), true
+}
+
+func (f *File) emitThrottled(until time.Time) {
+	f.emit(Event{
+		Type:     EventRotationThrottled,
+		Filename: f.Filename,
+		Message:  fmt.Sprintf("rotation of %s throttled until %s", f.Filename, until.Format(time.RFC3339)),
+	})
+}
+
+// belowMinSize reports if the current file is smaller than MinSize.
+func (f *File) belowMinSize() bool {
+	if f.MinSize <= 0 || f.file == nil {
+		return false
+	}
+	info, err := f.file.Stat()
+	if err != nil {
+		return false
+	}
+	size := info.Size()
+	if f.buf != nil {
+		size += int64(f.buf.Buffered())
+	}
+	return size < f.MinSize
+}
+
+// now returns the time used for rotation decisions. It guards against the
+// wall clock stepping backwards by comparing against the latest time
+// observed, and handles any regression based on f.OnClockRegression.
+func (f *File) now() time.Time {
+	t := f.nowFunc()
+	if f.highWater.IsZero() || !t.Round(0).Before(f.highWater.Round(0)) {
+		// Round(0) strips the monotonic reading, so the comparison above is
+		// on the wall clock. Any monotonic reading in t is retained.
+		f.highWater = t
+		f.regressed = false
+		return t
+	}
+	if f.OnClockRegression == ClockRegressionSequence {
+		if !f.regressed {
+			f.regressionRotate = true
+		}
+		f.regressed = true
+		return t
+	}
+	f.regressed = true
+	return f.highWater
+}
+
 // rotateOpen moves any existing log file and opens a new log file for writing.
-// This function assumes that the original file has already been closed.
-func (f *File) rotateOpen() error {
+// This function assumes that the original file has already been closed. If
+// force is true, an empty or missing file is backed up as an empty backup.
+// If empty is true, the file was open without output and is reused unless
+// force is true, even if it holds a start marker.
+func (f *File) rotateOpen(force, empty bool) error {
 	if err := os.MkdirAll(f.directory, dirCreateMode); err != nil {
 		return fmt.Errorf("cannot make directories for new logfiles at %s: %v", f.Filename, err)
 	}
+	if err := os.MkdirAll(f.backupDirectory, dirCreateMode); err != nil {
+		return fmt.Errorf("cannot make backup directory %s: %v", f.backupDirectory, err)
+	}
 	mode := fileOpenMode
-	if info, err := os.Stat(f.Filename); err == nil && info.Size() > 0 {
+	f.lastBackup, f.lastBackupJob = "", nil
+	if force {
+		if err := touch(f.Filename, mode); err != nil {
+			return err
+		}
+	}
+	if info, err := os.Stat(f.Filename); err == nil && ((info.Size() > 0 && !empty) || force) {
 		// TODO: Potentially need a file locking mechanism here otherwise
 		// writes and deletes may not be correctly synchronised.
 		mode = info.Mode()
-		// use prevRotateAt as the log was for the previous day
-		dstFilename := f.filenameWithTimestamp(f.time(f.prevRotateAt))
-		originalFilestat, err1 := os.Stat(f.Filename)
-		_, err2 := os.Stat(dstFilename)
-		originalFileExistAndIsNotEmpty := err1 == nil && originalFilestat.Size() > 0
-		if originalFileExistAndIsNotEmpty {
-			// original file exists and its not empty, ready to be rotated
-			if os.IsNotExist(err2) {
-				// If dst doesnt exist, move orignal file to dst path.
-				if err := os.Rename(f.Filename, dstFilename); err != nil {
-					return fmt.Errorf("unable to rename file %s to %s with err: %v", f.Filename, dstFilename, err)
-				}
+		job := &backupJob{
+			src: f.Filename,
+			// use prevRotateAt as the log was for the previous day
+			dst:       f.filenameWithTimestamp(f.prevRotateAt),
+			period:    f.prevRotateAt,
+			regressed: f.regressed,
+			force:     force,
+			mode:      mode,
+		}
+		if f.BackgroundBackup {
+			if err := f.stageBackup(job); err != nil {
+				return err
 			}
-			if err2 == nil {
-				// If dstfilename is found somehow, we flush current file's content
-				// to this dst file
-				dstFile, err := os.OpenFile(dstFilename, fileWriteAppend, mode)
-				if err != nil {
-					return fmt.Errorf("open existing dst file %s to append fail with err: %v", dstFilename, err)
-				}
-				file, err := os.Open(f.Filename)
-				if err != nil {
-					return fmt.Errorf("open file %s to append to existing dst fail with err: %v", f.Filename, err)
-				}
-				buf := make([]byte, oneMB)
-				_, err = io.CopyBuffer(dstFile, file, buf)
-				if err != nil {
-					return fmt.Errorf("copy append from file %s to dst %s fail with error: %v", f.Filename, dstFilename, err)
-				}
-				dstFile.Close()
-				file.Close()
-				// Remove the existing file after appending, we ignore the error here
-				_ = os.Remove(f.Filename)
+			// the backup it ends up in is only known later
+			f.lastBackup = job.dst
+		} else {
+			if err := f.backup(job); err != nil {
+				return err
 			}
+			f.lastBackup = job.backup
+		}
+		f.lastBackupJob = job
+		if f.RotationMethod == RotationLink {
+			return f.replaceActive(mode)
 		}
 	}
 	fh, err := os.OpenFile(f.Filename, fileWriteCreateAppendFlag, mode)
 	if err != nil {
 		return err
 	}
-	f.file = fh
+	f.syncDirs(f.Filename)
+	f.setFile(fh)
+	if empty && f.lastBackupJob == nil {
+		// the reused file holds no output either
+		f.markerBytes = f.fileOffset
+	}
+	return f.writeStartMarker()
+}
+
+// backup moves job.src to its backup filename job.dst, existing backups of
+// the same name are handled based on f.OnBackupCollision, or sequenced if
+// job.force is true. It records the backup it ended up in into job.
+func (f *File) backup(job *backupJob) error {
+	// keep trim from compressing or removing a backup appended to here
+	f.trimMu.Lock()
+	defer f.trimMu.Unlock()
+	if latest, full := f.periodFull(job.dst); full {
+		return f.appendTo(job, latest)
+	}
+	// a backup moved to the Archiver collides as if it were still here
+	if err := f.restoreArchived(job.dst); err != nil {
+		return err
+	}
+	_, err := os.Stat(job.dst)
+	compressed := f.compressedExists(job.dst)
+	if os.IsNotExist(err) && !compressed {
+		// If dst doesnt exist, move orignal file to dst path.
+		return f.renameTo(job, job.dst)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error getting file info of backup %s: %v", job.dst, err)
+	}
+	policy := f.OnBackupCollision
+	if job.regressed && f.OnClockRegression == ClockRegressionSequence {
+		// The clock went backwards, dst is most likely a backup for
+		// a period that we are now repeating, keep them apart.
+		policy = CollisionSequence
+	}
+	if job.force {
+		policy = CollisionSequence
+	}
+	if f.OneFilePerPeriod {
+		// rotations within a period are merged into its backup
+		policy = CollisionAppend
+	} else {
+		f.emit(Event{
+			Type:     EventBackupCollision,
+			Filename: job.dst,
+			Message:  fmt.Sprintf("backup %s already exists, resolving with the %s policy", job.dst, policy),
+		})
+	}
+	switch policy {
+	case CollisionSequence:
+		dst, err := f.sequencedFilename(job.period)
+		if err != nil {
+			return err
+		}
+		return f.renameTo(job, dst)
+	case CollisionOverwrite:
+		if compressed {
+			if err := deleteBackup(job.dst + compressExt); err != nil {
+				return err
+			}
+		}
+		return f.renameTo(job, job.dst)
+	case CollisionError:
+		return fmt.Errorf("unable to backup file %s, backup %s already exists", f.Filename, job.dst)
+	default:
+		if os.IsNotExist(err) {
+			// only the compressed backup exists, it is appended to when
+			// this one is compressed
+			return f.renameTo(job, job.dst)
+		}
+		return f.appendTo(job, job.dst)
+	}
+}
+
+// periodFull reports if the period of the backup dstFilename already has
+// MaxBackupsPerPeriod backups, and returns the latest of them that can be
+// appended to if so.
+func (f *File) periodFull(dstFilename string) (latest string, full bool) {
+	if f.MaxBackupsPerPeriod <= 0 {
+		return "", false
+	}
+	t, _, ok := f.parseBackupName(filepath.Base(dstFilename))
+	if !ok {
+		return "", false
+	}
+	backups, err := f.backups()
+	if err != nil {
+		return "", false
+	}
+	var n int
+	for _, b := range backups {
+		if !b.Time.Equal(t) {
+			continue
+		}
+		n++
+		if b.Encoded == "" && !b.Remote {
+			latest = b.Name
+		}
+	}
+	// encoded backups cannot be appended to
+	return latest, latest != "" && n >= f.MaxBackupsPerPeriod
+}
+
+// touch creates the file name if it does not exist.
+func touch(name string, mode os.FileMode) error {
+	fh, err := os.OpenFile(name, fileWriteCreateAppendFlag, mode)
+	if err != nil {
+		return err
+	}
+	return fh.Close()
+}
+
+// renameTo moves job.src to dstFilename.
+func (f *File) renameTo(job *backupJob, dstFilename string) error {
+	if err := f.moveActive(job.src, dstFilename); err != nil {
+		return fmt.Errorf("unable to rename file %s to %s with err: %v", job.src, dstFilename, err)
+	}
+	if err := renameIndex(job.src, dstFilename); err != nil {
+		f.emit(Event{Type: EventIndexError, Filename: IndexFilename(dstFilename), Message: "unable to move time index", Err: err})
+	}
+	job.backup = dstFilename
+	return nil
+}
+
+// appendTo flushes job.src's content to the existing dstFilename and removes
+// job.src.
+func (f *File) appendTo(job *backupJob, dstFilename string) error {
+	if info, err := os.Stat(job.src); err == nil && !f.hasSpaceFor(dstFilename, info.Size(), "append to "+dstFilename) {
+		if f.OneFilePerPeriod {
+			// the period has a single backup, job.src is left to retry
+			return fmt.Errorf("not enough space to append %s to %s, one_file_per_period keeps no other backup", job.src, dstFilename)
+		}
+		// a rename takes no space, keep job.src apart instead
+		dst, err := f.sequencedFilename(job.period)
+		if err != nil {
+			return err
+		}
+		return f.renameTo(job, dst)
+	}
+	dstFile, err := os.OpenFile(dstFilename, fileWriteCopyTo, job.mode)
+	if err != nil {
+		return fmt.Errorf("open existing dst file %s to append fail with err: %v", dstFilename, err)
+	}
+	defer dstFile.Close()
+	var shift int64
+	if info, err := dstFile.Stat(); err == nil {
+		shift = info.Size()
+	}
+	file, err := os.Open(job.src)
+	if err != nil {
+		return fmt.Errorf("open file %s to append to existing dst fail with err: %v", job.src, err)
+	}
+	defer file.Close()
+	_, err = copyFile(dstFile, file, f.CopyBufferSize)
+	if err != nil {
+		return fmt.Errorf("copy append from file %s to dst %s fail with error: %v", job.src, dstFilename, err)
+	}
+	if f.Durability != DurabilityNone {
+		// commit the content before its only other copy is removed
+		if err := dstFile.Sync(); err != nil {
+			return fmt.Errorf("sync dst %s after append fail with error: %v", dstFilename, err)
+		}
+	}
+	// Remove the existing file after appending, we ignore the error here.
+	// The active file is replaced instead when rotating by link.
+	if !f.linking(job.src) {
+		_ = os.Remove(job.src)
+		f.syncDirs(job.src)
+	}
+	if err := appendIndexTo(job.src, dstFilename, shift); err != nil {
+		f.emit(Event{Type: EventIndexError, Filename: IndexFilename(dstFilename), Message: "unable to move time index", Err: err})
+	}
+	job.backup, job.appended = dstFilename, true
 	return nil
 }
 
@@ -358,42 +2245,235 @@ func (f *File) rotateOpen() error {
 // This function ignores any potential problems with daylight savings
 func (f *File) calcRotationTimes(t time.Time) (prev, next time.Time) {
 	t = f.time(t)
-	r := f.When
-	timeSchedules := f.timeRotationSchedule
-	// Check first offset time first by picking out the last entry and minus 1 Hour/Day/Month/Year
-	firstOffsetToCheck := r.addTime(r.nearestScheduledTime(t, timeSchedules[len(timeSchedules)-1]), -1)
-	if firstOffsetToCheck.After(t) {
-		return prev, firstOffsetToCheck
-	}
-	var lastOffsetToCheck time.Time
-	next = firstOffsetToCheck
-	for i, sch := range timeSchedules {
-		prev = next
-		next = r.nearestScheduledTime(t, sch)
-		if i == 0 {
-			// last offset entry to check is the 1st offset time but add 1 Hour/Day/Month/Year
-			lastOffsetToCheck = r.addTime(next, 1)
-		}
-		if !next.After(t) {
-			continue
+	if f.AnchorToCreation {
+		return f.calcAnchoredRotationTimes(t)
+	}
+	if f.Every > 0 {
+		return f.calcEveryRotationTimes(t)
+	}
+	prev, next = f.scheduledTimes(f.When, f.timeRotationSchedule, t)
+	for _, g := range f.extraSchedules {
+		p, n := f.scheduledTimes(g.when, g.times, t)
+		if p.After(prev) {
+			prev = p
+		}
+		if n.Before(next) {
+			next = n
+		}
+	}
+	return prev, next
+}
+
+// scheduledTimes returns the rotation times around t of a When of r with the
+// schedules times.
+func (f *File) scheduledTimes(r WhenRotate, times []timeSchedule, t time.Time) (prev, next time.Time) {
+	return r.scheduledTimes(times, t, f.DayOverflow == DayOverflowSkip, f.isRotationDay)
+}
+
+// scheduledTimes returns the rotation times around t with the schedules
+// times. Schedules that do not exist in a period are skipped if skipMissing
+// is true, and clamped otherwise. Only times isRotationDay allows are used,
+// all of them if it is nil.
+func (r WhenRotate) scheduledTimes(times []timeSchedule, t time.Time, skipMissing bool, isRotationDay func(time.Time) bool) (prev, next time.Time) {
+	start := r.periodStart(t)
+	// Check the schedules of the periods surrounding t, moving outwards
+	// until both times are found as schedules may be skipped.
+	for n := 0; n <= maxPeriodSearchSpan && (prev.IsZero() || next.IsZero()); n++ {
+		for _, periodStart := range [...]time.Time{r.addTime(start, -n), r.addTime(start, n)} {
+			for _, sch := range times {
+				if skipMissing && !r.scheduleExists(periodStart, sch) {
+					continue
+				}
+				scheduled := r.nearestScheduledTime(periodStart, sch)
+				if isRotationDay != nil && !isRotationDay(scheduled) {
+					continue
+				}
+				switch {
+				case !scheduled.After(t):
+					if scheduled.After(prev) {
+						prev = scheduled
+					}
+				case next.IsZero() || scheduled.Before(next):
+					next = scheduled
+				}
+			}
 		}
-		return prev, next
 	}
-	if lastOffsetToCheck.After(t) {
-		return next, lastOffsetToCheck
+	if !prev.IsZero() && !next.IsZero() {
+		return prev, next
 	}
 	// Code should not reach here, if it did anyway it will move the date
 	// forward by 1 * (when), and prev will be assumed to be - 1 * (when)
 	return t.Add(-r.interval(t)), t.Add(r.interval(t))
 }
 
+// calcEveryRotationTimes calculates the next and previous rotation times
+// based on Every and EveryAnchor.
+func (f *File) calcEveryRotationTimes(t time.Time) (prev, next time.Time) {
+	every := time.Duration(f.Every)
+	elapsed := t.Sub(f.EveryAnchor)
+	n := elapsed / every
+	if elapsed < 0 && elapsed%every != 0 {
+		// round towards negative infinity
+		n--
+	}
+	prev = f.EveryAnchor.Add(n * every).In(t.Location())
+	next = prev.Add(every)
+	for i := 0; i < maxPeriodSearchSpan && !f.isRotationDay(prev); i++ {
+		prev = prev.Add(-every)
+	}
+	for i := 0; i < maxPeriodSearchSpan && !f.isRotationDay(next); i++ {
+		next = next.Add(every)
+	}
+	return prev, next
+}
+
+// calcAnchoredRotationTimes calculates the rotation times of a file created
+// at t, which rotates once it is one interval old.
+func (f *File) calcAnchoredRotationTimes(t time.Time) (prev, next time.Time) {
+	step := func(t time.Time) time.Time { return f.When.addTime(t, 1) }
+	if f.Every > 0 {
+		step = func(t time.Time) time.Time { return t.Add(time.Duration(f.Every)) }
+	}
+	next = step(t)
+	for i := 0; i < maxPeriodSearchSpan && !f.isRotationDay(next); i++ {
+		next = step(next)
+	}
+	return t, next
+}
+
+// isRotationDay reports if rotations scheduled on the day of t may happen.
+func (f *File) isRotationDay(t time.Time) bool {
+	if f.WeekdaysOnly {
+		if wd := t.Weekday(); wd == time.Saturday || wd == time.Sunday {
+			return false
+		}
+	}
+	if !f.WeekParity.matches(t) {
+		return false
+	}
+	if f.IsRotationDay != nil {
+		return f.IsRotationDay(t)
+	}
+	return true
+}
+
+// maxPooledBuf is the largest buffer put back into bufPool.
+const maxPooledBuf = 64 * 1024
+
+// bufPool pools intermediate buffers, like those backup filenames are built
+// in.
+var bufPool = sync.Pool{New: func() interface{} {
+	b := make([]byte, 0, 256)
+	return &b
+}}
+
 // filenameWithTimestamp returns a new filename with timestamps from the given
 // time t passed in. If the filename was /var/www/some-app/info.log,
 // then the resultant filename will be /var/www/some-app/info<timstamp>.log
-// It uses the timstamp format from f.BackupTimeFormat.
+// It uses the timstamp format from f.BackupTimeFormat. The last filename is
+// cached as it is asked for with the same t for the whole rotation period.
 func (f *File) filenameWithTimestamp(t time.Time) string {
-	timestamp := t.Format(f.BackupTimeFormat)
-	return filepath.Join(f.directory, fmt.Sprint(f.fileBase, timestamp, f.ext))
+	if t.Equal(f.backupNameAt) && f.backupName != "" {
+		return f.backupName
+	}
+	f.backupNameAt, f.backupName = t, f.backupFilename(t, 0)
+	return f.backupName
+}
+
+// sequencedFilename returns the first filename from filenameWithTimestamp
+// with a sequence suffix that does not exist yet, locally or in the Archiver.
+// If the filename was /var/www/some-app/info.log, then the resultant filename
+// will be /var/www/some-app/info<timestamp>_<n>.log
+func (f *File) sequencedFilename(t time.Time) (string, error) {
+	archived, err := f.archivedNames()
+	if err != nil {
+		return "", err
+	}
+	for n := 1; ; n++ {
+		name := f.backupFilename(t, n)
+		if _, err := os.Stat(name); os.IsNotExist(err) && !f.compressedExists(name) && !archived[filepath.Base(name)] {
+			return name, nil
+		}
+	}
+}
+
+// backupFilename builds the backup filename for t, with the sequence suffix
+// seq if it is above 0.
+func (f *File) backupFilename(t time.Time, seq int) string {
+	bp := bufPool.Get().(*[]byte)
+	b := append((*bp)[:0], f.backupPrefix...)
+	b = f.backupTime(t).AppendFormat(b, f.BackupTimeFormat)
+	if f.BackupNaming == BackupNamingPeriod {
+		_, end := f.calcRotationTimes(t)
+		b = append(b, periodSep...)
+		b = f.backupTime(end).AppendFormat(b, f.periodEndFormat())
+	}
+	if seq > 0 {
+		b = append(b, sequenceSep...)
+		b = strconv.AppendInt(b, int64(seq), 10)
+	}
+	b = append(b, f.ext...)
+	name := string(b)
+	*bp = b
+	bufPool.Put(bp)
+	return name
+}
+
+// parseBackupTimestamp parses the timestamp encoded in a backup filename,
+// with its base name and extension trimmed, returning the time and the
+// sequence number if it has one.
+func (f *File) parseBackupTimestamp(timestamp string) (t time.Time, seq int, err error) {
+	t, err = f.parseBackupTime(timestamp)
+	if err == nil {
+		return t, 0, nil
+	}
+	i := strings.LastIndex(timestamp, sequenceSep)
+	if i < 0 {
+		return t, 0, err
+	}
+	seq, errSeq := strconv.Atoi(timestamp[i+len(sequenceSep):])
+	if errSeq != nil || seq < 1 {
+		return t, 0, err
+	}
+	t, err = f.parseBackupTime(timestamp[:i])
+	return t, seq, err
+}
+
+// parseBackupTime parses the timestamp of a backup without a sequence
+// number, returning the start of its period. With a BackupNaming of
+// "period", the end of the period is expected after the start, and is
+// optional.
+func (f *File) parseBackupTime(timestamp string) (time.Time, error) {
+	loc := f.backupLocationOrDefault()
+	t, err := time.ParseInLocation(f.BackupTimeFormat, timestamp, loc)
+	if err == nil || f.BackupNaming != BackupNamingPeriod {
+		return t, err
+	}
+	// the separator may also be within the timestamps, try each of them
+	for i := strings.Index(timestamp, periodSep); i >= 0; {
+		start, startErr := time.ParseInLocation(f.BackupTimeFormat, timestamp[:i], loc)
+		if startErr == nil {
+			if _, endErr := time.ParseInLocation(f.periodEndFormat(), timestamp[i+len(periodSep):], loc); endErr == nil {
+				return start, nil
+			}
+		}
+		j := strings.Index(timestamp[i+len(periodSep):], periodSep)
+		if j < 0 {
+			break
+		}
+		i += len(periodSep) + j
+	}
+	return t, err
+}
+
+// periodEndFormat is the layout of the end of the period in backup
+// filenames with a BackupNaming of "period".
+func (f *File) periodEndFormat() string {
+	if layout := strings.TrimLeft(f.BackupTimeFormat, periodEndTrim); layout != "" {
+		return layout
+	}
+	return f.BackupTimeFormat
 }
 
 // updateRotateAt updates prevRotateAt and rotateAt
@@ -407,59 +2487,160 @@ func (f *File) triggerTrim() error {
 	if err := f.init(); err != nil {
 		return err
 	}
+	if f.NoGoroutines {
+		_ = f.trim()
+		return nil
+	}
+	f.maintenance.request()
 	f.trimCh <- struct{}{}
 	return nil
 }
 
+// Maintain runs the maintenance that otherwise follows rotations right away or
+// runs on timers: it removes backups beyond Backups, purges expired backups
+// from the trash, and does the StaleAfter, SyncInterval and TriggerFile
+// checks. It is meant for NoGoroutines, but can be used in any mode.
+func (f *File) Maintain() error {
+	if err := f.init(); err != nil {
+		return err
+	}
+	f.checkStale()
+	f.syncWrites()
+	f.checkTrigger()
+	return f.trim()
+}
+
 // trim does the cleanup of rotated backup files
 func (f *File) trim() error {
-	if f.Backups <= 0 {
-		return nil
+	f.trimMu.Lock()
+	defer f.trimMu.Unlock()
+	var errs multipleErrors
+	if err := f.purgeTrash(); err != nil {
+		errs = append(errs, err)
+	}
+	if f.Backups <= 0 && f.MaxAge <= 0 && f.Retention == nil && !f.Compress && f.Archiver == nil && len(f.overPeriods) == 0 {
+		return errs.err()
 	}
-	dirEntries, err := ioutil.ReadDir(f.directory)
+	all, err := f.backups()
 	if err != nil {
-		return fmt.Errorf("cannot read log file directory %s: %v", f.directory, err)
+		return append(errs, err)
+	}
+	if f.Archiver != nil && !f.ArchiveRetention {
+		// archived backups are kept for as long as the archive keeps them
+		local := all[:0]
+		for _, b := range all {
+			if !b.Remote {
+				local = append(local, b)
+			}
+		}
+		all = local
 	}
-	type fileInfoWithTime struct {
-		t time.Time
-		os.FileInfo
+	// newest first, backups compressed or encrypted outside of logfeller
+	// count towards Backups and MaxAge as well
+	backups := make([]Backup, 0, len(all))
+	for i := len(all) - 1; i >= 0; i-- {
+		backups = append(backups, all[i])
 	}
-	var backupFIs []fileInfoWithTime
-	for _, dirEntry := range dirEntries {
-		if dirEntry.IsDir() {
-			continue
+	var toRemove []Backup
+	if f.Backups > 0 && len(backups) > f.Backups {
+		toRemove = backups[f.Backups:]
+		backups = backups[:f.Backups]
+	}
+	var now time.Time
+	if f.MaxAge > 0 || f.RetentionGrace > 0 || f.Retention != nil {
+		now = f.nowFunc()
+	}
+	if f.MaxAge > 0 {
+		for _, b := range backups {
+			if now.Sub(b.rotatedAt()) >= time.Duration(f.MaxAge) {
+				toRemove = append(toRemove, b)
+			}
+		}
+	}
+	if f.Retention != nil {
+		toRemove = append(toRemove, f.Retention.Expired(backups, now)...)
+	}
+	if f.RetentionGrace > 0 {
+		var expired []Backup
+		for _, b := range toRemove {
+			if now.Sub(b.rotatedAt()) >= time.Duration(f.RetentionGrace) {
+				expired = append(expired, b)
+			}
 		}
-		filename := dirEntry.Name()
-		if !strings.HasPrefix(filename, f.fileBase) || !strings.HasSuffix(filename, f.ext) {
-			// file is not a backup file if the fileBase and ext dont match
+		toRemove = expired
+	}
+	removed := make(map[string]bool, len(toRemove))
+	for _, b := range toRemove {
+		if removed[b.Name] {
+			// expired by more than one rule
 			continue
 		}
-		// get time from filename
-		timestamp := strings.TrimSuffix(strings.TrimPrefix(filename, f.fileBase), f.ext)
-		t, err := time.Parse(f.BackupTimeFormat, timestamp)
+		err := f.removeBackup(b)
 		if err != nil {
-			continue
+			errs = append(errs, err)
 		}
-		backupFIs = append(backupFIs, fileInfoWithTime{t, dirEntry})
+		f.audit(AuditEntry{Action: AuditTrim, Trigger: TriggerRetention, Backup: b.Name, Error: errString(err)})
+		removed[b.Name] = true
 	}
-	sort.SliceStable(backupFIs, func(i, j int) bool { return backupFIs[i].t.After(backupFIs[j].t) })
-
-	var toRemove []fileInfoWithTime
-	if len(backupFIs) > f.Backups {
-		toRemove = backupFIs[f.Backups:]
+	if f.Compress {
+		uncompressed := len(all) - f.CompressAfter
+		if uncompressed < 0 {
+			uncompressed = 0
+		}
+		for _, b := range all[:uncompressed] {
+			if b.Encoded != "" || b.Remote || removed[b.Name] {
+				continue
+			}
+			if err := f.compressBackup(b.Name); err != nil {
+				errs = append(errs, err)
+			}
+		}
 	}
-	var errs multipleErrors
-	for _, fi := range toRemove {
-		err := os.Remove(filepath.Join(f.directory, fi.Name()))
-		if err != nil {
+	if f.Archiver != nil {
+		if err := f.archiveBackups(); err != nil {
 			errs = append(errs, err)
 		}
 	}
-	return errs
+	if err := f.reportComplete(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs.err()
+}
+
+// removeBackup removes b along with its sidecars, or moves them to the trash
+// directory if TrashRetention is set and b is not Remote.
+func (f *File) removeBackup(b Backup) error {
+	if f.TrashRetention > 0 && !b.Remote {
+		return f.moveToTrash(b.Name)
+	}
+	return f.deleteBackupOf(b)
+}
+
+// deleteBackup deletes the backup name along with its sidecars.
+func deleteBackup(name string) error {
+	if err := os.Remove(name); err != nil {
+		return err
+	}
+	var errs multipleErrors
+	if err := removeMetadata(name); err != nil {
+		errs = append(errs, err)
+	}
+	if err := removeIndex(name); err != nil {
+		errs = append(errs, err)
+	}
+	return errs.err()
 }
 
 type multipleErrors []error
 
+// err returns errs if it has any errors, nil otherwise.
+func (errs multipleErrors) err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
 func (errs multipleErrors) Error() string {
 	if len(errs) == 1 {
 		return errs[0].Error()
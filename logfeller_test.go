@@ -7,12 +7,15 @@
 package logfeller
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
@@ -85,6 +88,32 @@ func TestFile_init(t *testing.T) {
 				ext:       ".log",
 			},
 		},
+		{
+			name: "BaseDir_resolves_relative_Filename",
+			f:    &File{Filename: "logs/app.log", BaseDir: filepath.Join(os.TempDir(), "base")},
+			want: wantFields{
+				Filename:             filepath.Join(os.TempDir(), "base", "logs", "app.log"),
+				When:                 "d",
+				BackupTimeFormat:     ".2006-01-02T1504-05",
+				timeRotationSchedule: []timeSchedule{{}},
+				directory:            filepath.Join(os.TempDir(), "base", "logs"),
+				fileBase:             "app",
+				ext:                  ".log",
+			},
+		},
+		{
+			name: "BaseDir_ignored_for_absolute_Filename",
+			f:    &File{Filename: filepath.Join(os.TempDir(), "app.log"), BaseDir: filepath.Join(os.TempDir(), "base")},
+			want: wantFields{
+				Filename:             filepath.Join(os.TempDir(), "app.log"),
+				When:                 "d",
+				BackupTimeFormat:     ".2006-01-02T1504-05",
+				timeRotationSchedule: []timeSchedule{{}},
+				directory:            os.TempDir(),
+				fileBase:             "app",
+				ext:                  ".log",
+			},
+		},
 		{
 			name: "sort_schedules_offsets",
 			f: &File{
@@ -101,7 +130,6 @@ func TestFile_init(t *testing.T) {
 					{month: 1, day: 2, hour: 5, minute: 44, second: 5},
 					{month: 1, day: 2, hour: 5, minute: 44, second: 32},
 					{month: 1, day: 2, hour: 8, minute: 21, second: 22},
-					{month: 1, day: 2, hour: 8, minute: 21, second: 22},
 					{month: 1, day: 9, hour: 15, minute: 04, second: 5},
 					{month: 6, day: 11, hour: 15, minute: 04, second: 5},
 					{month: 12, day: 2, hour: 23, minute: 11, second: 55},
@@ -124,6 +152,235 @@ func TestFile_init(t *testing.T) {
 			f:       &File{When: "HOUR"},
 			wantErr: true,
 		},
+		{
+			name: "DayOverflow_error_rejects_short_month_schedule",
+			f: &File{
+				When:             "m",
+				RotationSchedule: []string{"30 0000:00"},
+				DayOverflow:      "ERROR",
+			},
+			wantErr: true,
+		},
+		{
+			name:    "Every_with_RotationSchedule_error",
+			f:       &File{Every: Duration(time.Hour), RotationSchedule: []string{"0000:00"}},
+			wantErr: true,
+		},
+		{
+			name:    "Every_BackupTimeFormat_not_precise_enough_error",
+			f:       &File{Every: Duration(time.Second / 2)},
+			wantErr: true,
+		},
+		{
+			name:    "OnBackupCollision_invalid_error",
+			f:       &File{OnBackupCollision: "merge"},
+			wantErr: true,
+		},
+		{
+			name:    "BackupTimeZone_invalid_error",
+			f:       &File{BackupTimeZone: "Mars/Olympus_Mons"},
+			wantErr: true,
+		},
+		{
+			name:    "BaseDir_relative_error",
+			f:       &File{BaseDir: "logs"},
+			wantErr: true,
+		},
+		{
+			name:    "BufferSize_negative_error",
+			f:       &File{BufferSize: -1},
+			wantErr: true,
+		},
+		{
+			name:    "BackupTimeFormat_strftime_invalid_error",
+			f:       &File{BackupTimeFormat: "%Y%Q"},
+			wantErr: true,
+		},
+		{
+			name:    "MinRotationInterval_negative_error",
+			f:       &File{MinRotationInterval: Duration(-time.Minute)},
+			wantErr: true,
+		},
+		{
+			name:    "NoGoroutines_Shards_error",
+			f:       &File{NoGoroutines: true, Shards: 2},
+			wantErr: true,
+		},
+		{
+			name:    "CopyBufferSize_negative",
+			f:       &File{CopyBufferSize: -1},
+			wantErr: true,
+		},
+		{
+			name:    "RotationMethod_invalid",
+			f:       &File{RotationMethod: "copy"},
+			wantErr: true,
+		},
+		{
+			name:    "SyncInterval_negative",
+			f:       &File{SyncInterval: Duration(-time.Second)},
+			wantErr: true,
+		},
+		{
+			name:    "SampleEvery_negative",
+			f:       &File{SampleAbove: 10, SampleEvery: -1},
+			wantErr: true,
+		},
+		{
+			name:    "OnQuotaExceeded_invalid",
+			f:       &File{DailyQuotaBytes: 10, OnQuotaExceeded: "error"},
+			wantErr: true,
+		},
+		{
+			name:    "ShardMaxBytes_negative",
+			f:       &File{ShardMaxBytes: -1},
+			wantErr: true,
+		},
+		{
+			name:    "IOUring_NoGoroutines_error",
+			f:       &File{IOUring: true, NoGoroutines: true},
+			wantErr: true,
+		},
+		{
+			name:    "Durability_invalid",
+			f:       &File{Durability: "always"},
+			wantErr: true,
+		},
+		{
+			name:    "ExtraSchedules_when_invalid",
+			f:       &File{ExtraSchedules: []ScheduleGroup{{When: "x"}}},
+			wantErr: true,
+		},
+		{
+			name:    "ExtraSchedules_schedule_invalid",
+			f:       &File{When: "h", ExtraSchedules: []ScheduleGroup{{When: "d", RotationSchedule: []string{"2500:00"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "ExtraSchedules_Every_error",
+			f:       &File{Every: Duration(time.Hour), ExtraSchedules: []ScheduleGroup{{When: "d"}}},
+			wantErr: true,
+		},
+		{
+			name:    "WeekParity_invalid",
+			f:       &File{When: "w", WeekParity: "third"},
+			wantErr: true,
+		},
+		{
+			name:    "CompressAfter_negative",
+			f:       &File{Compress: true, CompressAfter: -1},
+			wantErr: true,
+		},
+		{
+			name:    "BackupNaming_invalid",
+			f:       &File{BackupNaming: "end"},
+			wantErr: true,
+		},
+		{
+			name:    "ActiveCompression_invalid",
+			f:       &File{ActiveCompression: "lz4"},
+			wantErr: true,
+		},
+		{
+			name:    "ActiveCompression_Compress_error",
+			f:       &File{ActiveCompression: "snappy", Compress: true},
+			wantErr: true,
+		},
+		{
+			name:    "ActiveCompression_WriteAhead_error",
+			f:       &File{ActiveCompression: "snappy", BufferSize: 4096, WriteAhead: true},
+			wantErr: true,
+		},
+		{
+			name:    "RecentSize_negative",
+			f:       &File{RecentFile: "app.recent", RecentSize: -1},
+			wantErr: true,
+		},
+		{
+			name:    "OnEmptyRotation_invalid",
+			f:       &File{OnEmptyRotation: "skip"},
+			wantErr: true,
+		},
+		{
+			name:    "OneFilePerPeriod_OnBackupCollision_error",
+			f:       &File{OneFilePerPeriod: true, OnBackupCollision: "sequence"},
+			wantErr: true,
+		},
+		{
+			name:    "OneFilePerPeriod_OnEmptyRotation_error",
+			f:       &File{OneFilePerPeriod: true, OnEmptyRotation: "reuse"},
+			wantErr: true,
+		},
+		{
+			name:    "OneFilePerPeriod_MinSize_error",
+			f:       &File{OneFilePerPeriod: true, MinSize: 1024},
+			wantErr: true,
+		},
+		{
+			name:    "OneFilePerPeriod_MinRotationInterval_error",
+			f:       &File{OneFilePerPeriod: true, MinRotationInterval: Duration(time.Hour)},
+			wantErr: true,
+		},
+		{
+			name:    "OneFilePerPeriod_BlackoutWindows_error",
+			f:       &File{OneFilePerPeriod: true, BlackoutWindows: []string{"2300:00-0100:00"}},
+			wantErr: true,
+		},
+		{
+			name:    "ArchiveRetention_no_Archiver_error",
+			f:       &File{ArchiveRetention: true},
+			wantErr: true,
+		},
+		{
+			name:    "ArchiveRetention_no_ArchiveDeleter_error",
+			f:       &File{ArchiveRetention: true, Archiver: struct{ Archiver }{&memArchiver{}}},
+			wantErr: true,
+		},
+		{
+			name:    "PressureThresholds_out_of_range",
+			f:       &File{PressureThresholds: []float64{0.5, 1.5}},
+			wantErr: true,
+		},
+		{
+			name:    "Archiver_BackgroundBackup_error",
+			f:       &File{Archiver: &memArchiver{}, BackgroundBackup: true},
+			wantErr: true,
+		},
+		{
+			name:    "SingleWriter_Shards_error",
+			f:       &File{SingleWriter: true, Shards: 2},
+			wantErr: true,
+		},
+		{
+			name:    "SingleWriter_SyncInterval_error",
+			f:       &File{SingleWriter: true, SyncInterval: Duration(time.Second)},
+			wantErr: true,
+		},
+		{
+			name:    "SingleWriter_TriggerFile_error",
+			f:       &File{SingleWriter: true, TriggerFile: "rotate.trigger"},
+			wantErr: true,
+		},
+		{
+			name:    "NoGoroutines_BackgroundBackup_error",
+			f:       &File{NoGoroutines: true, BackgroundBackup: true},
+			wantErr: true,
+		},
+		{
+			name:    "WriteAhead_unbuffered_error",
+			f:       &File{WriteAhead: true},
+			wantErr: true,
+		},
+		{
+			name:    "BlackoutWindows_invalid_error",
+			f:       &File{BlackoutWindows: []string{"0100:00"}},
+			wantErr: true,
+		},
+		{
+			name:    "OnClockRegression_invalid_error",
+			f:       &File{OnClockRegression: "rewind"},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -146,6 +403,221 @@ func TestFile_init(t *testing.T) {
 	}
 }
 
+func TestFile_init_aggregatesErrors(t *testing.T) {
+	f := &File{
+		RotationSchedule:  []string{"0000:00", "2500:00", "0000:61"},
+		BlackoutWindows:   []string{"0100:00"},
+		BackupTimeZone:    "Nowhere/Nothing",
+		OnBackupCollision: "panic",
+	}
+	err := f.init()
+	var cerr *ConfigError
+	testutils.TrueOrFatal(t, errors.As(err, &cerr), "File.init() error = %v, want *ConfigError", err)
+	var fields []string
+	for _, fe := range cerr.Errors {
+		fields = append(fields, fe.Field)
+	}
+	want := []string{"on_backup_collision", "rotation_schedule[1]", "rotation_schedule[2]", "blackout_windows[0]", "backup_time_zone"}
+	testutils.TrueOrError(t, reflect.DeepEqual(fields, want), "ConfigError fields = %v, want %v", fields, want)
+
+	// schedules are not parsed against an invalid When
+	err = (&File{When: "x", RotationSchedule: []string{"bad"}}).init()
+	testutils.TrueOrFatal(t, errors.As(err, &cerr), "File.init() error = %v, want *ConfigError", err)
+	testutils.TrueOrError(t, len(cerr.Errors) == 1 && cerr.Errors[0].Field == "when", "ConfigError = %v, want only when", err)
+}
+
+func TestFile_init_dedupesSchedules(t *testing.T) {
+	var events []Event
+	f := &File{
+		When:             "h",
+		RotationSchedule: []string{"30:00", "00:00", "00:00.5", "30:00", "45:00"},
+		OnEvent:          func(e Event) { events = append(events, e) },
+	}
+	testutils.TrueOrFatal(t, f.init() == nil, "File.init() error = %v, want nil", f.initErr)
+	want := []timeSchedule{{}, {minute: 30}, {minute: 45}}
+	testutils.TrueOrError(t, reflect.DeepEqual(f.timeRotationSchedule, want), "File.timeRotationSchedule = %v, want %v", f.timeRotationSchedule, want)
+	testutils.TrueOrFatal(t, len(events) == 2, "File.init() events = %v, want 2", events)
+	for _, e := range events {
+		testutils.TrueOrError(t, e.Type == EventConfigWarning, "Event.Type = %v, want %v", e.Type, EventConfigWarning)
+	}
+	testutils.TrueOrError(t, strings.Contains(events[0].Message, "cannot tell it apart"), "Event.Message = %q, want precision warning", events[0].Message)
+	testutils.TrueOrError(t, strings.Contains(events[1].Message, "duplicate"), "Event.Message = %q, want duplicate warning", events[1].Message)
+}
+
+func TestFile_calcRotationTimes(t *testing.T) {
+	tests := []struct {
+		name     string
+		f        *File
+		t        time.Time
+		wantPrev time.Time
+		wantNext time.Time
+	}{
+		{
+			name:     "daily_multiple_schedules",
+			f:        &File{When: "d", RotationSchedule: []string{"0100:00", "1400:00"}},
+			t:        time.Date(2020, 8, 10, 10, 0, 0, 0, time.UTC),
+			wantPrev: time.Date(2020, 8, 10, 1, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2020, 8, 10, 14, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "daily_before_first_schedule",
+			f:        &File{When: "d", RotationSchedule: []string{"0100:00", "1400:00"}},
+			t:        time.Date(2020, 8, 10, 0, 30, 0, 0, time.UTC),
+			wantPrev: time.Date(2020, 8, 9, 14, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2020, 8, 10, 1, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "daily_on_schedule",
+			f:        &File{When: "d", RotationSchedule: []string{"0100:00", "1400:00"}},
+			t:        time.Date(2020, 8, 10, 14, 0, 0, 0, time.UTC),
+			wantPrev: time.Date(2020, 8, 10, 14, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2020, 8, 11, 1, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "hourly_sub_second_schedules",
+			f: &File{
+				When:             "h",
+				RotationSchedule: []string{"00:00", "00:00.5"},
+				BackupTimeFormat: ".2006-01-02T1504-05.000",
+			},
+			t:        time.Date(2020, 8, 10, 10, 0, 0, 250000000, time.UTC),
+			wantPrev: time.Date(2020, 8, 10, 10, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2020, 8, 10, 10, 0, 0, 500000000, time.UTC),
+		},
+		{
+			name:     "weekdays_only_friday_rolls_on_monday",
+			f:        &File{When: "d", WeekdaysOnly: true},
+			t:        time.Date(2020, 8, 8, 10, 0, 0, 0, time.UTC), // Saturday
+			wantPrev: time.Date(2020, 8, 7, 0, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2020, 8, 10, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "calendar_hook_skips_holiday",
+			f: &File{When: "d", WeekdaysOnly: true, IsRotationDay: func(t time.Time) bool {
+				return !(t.Month() == time.August && t.Day() == 10)
+			}},
+			t:        time.Date(2020, 8, 8, 10, 0, 0, 0, time.UTC), // Saturday
+			wantPrev: time.Date(2020, 8, 7, 0, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2020, 8, 11, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "extra_schedules_union",
+			f: &File{
+				When:             "h",
+				RotationSchedule: []string{"30:00"},
+				ExtraSchedules:   []ScheduleGroup{{When: "d", RotationSchedule: []string{"0000:00"}}},
+			},
+			t:        time.Date(2020, 8, 10, 23, 45, 0, 0, time.UTC),
+			wantPrev: time.Date(2020, 8, 10, 23, 30, 0, 0, time.UTC),
+			wantNext: time.Date(2020, 8, 11, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "extra_schedules_after_midnight",
+			f: &File{
+				When:             "h",
+				RotationSchedule: []string{"30:00"},
+				ExtraSchedules:   []ScheduleGroup{{When: "d"}},
+			},
+			t:        time.Date(2020, 8, 11, 0, 15, 0, 0, time.UTC),
+			wantPrev: time.Date(2020, 8, 11, 0, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2020, 8, 11, 0, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "weekly_default_schedule",
+			f:        &File{When: "w"},
+			t:        time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC), // Friday of ISO week 53 of 2020
+			wantPrev: time.Date(2020, 12, 28, 0, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "weekly_even_iso_weeks",
+			f:        &File{When: "w", RotationSchedule: []string{"5 1800:00"}, WeekParity: "even"},
+			t:        time.Date(2021, 1, 20, 10, 0, 0, 0, time.UTC), // ISO week 3
+			wantPrev: time.Date(2021, 1, 15, 18, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2021, 1, 29, 18, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "quarterly_default_schedule",
+			f:        &File{When: "q"},
+			t:        time.Date(2021, 2, 10, 0, 0, 0, 0, time.UTC),
+			wantPrev: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "quarterly_multiple_schedules",
+			f:        &File{When: "q", RotationSchedule: []string{"0101 0000:00", "0215 0000:00"}},
+			t:        time.Date(2021, 3, 10, 0, 0, 0, 0, time.UTC),
+			wantPrev: time.Date(2021, 2, 15, 0, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "every_6_hours",
+			f:        &File{Every: Duration(6 * time.Hour)},
+			t:        time.Date(2021, 2, 10, 13, 0, 0, 0, time.UTC),
+			wantPrev: time.Date(2021, 2, 10, 12, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2021, 2, 10, 18, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "every_90_minutes_anchored",
+			f:        &File{Every: Duration(90 * time.Minute), EveryAnchor: time.Date(2021, 2, 10, 0, 15, 0, 0, time.UTC)},
+			t:        time.Date(2021, 2, 10, 2, 0, 0, 0, time.UTC),
+			wantPrev: time.Date(2021, 2, 10, 1, 45, 0, 0, time.UTC),
+			wantNext: time.Date(2021, 2, 10, 3, 15, 0, 0, time.UTC),
+		},
+		{
+			name:     "every_before_anchor",
+			f:        &File{Every: Duration(time.Hour), EveryAnchor: time.Date(2021, 2, 10, 0, 30, 0, 0, time.UTC)},
+			t:        time.Date(2021, 2, 9, 22, 0, 0, 0, time.UTC),
+			wantPrev: time.Date(2021, 2, 9, 21, 30, 0, 0, time.UTC),
+			wantNext: time.Date(2021, 2, 9, 22, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "anchored_to_creation_hourly",
+			f:        &File{When: "h", AnchorToCreation: true},
+			t:        time.Date(2021, 2, 10, 13, 20, 5, 0, time.UTC),
+			wantPrev: time.Date(2021, 2, 10, 13, 20, 5, 0, time.UTC),
+			wantNext: time.Date(2021, 2, 10, 14, 20, 5, 0, time.UTC),
+		},
+		{
+			name:     "anchored_to_creation_every_weekdays_only",
+			f:        &File{Every: Duration(oneDay), AnchorToCreation: true, WeekdaysOnly: true},
+			t:        time.Date(2020, 8, 7, 13, 0, 0, 0, time.UTC), // Friday
+			wantPrev: time.Date(2020, 8, 7, 13, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2020, 8, 10, 13, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "monthly_31st_clamped",
+			f:        &File{When: "m", RotationSchedule: []string{"31 0000:00"}},
+			t:        time.Date(2021, 2, 10, 0, 0, 0, 0, time.UTC),
+			wantPrev: time.Date(2021, 1, 31, 0, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2021, 2, 28, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "monthly_31st_skipped",
+			f:        &File{When: "m", RotationSchedule: []string{"31 0000:00"}, DayOverflow: "skip"},
+			t:        time.Date(2021, 2, 10, 0, 0, 0, 0, time.UTC),
+			wantPrev: time.Date(2021, 1, 31, 0, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2021, 3, 31, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "yearly_leap_day_skipped",
+			f:        &File{When: "y", RotationSchedule: []string{"0229 0000:00"}, DayOverflow: "skip"},
+			t:        time.Date(2021, 2, 10, 0, 0, 0, 0, time.UTC),
+			wantPrev: time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.f.init()
+			testutils.TrueOrFatal(t, err == nil, "File.init() error = %v", err)
+			gotPrev, gotNext := tt.f.calcRotationTimes(tt.t)
+			testutils.TrueOrError(t, gotPrev.Equal(tt.wantPrev), "File.calcRotationTimes() prev = %v, want %v", gotPrev, tt.wantPrev)
+			testutils.TrueOrError(t, gotNext.Equal(tt.wantNext), "File.calcRotationTimes() next = %v, want %v", gotNext, tt.wantNext)
+		})
+	}
+}
+
 // TestFile_UnmarshalJSON is purely there to see if mapping between JSON tag
 // fields are accurate. For the actual init check TestFile_init
 func TestFile_UnmarshalJSON(t *testing.T) {
@@ -175,7 +647,8 @@ func TestFile_UnmarshalJSON(t *testing.T) {
 	"rotation_schedule": ["03 1430:00", "10 1200:00"],
 	"use_local":         true,
 	"backups":          69,
-	"backup_time_format": "Jan _2 15:04:05"
+	"backup_time_format": "Jan _2 15:04:05",
+	"every_anchor": "2021-02-10T00:15:00Z"
 }`),
 			},
 			want: wantFields{
@@ -577,6 +1050,114 @@ func TestFile(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "backup_collision_sequence",
+			do: func(t testing.TB, dirname string) map[string][]byte {
+				now := time.Now()
+				fullpath := filepath.Join(dirname, fname)
+				var events []Event
+				rf := File{Filename: fullpath, OnBackupCollision: "sequence", OnEvent: func(e Event) {
+					if e.Type == EventBackupCollision {
+						events = append(events, e)
+					}
+				}}
+				defer rf.Close()
+
+				b1 := []byte("BARBAR1\n")
+				_, err := rf.Write(b1)
+				testutils.TrueOrFatal(t, err == nil, "write error b1 err: content=%s,err=%v", b1, err)
+				err = rf.Rotate()
+				testutils.TrueOrFatal(t, err == nil, "rotate b1 err: err=%v", err)
+				testutils.TrueOrFatal(t, len(events) == 0, "no events expected before the collision; events=%v", events)
+
+				b2 := []byte("BARBAR2\n")
+				_, err = rf.Write(b2)
+				testutils.TrueOrFatal(t, err == nil, "write error b2 err: content=%s,err=%v", b2, err)
+				err = rf.Rotate()
+				testutils.TrueOrFatal(t, err == nil, "rotate b2 err: err=%v", err)
+				testutils.TrueOrFatal(t, len(events) == 1 && events[0].Type == EventBackupCollision, "collision event expected; events=%v", events)
+
+				b3 := []byte("BARBAR3\n")
+				_, err = rf.Write(b3)
+				testutils.TrueOrFatal(t, err == nil, "write error b3 err: content=%s,err=%v", b3, err)
+
+				backupTimestamp := testutils.TimeOfDay(now, 0, 0, 0).Format(defaultBackupTimeFormat)
+				time.Sleep(10 * time.Millisecond)
+				return map[string][]byte{
+					fmt.Sprint("foo", backupTimestamp, ".log"):   []byte("BARBAR1\n"),
+					fmt.Sprint("foo", backupTimestamp, "_1.log"): []byte("BARBAR2\n"),
+					fname: []byte("BARBAR3\n"),
+				}
+			},
+		},
+		{
+			name: "backup_collision_overwrite",
+			do: func(t testing.TB, dirname string) map[string][]byte {
+				now := time.Now()
+				fullpath := filepath.Join(dirname, fname)
+				var events []Event
+				rf := File{Filename: fullpath, OnBackupCollision: "Overwrite", OnEvent: func(e Event) {
+					if e.Type == EventBackupCollision {
+						events = append(events, e)
+					}
+				}}
+				defer rf.Close()
+
+				b1 := []byte("BARBAR1\n")
+				_, err := rf.Write(b1)
+				testutils.TrueOrFatal(t, err == nil, "write error b1 err: content=%s,err=%v", b1, err)
+				err = rf.Rotate()
+				testutils.TrueOrFatal(t, err == nil, "rotate b1 err: err=%v", err)
+
+				b2 := []byte("BARBAR2\n")
+				_, err = rf.Write(b2)
+				testutils.TrueOrFatal(t, err == nil, "write error b2 err: content=%s,err=%v", b2, err)
+				err = rf.Rotate()
+				testutils.TrueOrFatal(t, err == nil, "rotate b2 err: err=%v", err)
+				testutils.TrueOrFatal(t, len(events) == 1 && events[0].Type == EventBackupCollision, "collision event expected; events=%v", events)
+
+				backupFilename := fmt.Sprint("foo", testutils.TimeOfDay(now, 0, 0, 0).Format(defaultBackupTimeFormat), ".log")
+				time.Sleep(10 * time.Millisecond)
+				return map[string][]byte{
+					backupFilename: []byte("BARBAR2\n"),
+					fname:          {},
+				}
+			},
+		},
+		{
+			name: "backup_collision_error",
+			do: func(t testing.TB, dirname string) map[string][]byte {
+				now := time.Now()
+				fullpath := filepath.Join(dirname, fname)
+				var events []Event
+				rf := File{Filename: fullpath, OnBackupCollision: "error", OnEvent: func(e Event) {
+					if e.Type == EventBackupCollision {
+						events = append(events, e)
+					}
+				}}
+				defer rf.Close()
+
+				b1 := []byte("BARBAR1\n")
+				_, err := rf.Write(b1)
+				testutils.TrueOrFatal(t, err == nil, "write error b1 err: content=%s,err=%v", b1, err)
+				err = rf.Rotate()
+				testutils.TrueOrFatal(t, err == nil, "rotate b1 err: err=%v", err)
+
+				b2 := []byte("BARBAR2\n")
+				_, err = rf.Write(b2)
+				testutils.TrueOrFatal(t, err == nil, "write error b2 err: content=%s,err=%v", b2, err)
+				err = rf.Rotate()
+				testutils.TrueOrFatal(t, err != nil, "rotate b2 should fail on collision")
+				testutils.TrueOrFatal(t, len(events) == 1 && events[0].Type == EventBackupCollision, "collision event expected; events=%v", events)
+
+				backupFilename := fmt.Sprint("foo", testutils.TimeOfDay(now, 0, 0, 0).Format(defaultBackupTimeFormat), ".log")
+				time.Sleep(10 * time.Millisecond)
+				return map[string][]byte{
+					backupFilename: []byte("BARBAR1\n"),
+					fname:          []byte("BARBAR2\n"),
+				}
+			},
+		},
 		{
 			name: "clear_previous_backup_before_writing",
 			do: func(t testing.TB, dirname string) map[string][]byte {
@@ -608,6 +1189,210 @@ func TestFile(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "rotation_deferred_during_blackout_window",
+			do: func(t testing.TB, dirname string) map[string][]byte {
+				day1 := time.Date(2020, 8, 10, 10, 0, 0, 0, time.UTC)
+				day2 := time.Date(2020, 8, 11, 0, 0, 0, 0, time.UTC)
+				fullpath := filepath.Join(dirname, fname)
+
+				rf := File{
+					Filename:        fullpath,
+					BlackoutWindows: []string{"2300:00-0100:00"},
+					nowFunc:         func() time.Time { return day1 },
+				}
+				defer rf.Close()
+				b1 := []byte("BARBAR1\n")
+				_, err := rf.Write(b1)
+				testutils.TrueOrFatal(t, err == nil, "write error b1 err: content=%s,err=%v", b1, err)
+
+				// Past midnight but within the window, no rotation
+				rf.setNowFunc(func() time.Time { return day2.Add(30 * time.Minute) })
+				b2 := []byte("BARBAR2\n")
+				_, err = rf.Write(b2)
+				testutils.TrueOrFatal(t, err == nil, "write error b2 err: content=%s,err=%v", b2, err)
+
+				// Window is over, rotation happens
+				rf.setNowFunc(func() time.Time { return day2.Add(time.Hour) })
+				b3 := []byte("BARBAR3\n")
+				_, err = rf.Write(b3)
+				testutils.TrueOrFatal(t, err == nil, "write error b3 err: content=%s,err=%v", b3, err)
+
+				rotatedFilename := fmt.Sprint("foo", testutils.TimeOfDay(day1, 0, 0, 0).Format(defaultBackupTimeFormat), ".log")
+				return map[string][]byte{
+					rotatedFilename: []byte("BARBAR1\nBARBAR2\n"),
+					fname:           []byte("BARBAR3\n"),
+				}
+			},
+		},
+		{
+			name: "anchor_to_creation_rotates_fixed_length_files",
+			do: func(t testing.TB, dirname string) map[string][]byte {
+				created := time.Date(2020, 8, 10, 10, 20, 0, 0, time.UTC)
+				fullpath := filepath.Join(dirname, fname)
+
+				rf := File{Filename: fullpath, When: "h", AnchorToCreation: true, nowFunc: func() time.Time { return created }}
+				defer rf.Close()
+				b1 := []byte("BARBAR1\n")
+				_, err := rf.Write(b1)
+				testutils.TrueOrFatal(t, err == nil, "write error b1 err: content=%s,err=%v", b1, err)
+
+				// Past the hour but the file is not an hour old yet
+				rf.setNowFunc(func() time.Time { return created.Add(50 * time.Minute) })
+				b2 := []byte("BARBAR2\n")
+				_, err = rf.Write(b2)
+				testutils.TrueOrFatal(t, err == nil, "write error b2 err: content=%s,err=%v", b2, err)
+
+				rf.setNowFunc(func() time.Time { return created.Add(65 * time.Minute) })
+				b3 := []byte("BARBAR3\n")
+				_, err = rf.Write(b3)
+				testutils.TrueOrFatal(t, err == nil, "write error b3 err: content=%s,err=%v", b3, err)
+
+				// The new file was created 65 minutes in, so this stays
+				rf.setNowFunc(func() time.Time { return created.Add(120 * time.Minute) })
+				b4 := []byte("BARBAR4\n")
+				_, err = rf.Write(b4)
+				testutils.TrueOrFatal(t, err == nil, "write error b4 err: content=%s,err=%v", b4, err)
+
+				return map[string][]byte{
+					fmt.Sprint("foo", created.Format(defaultBackupTimeFormat), ".log"): []byte("BARBAR1\nBARBAR2\n"),
+					fname: []byte("BARBAR3\nBARBAR4\n"),
+				}
+			},
+		},
+		{
+			name: "rotation_deferred_below_min_size",
+			do: func(t testing.TB, dirname string) map[string][]byte {
+				start := time.Date(2020, 8, 10, 10, 20, 0, 0, time.UTC)
+				fullpath := filepath.Join(dirname, fname)
+
+				rf := File{Filename: fullpath, When: "h", MinSize: 16, nowFunc: func() time.Time { return start }}
+				defer rf.Close()
+				b1 := []byte("BARBAR1\n")
+				_, err := rf.Write(b1)
+				testutils.TrueOrFatal(t, err == nil, "write error b1 err: content=%s,err=%v", b1, err)
+
+				// File is too small at the next hour, rotation is deferred
+				rf.setNowFunc(func() time.Time { return start.Add(time.Hour) })
+				b2 := []byte("BARBAR2\n")
+				_, err = rf.Write(b2)
+				testutils.TrueOrFatal(t, err == nil, "write error b2 err: content=%s,err=%v", b2, err)
+
+				rf.setNowFunc(func() time.Time { return start.Add(2 * time.Hour) })
+				b3 := []byte("BARBAR3\n")
+				_, err = rf.Write(b3)
+				testutils.TrueOrFatal(t, err == nil, "write error b3 err: content=%s,err=%v", b3, err)
+
+				rotatedFilename := fmt.Sprint("foo", time.Date(2020, 8, 10, 10, 0, 0, 0, time.UTC).Format(defaultBackupTimeFormat), ".log")
+				return map[string][]byte{
+					rotatedFilename: []byte("BARBAR1\nBARBAR2\n"),
+					fname:           []byte("BARBAR3\n"),
+				}
+			},
+		},
+		{
+			name: "backup_time_zone_independent_of_schedule",
+			do: func(t testing.TB, dirname string) map[string][]byte {
+				singapore := time.FixedZone("SGT", 8*60*60)
+				start := time.Date(2020, 8, 10, 10, 0, 0, 0, singapore)
+				fullpath := filepath.Join(dirname, fname)
+
+				rf := File{Filename: fullpath, UseLocal: true, BackupTimeZone: "UTC", nowFunc: func() time.Time { return start }}
+				defer rf.Close()
+				b1 := []byte("BARBAR1\n")
+				_, err := rf.Write(b1)
+				testutils.TrueOrFatal(t, err == nil, "write error b1 err: content=%s,err=%v", b1, err)
+
+				rf.setNowFunc(func() time.Time { return start.Add(24 * time.Hour) })
+				b2 := []byte("BARBAR2\n")
+				_, err = rf.Write(b2)
+				testutils.TrueOrFatal(t, err == nil, "write error b2 err: content=%s,err=%v", b2, err)
+
+				// Rotated at midnight in Singapore, which is 4pm the day before in UTC
+				rotatedFilename := fmt.Sprint("foo", time.Date(2020, 8, 9, 16, 0, 0, 0, time.UTC).Format(defaultBackupTimeFormat), ".log")
+				return map[string][]byte{
+					rotatedFilename: []byte("BARBAR1\n"),
+					fname:           []byte("BARBAR2\n"),
+				}
+			},
+		},
+		{
+			name: "clock_regression_freeze_no_rotate",
+			do: func(t testing.TB, dirname string) map[string][]byte {
+				day1 := time.Date(2020, 8, 10, 10, 0, 0, 0, time.UTC)
+				day2 := time.Date(2020, 8, 11, 1, 0, 0, 0, time.UTC)
+				fullpath := filepath.Join(dirname, fname)
+
+				rf := File{Filename: fullpath, nowFunc: func() time.Time { return day1 }}
+				defer rf.Close()
+				b1 := []byte("BARBAR1\n")
+				_, err := rf.Write(b1)
+				testutils.TrueOrFatal(t, err == nil, "write error b1 err: content=%s,err=%v", b1, err)
+
+				rf.setNowFunc(func() time.Time { return day2 })
+				b2 := []byte("BARBAR2\n")
+				_, err = rf.Write(b2)
+				testutils.TrueOrFatal(t, err == nil, "write error b2 err: content=%s,err=%v", b2, err)
+
+				// Clock steps back before the rotation boundary, rotation
+				// is held back until the clock catches up
+				rf.setNowFunc(func() time.Time { return day2.Add(-2 * time.Hour) })
+				b3 := []byte("BARBAR3\n")
+				_, err = rf.Write(b3)
+				testutils.TrueOrFatal(t, err == nil, "write error b3 err: content=%s,err=%v", b3, err)
+
+				rf.setNowFunc(func() time.Time { return day2.Add(time.Hour) })
+				b4 := []byte("BARBAR4\n")
+				_, err = rf.Write(b4)
+				testutils.TrueOrFatal(t, err == nil, "write error b4 err: content=%s,err=%v", b4, err)
+
+				rotatedFilename := fmt.Sprint("foo", testutils.TimeOfDay(day1, 0, 0, 0).Format(defaultBackupTimeFormat), ".log")
+				return map[string][]byte{
+					rotatedFilename: []byte("BARBAR1\n"),
+					fname:           []byte("BARBAR2\nBARBAR3\nBARBAR4\n"),
+				}
+			},
+		},
+		{
+			name: "clock_regression_sequence_rotates_with_suffix",
+			do: func(t testing.TB, dirname string) map[string][]byte {
+				day1 := time.Date(2020, 8, 10, 10, 0, 0, 0, time.UTC)
+				day2 := time.Date(2020, 8, 11, 1, 0, 0, 0, time.UTC)
+				fullpath := filepath.Join(dirname, fname)
+
+				rf := File{Filename: fullpath, OnClockRegression: "Sequence", nowFunc: func() time.Time { return day1 }}
+				defer rf.Close()
+				b1 := []byte("BARBAR1\n")
+				_, err := rf.Write(b1)
+				testutils.TrueOrFatal(t, err == nil, "write error b1 err: content=%s,err=%v", b1, err)
+
+				rf.setNowFunc(func() time.Time { return day2 })
+				b2 := []byte("BARBAR2\n")
+				_, err = rf.Write(b2)
+				testutils.TrueOrFatal(t, err == nil, "write error b2 err: content=%s,err=%v", b2, err)
+
+				// Clock steps back to the previous day, rotate immediately
+				rf.setNowFunc(func() time.Time { return day2.Add(-2 * time.Hour) })
+				b3 := []byte("BARBAR3\n")
+				_, err = rf.Write(b3)
+				testutils.TrueOrFatal(t, err == nil, "write error b3 err: content=%s,err=%v", b3, err)
+
+				// Crossing midnight again collides with the first backup
+				rf.setNowFunc(func() time.Time { return day2.Add(-30 * time.Minute) })
+				b4 := []byte("BARBAR4\n")
+				_, err = rf.Write(b4)
+				testutils.TrueOrFatal(t, err == nil, "write error b4 err: content=%s,err=%v", b4, err)
+
+				day1Backup := testutils.TimeOfDay(day1, 0, 0, 0).Format(defaultBackupTimeFormat)
+				day2Backup := testutils.TimeOfDay(day2, 0, 0, 0).Format(defaultBackupTimeFormat)
+				return map[string][]byte{
+					fmt.Sprint("foo", day1Backup, ".log"):   []byte("BARBAR1\n"),
+					fmt.Sprint("foo", day2Backup, ".log"):   []byte("BARBAR2\n"),
+					fmt.Sprint("foo", day1Backup, "_1.log"): []byte("BARBAR3\n"),
+					fname:                                   []byte("BARBAR4\n"),
+				}
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -648,3 +1433,402 @@ func TestFile(t *testing.T) {
 		})
 	}
 }
+
+func TestFile_parseBackupTimestamp(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    string
+		naming    BackupNaming
+		timestamp string
+		wantT     time.Time
+		wantSeq   int
+		wantErr   bool
+	}{
+		{name: "no_sequence", format: defaultBackupTimeFormat, timestamp: ".2020-08-10T0000-00", wantT: time.Date(2020, 8, 10, 0, 0, 0, 0, time.UTC)},
+		{name: "with_sequence", format: defaultBackupTimeFormat, timestamp: ".2020-08-10T0000-00_12", wantT: time.Date(2020, 8, 10, 0, 0, 0, 0, time.UTC), wantSeq: 12},
+		{name: "underscore_in_format", format: "Jan _2 15:04:05", timestamp: "Aug  9 10:00:00_3", wantT: time.Date(0, 8, 9, 10, 0, 0, 0, time.UTC), wantSeq: 3},
+		{name: "invalid_sequence", format: defaultBackupTimeFormat, timestamp: ".2020-08-10T0000-00_x", wantErr: true},
+		{name: "zero_sequence", format: defaultBackupTimeFormat, timestamp: ".2020-08-10T0000-00_0", wantErr: true},
+		{name: "invalid_timestamp", format: defaultBackupTimeFormat, timestamp: "foo_1", wantErr: true},
+		{name: "period", format: defaultBackupTimeFormat, naming: BackupNamingPeriod, timestamp: ".2020-08-10T0000-00-2020-08-11T0000-00", wantT: time.Date(2020, 8, 10, 0, 0, 0, 0, time.UTC)},
+		{name: "period_with_sequence", format: ".20060102T1504", naming: BackupNamingPeriod, timestamp: ".20200810T0000-20200810T0600_2", wantT: time.Date(2020, 8, 10, 0, 0, 0, 0, time.UTC), wantSeq: 2},
+		{name: "period_start_only", format: defaultBackupTimeFormat, naming: BackupNamingPeriod, timestamp: ".2020-08-10T0000-00", wantT: time.Date(2020, 8, 10, 0, 0, 0, 0, time.UTC)},
+		{name: "period_invalid_end", format: defaultBackupTimeFormat, naming: BackupNamingPeriod, timestamp: ".2020-08-10T0000-00-2020-08-11", wantErr: true},
+		{name: "period_not_expected", format: defaultBackupTimeFormat, timestamp: ".2020-08-10T0000-00-2020-08-11T0000-00", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &File{BackupTimeFormat: tt.format, BackupNaming: tt.naming}
+			gotT, gotSeq, err := f.parseBackupTimestamp(tt.timestamp)
+			testutils.TrueOrFatal(t, (err != nil) == tt.wantErr, "File.parseBackupTimestamp() error = %v, wantErr %v", err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			testutils.TrueOrError(t, gotT.Equal(tt.wantT), "File.parseBackupTimestamp() t = %v, want %v", gotT, tt.wantT)
+			testutils.TrueOrError(t, gotSeq == tt.wantSeq, "File.parseBackupTimestamp() seq = %v, want %v", gotSeq, tt.wantSeq)
+		})
+	}
+}
+
+func TestFile_WriteContext(t *testing.T) {
+	dirname, err := testutils.MkTestDir("WriteContext")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	f := &File{Filename: filepath.Join(dirname, "app.log")}
+	defer f.Close()
+
+	// simulate a slow rotation holding the lock
+	f.mu.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = f.WriteContext(ctx, []byte("timeout\n"))
+	testutils.TrueOrError(t, errors.Is(err, context.DeadlineExceeded), "File.WriteContext() error = %v, want %v", err, context.DeadlineExceeded)
+	f.mu.Unlock()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = f.WriteContext(ctx, []byte("cancelled\n"))
+	testutils.TrueOrError(t, errors.Is(err, context.Canceled), "File.WriteContext() error = %v, want %v", err, context.Canceled)
+
+	n, err := f.WriteContext(context.Background(), []byte("ok\n"))
+	testutils.TrueOrFatal(t, err == nil && n == 3, "File.WriteContext() = %d, %v, want 3, nil", n, err)
+	b, err := ioutil.ReadFile(f.Filename)
+	testutils.TrueOrFatal(t, err == nil, "failed to read file: %v", err)
+	testutils.TrueOrError(t, string(b) == "ok\n", "file content = %q, want %q", b, "ok\n")
+}
+
+func TestFile_Flush(t *testing.T) {
+	dirname, err := testutils.MkTestDir("Flush")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), BufferSize: 64}
+	readFile := func() string {
+		b, err := ioutil.ReadFile(f.Filename)
+		testutils.TrueOrFatal(t, err == nil, "failed to read file: %v", err)
+		return string(b)
+	}
+
+	_, err = f.Write([]byte("first\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrError(t, readFile() == "", "file content before Flush = %q, want empty", readFile())
+	testutils.TrueOrFatal(t, f.Flush() == nil, "File.Flush() should not fail")
+	testutils.TrueOrError(t, readFile() == "first\n", "file content after Flush = %q, want %q", readFile(), "first\n")
+
+	_, err = f.Write([]byte("second\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+	testutils.TrueOrError(t, readFile() == "first\nsecond\n", "file content after Close = %q, want %q", readFile(), "first\nsecond\n")
+}
+
+func TestFile_ForceRotate(t *testing.T) {
+	dirname, err := testutils.MkTestDir("ForceRotate")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log")}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+
+	// Rotate skips the empty file, ForceRotate does not
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	backups, err := f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil && len(backups) == 0, "File.ListBackups() = %v, %v, want no backups", backups, err)
+	for i := 0; i < 2; i++ {
+		testutils.TrueOrFatal(t, f.ForceRotate() == nil, "File.ForceRotate() should not fail")
+	}
+	backups, err = f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil, "File.ListBackups() error = %v", err)
+	var got []string
+	for _, b := range backups {
+		got = append(got, filepath.Base(b.Name))
+	}
+	want := []string{"app.2021-03-04T0000-00.log", "app.2021-03-04T0000-00_1.log"}
+	testutils.TrueOrError(t, reflect.DeepEqual(got, want), "backups after ForceRotate = %v, want %v", got, want)
+}
+
+func TestFile_TruncateCurrent(t *testing.T) {
+	dirname, err := testutils.MkTestDir("TruncateCurrent")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	var events []Event
+	f := &File{Filename: filepath.Join(dirname, "app.log"), BufferSize: 64, OnEvent: func(e Event) { events = append(events, e) }}
+	defer f.Close()
+
+	_, err = f.Write([]byte("flushed\n"))
+	testutils.TrueOrFatal(t, err == nil && f.Flush() == nil, "File.Write() and Flush() should not fail, err = %v", err)
+	_, err = f.Write([]byte("buffered\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.TruncateCurrent() == nil, "File.TruncateCurrent() should not fail")
+	testutils.TrueOrError(t, len(events) == 1 && events[0].Type == EventTruncate, "events = %v, want 1 %s event", events, EventTruncate)
+	_, err = f.Write([]byte("after\n"))
+	testutils.TrueOrFatal(t, err == nil && f.Flush() == nil, "File.Write() and Flush() should not fail, err = %v", err)
+
+	b, err := ioutil.ReadFile(f.Filename)
+	testutils.TrueOrFatal(t, err == nil, "failed to read file: %v", err)
+	testutils.TrueOrError(t, string(b) == "after\n", "file content = %q, want %q", b, "after\n")
+	backups, err := f.ListBackups()
+	testutils.TrueOrError(t, err == nil && len(backups) == 0, "File.ListBackups() = %v, %v, want no backups", backups, err)
+}
+
+func TestFile_TruncateCurrent_shards(t *testing.T) {
+	dirname, err := testutils.MkTestDir("TruncateCurrent_shards")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	// the flusher does not get to the held write on its own
+	f := &File{Filename: filepath.Join(dirname, "app.log"), Shards: 2, ShardFlushInterval: Duration(time.Hour)}
+	defer f.Close()
+
+	_, err = f.Write([]byte("held\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.TruncateCurrent() == nil, "File.TruncateCurrent() should not fail")
+	_, err = f.Write([]byte("after\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+
+	b, err := ioutil.ReadFile(f.Filename)
+	testutils.TrueOrFatal(t, err == nil, "failed to read file: %v", err)
+	testutils.TrueOrError(t, string(b) == "after\n", "file content = %q, want %q", b, "after\n")
+	writes, bytes := f.shards.held()
+	testutils.TrueOrError(t, writes == 0 && bytes == 0, "held writes = %d of %d bytes, want none", writes, bytes)
+}
+
+func TestFile_TruncateCurrent_markers(t *testing.T) {
+	dirname, err := testutils.MkTestDir("TruncateCurrent_markers")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), RotationMarkers: true}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+
+	_, err = f.Write([]byte("one\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	// the start marker of the new file is truncated away, output shorter
+	// than it is still output
+	testutils.TrueOrFatal(t, f.TruncateCurrent() == nil, "File.TruncateCurrent() should not fail")
+	_, err = f.Write([]byte("x\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+
+	b, err := ioutil.ReadFile(filepath.Join(dirname, "app.2021-03-04T0000-00.log"))
+	want := "one\n--- logfeller: continued in app.log ---\nx\n--- logfeller: continued in app.log ---\n"
+	testutils.TrueOrError(t, err == nil && string(b) == want, "backup content = %q, want %q, err = %v", b, want, err)
+}
+
+func TestFile_RemoveAll(t *testing.T) {
+	dirname, err := testutils.MkTestDir("RemoveAll")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	other := filepath.Join(dirname, "other.log")
+	testutils.TrueOrFatal(t, ioutil.WriteFile(other, []byte("x\n"), 0600) == nil, "failed to write %s", other)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), BackupMetadata: true, IndexBytes: 1, BufferSize: 4096, WriteAhead: true, RotationCounter: true}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+	for _, line := range []string{"one", "two", "three"} {
+		_, err := f.Write([]byte(line + "\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		now = now.Add(24 * time.Hour)
+	}
+
+	testutils.TrueOrFatal(t, f.RemoveAll() == nil, "File.RemoveAll() should not fail")
+	entries, err := ioutil.ReadDir(dirname)
+	testutils.TrueOrFatal(t, err == nil, "failed to read dir: %v", err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	// nothing of f is left, such as its write-ahead file or rotation counter
+	testutils.TrueOrError(t, len(names) == 1 && names[0] == "other.log", "entries after RemoveAll = %v, want only other.log", names)
+
+	_, err = f.Write([]byte("again\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() after RemoveAll error = %v", err)
+	testutils.TrueOrFatal(t, f.Flush() == nil, "File.Flush() should not fail")
+	b, err := ioutil.ReadFile(f.Filename)
+	testutils.TrueOrError(t, err == nil && string(b) == "again\n", "file content = %q, %v, want %q", b, err, "again\n")
+}
+
+func TestFile_filenameWithTimestamp(t *testing.T) {
+	at := time.Date(2021, time.March, 4, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		filename string
+		seq      int
+		naming   BackupNaming
+		want     string
+	}{
+		{"absolute", "/var/log/app.log", 0, "", "/var/log/app.2021-03-04T0000-00.log"},
+		{"relative", "app.log", 0, "", "app.2021-03-04T0000-00.log"},
+		{"root", "/app.log", 0, "", "/app.2021-03-04T0000-00.log"},
+		{"sequenced", "/var/log/app.log", 2, "", "/var/log/app.2021-03-04T0000-00_2.log"},
+		{"period", "/var/log/app.log", 0, BackupNamingPeriod, "/var/log/app.2021-03-04T0000-00-2021-03-05T0000-00.log"},
+		{"period_sequenced", "/var/log/app.log", 2, BackupNamingPeriod, "/var/log/app.2021-03-04T0000-00-2021-03-05T0000-00_2.log"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &File{Filename: tt.filename, BackupNaming: tt.naming}
+			testutils.TrueOrFatal(t, f.configure() == nil, "File.configure() should not fail")
+			got := f.backupFilename(at, tt.seq)
+			testutils.TrueOrError(t, got == tt.want, "File.backupFilename() = %s, want %s", got, tt.want)
+		})
+	}
+
+	f := &File{Filename: "/var/log/app.log"}
+	testutils.TrueOrFatal(t, f.configure() == nil, "File.configure() should not fail")
+	f.filenameWithTimestamp(at)
+	allocs := testing.AllocsPerRun(100, func() { f.filenameWithTimestamp(at) })
+	testutils.TrueOrError(t, allocs == 0, "File.filenameWithTimestamp() within a period allocs = %v, want 0", allocs)
+}
+
+func TestFile_MinRotationInterval(t *testing.T) {
+	dirname, err := testutils.MkTestDir("MinRotationInterval")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+
+	t.Run("scheduled", func(t *testing.T) {
+		now := time.Date(2021, time.March, 4, 10, 30, 0, 0, time.UTC)
+		var throttled int
+		f := &File{
+			Filename:            filepath.Join(dirname, "scheduled.log"),
+			When:                Hour,
+			MinRotationInterval: Duration(3 * time.Hour),
+			OnEvent: func(e Event) {
+				if e.Type == EventRotationThrottled {
+					throttled++
+				}
+			},
+		}
+		f.setNowFunc(func() time.Time { return now })
+		defer f.Close()
+		for _, d := range []time.Duration{0, 35 * time.Minute, time.Hour, 55 * time.Minute, 70 * time.Minute} {
+			now = now.Add(d)
+			_, err := f.Write([]byte(now.Format("1504") + "\n"))
+			testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		}
+		backups, err := f.ListBackups()
+		testutils.TrueOrFatal(t, err == nil, "File.ListBackups() error = %v", err)
+		var got []string
+		for _, b := range backups {
+			got = append(got, filepath.Base(b.Name))
+		}
+		want := []string{"scheduled.2021-03-04T1000-00.log", "scheduled.2021-03-04T1100-00.log"}
+		testutils.TrueOrError(t, reflect.DeepEqual(got, want), "backups = %v, want %v", got, want)
+		b, err := ioutil.ReadFile(filepath.Join(dirname, want[1]))
+		testutils.TrueOrError(t, err == nil && string(b) == "1105\n1205\n1300\n", "deferred backup content = %q, %v", b, err)
+		testutils.TrueOrError(t, throttled == 1, "throttled events = %d, want 1", throttled)
+	})
+
+	t.Run("ForceRotate", func(t *testing.T) {
+		now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+		f := &File{Filename: filepath.Join(dirname, "force.log"), MinRotationInterval: Duration(time.Hour)}
+		f.setNowFunc(func() time.Time { return now })
+		defer f.Close()
+		for _, d := range []time.Duration{0, time.Minute, time.Hour} {
+			now = now.Add(d)
+			testutils.TrueOrFatal(t, f.ForceRotate() == nil, "File.ForceRotate() should not fail")
+		}
+		backups, err := f.ListBackups()
+		testutils.TrueOrError(t, err == nil && len(backups) == 2, "File.ListBackups() = %v, %v, want 2 backups", backups, err)
+	})
+}
+
+func TestFile_NoGoroutines(t *testing.T) {
+	dirname, err := testutils.MkTestDir("NoGoroutines")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	goroutines := runtime.NumGoroutine()
+	f := &File{Filename: filepath.Join(dirname, "app.log"), Backups: 1, NoGoroutines: true}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+	for i := 0; i < 3; i++ {
+		_, err := f.Write([]byte("line\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		now = now.Add(24 * time.Hour)
+	}
+	testutils.TrueOrError(t, runtime.NumGoroutine() <= goroutines, "goroutines = %d, want at most %d", runtime.NumGoroutine(), goroutines)
+	// trimmed inline, there is nothing to wait for
+	backups, err := f.ListBackups()
+	testutils.TrueOrError(t, err == nil && len(backups) == 1, "File.ListBackups() = %v, %v, want 1 backup", backups, err)
+
+	extra := filepath.Join(dirname, "app.2021-03-01T0000-00.log")
+	testutils.TrueOrFatal(t, ioutil.WriteFile(extra, []byte("x\n"), 0600) == nil, "failed to write %s", extra)
+	testutils.TrueOrFatal(t, f.Maintain() == nil, "File.Maintain() should not fail")
+	_, err = os.Stat(extra)
+	testutils.TrueOrError(t, os.IsNotExist(err), "File.Maintain() should have trimmed %s, stat error = %v", extra, err)
+}
+
+func TestFile_SingleWriter(t *testing.T) {
+	dirname, err := testutils.MkTestDir("SingleWriter")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), SingleWriter: true}
+	defer f.Close()
+	_, err = f.Write([]byte("line\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+
+	// another write is still in progress
+	f.mu.Lock()
+	func() {
+		defer func() {
+			testutils.TrueOrError(t, recover() != nil, "concurrent File.Write() should panic")
+		}()
+		_, _ = f.Write([]byte("line\n"))
+	}()
+	f.mu.Unlock()
+	_, err = f.Write([]byte("line\n"))
+	testutils.TrueOrError(t, err == nil, "File.Write() error = %v", err)
+}
+
+func TestFile_MaxSize(t *testing.T) {
+	dirname, err := testutils.MkTestDir("MaxSize")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), MaxSize: 10}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+	for _, line := range []string{"1234\n", "5678\n", "abcd\n", "a line over max size\n", "x\n"} {
+		_, err := f.Write([]byte(line))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	}
+
+	want := map[string]string{
+		"app.2021-03-04T0000-00.log":   "1234\n5678\n",
+		"app.2021-03-04T0000-00_1.log": "abcd\n",
+		"app.2021-03-04T0000-00_2.log": "a line over max size\n",
+		"app.log":                      "x\n",
+	}
+	entries, err := ioutil.ReadDir(dirname)
+	testutils.TrueOrFatal(t, err == nil, "failed to read dir: %v", err)
+	testutils.TrueOrError(t, len(entries) == len(want), "entries = %v, want %d", entries, len(want))
+	for name, content := range want {
+		b, err := ioutil.ReadFile(filepath.Join(dirname, name))
+		testutils.TrueOrError(t, err == nil && string(b) == content, "%s content = %q, %v, want %q", name, b, err, content)
+	}
+}
+
+func TestFile_MaxAge(t *testing.T) {
+	dirname, err := testutils.MkTestDir("MaxAge")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 10, 10, 0, 0, 0, time.UTC)
+	for _, day := range []int{1, 5, 9} {
+		name := filepath.Join(dirname, fmt.Sprintf("app.2021-03-%02dT0000-00.log", day))
+		testutils.TrueOrFatal(t, ioutil.WriteFile(name, []byte("x\n"), 0600) == nil, "failed to write %s", name)
+		rotatedAt := time.Date(2021, time.March, day+1, 0, 0, 0, 0, time.UTC)
+		testutils.TrueOrFatal(t, os.Chtimes(name, rotatedAt, rotatedAt) == nil, "failed to set times of %s", name)
+	}
+	f := &File{Filename: filepath.Join(dirname, "app.log"), MaxAge: Duration(7 * 24 * time.Hour), NoGoroutines: true}
+	f.setNowFunc(func() time.Time { return now })
+	testutils.TrueOrFatal(t, f.Maintain() == nil, "File.Maintain() should not fail")
+	backups, err := f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil, "File.ListBackups() error = %v", err)
+	var got []string
+	for _, b := range backups {
+		got = append(got, filepath.Base(b.Name))
+	}
+	want := []string{"app.2021-03-05T0000-00.log", "app.2021-03-09T0000-00.log"}
+	testutils.TrueOrError(t, reflect.DeepEqual(got, want), "backups after MaxAge = %v, want %v", got, want)
+}
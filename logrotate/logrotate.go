@@ -0,0 +1,336 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+// Package logrotate reads a subset of logrotate(8) configuration into
+// logfeller Files, to ease moving from system log rotation to rotating in
+// process.
+//
+// The directives understood are
+//
+//	hourly, daily, weekly [weekday], monthly, yearly
+//	rotate N
+//	compress, nocompress, delaycompress, nodelaycompress
+//	dateext, nodateext, dateformat FORMAT
+//	olddir DIR, noolddir
+//	maxage N
+//	size N[k|M|G], maxsize N[k|M|G], minsize N[k|M|G]
+//
+// Directives that do not matter when rotating in process, such as missingok,
+// create or copytruncate, are ignored along with scripts. Any other directive
+// is an error. Directives outside of a block are defaults for the blocks
+// that follow them, as with logrotate.
+//
+// Some behaviours cannot be carried over exactly: backups are always dated,
+// "size" rotates in addition to the schedule rather than instead of it, and
+// "rotate 0" or no rotate directive keeps every backup rather than none.
+package logrotate
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lohvht/logfeller"
+)
+
+const (
+	day  = 24 * time.Hour
+	week = 7 * day
+	// dateFormat and hourlyDateFormat are logrotate's default dateformat for
+	// dateext, as Go layouts.
+	dateFormat       = "-20060102"
+	hourlyDateFormat = "-2006010215"
+)
+
+// ignored are directives that have no bearing on rotating in process.
+var ignored = map[string]bool{
+	"missingok": true, "nomissingok": true, "ifempty": true, "notifempty": true,
+	"create": true, "nocreate": true, "copytruncate": true, "nocopytruncate": true,
+	"copy": true, "nocopy": true, "sharedscripts": true, "nosharedscripts": true,
+	"nomail": true,
+}
+
+// scripts are directives followed by a script up to "endscript".
+var scripts = map[string]bool{
+	"prerotate": true, "postrotate": true, "firstaction": true, "lastaction": true, "preremove": true,
+}
+
+// config holds the directives that apply to a block.
+type config struct {
+	when     logfeller.WhenRotate
+	every    time.Duration
+	weekday  time.Weekday
+	rotate   int
+	compress bool
+	// delayCompress keeps the newest backup uncompressed.
+	delayCompress bool
+	dateext       bool
+	// dateformat is the strftime pattern of dateformat, if given.
+	dateformat string
+	olddir     string
+	maxAge     int
+	size       int64
+	minSize    int64
+}
+
+// file returns the logfeller.File for filename with c applied.
+func (c config) file(filename string) *logfeller.File {
+	f := &logfeller.File{
+		Filename: filename,
+		When:     c.when,
+		// logrotate goes by local time
+		UseLocal:  true,
+		Backups:   c.rotate,
+		Compress:  c.compress,
+		BackupDir: c.olddir,
+		MaxAge:    logfeller.Duration(time.Duration(c.maxAge) * day),
+		MaxSize:   c.size,
+		MinSize:   c.minSize,
+	}
+	if c.compress && c.delayCompress {
+		f.CompressAfter = 1
+	}
+	if c.every > 0 {
+		f.When = ""
+		f.Every = logfeller.Duration(c.every)
+		// 4 January 1970 was a Sunday
+		f.EveryAnchor = time.Date(1970, time.January, 4+int(c.weekday), 0, 0, 0, 0, time.Local)
+	}
+	if c.dateext {
+		f.BackupTimeFormat = dateFormat
+		if c.when == logfeller.Hour {
+			f.BackupTimeFormat = hourlyDateFormat
+		}
+		if c.dateformat != "" {
+			// converted by File on init
+			f.BackupTimeFormat = c.dateformat
+		}
+	}
+	return f
+}
+
+// ParseFile reads the logrotate configuration in the file name, see Parse.
+func ParseFile(name string) ([]*logfeller.File, error) {
+	fh, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	return Parse(fh)
+}
+
+// Parse reads logrotate configuration from r, and returns a File for each of
+// the paths of its blocks, in order. The Files are not initialised, so they
+// can still be adjusted before they are first used.
+func Parse(r io.Reader) ([]*logfeller.File, error) {
+	p := parser{global: config{when: logfeller.Day}}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		p.line++
+		if err := p.parseLine(scanner.Text()); err != nil {
+			return nil, fmt.Errorf("logrotate: line %d: %v", p.line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("logrotate: %v", err)
+	}
+	switch {
+	case p.inScript:
+		return nil, fmt.Errorf("logrotate: line %d: missing endscript", p.line)
+	case p.block != nil || len(p.paths) > 0:
+		return nil, fmt.Errorf("logrotate: line %d: missing }", p.line)
+	}
+	return p.files, nil
+}
+
+type parser struct {
+	line   int
+	global config
+	// block is the config of the block being read, nil outside of blocks.
+	block *config
+	// paths are the paths of the block being read, or of the block about
+	// to start if block is nil.
+	paths    []string
+	inScript bool
+	files    []*logfeller.File
+}
+
+func (p *parser) parseLine(line string) error {
+	line = strings.TrimSpace(line)
+	if p.inScript {
+		p.inScript = line != "endscript"
+		return nil
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	if line == "}" {
+		if p.block == nil {
+			return fmt.Errorf("unexpected }")
+		}
+		for _, path := range p.paths {
+			p.files = append(p.files, p.block.file(path))
+		}
+		p.block, p.paths = nil, nil
+		return nil
+	}
+	if p.block == nil && (strings.HasSuffix(line, "{") || len(p.paths) > 0 || isPath(line)) {
+		return p.parseHeader(line)
+	}
+	fields := strings.Fields(line)
+	c := &p.global
+	if p.block != nil {
+		c = p.block
+	}
+	return p.parseDirective(c, fields[0], fields[1:])
+}
+
+// isPath reports if line starts with a path rather than a directive.
+func isPath(line string) bool {
+	return strings.HasPrefix(line, "/") || strings.HasPrefix(line, "\"") || strings.HasPrefix(line, "~")
+}
+
+// parseHeader reads the paths of a block up to its opening brace.
+func (p *parser) parseHeader(line string) error {
+	open := strings.HasSuffix(line, "{")
+	line = strings.TrimSpace(strings.TrimSuffix(line, "{"))
+	for line != "" {
+		var path string
+		if strings.HasPrefix(line, "\"") {
+			end := strings.Index(line[1:], "\"")
+			if end < 0 {
+				return fmt.Errorf("unterminated quote in %s", line)
+			}
+			path, line = line[1:end+1], line[end+2:]
+		} else {
+			i := strings.IndexAny(line, " \t")
+			if i < 0 {
+				i = len(line)
+			}
+			path, line = line[:i], line[i:]
+		}
+		if strings.ContainsAny(path, "*?[") {
+			return fmt.Errorf("glob %s is not supported, list the files written to instead", path)
+		}
+		p.paths = append(p.paths, path)
+		line = strings.TrimSpace(line)
+	}
+	if open {
+		if len(p.paths) == 0 {
+			return fmt.Errorf("block without paths")
+		}
+		block := p.global
+		p.block = &block
+	}
+	return nil
+}
+
+func (p *parser) parseDirective(c *config, name string, args []string) error { //nolint:gocyclo // flat list of directives
+	switch {
+	case ignored[name]:
+		return nil
+	case scripts[name]:
+		p.inScript = true
+		return nil
+	}
+	var err error
+	switch name {
+	case "hourly":
+		c.when, c.every = logfeller.Hour, 0
+	case "daily":
+		c.when, c.every = logfeller.Day, 0
+	case "weekly":
+		c.every, c.weekday = week, time.Sunday
+		if len(args) > 0 {
+			var weekday int
+			weekday, err = strconv.Atoi(args[0])
+			if err == nil && (weekday < 0 || weekday > 7) {
+				err = fmt.Errorf("weekday must be between 0 and 7")
+			}
+			// 7 rotates every 7 days regardless of the weekday
+			c.weekday = time.Weekday(weekday % 7)
+		}
+	case "monthly":
+		c.when, c.every = logfeller.Month, 0
+	case "yearly":
+		c.when, c.every = logfeller.Year, 0
+	case "rotate":
+		c.rotate, err = intArg(args)
+	case "compress":
+		c.compress = true
+	case "nocompress":
+		c.compress = false
+	case "delaycompress":
+		c.delayCompress = true
+	case "nodelaycompress":
+		c.delayCompress = false
+	case "dateext":
+		c.dateext = true
+	case "nodateext":
+		c.dateext = false
+	case "dateformat":
+		if len(args) != 1 {
+			return fmt.Errorf("dateformat takes a format")
+		}
+		if _, err := logfeller.StrftimeLayout(args[0]); err != nil {
+			return err
+		}
+		c.dateformat = args[0]
+	case "olddir":
+		if len(args) != 1 {
+			return fmt.Errorf("olddir takes a directory")
+		}
+		c.olddir = args[0]
+	case "noolddir":
+		c.olddir = ""
+	case "maxage":
+		c.maxAge, err = intArg(args)
+	case "size", "maxsize":
+		c.size, err = sizeArg(args)
+	case "minsize":
+		c.minSize, err = sizeArg(args)
+	default:
+		return fmt.Errorf("unsupported directive %s", name)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
+
+func intArg(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("takes a single number")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid number %s", args[0])
+	}
+	return n, nil
+}
+
+// sizeArg parses a size in bytes with an optional k, M or G suffix.
+func sizeArg(args []string) (int64, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("takes a single size")
+	}
+	s, unit := args[0], int64(1)
+	switch {
+	case strings.HasSuffix(s, "k"):
+		s, unit = strings.TrimSuffix(s, "k"), 1024
+	case strings.HasSuffix(s, "M"):
+		s, unit = strings.TrimSuffix(s, "M"), 1024*1024
+	case strings.HasSuffix(s, "G"):
+		s, unit = strings.TrimSuffix(s, "G"), 1024*1024*1024
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %s", args[0])
+	}
+	return n * unit, nil
+}
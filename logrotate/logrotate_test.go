@@ -0,0 +1,98 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logrotate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller"
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+const sample = `
+# defaults
+weekly
+rotate 4
+dateext
+
+/var/log/app/access.log "/var/log/app/error log.log" {
+	daily
+	rotate 7
+	compress
+	delaycompress
+	missingok
+	olddir archive
+	maxage 30
+	postrotate
+		/usr/bin/killall -HUP app
+	endscript
+}
+
+/var/log/app/debug.log
+{
+	size 100M
+	nodateext
+}
+
+/var/log/app/audit.log {
+	hourly
+	dateformat -%Y%m%d%H
+}
+`
+
+func TestParse(t *testing.T) {
+	files, err := Parse(strings.NewReader(sample))
+	testutils.TrueOrFatal(t, err == nil, "Parse() error = %v", err)
+	testutils.TrueOrFatal(t, len(files) == 4, "Parse() = %d files, want 4", len(files))
+
+	for i, name := range []string{"/var/log/app/access.log", "/var/log/app/error log.log"} {
+		f := files[i]
+		testutils.TrueOrError(t, f.Filename == name, "files[%d].Filename = %s, want %s", i, f.Filename, name)
+		testutils.TrueOrError(t, f.When == logfeller.Day && f.Every == 0, "files[%d] When, Every = %s, %s, want daily", i, f.When, f.Every)
+		testutils.TrueOrError(t, f.Backups == 7 && f.Compress && f.CompressAfter == 1 && f.BackupDir == "archive" && f.UseLocal,
+			"files[%d] = %+v, does not match the block", i, f)
+		testutils.TrueOrError(t, time.Duration(f.MaxAge) == 30*24*time.Hour, "files[%d].MaxAge = %s, want 30 days", i, f.MaxAge)
+		testutils.TrueOrError(t, f.BackupTimeFormat == "-20060102", "files[%d].BackupTimeFormat = %s, want -20060102", i, f.BackupTimeFormat)
+	}
+	f := files[2]
+	testutils.TrueOrError(t, f.Every == logfeller.Duration(7*24*time.Hour) && f.EveryAnchor.Weekday() == time.Sunday,
+		"debug.log Every, EveryAnchor = %s, %s, want weekly from a Sunday", f.Every, f.EveryAnchor)
+	testutils.TrueOrError(t, f.Backups == 4 && !f.Compress && f.MaxSize == 100*1024*1024 && f.BackupTimeFormat == "",
+		"debug.log = %+v, does not match the defaults and block", f)
+	f = files[3]
+	testutils.TrueOrError(t, f.When == logfeller.Hour && f.BackupTimeFormat == "-%Y%m%d%H",
+		"audit.log When, BackupTimeFormat = %s, %s, want hourly with the dateformat", f.When, f.BackupTimeFormat)
+
+	for _, f := range files {
+		f.Filename = filepath.Join(os.TempDir(), filepath.Base(f.Filename))
+		testutils.TrueOrError(t, f.Maintain() == nil, "%s should be a valid configuration", f.Filename)
+	}
+}
+
+func TestParse_errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"unsupported_directive", "/a.log {\n\tmail ops@example.com\n}"},
+		{"glob", "/var/log/*.log {\n\tdaily\n}"},
+		{"invalid_rotate", "/a.log {\n\trotate many\n}"},
+		{"invalid_size", "/a.log {\n\tsize 10T\n}"},
+		{"missing_brace", "/a.log {\n\tdaily\n"},
+		{"missing_endscript", "/a.log {\n\tpostrotate\n\t\techo\n}"},
+		{"unexpected_brace", "daily\n}"},
+		{"invalid_dateformat", "/a.log {\n\tdateext\n\tdateformat -%Y%s\n}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.config))
+			testutils.TrueOrError(t, err != nil, "Parse() should fail")
+		})
+	}
+}
@@ -0,0 +1,111 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+// Package lumberjack provides Logger, a stand in for the Logger of
+// gopkg.in/natefinch/lumberjack.v2 backed by logfeller. Existing users of
+// lumberjack can switch by changing the import path, and gain scheduled
+// rotation through the When and RotationSchedule fields.
+//
+// As with lumberjack, files are only rotated on MaxSize unless When or
+// RotationSchedule is set, which rotates them on that schedule as well.
+// Backups are named after the time their file was created, or after their
+// period when rotated on a schedule, as with logfeller.File.
+package lumberjack
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lohvht/logfeller"
+)
+
+const (
+	// defaultMaxSize is the MaxSize used if it is empty, as with lumberjack.
+	defaultMaxSize = 100
+	megabyte       = 1024 * 1024
+	day            = 24 * time.Hour
+	// sizeOnly is the age files are rotated at if no schedule is set, far
+	// enough out that they are only rotated on MaxSize.
+	sizeOnly = 100 * 365 * day
+)
+
+// Logger is an io.WriteCloser that writes to the specified filename, with
+// the same fields as lumberjack's Logger.
+type Logger struct {
+	// Filename is the file to write logs to. If empty, logfeller's default
+	// of `<cmdname>-logfeller.log` within os.TempDir() is used.
+	Filename string `json:"filename" yaml:"filename"`
+	// MaxSize is the maximum size in megabytes of the log file before it gets
+	// rotated. It defaults to 100 megabytes.
+	MaxSize int `json:"maxsize" yaml:"maxsize"`
+	// MaxAge is the maximum number of days to retain old log files, based on
+	// when they were rotated out. If empty, old log files are not removed
+	// based on their age.
+	MaxAge int `json:"maxage" yaml:"maxage"`
+	// MaxBackups is the maximum number of old log files to retain. If empty,
+	// all old log files are retained, though MaxAge may still remove them.
+	MaxBackups int `json:"maxbackups" yaml:"maxbackups"`
+	// LocalTime determines if the time used for rotating and naming backups
+	// is the computer's local time. The default is to use UTC time.
+	LocalTime bool `json:"localtime" yaml:"localtime"`
+	// Compress determines if the rotated log files should be compressed
+	// using gzip.
+	Compress bool `json:"compress" yaml:"compress"`
+	// When and RotationSchedule schedule rotations as with logfeller.File.
+	// If neither is set, files are only rotated on MaxSize.
+	When             logfeller.WhenRotate `json:"when" yaml:"when"`
+	RotationSchedule []string             `json:"rotation_schedule" yaml:"rotation-schedule"`
+
+	once sync.Once
+	file *logfeller.File
+}
+
+// logfellerFile returns the logfeller.File backing l, built from l's fields
+// on the first call.
+func (l *Logger) logfellerFile() *logfeller.File {
+	l.once.Do(func() {
+		maxSize := l.MaxSize
+		if maxSize == 0 {
+			maxSize = defaultMaxSize
+		}
+		l.file = &logfeller.File{
+			Filename:         l.Filename,
+			When:             l.When,
+			RotationSchedule: l.RotationSchedule,
+			UseLocal:         l.LocalTime,
+			Backups:          l.MaxBackups,
+			MaxAge:           logfeller.Duration(time.Duration(l.MaxAge) * day),
+			MaxSize:          int64(maxSize) * megabyte,
+			Compress:         l.Compress,
+		}
+		if l.When == "" && len(l.RotationSchedule) == 0 {
+			l.file.AnchorToCreation = true
+			l.file.Every = logfeller.Duration(sizeOnly)
+		}
+	})
+	return l.file
+}
+
+// Write implements io.Writer. A write that would take the file past MaxSize
+// rotates it first, as does a write after a scheduled rotation time.
+func (l *Logger) Write(p []byte) (n int, err error) {
+	return l.logfellerFile().Write(p)
+}
+
+// Close implements io.Closer, and closes the current log file.
+func (l *Logger) Close() error {
+	return l.logfellerFile().Close()
+}
+
+// Rotate causes Logger to close the existing log file and immediately create
+// a new one.
+func (l *Logger) Rotate() error {
+	return l.logfellerFile().ForceRotate()
+}
+
+// File returns the logfeller.File backing l, for access to the rest of
+// logfeller's features. Its configuration must not be changed.
+func (l *Logger) File() *logfeller.File {
+	return l.logfellerFile()
+}
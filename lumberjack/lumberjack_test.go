@@ -0,0 +1,73 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package lumberjack
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestLogger(t *testing.T) {
+	dirname, err := testutils.MkTestDir("lumberjack")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+
+	var l Logger
+	err = json.Unmarshal([]byte(`{
+		"filename": "`+filepath.ToSlash(filepath.Join(dirname, "app.log"))+`",
+		"maxsize": 1,
+		"maxage": 28,
+		"maxbackups": 3,
+		"localtime": true,
+		"compress": true,
+		"when": "h"
+	}`), &l)
+	testutils.TrueOrFatal(t, err == nil, "json.Unmarshal() error = %v", err)
+	f := l.File()
+	testutils.TrueOrError(t, f.MaxSize == 1024*1024 && f.Backups == 3 && f.UseLocal && f.Compress && f.When == "h",
+		"logfeller.File = %+v, does not match the Logger", f)
+	testutils.TrueOrError(t, !f.AnchorToCreation && f.Every == 0, "logfeller.File = %+v, want rotations on the hourly schedule", f)
+	testutils.TrueOrError(t, time.Duration(f.MaxAge) == 28*24*time.Hour, "MaxAge = %v, want 28 days", f.MaxAge)
+
+	line := []byte(strings.Repeat("x", 1023) + "\n")
+	for i := 0; i < 1025; i++ {
+		_, err := l.Write(line)
+		testutils.TrueOrFatal(t, err == nil, "Logger.Write() error = %v", err)
+	}
+	testutils.TrueOrFatal(t, l.Rotate() == nil, "Logger.Rotate() should not fail")
+	testutils.TrueOrFatal(t, l.Close() == nil, "Logger.Close() should not fail")
+	backups, err := f.ListBackups()
+	testutils.TrueOrError(t, err == nil && len(backups) == 2, "File.ListBackups() = %v, %v, want 2 backups", backups, err)
+}
+
+func TestLogger_defaults(t *testing.T) {
+	l := &Logger{Filename: filepath.Join(os.TempDir(), "lumberjack-defaults.log")}
+	f := l.File()
+	testutils.TrueOrError(t, f.MaxSize == 100*1024*1024 && f.MaxAge == 0 && f.Backups == 0 && !f.Compress,
+		"logfeller.File = %+v, want lumberjack's defaults", f)
+	testutils.TrueOrError(t, f.AnchorToCreation && time.Duration(f.Every) == sizeOnly, "logfeller.File = %+v, want rotations on MaxSize only", f)
+}
+
+func TestLogger_sizeOnly(t *testing.T) {
+	dirname, err := testutils.MkTestDir("lumberjack_sizeOnly")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+
+	l := &Logger{Filename: filepath.Join(dirname, "app.log"), MaxSize: 1}
+	defer l.Close()
+	line := []byte(strings.Repeat("x", 1023) + "\n")
+	for i := 0; i < 1025; i++ {
+		_, err := l.Write(line)
+		testutils.TrueOrFatal(t, err == nil, "Logger.Write() error = %v", err)
+	}
+	backups, err := l.File().ListBackups()
+	testutils.TrueOrError(t, err == nil && len(backups) == 1, "File.ListBackups() = %v, %v, want the file rotated on MaxSize", backups, err)
+}
@@ -0,0 +1,107 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"context"
+	"sync"
+)
+
+// maintenance tracks the background trims requested and done, so that they
+// can be waited for.
+type maintenance struct {
+	mu sync.Mutex
+	// requested is the number of trims requested, and done the number
+	// requested before the last trim that finished started.
+	requested, done uint64
+	// changed is closed and replaced whenever done moves.
+	changed chan struct{}
+}
+
+// request records a trim requested.
+func (m *maintenance) request() {
+	m.mu.Lock()
+	m.requested++
+	m.mu.Unlock()
+}
+
+// run runs trim, which covers all the trims requested before it starts.
+func (m *maintenance) run(trim func()) {
+	m.mu.Lock()
+	requested := m.requested
+	m.mu.Unlock()
+	trim()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if requested > m.done {
+		m.done = requested
+		if m.changed != nil {
+			close(m.changed)
+			m.changed = nil
+		}
+	}
+}
+
+// wait waits until the trims requested so far are done, or ctx is done.
+func (m *maintenance) wait(ctx context.Context) error {
+	m.mu.Lock()
+	target := m.requested
+	for m.done < target {
+		if m.changed == nil {
+			m.changed = make(chan struct{})
+		}
+		changed := m.changed
+		m.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+		m.mu.Lock()
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+// WaitForMaintenance waits until the background work triggered so far is
+// done: the BackgroundBackup of files rotated out, RepairBackups, and the
+// trims that follow rotations, which remove, compress and move backups. It
+// returns ctx.Err() if ctx is done first. Tests and graceful shutdowns can
+// use it instead of sleeping until the work is likely done. It returns
+// immediately with NoGoroutines, as the work is done as it is triggered.
+func (f *File) WaitForMaintenance(ctx context.Context) error {
+	if err := f.init(); err != nil {
+		return err
+	}
+	backups := make(chan struct{})
+	go func() {
+		// finished backups trigger trims, wait for them first
+		f.WaitBackups()
+		close(backups)
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-backups:
+	}
+	return f.maintenance.wait(ctx)
+}
+
+// WaitForMaintenance waits for the background work of every managed file as
+// with File.WaitForMaintenance.
+func (m *Manager) WaitForMaintenance(ctx context.Context) error {
+	m.mu.Lock()
+	files := make([]*File, 0, len(m.Files))
+	for _, f := range m.Files {
+		files = append(files, f)
+	}
+	m.mu.Unlock()
+	for _, f := range files {
+		if err := f.WaitForMaintenance(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
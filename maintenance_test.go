@@ -0,0 +1,40 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_WaitForMaintenance(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_WaitForMaintenance")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), Compress: true, Backups: 1, BackgroundBackup: true}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		_, err := f.Write([]byte("line\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+		now = now.Add(24 * time.Hour)
+	}
+	testutils.TrueOrFatal(t, f.WaitForMaintenance(ctx) == nil, "File.WaitForMaintenance() should not fail")
+
+	backups, err := f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil, "File.ListBackups() error = %v", err)
+	testutils.TrueOrError(t, len(backups) == 1 && strings.HasSuffix(backups[0].Name, "app.2021-03-06T0000-00.log.gz"), "want the last backup compressed and the others trimmed, got %v", backups)
+}
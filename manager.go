@@ -0,0 +1,126 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+// Manager manages a set of Files by name, such as a file per tenant that
+// writes are routed to. Files are opened as they are written to, and at most
+// MaxOpen of them are kept open at once.
+type Manager struct {
+	// Files are the files managed, by name.
+	Files map[string]*File `json:"files" yaml:"files" mapstructure:"files"`
+	// New creates the File for a name that is not in Files, it is added to
+	// Files once created. If New is nil, names not in Files are an error.
+	New func(name string) (*File, error) `json:"-" yaml:"-" mapstructure:"-"`
+	// MaxOpen is the maximum number of files kept open at once. Once it is
+	// reached, the least recently written file is closed to make room, and
+	// it is opened again on its next write. If MaxOpen is 0, files are kept
+	// open until Close.
+	MaxOpen int `json:"max_open" yaml:"max-open" mapstructure:"max_open"`
+
+	mu sync.Mutex
+	// recent lists the names of open files, most recently written first.
+	recent *list.List
+	// open are the elements of recent by name.
+	open map[string]*list.Element
+}
+
+// File returns the file of name, creating it with New if it is not managed
+// yet.
+func (m *Manager) File(name string) (*File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.file(name)
+}
+
+func (m *Manager) file(name string) (*File, error) {
+	if f, ok := m.Files[name]; ok {
+		return f, nil
+	}
+	if m.New == nil {
+		return nil, fmt.Errorf("no file named %s", name)
+	}
+	f, err := m.New(name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create file %s: %v", name, err)
+	}
+	if m.Files == nil {
+		m.Files = make(map[string]*File)
+	}
+	m.Files[name] = f
+	return f, nil
+}
+
+// Write writes p to the file of name, creating it with New if it is not
+// managed yet.
+func (m *Manager) Write(name string, p []byte) (int, error) {
+	m.mu.Lock()
+	f, err := m.file(name)
+	if err != nil {
+		m.mu.Unlock()
+		return 0, err
+	}
+	evicted := m.touch(name)
+	m.mu.Unlock()
+	for _, e := range evicted {
+		if err := e.release(); err != nil {
+			e.emit(Event{Type: EventWriteError, Filename: e.Filename, Message: "unable to close file evicted from the open files", Err: err})
+		}
+	}
+	return f.Write(p)
+}
+
+// touch marks the file of name as the most recently written, and returns
+// the files that have to be closed to stay within MaxOpen.
+func (m *Manager) touch(name string) []*File {
+	if m.MaxOpen <= 0 {
+		return nil
+	}
+	if m.recent == nil {
+		m.recent, m.open = list.New(), make(map[string]*list.Element)
+	}
+	if e, ok := m.open[name]; ok {
+		m.recent.MoveToFront(e)
+		return nil
+	}
+	m.open[name] = m.recent.PushFront(name)
+	var evicted []*File
+	for m.recent.Len() > m.MaxOpen {
+		oldest := m.recent.Remove(m.recent.Back()).(string)
+		delete(m.open, oldest)
+		evicted = append(evicted, m.Files[oldest])
+	}
+	return evicted
+}
+
+// Close closes every managed file.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var errs multipleErrors
+	for name, f := range m.Files {
+		if err := f.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", name, err))
+		}
+	}
+	m.recent, m.open = nil, nil
+	return errs.err()
+}
+
+// release flushes and closes the file without writing a Footer, the next
+// write opens it again.
+func (f *File) release() error {
+	if err := f.drainShards(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.close()
+}
@@ -0,0 +1,49 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestManager_MaxOpen(t *testing.T) {
+	dirname, err := testutils.MkTestDir("Manager_MaxOpen")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+
+	m := &Manager{
+		MaxOpen: 2,
+		New: func(name string) (*File, error) {
+			return &File{Filename: filepath.Join(dirname, name+".log"), BufferSize: 64}, nil
+		},
+	}
+	isOpen := func(name string) bool {
+		f := m.Files[name]
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return f.file != nil
+	}
+	for _, name := range []string{"a", "b", "a", "c", "b"} {
+		_, err := m.Write(name, []byte(name+"\n"))
+		testutils.TrueOrFatal(t, err == nil, "Manager.Write(%s) error = %v", name, err)
+	}
+	// b was evicted by c, then a by b
+	testutils.TrueOrError(t, !isOpen("a") && isOpen("b") && isOpen("c"), "want b and c open, got a = %v, b = %v, c = %v", isOpen("a"), isOpen("b"), isOpen("c"))
+	b, err := ioutil.ReadFile(filepath.Join(dirname, "a.log"))
+	testutils.TrueOrError(t, err == nil && string(b) == "a\na\n", "evicted file should be flushed, got %q, err = %v", b, err)
+
+	testutils.TrueOrFatal(t, m.Close() == nil, "Manager.Close() should not fail")
+	for name, want := range map[string]string{"a": "a\na\n", "b": "b\nb\n", "c": "c\n"} {
+		b, err := ioutil.ReadFile(filepath.Join(dirname, name+".log"))
+		testutils.TrueOrError(t, err == nil && string(b) == want, "%s.log = %q, want %q, err = %v", name, b, want, err)
+	}
+	_, err = (&Manager{}).Write("unknown", []byte("line\n"))
+	testutils.TrueOrError(t, err != nil, "Manager.Write() to an unknown file without New should fail")
+}
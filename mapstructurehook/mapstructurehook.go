@@ -0,0 +1,52 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+// Package mapstructurehook decodes logfeller Files and Managers with
+// mapstructure, such as from viper. It is kept apart from logfeller so that
+// only its users depend on mapstructure.
+package mapstructurehook
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/lohvht/logfeller"
+	"github.com/mitchellh/mapstructure"
+)
+
+var (
+	durationType   = reflect.TypeOf(logfeller.Duration(0))
+	timeType       = reflect.TypeOf(time.Time{})
+	whenRotateType = reflect.TypeOf(logfeller.WhenRotate(""))
+)
+
+// DecodeHook returns a mapstructure.DecodeHookFunc that decodes the fields of
+// File and Manager as their JSON and YAML decoding does, so that they can be
+// decoded by mapstructure, such as with viper:
+//
+//	var f logfeller.File
+//	err := v.UnmarshalKey("log", &f, viper.DecodeHook(mapstructurehook.DecodeHook()))
+//
+// Durations are parsed with logfeller.ParseDuration, times as RFC 3339 and
+// When is case insensitive. Files decoded this way are initialised on their
+// first use, use File.Validate to report problems with their configuration
+// earlier.
+func DecodeHook() mapstructure.DecodeHookFunc {
+	return func(from, to reflect.Type, data interface{}) (interface{}, error) {
+		s, ok := data.(string)
+		if !ok || from.Kind() != reflect.String {
+			return data, nil
+		}
+		switch to {
+		case durationType:
+			return logfeller.ParseDuration(s)
+		case timeType:
+			return time.Parse(time.RFC3339Nano, s)
+		case whenRotateType:
+			return logfeller.WhenRotate(strings.ToLower(s)), nil
+		}
+		return data, nil
+	}
+}
@@ -0,0 +1,54 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package mapstructurehook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller"
+	"github.com/lohvht/logfeller/internal/testutils"
+	"github.com/mitchellh/mapstructure"
+)
+
+func TestDecodeHook(t *testing.T) {
+	input := map[string]interface{}{
+		"max_open": 4,
+		"files": map[string]interface{}{
+			"app": map[string]interface{}{
+				"filename":              "app.log",
+				"when":                  "H",
+				"rotation_schedule":     []string{"30:00"},
+				"extra_schedules":       []map[string]interface{}{{"when": "D"}},
+				"min_rotation_interval": "PT1M",
+				"stale_after":           "90s",
+				"backup_dir":            "old",
+			},
+			"every": map[string]interface{}{
+				"filename":     "every.log",
+				"every":        "6h",
+				"every_anchor": "2021-03-04T01:00:00Z",
+			},
+		},
+	}
+	var m logfeller.Manager
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{DecodeHook: DecodeHook(), Result: &m})
+	testutils.TrueOrFatal(t, err == nil, "mapstructure.NewDecoder() error = %v", err)
+	testutils.TrueOrFatal(t, dec.Decode(input) == nil, "Decode() should not fail")
+	app, every := m.Files["app"], m.Files["every"]
+	testutils.TrueOrFatal(t, m.MaxOpen == 4 && app != nil && every != nil, "Decode() = %#v", m.Files)
+	testutils.TrueOrError(t, app.Validate() == nil && every.Validate() == nil, "decoded files should be valid")
+	testutils.TrueOrError(t, app.When == logfeller.Hour && len(app.ExtraSchedules) == 1 && app.ExtraSchedules[0].When == logfeller.Day,
+		"app When = %s, extra schedules = %v", app.When, app.ExtraSchedules)
+	testutils.TrueOrError(t, app.MinRotationInterval == logfeller.Duration(time.Minute) && app.StaleAfter == logfeller.Duration(90*time.Second) && app.BackupDir == "old",
+		"app = %#v", app)
+	testutils.TrueOrError(t, every.Every == logfeller.Duration(6*time.Hour) && every.EveryAnchor.Equal(time.Date(2021, 3, 4, 1, 0, 0, 0, time.UTC)),
+		"every = %#v", every)
+
+	bad := &logfeller.File{}
+	err = mapstructure.Decode(map[string]interface{}{"when": "x"}, bad)
+	testutils.TrueOrFatal(t, err == nil, "mapstructure.Decode() error = %v", err)
+	testutils.TrueOrError(t, bad.Validate() != nil, "File.Validate() should fail on an invalid When")
+}
@@ -0,0 +1,22 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"os"
+)
+
+// mapFile returns nil as files are not mapped on this platform, they are
+// written to instead.
+func mapFile(fh *os.File, size int) ([]byte, error) {
+	return nil, nil
+}
+
+func unmapFile(b []byte) error {
+	return nil
+}
@@ -0,0 +1,44 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_expandPath(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skipf("no home directory: %v", err)
+	}
+	os.Setenv("LOGFELLER_TEST_DIR", "/var/log/app")
+	defer os.Unsetenv("LOGFELLER_TEST_DIR")
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "plain", path: "logs/app.log", want: "logs/app.log"},
+		{name: "home", path: "~/logs/app.log", want: filepath.Join(home, "logs/app.log")},
+		{name: "home_only", path: "~", want: home},
+		{name: "tilde_user_untouched", path: "~bob/app.log", want: "~bob/app.log"},
+		{name: "env", path: "$LOGFELLER_TEST_DIR/app.log", want: "/var/log/app/app.log"},
+		{name: "env_braces", path: "${LOGFELLER_TEST_DIR}/app.log", want: "/var/log/app/app.log"},
+		{name: "env_unset", path: "$LOGFELLER_TEST_UNSET/app.log", want: "/app.log"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandPath(tt.path)
+			if err != nil {
+				t.Fatalf("expandPath() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expandPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
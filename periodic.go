@@ -0,0 +1,67 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"sync"
+	"time"
+)
+
+// periodic runs a check of File on a timer, such as for StaleAfter, until it
+// is stopped. The nil *periodic is stopped.
+type periodic struct {
+	// first is how long after it is started check is first run.
+	first time.Duration
+	check func() (next time.Duration)
+	// mu protects timer.
+	mu sync.Mutex
+	// timer runs the check, it is nil once stopped.
+	timer *time.Timer
+}
+
+// startPeriodic runs check after first, and then again after the duration it
+// returns each time, until the returned periodic is stopped.
+func startPeriodic(first time.Duration, check func() (next time.Duration)) *periodic {
+	p := &periodic{first: first, check: check}
+	p.start()
+	return p
+}
+
+// start starts p again once it is stopped, such as by Close, it does
+// nothing if p is running.
+func (p *periodic) start() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.timer != nil {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(p.first, func() {
+		next := p.check()
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		// a timer stopped and replaced while check ran is not reset
+		if p.timer == timer {
+			timer.Reset(next)
+		}
+	})
+	p.timer = timer
+}
+
+// stop stops p, a check that is running already is not waited on.
+func (p *periodic) stop() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+}
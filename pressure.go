@@ -0,0 +1,125 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// pressureDiskInterval is how often the free disk space is checked for
+// Pressure at most, as it takes a syscall.
+const pressureDiskInterval = time.Second
+
+// pressure tracks the Pressure of File for PressureThresholds.
+type pressure struct {
+	mu sync.Mutex
+	// disk is the disk pressure as of diskAt.
+	disk   float64
+	diskAt time.Time
+	// level is the number of PressureThresholds reached as of the last
+	// check.
+	level int
+}
+
+// Pressure returns how close f is to dropping or failing writes, from 0 for
+// none to 1 when writes are being dropped or held back. It is the highest of
+// how full the Shards are of ShardMaxBytes, how full the queue of
+// BackgroundBackup is, how much of DailyQuotaBytes is used, and how far the
+// free disk space is below PressureFreeSpace, for those that are set. It is
+// meant for applications to reduce their output before anything is lost,
+// see also PressureThresholds.
+func (f *File) Pressure() float64 {
+	if err := f.init(); err != nil {
+		return 0
+	}
+	return f.currentPressure()
+}
+
+func (f *File) currentPressure() float64 {
+	var p float64
+	if f.ShardMaxBytes > 0 {
+		_, held := f.shards.held()
+		p = maxPressure(p, float64(held)/float64(f.ShardMaxBytes))
+	}
+	if f.backupJobs != nil {
+		p = maxPressure(p, float64(len(f.backupJobs))/float64(cap(f.backupJobs)))
+	}
+	if f.DailyQuotaBytes > 0 {
+		used, _ := f.quotaStats()
+		p = maxPressure(p, float64(used)/float64(f.DailyQuotaBytes))
+	}
+	if f.PressureFreeSpace > 0 {
+		p = maxPressure(p, f.diskPressure())
+	}
+	return p
+}
+
+// diskPressure returns how far the free disk space is below
+// PressureFreeSpace, checking it at most every pressureDiskInterval.
+func (f *File) diskPressure() float64 {
+	f.pressure.mu.Lock()
+	defer f.pressure.mu.Unlock()
+	now := f.nowFunc()
+	if !f.pressure.diskAt.IsZero() && now.Sub(f.pressure.diskAt) < pressureDiskInterval {
+		return f.pressure.disk
+	}
+	f.pressure.diskAt = now
+	free, err := diskFree(f.directory)
+	if err != nil {
+		// the free space cannot be told
+		f.pressure.disk = 0
+		return 0
+	}
+	f.pressure.disk = 0
+	if want := uint64(f.PressureFreeSpace); free < want {
+		f.pressure.disk = float64(want-free) / float64(want)
+	}
+	return f.pressure.disk
+}
+
+// maxPressure returns the higher of p and q, capped at 1.
+func maxPressure(p, q float64) float64 {
+	if q > p {
+		p = q
+	}
+	if p > 1 {
+		return 1
+	}
+	return p
+}
+
+// checkPressure emits an EventPressure when the Pressure of f crosses one of
+// PressureThresholds, either way.
+func (f *File) checkPressure() {
+	if len(f.PressureThresholds) == 0 {
+		return
+	}
+	p := f.currentPressure()
+	var level int
+	for _, t := range f.PressureThresholds {
+		if p >= t {
+			level++
+		}
+	}
+	f.pressure.mu.Lock()
+	prev := f.pressure.level
+	f.pressure.level = level
+	f.pressure.mu.Unlock()
+	if level == prev {
+		return
+	}
+	direction := "rose"
+	if level < prev {
+		direction = "fell"
+	}
+	f.emit(Event{
+		Type:     EventPressure,
+		Filename: f.Filename,
+		Pressure: p,
+		Message:  fmt.Sprintf("pressure on %s %s to %.2f", f.Filename, direction, p),
+	})
+}
@@ -0,0 +1,57 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_Pressure(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_Pressure")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	var free uint64 = 800
+	diskFree = func(dir string) (uint64, error) { return free, nil }
+	defer func() { diskFree = freeSpace }()
+
+	var events []Event
+	f := &File{
+		Filename:           filepath.Join(dirname, "app.log"),
+		PressureThresholds: []float64{0.5, 0.9},
+		PressureFreeSpace:  1000,
+		OnEvent: func(e Event) {
+			if e.Type == EventPressure {
+				events = append(events, e)
+			}
+		},
+	}
+	defer f.Close()
+	now := time.Date(2021, 3, 4, 10, 15, 0, 0, time.UTC)
+	f.setNowFunc(func() time.Time { return now })
+	write := func() {
+		_, err := f.Write([]byte("line\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	}
+
+	write()
+	testutils.TrueOrError(t, f.Pressure() == 0.2 && len(events) == 0, "want a pressure of 0.2 below the thresholds, got %v, events %v", f.Pressure(), events)
+
+	free = 50
+	write()
+	testutils.TrueOrError(t, len(events) == 0, "want the free space cached for a second, got events %v", events)
+	now = now.Add(pressureDiskInterval)
+	write()
+	testutils.TrueOrFatal(t, len(events) == 1 && events[0].Pressure == 0.95, "want an event as both thresholds are crossed, got %v", events)
+
+	free = 600
+	now = now.Add(pressureDiskInterval)
+	write()
+	testutils.TrueOrFatal(t, len(events) == 2 && events[1].Pressure == 0.4, "want an event as the pressure falls back, got %v", events)
+}
@@ -0,0 +1,118 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QuotaPolicy decides what happens to writes over DailyQuotaBytes.
+type QuotaPolicy string
+
+const (
+	QuotaDrop   QuotaPolicy = "drop"
+	QuotaBlock  QuotaPolicy = "block"
+	QuotaRotate QuotaPolicy = "rotate"
+)
+
+func (p QuotaPolicy) lower() QuotaPolicy { return QuotaPolicy(strings.ToLower(string(p))) }
+
+// valid returns an error if its not valid
+func (p QuotaPolicy) valid() error {
+	switch p {
+	case QuotaDrop, QuotaBlock, QuotaRotate:
+		return nil
+	default:
+		return fmt.Errorf("invalid quota policy specified: %s, accepted values are %v",
+			p, []QuotaPolicy{QuotaDrop, QuotaBlock, QuotaRotate})
+	}
+}
+
+// quota counts the bytes written each day for DailyQuotaBytes.
+type quota struct {
+	mu sync.Mutex
+	// day is the start of the day counted, in the time zone of File.
+	day time.Time
+	// used and dropped are the bytes written and dropped on day.
+	used, dropped int64
+	// exceeded is set once EventQuotaExceeded is emitted for day.
+	exceeded bool
+}
+
+// checkQuota counts a write of n bytes against DailyQuotaBytes, and reports
+// if it is to be written, blocking or rotating as OnQuotaExceeded says if it
+// goes over. A write is always allowed if nothing was written yet that day.
+func (f *File) checkQuota(ctx context.Context, n int) (bool, error) {
+	q := f.quota
+	if q == nil {
+		return true, nil
+	}
+	for {
+		q.mu.Lock()
+		now := f.nowFunc()
+		t := f.time(now)
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		if !q.day.Equal(day) {
+			q.day, q.used, q.dropped, q.exceeded = day, 0, 0, false
+		}
+		if q.used == 0 || q.used+int64(n) <= f.DailyQuotaBytes {
+			q.used += int64(n)
+			q.mu.Unlock()
+			return true, nil
+		}
+		first := !q.exceeded
+		q.exceeded = true
+		switch f.OnQuotaExceeded {
+		case QuotaRotate:
+			// the quota starts over with the new file
+			q.used, q.exceeded = int64(n), false
+			q.mu.Unlock()
+			f.emitQuotaExceeded("rotating")
+			return true, f.rotateNow(true, TriggerQuota)
+		case QuotaBlock:
+			q.mu.Unlock()
+			if first {
+				f.emitQuotaExceeded("blocking writes until the next day")
+			}
+			timer := time.NewTimer(day.AddDate(0, 0, 1).Sub(t))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return false, ctx.Err()
+			case <-timer.C:
+			}
+		default:
+			q.dropped += int64(n)
+			q.mu.Unlock()
+			if first {
+				f.emitQuotaExceeded("dropping writes until the next day")
+			}
+			return false, nil
+		}
+	}
+}
+
+func (f *File) emitQuotaExceeded(action string) {
+	f.emit(Event{
+		Type:     EventQuotaExceeded,
+		Filename: f.Filename,
+		Message:  fmt.Sprintf("daily quota of %d bytes exceeded for %s, %s", f.DailyQuotaBytes, f.Filename, action),
+	})
+}
+
+// quotaStats returns the bytes written and dropped today.
+func (f *File) quotaStats() (used, dropped int64) {
+	q := f.quota
+	if q == nil {
+		return 0, 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.used, q.dropped
+}
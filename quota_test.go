@@ -0,0 +1,89 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_DailyQuotaBytes(t *testing.T) {
+	tests := []struct {
+		policy QuotaPolicy
+		// want is what was written after the lines, and backups the
+		// backups forced by "rotate"
+		want     string
+		exceeded int
+		backups  map[string]string
+	}{
+		{policy: "", want: "aaaa\nbbbb\neeee\n", exceeded: 1},
+		{policy: "ROTATE", want: "eeee\n", exceeded: 2, backups: map[string]string{
+			"app.2021-03-04T0000-00.log":   "aaaa\nbbbb\n",
+			"app.2021-03-04T0000-00_1.log": "cccc\ndddd\n",
+		}},
+	}
+	for _, tt := range tests {
+		dirname, err := testutils.MkTestDir(fmt.Sprintf("File_DailyQuotaBytes_%s", tt.policy))
+		testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+		defer os.RemoveAll(dirname)
+		now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+		var exceeded int
+		f := &File{Filename: filepath.Join(dirname, "app.log"), DailyQuotaBytes: 10, OnQuotaExceeded: tt.policy, OnEvent: func(e Event) {
+			if e.Type == EventQuotaExceeded {
+				exceeded++
+			}
+		}}
+		f.setNowFunc(func() time.Time { return now })
+
+		for _, line := range []string{"aaaa", "bbbb", "cccc", "dddd"} {
+			n, err := f.Write([]byte(line + "\n"))
+			testutils.TrueOrFatal(t, err == nil && n == 5, "policy = %s, File.Write() = %d, %v", tt.policy, n, err)
+		}
+		if tt.policy == "" {
+			s := f.Stats()
+			testutils.TrueOrError(t, s.QuotaUsed == 10 && s.QuotaDropped == 10, "policy = %s, want 10 bytes used and dropped, got %d and %d", tt.policy, s.QuotaUsed, s.QuotaDropped)
+			// the quota starts over on the next day
+			now = now.Add(24 * time.Hour)
+		}
+		_, err = f.Write([]byte("eeee\n"))
+		testutils.TrueOrFatal(t, err == nil, "policy = %s, File.Write() error = %v", tt.policy, err)
+		testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+		testutils.TrueOrError(t, exceeded == tt.exceeded, "policy = %s, want %d EventQuotaExceeded, got %d", tt.policy, tt.exceeded, exceeded)
+
+		b, err := ioutil.ReadFile(f.Filename)
+		if tt.policy == "" {
+			// the file was rotated on the next day
+			b, err = ioutil.ReadFile(filepath.Join(dirname, "app.2021-03-04T0000-00.log"))
+			b = append(b, "eeee\n"...)
+		}
+		testutils.TrueOrError(t, err == nil && string(b) == tt.want, "policy = %s, file = %q, want %q, err = %v", tt.policy, b, tt.want, err)
+		for name, want := range tt.backups {
+			b, err := ioutil.ReadFile(filepath.Join(dirname, name))
+			testutils.TrueOrError(t, err == nil && string(b) == want, "policy = %s, %s = %q, want %q, err = %v", tt.policy, name, b, want, err)
+		}
+	}
+}
+
+func TestFile_DailyQuotaBytesBlock(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_DailyQuotaBytesBlock")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), DailyQuotaBytes: 5, OnQuotaExceeded: QuotaBlock}
+	defer f.Close()
+
+	_, err = f.Write([]byte("aaaa\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = f.WriteContext(ctx, []byte("bbbb\n"))
+	testutils.TrueOrError(t, err == context.DeadlineExceeded, "WriteContext() over the quota should block until ctx is done, got %v", err)
+}
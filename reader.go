@@ -0,0 +1,350 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// followPollInterval is how often Follow checks the active file for new data
+// and rotations.
+const followPollInterval = 250 * time.Millisecond
+
+// NewReader returns a reader over the backups of f and then the active file,
+// from the oldest to the newest. Backups are decoded as with OpenBackup, and
+// read from the Archiver if it stores them. If since is not zero, reading
+// starts from the file holding since, skipping ahead within it using its time
+// index if it has one.
+//
+// Data still buffered by f, and backups rotated out after NewReader is
+// called, are not read.
+func (f *File) NewReader(since time.Time) (io.ReadCloser, error) {
+	segments, err := f.readSegments(since, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	active := f.readActive(since, time.Time{}, len(segments) == 0)
+	return newChainReader(append(segments, active)), nil
+}
+
+// Follow is like NewReader, but keeps reading the active file as it is
+// written to, following it across rotations like "tail -F". If since is zero,
+// it starts from the current end of the active file. Reads block until there
+// is more data, ctx is done, or the returned reader is closed; Close may be
+// called concurrently with Read to stop following. It cannot follow a file
+// written with ActiveCompression.
+func (f *File) Follow(ctx context.Context, since time.Time) (io.ReadCloser, error) {
+	if err := f.init(); err != nil {
+		return nil, err
+	}
+	if f.ActiveCompression != ActiveCompressionNone {
+		return nil, fmt.Errorf("cannot follow %s, it is written with %s active compression", f.Filename, f.ActiveCompression)
+	}
+	var segments []segment
+	if !since.IsZero() {
+		var err error
+		if segments, err = f.readSegments(since, time.Time{}); err != nil {
+			return nil, err
+		}
+	}
+	cr := newChainReader(segments)
+	cr.follow = true
+	var skip int64
+	switch {
+	case since.IsZero():
+		// start from the current end
+		if info, err := os.Stat(f.Filename); err == nil {
+			skip = info.Size()
+		}
+	case len(segments) == 0:
+		skip = indexOffsetOf(f.Filename, since)
+	}
+	name := f.Filename
+	cr.segments = append(cr.segments, func() (io.ReadCloser, error) {
+		return &followReader{ctx: ctx, name: name, skip: skip, done: cr.done}, nil
+	})
+	return cr, nil
+}
+
+// segment opens one of the files read by a chainReader.
+type segment func() (io.ReadCloser, error)
+
+// readSegments returns the segments for the backups to read to get data
+// written from since until until, either of which may be zero for no bound.
+func (f *File) readSegments(since, until time.Time) ([]segment, error) {
+	backups, err := f.BackupsBetween(since, until)
+	if err != nil {
+		return nil, err
+	}
+	segments := make([]segment, 0, len(backups))
+	for i, b := range backups {
+		b, skip, end := b, int64(0), int64(-1)
+		if !b.Remote {
+			// the time indexes of remote backups are not archived
+			end = indexEndOf(b.Name, until)
+			if i == 0 && !since.IsZero() {
+				skip = indexOffsetOf(b.Name, since)
+			}
+		}
+		segments = append(segments, func() (io.ReadCloser, error) {
+			rc, err := f.openBackup(b)
+			if err != nil {
+				return nil, err
+			}
+			return sliced(rc, skip, end)
+		})
+	}
+	return segments, nil
+}
+
+// readActive returns the segment for the active file, skipping ahead to since
+// if it is the first file read. It returns nil if the active file only holds
+// data written after until.
+func (f *File) readActive(since, until time.Time, first bool) segment {
+	if stats := f.Stats(); !until.IsZero() && stats.PeriodStart.After(until) {
+		return nil
+	}
+	name := f.Filename
+	var skip int64
+	if first && !since.IsZero() {
+		skip = indexOffsetOf(name, since)
+	}
+	end := indexEndOf(name, until)
+	return func() (io.ReadCloser, error) {
+		fh, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		if f.ActiveCompression != ActiveCompressionNone {
+			return decode(fh)
+		}
+		return sliced(fh, skip, end)
+	}
+}
+
+// indexOffsetOf returns the offset to start reading name from to find data
+// written since t, based on its time index if it has one.
+func indexOffsetOf(name string, t time.Time) int64 {
+	index, err := ReadTimeIndex(name)
+	if err != nil {
+		return 0
+	}
+	return IndexOffset(index, t)
+}
+
+// indexEndOf returns the offset from which all data in name was written after
+// t, based on its time index if it has one. It returns -1 if t is zero or
+// there is no such offset.
+func indexEndOf(name string, t time.Time) int64 {
+	if t.IsZero() {
+		return -1
+	}
+	index, err := ReadTimeIndex(name)
+	if err != nil {
+		return -1
+	}
+	for _, c := range index {
+		if c.Time.After(t) {
+			return c.Offset
+		}
+	}
+	return -1
+}
+
+// sliced discards the first skip bytes of rc and stops reading it at end, if
+// end is not negative.
+func sliced(rc io.ReadCloser, skip, end int64) (io.ReadCloser, error) {
+	rc, err := skipped(rc, skip)
+	if err != nil || end < 0 {
+		return rc, err
+	}
+	n := end - skip
+	if n < 0 {
+		n = 0
+	}
+	return readCloser{Reader: io.LimitReader(rc, n), Closer: rc}, nil
+}
+
+// skipped discards the first n bytes of rc.
+func skipped(rc io.ReadCloser, n int64) (io.ReadCloser, error) {
+	if n <= 0 {
+		return rc, nil
+	}
+	if s, ok := rc.(io.Seeker); ok {
+		if _, err := s.Seek(n, io.SeekStart); err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return rc, nil
+	}
+	if _, err := io.CopyN(ioutil.Discard, rc, n); err != nil && err != io.EOF {
+		rc.Close()
+		return nil, err
+	}
+	return rc, nil
+}
+
+// chainReader reads its segments one after another. Segments whose files no
+// longer exist, such as backups trimmed in the meantime, are skipped.
+type chainReader struct {
+	segments  []segment
+	cur       io.ReadCloser
+	follow    bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newChainReader(segments []segment) *chainReader {
+	return &chainReader{segments: segments, done: make(chan struct{})}
+}
+
+func (cr *chainReader) Read(p []byte) (int, error) {
+	for {
+		select {
+		case <-cr.done:
+			cr.closeCurrent()
+			return 0, os.ErrClosed
+		default:
+		}
+		if cr.cur == nil {
+			if len(cr.segments) == 0 {
+				return 0, io.EOF
+			}
+			open := cr.segments[0]
+			cr.segments = cr.segments[1:]
+			rc, err := open()
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return 0, err
+			}
+			cr.cur = rc
+		}
+		n, err := cr.cur.Read(p)
+		if err == io.EOF {
+			cr.closeCurrent()
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (cr *chainReader) closeCurrent() {
+	if cr.cur != nil {
+		cr.cur.Close()
+		cr.cur = nil
+	}
+}
+
+// Close stops reading. When following, it may be called while a Read is
+// blocked, and the current file is closed by that Read instead.
+func (cr *chainReader) Close() error {
+	cr.closeOnce.Do(func() { close(cr.done) })
+	if !cr.follow {
+		cr.closeCurrent()
+	}
+	return nil
+}
+
+// followReader reads the file name as it is written to, reopening it when it
+// is rotated.
+type followReader struct {
+	ctx  context.Context
+	name string
+	// skip is the offset to start reading from when name is first opened.
+	skip int64
+	fh   *os.File
+	// rotated is set once fh is found to have been rotated out, it is read
+	// to its end once more before moving on to the new file.
+	rotated bool
+	done    chan struct{}
+}
+
+func (fr *followReader) Read(p []byte) (int, error) {
+	for {
+		if fr.fh == nil {
+			if err := fr.open(); err != nil && !os.IsNotExist(err) {
+				return 0, err
+			}
+		}
+		if fr.fh != nil {
+			n, err := fr.fh.Read(p)
+			if n > 0 || (err != nil && err != io.EOF) {
+				return n, err
+			}
+			if fr.rotated {
+				fr.Close()
+				fr.rotated = false
+				continue
+			}
+			if fr.reopen() {
+				continue
+			}
+		}
+		select {
+		case <-fr.ctx.Done():
+			return 0, fr.ctx.Err()
+		case <-fr.done:
+			return 0, os.ErrClosed
+		case <-time.After(followPollInterval):
+		}
+	}
+}
+
+func (fr *followReader) open() error {
+	fh, err := os.Open(fr.name)
+	if err != nil {
+		return err
+	}
+	if _, err := fh.Seek(fr.skip, io.SeekStart); err != nil {
+		fh.Close()
+		return err
+	}
+	fr.fh, fr.skip = fh, 0
+	return nil
+}
+
+// reopen is called at the end of the open file. It reports if the file should
+// be read again, because it was rotated out and may have been written to just
+// before that, or because it was truncated and has been rewound.
+func (fr *followReader) reopen() bool {
+	info, err := os.Stat(fr.name)
+	if err != nil {
+		// rotated out, but the new file is not there yet
+		return false
+	}
+	cur, err := fr.fh.Stat()
+	if err != nil {
+		return false
+	}
+	if !os.SameFile(info, cur) {
+		fr.rotated = true
+		return true
+	}
+	if pos, err := fr.fh.Seek(0, io.SeekCurrent); err == nil && info.Size() < pos {
+		_, _ = fr.fh.Seek(0, io.SeekStart)
+		return true
+	}
+	return false
+}
+
+func (fr *followReader) Close() error {
+	if fr.fh == nil {
+		return nil
+	}
+	err := fr.fh.Close()
+	fr.fh = nil
+	return err
+}
@@ -0,0 +1,151 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+// gzipFile replaces name with a gzip compressed copy named name+".gz".
+func gzipFile(t *testing.T, name string) {
+	b, err := ioutil.ReadFile(name)
+	testutils.TrueOrFatal(t, err == nil, "failed to read %s: %v", name, err)
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write(b)
+	testutils.TrueOrFatal(t, zw.Close() == nil, "failed to gzip %s", name)
+	testutils.TrueOrFatal(t, ioutil.WriteFile(name+".gz", buf.Bytes(), 0600) == nil, "failed to write %s.gz", name)
+	testutils.TrueOrFatal(t, os.Remove(name) == nil, "failed to remove %s", name)
+}
+
+func TestOpenBackup(t *testing.T) {
+	dirname, err := testutils.MkTestDir("OpenBackup")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	// a toy encryption that prefixes the content
+	RegisterDecoder(".testenc", []byte("ENC:"), func(r io.Reader) (io.ReadCloser, error) {
+		_, err := io.CopyN(ioutil.Discard, r, 4)
+		return ioutil.NopCloser(r), err
+	})
+
+	plain := filepath.Join(dirname, "plain.log")
+	testutils.TrueOrFatal(t, ioutil.WriteFile(plain, []byte("hello\n"), 0600) == nil, "failed to write file")
+	compressed := filepath.Join(dirname, "compressed.log")
+	testutils.TrueOrFatal(t, ioutil.WriteFile(compressed, []byte("hello\n"), 0600) == nil, "failed to write file")
+	gzipFile(t, compressed)
+	b, err := ioutil.ReadFile(compressed + ".gz")
+	testutils.TrueOrFatal(t, err == nil, "failed to read file: %v", err)
+	encrypted := compressed + ".gz.testenc"
+	testutils.TrueOrFatal(t, ioutil.WriteFile(encrypted, append([]byte("ENC:"), b...), 0600) == nil, "failed to write file")
+
+	for _, name := range []string{plain, compressed + ".gz", encrypted} {
+		rc, err := OpenBackup(name)
+		testutils.TrueOrFatal(t, err == nil, "OpenBackup(%s) error = %v", name, err)
+		got, err := ioutil.ReadAll(rc)
+		rc.Close()
+		testutils.TrueOrError(t, err == nil && string(got) == "hello\n", "OpenBackup(%s) read = %q, %v, want %q", name, got, err, "hello\n")
+	}
+}
+
+func TestFile_NewReader(t *testing.T) {
+	dirname, err := testutils.MkTestDir("NewReader")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), IndexInterval: Duration(time.Minute)}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+	write := func(s string) {
+		_, err := f.Write([]byte(s))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	}
+	write("one\n")
+	now = now.Add(24 * time.Hour)
+	write("two\n")
+	now = now.Add(time.Hour)
+	write("three\n")
+	now = now.Add(24 * time.Hour)
+	write("four\n")
+	gzipFile(t, filepath.Join(dirname, "app.2021-03-04T0000-00.log"))
+
+	tests := []struct {
+		name  string
+		since time.Time
+		want  string
+	}{
+		{name: "all", want: "one\ntwo\nthree\nfour\n"},
+		{name: "since_before_all", since: time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC), want: "one\ntwo\nthree\nfour\n"},
+		{name: "since_within_backup", since: time.Date(2021, time.March, 5, 11, 30, 0, 0, time.UTC), want: "three\nfour\n"},
+		{name: "since_between_checkpoints", since: time.Date(2021, time.March, 5, 10, 30, 0, 0, time.UTC), want: "two\nthree\nfour\n"},
+		{name: "since_within_active", since: time.Date(2021, time.March, 6, 12, 0, 0, 0, time.UTC), want: "four\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := f.NewReader(tt.since)
+			testutils.TrueOrFatal(t, err == nil, "File.NewReader() error = %v", err)
+			defer rc.Close()
+			got, err := ioutil.ReadAll(rc)
+			testutils.TrueOrError(t, err == nil && string(got) == tt.want, "File.NewReader() read = %q, %v, want %q", got, err, tt.want)
+		})
+	}
+}
+
+func TestFile_Follow(t *testing.T) {
+	dirname, err := testutils.MkTestDir("Follow")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	f := &File{Filename: filepath.Join(dirname, "app.log")}
+	defer f.Close()
+	_, err = f.Write([]byte("before\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	rc, err := f.Follow(ctx, time.Time{})
+	testutils.TrueOrFatal(t, err == nil, "File.Follow() error = %v", err)
+	defer rc.Close()
+	want := "after\nrotated\n"
+	got := make(chan string)
+	go func() {
+		b := make([]byte, len(want))
+		n, err := io.ReadFull(rc, b)
+		if err != nil {
+			got <- err.Error()
+			return
+		}
+		got <- string(b[:n])
+	}()
+
+	_, err = f.Write([]byte("after\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	time.Sleep(2 * followPollInterval)
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	_, err = f.Write([]byte("rotated\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	s := <-got
+	testutils.TrueOrError(t, s == want, "File.Follow() read = %q, want %q", s, want)
+
+	// Close unblocks a pending Read
+	errc := make(chan error)
+	go func() {
+		_, err := rc.Read(make([]byte, 1))
+		errc <- err
+	}()
+	time.Sleep(followPollInterval / 2)
+	rc.Close()
+	err = <-errc
+	testutils.TrueOrError(t, err != nil && !strings.Contains(err.Error(), "deadline"), "Read after Close error = %v, want closed", err)
+}
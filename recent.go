@@ -0,0 +1,158 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultRecentSize is the size of the RecentFile window by default.
+	defaultRecentSize = 10 * oneMB
+	// recentHeaderPrefix starts the header of a RecentFile, which is
+	// followed by the number of bytes ever written to it.
+	recentHeaderPrefix = "logfeller-recent "
+	// recentHeaderFormat is the header of a RecentFile, it has a fixed
+	// length so that it can be rewritten in place.
+	recentHeaderFormat = recentHeaderPrefix + "%020d\n"
+)
+
+// recentHeaderLen is the length of the header of a RecentFile.
+var recentHeaderLen = int64(len(fmt.Sprintf(recentHeaderFormat, 0)))
+
+// recentWindow is the ring file RecentFile, which holds the last RecentSize
+// bytes written after a header. Writes wrap around to the start of the ring
+// once it is full.
+type recentWindow struct {
+	fh   *os.File
+	size int64
+	// total is the number of bytes ever written to the ring, it is where
+	// the next write goes modulo size.
+	total int64
+}
+
+// openRecent opens RecentFile, carrying on from where it was left if it has
+// a window of the same size.
+func (f *File) openRecent() error {
+	if err := os.MkdirAll(filepath.Dir(f.RecentFile), dirCreateMode); err != nil {
+		return err
+	}
+	fh, err := os.OpenFile(f.RecentFile, os.O_RDWR|os.O_CREATE, fileOpenMode)
+	if err != nil {
+		return err
+	}
+	w := &recentWindow{fh: fh, size: f.RecentSize}
+	header := make([]byte, recentHeaderLen)
+	total, ok := int64(0), false
+	if info, err := fh.Stat(); err == nil && info.Size() == recentHeaderLen+w.size {
+		if _, err := fh.ReadAt(header, 0); err == nil {
+			total, ok = parseRecentHeader(header)
+		}
+	}
+	if !ok {
+		// a new window, or one of another size
+		if err := fh.Truncate(recentHeaderLen + w.size); err != nil {
+			fh.Close()
+			return err
+		}
+	}
+	w.total = total
+	f.recent = w
+	return nil
+}
+
+// parseRecentHeader returns the number of bytes written to a RecentFile from
+// its header.
+func parseRecentHeader(header []byte) (int64, bool) {
+	s := string(header)
+	if !strings.HasPrefix(s, recentHeaderPrefix) || !strings.HasSuffix(s, "\n") {
+		return 0, false
+	}
+	total, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(s, recentHeaderPrefix), "\n"), 10, 64)
+	return total, err == nil && total >= 0
+}
+
+// writeRecent writes p to RecentFile if it is set, its errors are reported
+// with an EventWriteError rather than failing the write.
+func (f *File) writeRecent(p []byte) {
+	if f.RecentFile == "" || len(p) == 0 {
+		return
+	}
+	if f.recent == nil {
+		if err := f.openRecent(); err != nil {
+			f.emit(Event{Type: EventWriteError, Filename: f.RecentFile, Message: "unable to open recent file", Err: err})
+			return
+		}
+	}
+	if err := f.recent.write(p); err != nil {
+		f.emit(Event{Type: EventWriteError, Filename: f.RecentFile, Message: "unable to write to recent file", Err: err})
+	}
+}
+
+func (w *recentWindow) write(p []byte) error {
+	if int64(len(p)) > w.size {
+		// only the end of p fits
+		w.total += int64(len(p)) - w.size
+		p = p[int64(len(p))-w.size:]
+	}
+	for len(p) > 0 {
+		pos := w.total % w.size
+		n := int64(len(p))
+		if n > w.size-pos {
+			n = w.size - pos
+		}
+		if _, err := w.fh.WriteAt(p[:n], recentHeaderLen+pos); err != nil {
+			return err
+		}
+		w.total += n
+		p = p[n:]
+	}
+	_, err := w.fh.WriteAt([]byte(fmt.Sprintf(recentHeaderFormat, w.total)), 0)
+	return err
+}
+
+// closeRecent closes RecentFile if it is open.
+func (f *File) closeRecent() error {
+	if f.recent == nil {
+		return nil
+	}
+	err := f.recent.fh.Close()
+	f.recent = nil
+	return err
+}
+
+// ReadRecent reads the RecentFile name, and returns the most recent output
+// it holds from the oldest to the newest. Once the window has wrapped
+// around, the line it starts with is dropped as it may be partial.
+func ReadRecent(name string) ([]byte, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) < recentHeaderLen {
+		return nil, fmt.Errorf("%s is not a recent file", name)
+	}
+	total, ok := parseRecentHeader(b[:recentHeaderLen])
+	if !ok {
+		return nil, fmt.Errorf("%s is not a recent file", name)
+	}
+	data := b[recentHeaderLen:]
+	size := int64(len(data))
+	if size == 0 || total <= size {
+		return data[:total], nil
+	}
+	pos := total % size
+	out := append(append(make([]byte, 0, size), data[pos:]...), data[:pos]...)
+	if i := bytes.IndexByte(out, '\n'); i >= 0 {
+		out = out[i+1:]
+	}
+	return out, nil
+}
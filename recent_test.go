@@ -0,0 +1,53 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_RecentFile(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_RecentFile")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	newFile := func() *File {
+		return &File{Filename: filepath.Join(dirname, "app.log"), RecentFile: "app.recent", RecentSize: 16}
+	}
+	write := func(f *File, lines ...string) {
+		for _, line := range lines {
+			_, err := f.Write([]byte(line + "\n"))
+			testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		}
+	}
+	recent := filepath.Join(dirname, "app.recent")
+	readRecent := func() string {
+		b, err := ReadRecent(recent)
+		testutils.TrueOrFatal(t, err == nil, "ReadRecent() error = %v", err)
+		return string(b)
+	}
+
+	f := newFile()
+	write(f, "one", "two")
+	testutils.TrueOrError(t, readRecent() == "one\ntwo\n", "want the window before it is full, got %q", readRecent())
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	write(f, "three", "four")
+	testutils.TrueOrError(t, readRecent() == "two\nthree\nfour\n", "want the window across rotations without its first line, got %q", readRecent())
+	testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+
+	// the window carries on in a new File
+	f = newFile()
+	defer f.Close()
+	write(f, "five")
+	testutils.TrueOrError(t, readRecent() == "four\nfive\n", "want the window carried on, got %q", readRecent())
+	write(f, "a line longer than the window")
+	testutils.TrueOrError(t, readRecent() == "", "want only the partial end of a long line, which is dropped, got %q", readRecent())
+
+	_, err = ReadRecent(f.Filename)
+	testutils.TrueOrError(t, err != nil, "ReadRecent() should fail for a file that is not a recent file")
+}
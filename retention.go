@@ -0,0 +1,75 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import "time"
+
+// RetentionPolicy decides which backups are removed when backups are
+// trimmed, see File.Retention.
+type RetentionPolicy interface {
+	// Expired returns the backups to remove out of backups, which are
+	// sorted from the newest to the oldest, at now.
+	Expired(backups []Backup, now time.Time) []Backup
+}
+
+// TieredRetention is a RetentionPolicy that thins out older backups
+// progressively, such as keeping 24 hourly, 7 daily, 8 weekly and 12 monthly
+// backups. Each tier keeps the newest backup of as many of the latest hours,
+// days, weeks, months or years as it is set to, and a backup is kept if any
+// tier keeps it. Periods are taken from the times encoded in backup names,
+// weeks are ISO weeks.
+type TieredRetention struct {
+	Hourly  int `json:"hourly" yaml:"hourly" mapstructure:"hourly"`
+	Daily   int `json:"daily" yaml:"daily" mapstructure:"daily"`
+	Weekly  int `json:"weekly" yaml:"weekly" mapstructure:"weekly"`
+	Monthly int `json:"monthly" yaml:"monthly" mapstructure:"monthly"`
+	Yearly  int `json:"yearly" yaml:"yearly" mapstructure:"yearly"`
+}
+
+// retentionTier is a tier of TieredRetention, period returns the period t
+// falls in as the year and the number of the period within the year.
+type retentionTier struct {
+	keep   int
+	period func(t time.Time) [2]int
+}
+
+func (r TieredRetention) tiers() []retentionTier {
+	return []retentionTier{
+		{r.Hourly, func(t time.Time) [2]int { return [2]int{t.Year(), t.YearDay()*24 + t.Hour()} }},
+		{r.Daily, func(t time.Time) [2]int { return [2]int{t.Year(), t.YearDay()} }},
+		{r.Weekly, func(t time.Time) [2]int { y, w := t.ISOWeek(); return [2]int{y, w} }},
+		{r.Monthly, func(t time.Time) [2]int { return [2]int{t.Year(), int(t.Month())} }},
+		{r.Yearly, func(t time.Time) [2]int { return [2]int{t.Year(), 0} }},
+	}
+}
+
+// Expired implements RetentionPolicy.
+func (r TieredRetention) Expired(backups []Backup, _ time.Time) []Backup {
+	kept := make([]bool, len(backups))
+	for _, tier := range r.tiers() {
+		if tier.keep <= 0 {
+			continue
+		}
+		seen := make(map[[2]int]bool, tier.keep)
+		for i, b := range backups {
+			p := tier.period(b.Time)
+			if seen[p] {
+				continue
+			}
+			if len(seen) == tier.keep {
+				break
+			}
+			seen[p] = true
+			kept[i] = true
+		}
+	}
+	var expired []Backup
+	for i, b := range backups {
+		if !kept[i] {
+			expired = append(expired, b)
+		}
+	}
+	return expired
+}
@@ -0,0 +1,72 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestTieredRetention_Expired(t *testing.T) {
+	var backups []Backup
+	// a backup every 6 hours for 60 days, newest first
+	latest := time.Date(2021, time.March, 31, 18, 0, 0, 0, time.UTC)
+	for i := 0; i < 60*4; i++ {
+		backups = append(backups, Backup{Name: latest.Add(time.Duration(-i) * 6 * time.Hour).Format(time.RFC3339), Time: latest.Add(time.Duration(-i) * 6 * time.Hour)})
+	}
+	expired := TieredRetention{Hourly: 3, Daily: 4, Weekly: 2, Monthly: 3}.Expired(backups, latest)
+	gone := make(map[string]bool, len(expired))
+	for _, b := range expired {
+		gone[b.Name] = true
+	}
+	var kept []string
+	for _, b := range backups {
+		if !gone[b.Name] {
+			kept = append(kept, b.Name)
+		}
+	}
+	want := []string{
+		// hourly, the first of them also the newest of its day, week and month
+		"2021-03-31T18:00:00Z", "2021-03-31T12:00:00Z", "2021-03-31T06:00:00Z",
+		// daily, the last of them also the newest of the previous ISO week
+		"2021-03-30T18:00:00Z", "2021-03-29T18:00:00Z", "2021-03-28T18:00:00Z",
+		// monthly
+		"2021-02-28T18:00:00Z", "2021-01-31T18:00:00Z",
+	}
+	testutils.TrueOrError(t, reflect.DeepEqual(kept, want), "kept = %v, want %v", kept, want)
+}
+
+func TestFile_Retention(t *testing.T) {
+	dirname, err := testutils.MkTestDir("Retention")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	for _, name := range []string{
+		"app.2021-01-15T0000-00.log",
+		"app.2021-02-10T0000-00.log",
+		"app.2021-02-20T0000-00.log",
+		"app.2021-03-01T0000-00.log",
+		"app.2021-03-02T0000-00.log",
+	} {
+		name = filepath.Join(dirname, name)
+		testutils.TrueOrFatal(t, ioutil.WriteFile(name, []byte("x\n"), 0600) == nil, "failed to write %s", name)
+	}
+	f := &File{Filename: filepath.Join(dirname, "app.log"), Backups: 4, Retention: TieredRetention{Daily: 1, Monthly: 3}}
+	testutils.TrueOrFatal(t, f.Maintain() == nil, "File.Maintain() should not fail")
+	backups, err := f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil, "File.ListBackups() error = %v", err)
+	var got []string
+	for _, b := range backups {
+		got = append(got, filepath.Base(b.Name))
+	}
+	// the January backup is past Backups
+	want := []string{"app.2021-02-20T0000-00.log", "app.2021-03-02T0000-00.log"}
+	testutils.TrueOrError(t, reflect.DeepEqual(got, want), "backups after trim = %v, want %v", got, want)
+}
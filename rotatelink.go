@@ -0,0 +1,60 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"os"
+)
+
+// replaceSuffix is appended to Filename to get the name the new active file
+// is created under before it replaces the old one with RotationLink.
+const replaceSuffix = ".new"
+
+// linking reports if src is the active file and is moved out by linking it
+// rather than renaming it.
+func (f *File) linking(src string) bool {
+	return f.RotationMethod == RotationLink && src == f.Filename
+}
+
+// moveActive moves src to dst, replacing dst if it exists. With RotationLink,
+// the active file is linked to dst instead, and it is left in place for
+// replaceActive.
+func (f *File) moveActive(src, dst string) error {
+	if err := f.linkOrRename(src, dst); err != nil {
+		return err
+	}
+	f.syncDirs(src, dst)
+	return nil
+}
+
+// linkOrRename does the move of moveActive.
+func (f *File) linkOrRename(src, dst string) error {
+	if !f.linking(src) {
+		return os.Rename(src, dst)
+	}
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Link(src, dst)
+}
+
+// replaceActive creates a new active file and moves it over the one that was
+// linked to its backup, so that Filename exists throughout the rotation.
+func (f *File) replaceActive(mode os.FileMode) error {
+	tmp := f.Filename + replaceSuffix
+	fh, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, mode)
+	if err != nil {
+		return fmt.Errorf("unable to create new file %s: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, f.Filename); err != nil {
+		_ = fh.Close()
+		_ = os.Remove(tmp)
+		return fmt.Errorf("unable to replace file %s with %s: %v", f.Filename, tmp, err)
+	}
+	f.syncDirs(f.Filename)
+	f.setFile(fh)
+	return f.writeStartMarker()
+}
@@ -0,0 +1,52 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_RotationLink(t *testing.T) {
+	for _, background := range []bool{false, true} {
+		dirname, err := testutils.MkTestDir(fmt.Sprintf("RotationLink_%v", background))
+		testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+		defer os.RemoveAll(dirname)
+		now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+		filename := filepath.Join(dirname, "app.log")
+		f := &File{Filename: filename, RotationMethod: "LINK", BackgroundBackup: background}
+		f.setNowFunc(func() time.Time { return now })
+
+		_, err = f.Write([]byte("first\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		before, err := os.Stat(filename)
+		testutils.TrueOrFatal(t, err == nil, "failed to stat %s: %v", filename, err)
+		testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+		// the collision is appended to
+		_, err = f.Write([]byte("second\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+		_, err = f.Write([]byte("third\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+
+		after, err := os.Stat(filename)
+		testutils.TrueOrFatal(t, err == nil, "failed to stat %s: %v", filename, err)
+		testutils.TrueOrError(t, !os.SameFile(before, after), "background = %v, the active file should be replaced by a new one", background)
+		b, err := ioutil.ReadFile(filename)
+		testutils.TrueOrError(t, err == nil && string(b) == "third\n", "background = %v, active file = %q, err = %v", background, b, err)
+		backup := filepath.Join(dirname, "app.2021-03-04T0000-00.log")
+		b, err = ioutil.ReadFile(backup)
+		testutils.TrueOrError(t, err == nil && string(b) == "first\nsecond\n", "background = %v, backup = %q, err = %v", background, b, err)
+		infos, err := ioutil.ReadDir(dirname)
+		testutils.TrueOrError(t, err == nil && len(infos) == 2, "background = %v, want only the active file and the backup, got %d files", background, len(infos))
+	}
+}
@@ -0,0 +1,122 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultSampleEvery is used when SampleEvery is not set.
+const defaultSampleEvery = 10
+
+// sampler drops writes over above a second, keeping one in every of them,
+// and accounts for those dropped.
+type sampler struct {
+	above, every int
+	// now returns the time of a write, and zone converts the times of the
+	// notices.
+	now  func() time.Time
+	zone func(time.Time) time.Time
+
+	mu sync.Mutex
+	// window is when the current second of writes started, and writes the
+	// number of writes in it.
+	window time.Time
+	writes int
+	// dropped is the number of writes dropped since the last notice, from
+	// firstDrop to lastDrop.
+	dropped             int64
+	firstDrop, lastDrop time.Time
+}
+
+// SampleHook returns a WriteHook that sheds load during log storms as with
+// File.SampleAbove: once there are more than above writes in a second, only
+// one in every of the writes over it is kept for the rest of that second.
+// The writes dropped are accounted for by a notice line put before the first
+// write that comes out of it once the second is over, with times in UTC.
+func SampleHook(above, every int) WriteHook {
+	s := &sampler{above: above, every: every, now: time.Now, zone: time.Time.UTC}
+	return s.hook
+}
+
+// startSampling puts the sampling of SampleAbove first in the hooks of f.
+func (f *File) startSampling() {
+	f.hooks = f.WriteHooks
+	if f.SampleAbove <= 0 {
+		return
+	}
+	f.sampler = &sampler{
+		above: f.SampleAbove,
+		every: f.SampleEvery,
+		now:   func() time.Time { return f.nowFunc() },
+		zone:  f.time,
+	}
+	f.hooks = append([]WriteHook{f.sampler.hook}, f.WriteHooks...)
+}
+
+// hook is the WriteHook of s. A write is dropped unless it is kept, and the
+// notice of earlier drops is put before it once it is due, or written
+// instead of it if it is dropped.
+func (s *sampler) hook(_ context.Context, p []byte) ([]byte, error) {
+	keep, notice := s.sample(s.now())
+	switch {
+	case notice == nil && keep:
+		return p, nil
+	case notice == nil:
+		return nil, nil
+	case keep:
+		return append(notice, p...), nil
+	default:
+		return notice, nil
+	}
+}
+
+// sample reports if a write at now is kept. Once a second with drops is over,
+// it also returns the notice of the drops to write before the write.
+func (s *sampler) sample(now time.Time) (keep bool, notice []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.window.IsZero() || now.Sub(s.window) >= time.Second || now.Before(s.window) {
+		s.window, s.writes = now, 0
+		notice = s.notice()
+	}
+	s.writes++
+	over := s.writes - s.above
+	if over <= 0 || over%s.every == 0 {
+		return true, notice
+	}
+	if s.dropped == 0 {
+		s.firstDrop = now
+	}
+	s.dropped++
+	s.lastDrop = now
+	return false, notice
+}
+
+// notice returns the line accounting for the writes dropped since the last
+// one, nil if there were none. It must be called with mu held.
+func (s *sampler) notice() []byte {
+	if s.dropped == 0 {
+		return nil
+	}
+	notice := fmt.Sprintf("sampled: dropped %d records between %s and %s\n",
+		s.dropped, s.zone(s.firstDrop).Format(time.RFC3339), s.zone(s.lastDrop).Format(time.RFC3339))
+	s.dropped = 0
+	return []byte(notice)
+}
+
+// pendingSampleNotice returns the notice of the writes dropped that was not
+// written yet, for Close.
+func (f *File) pendingSampleNotice() []byte {
+	if f.sampler == nil {
+		return nil
+	}
+	f.sampler.mu.Lock()
+	defer f.sampler.mu.Unlock()
+	return f.sampler.notice()
+}
@@ -0,0 +1,103 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_SampleAbove(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_SampleAbove")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), When: "h", SampleAbove: 2, SampleEvery: 3}
+	f.setNowFunc(func() time.Time { return now })
+
+	write := func(line string) {
+		n, err := f.Write([]byte(line + "\n"))
+		testutils.TrueOrFatal(t, err == nil && n == len(line)+1, "File.Write() = %d, %v", n, err)
+	}
+	// 2 kept, then one in 3 of the 7 over it
+	for _, line := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i"} {
+		write(line)
+	}
+	now = now.Add(time.Second)
+	write("j")
+	now = now.Add(100 * time.Millisecond)
+	// k is within SampleAbove of the new second, l and m are dropped and only
+	// accounted for on Close
+	for _, line := range []string{"k", "l", "m"} {
+		write(line)
+	}
+	testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+
+	b, err := ioutil.ReadFile(f.Filename)
+	testutils.TrueOrFatal(t, err == nil, "failed to read file: %v", err)
+	want := strings.Join([]string{
+		"a", "b", "e", "h",
+		"sampled: dropped 5 records between 2021-03-04T10:00:00Z and 2021-03-04T10:00:00Z",
+		"j", "k",
+		"sampled: dropped 2 records between 2021-03-04T10:00:01Z and 2021-03-04T10:00:01Z",
+	}, "\n") + "\n"
+	testutils.TrueOrError(t, string(b) == want, "file = %q, want %q", b, want)
+}
+
+func TestFile_SampleAbove_hooks(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_SampleAbove_hooks")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	var observed []string
+	f := &File{
+		Filename: filepath.Join(dirname, "app.log"), When: "h", SampleAbove: 1, SampleEvery: 2,
+		WriteHooks: []WriteHook{
+			PrefixHook("host1 "),
+			ObserveHook(func(p []byte) { observed = append(observed, string(p)) }),
+		},
+	}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+
+	// b is dropped before the hooks see it, the notice goes through them
+	// along with d
+	for i, line := range []string{"a", "b", "c", "d"} {
+		if i == 3 {
+			now = now.Add(time.Second)
+		}
+		_, err := f.Write([]byte(line + "\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	}
+	want := []string{
+		"host1 a\n",
+		"host1 c\n",
+		"host1 sampled: dropped 1 records between 2021-03-04T10:00:00Z and 2021-03-04T10:00:00Z\nhost1 d\n",
+	}
+	testutils.TrueOrError(t, strings.Join(observed, "|") == strings.Join(want, "|"), "hooks saw %q, want %q", observed, want)
+	b, err := ioutil.ReadFile(f.Filename)
+	testutils.TrueOrFatal(t, err == nil, "failed to read file: %v", err)
+	testutils.TrueOrError(t, string(b) == strings.Join(want, ""), "file = %q, want %q", b, strings.Join(want, ""))
+}
+
+func TestSampleHook(t *testing.T) {
+	hook := SampleHook(1, 2)
+	var kept int
+	for i := 0; i < 5; i++ {
+		p, err := hook(context.Background(), []byte("x\n"))
+		testutils.TrueOrFatal(t, err == nil, "SampleHook() error = %v", err)
+		if p != nil {
+			kept++
+		}
+	}
+	testutils.TrueOrError(t, kept == 3, "SampleHook() kept %d of 5 writes in a second, want 3", kept)
+}
@@ -0,0 +1,203 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedule is the effective rotation schedule of a File.
+type Schedule struct {
+	When WhenRotate
+	// Every is the fixed interval between rotations, if set the schedule
+	// times of When are not used.
+	Every time.Duration
+	// EveryAnchor is the time intervals of Every are counted from.
+	EveryAnchor time.Time
+	// AnchorToCreation is true if rotations happen once the file is one
+	// interval old.
+	AnchorToCreation bool
+	// Location is the time zone rotations are scheduled in.
+	Location *time.Location
+	// WeekdaysOnly is true if rotations on weekends are skipped.
+	WeekdaysOnly bool
+	// WeekParity restricts rotations to even or odd ISO weeks.
+	WeekParity WeekParity
+	// HasCalendar is true if a calendar hook decides which days rotations
+	// may happen on.
+	HasCalendar bool
+	// BlackoutWindows are the daily windows where rotation is deferred.
+	BlackoutWindows []string
+
+	// times are the sorted times within each When period rotations happen at.
+	times []timeSchedule
+	// extra are the ExtraSchedules rotations also happen at.
+	extra []scheduleGroup
+}
+
+// Schedule returns the effective rotation schedule of f.
+func (f *File) Schedule() (Schedule, error) {
+	if err := f.init(); err != nil {
+		return Schedule{}, err
+	}
+	loc := time.UTC
+	if f.UseLocal {
+		loc = time.Local
+	}
+	return Schedule{
+		When:             f.When,
+		Every:            time.Duration(f.Every),
+		EveryAnchor:      f.EveryAnchor,
+		AnchorToCreation: f.AnchorToCreation,
+		Location:         loc,
+		WeekdaysOnly:     f.WeekdaysOnly,
+		WeekParity:       f.WeekParity,
+		HasCalendar:      f.IsRotationDay != nil,
+		BlackoutWindows:  f.BlackoutWindows,
+		times:            f.timeRotationSchedule,
+		extra:            f.extraSchedules,
+	}, nil
+}
+
+// DescribeSchedule renders the effective rotation and retention configuration
+// as text, such as "rotates daily at 01:00, 14:00 (UTC); keeps 14 backups",
+// to embed in startup logs and admin pages.
+func (f *File) DescribeSchedule() string {
+	sch, err := f.Schedule()
+	if err != nil {
+		return fmt.Sprintf("invalid schedule: %v", err)
+	}
+	if f.Backups <= 0 {
+		return sch.String() + "; keeps all backups"
+	}
+	return fmt.Sprintf("%s; keeps %d backups", sch, f.Backups)
+}
+
+// String renders the schedule as text, such as
+// "rotates daily at 01:00, 08:30 (Asia/Singapore)".
+func (s Schedule) String() string {
+	var sb strings.Builder
+	switch {
+	case s.AnchorToCreation && s.Every > 0:
+		fmt.Fprintf(&sb, "rotates every %s after the file is created", s.Every)
+	case s.AnchorToCreation:
+		fmt.Fprintf(&sb, "rotates %s after the file is created", s.When.periodName())
+	case s.Every > 0:
+		fmt.Fprintf(&sb, "rotates every %s from %s", s.Every, s.EveryAnchor.Format(time.RFC3339))
+	default:
+		sb.WriteString("rotates ")
+		describeTimes(&sb, s.When, s.times)
+		for _, g := range s.extra {
+			sb.WriteString(", and ")
+			describeTimes(&sb, g.when, g.times)
+		}
+	}
+	switch {
+	case s.WeekdaysOnly && s.HasCalendar:
+		sb.WriteString(" on weekdays allowed by the calendar")
+	case s.WeekdaysOnly:
+		sb.WriteString(" on weekdays")
+	case s.HasCalendar:
+		sb.WriteString(" on days allowed by the calendar")
+	}
+	if s.WeekParity == WeekParityEven || s.WeekParity == WeekParityOdd {
+		fmt.Fprintf(&sb, " in %s ISO weeks", s.WeekParity)
+	}
+	if s.Location != nil {
+		fmt.Fprintf(&sb, " (%s)", s.Location)
+	}
+	if len(s.BlackoutWindows) > 0 {
+		fmt.Fprintf(&sb, ", deferred during %s", strings.Join(s.BlackoutWindows, ", "))
+	}
+	return sb.String()
+}
+
+// describeTimes renders the schedule times of r, such as "daily at 01:00".
+func describeTimes(sb *strings.Builder, r WhenRotate, times []timeSchedule) {
+	entries := make([]string, 0, len(times))
+	for _, t := range times {
+		entries = append(entries, t.describe(r))
+	}
+	switch r {
+	case Hour:
+		fmt.Fprintf(sb, "hourly at %s past the hour", strings.Join(entries, ", "))
+	case Day:
+		fmt.Fprintf(sb, "daily at %s", strings.Join(entries, ", "))
+	default:
+		fmt.Fprintf(sb, "%s %s", r.adverb(), strings.Join(entries, ", "))
+	}
+}
+
+// adverb returns how often rotations happen, such as "daily".
+func (r WhenRotate) adverb() string {
+	switch r {
+	case Hour:
+		return "hourly"
+	case Day:
+		return "daily"
+	case Week:
+		return "weekly"
+	case Month:
+		return "monthly"
+	case Quarter:
+		return "quarterly"
+	case Year:
+		return "yearly"
+	default:
+		return string(r)
+	}
+}
+
+// periodName returns the length of a period, such as "an hour".
+func (r WhenRotate) periodName() string {
+	switch r {
+	case Hour:
+		return "an hour"
+	case Day:
+		return "a day"
+	case Week:
+		return "a week"
+	case Month:
+		return "a month"
+	case Quarter:
+		return "a quarter"
+	case Year:
+		return "a year"
+	default:
+		return string(r)
+	}
+}
+
+// describe renders t for the given When, such as "12:30" for daily
+// rotations or "on day 15 at 12:30" for monthly rotations.
+func (t timeSchedule) describe(r WhenRotate) string {
+	var fraction string
+	if t.nanosecond != 0 {
+		fraction = strings.TrimRight(fmt.Sprintf(".%09d", t.nanosecond), "0")
+	}
+	if r == Hour {
+		return fmt.Sprintf("%02d:%02d%s", t.minute, t.second, fraction)
+	}
+	clock := fmt.Sprintf("%02d:%02d", t.hour, t.minute)
+	if t.second != 0 || t.nanosecond != 0 {
+		clock += fmt.Sprintf(":%02d%s", t.second, fraction)
+	}
+	switch r {
+	case Day:
+		return clock
+	case Week:
+		return fmt.Sprintf("on %s at %s", time.Weekday(t.day % 7).String()[:3], clock)
+	case Month:
+		return fmt.Sprintf("on day %d at %s", t.day, clock)
+	case Quarter:
+		return fmt.Sprintf("on day %d of month %d at %s", t.day, t.month, clock)
+	case Year:
+		return fmt.Sprintf("on %s %d at %s", time.Month(t.month).String()[:3], t.day, clock)
+	default:
+		return clock
+	}
+}
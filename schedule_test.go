@@ -0,0 +1,154 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_DescribeSchedule(t *testing.T) {
+	tests := []struct {
+		name string
+		f    *File
+		want string
+	}{
+		{
+			name: "daily_multiple_schedules",
+			f:    &File{When: "d", RotationSchedule: []string{"1900:00", "0100:00", "0830:00", "1400:00"}, Backups: 14},
+			want: "rotates daily at 01:00, 08:30, 14:00, 19:00 (UTC); keeps 14 backups",
+		},
+		{
+			name: "hourly_sub_second",
+			f:    &File{When: "h", RotationSchedule: []string{"30:00.25"}, BackupTimeFormat: ".2006-01-02T150405.000"},
+			want: "rotates hourly at 30:00.25 past the hour (UTC); keeps all backups",
+		},
+		{
+			name: "monthly_weekdays",
+			f:    &File{When: "m", RotationSchedule: []string{"15 1230:05"}, WeekdaysOnly: true, Backups: 3},
+			want: "rotates monthly on day 15 at 12:30:05 on weekdays (UTC); keeps 3 backups",
+		},
+		{
+			name: "quarterly_default",
+			f:    &File{When: "q"},
+			want: "rotates quarterly on day 1 of month 1 at 00:00 (UTC); keeps all backups",
+		},
+		{
+			name: "yearly_with_blackout",
+			f:    &File{When: "y", RotationSchedule: []string{"0701 0000:00"}, BlackoutWindows: []string{"0000:00-0100:00"}},
+			want: "rotates yearly on Jul 1 at 00:00 (UTC), deferred during 0000:00-0100:00; keeps all backups",
+		},
+		{
+			name: "hourly_and_daily",
+			f: &File{
+				When:             "h",
+				RotationSchedule: []string{"30:00"},
+				ExtraSchedules:   []ScheduleGroup{{When: "d", RotationSchedule: []string{"0000:00"}}},
+			},
+			want: "rotates hourly at 30:00 past the hour, and daily at 00:00 (UTC); keeps all backups",
+		},
+		{
+			name: "biweekly",
+			f:    &File{When: "w", RotationSchedule: []string{"5 1800:00"}, WeekParity: "odd", Backups: 4},
+			want: "rotates weekly on Fri at 18:00 in odd ISO weeks (UTC); keeps 4 backups",
+		},
+		{
+			name: "every",
+			f:    &File{Every: Duration(6 * time.Hour)},
+			want: "rotates every 6h0m0s from 1970-01-01T00:00:00Z (UTC); keeps all backups",
+		},
+		{
+			name: "anchored_to_creation",
+			f:    &File{When: "h", AnchorToCreation: true},
+			want: "rotates an hour after the file is created (UTC); keeps all backups",
+		},
+		{
+			name: "invalid",
+			f:    &File{When: "x"},
+			want: "invalid schedule: logfeller: invalid configuration: when: invalid when rotate value specified: x, accepted values are [h d w m q y]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.f.DescribeSchedule(); got != tt.want {
+				t.Errorf("File.DescribeSchedule() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWhenRotate_String(t *testing.T) {
+	tests := []struct {
+		r            WhenRotate
+		want         string
+		wantGoString string
+	}{
+		{r: Hour, want: "hour", wantGoString: "logfeller.Hour"},
+		{r: "D", want: "day", wantGoString: `logfeller.WhenRotate("D")`},
+		{r: Quarter, want: "quarter", wantGoString: "logfeller.Quarter"},
+		{r: "W", want: "week", wantGoString: `logfeller.WhenRotate("W")`},
+		{r: "x", want: "x", wantGoString: `logfeller.WhenRotate("x")`},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.r), func(t *testing.T) {
+			if got := tt.r.String(); got != tt.want {
+				t.Errorf("WhenRotate.String() = %q, want %q", got, tt.want)
+			}
+			if got := fmt.Sprintf("%#v", tt.r); got != tt.wantGoString {
+				t.Errorf("WhenRotate.GoString() = %q, want %q", got, tt.wantGoString)
+			}
+		})
+	}
+}
+
+// stringArchiver is an Archiver that prints a secret with its String.
+type stringArchiver struct{ memArchiver }
+
+func (*stringArchiver) String() string { return "token=secret" }
+
+func TestFile_String(t *testing.T) {
+	f := &File{
+		Filename:          "/var/log/app name.log",
+		RotationSchedule:  []string{"0100:00"},
+		Backups:           14,
+		Archiver:          &stringArchiver{},
+		BackupNameParsers: []func(name string) (time.Time, bool){func(string) (time.Time, bool) { return time.Time{}, false }},
+		WriteHooks:        []WriteHook{func(_ context.Context, p []byte) ([]byte, error) { return p, nil }},
+		IsRotationDay:     func(time.Time) bool { return true },
+	}
+	got := f.String()
+	testutils.TrueOrError(t, strings.HasPrefix(got, `logfeller.File{filename="/var/log/app name.log" when=day rotation_schedule=[0100:00] backups=14 `),
+		"File.String() = %s, want the leading fields", got)
+	for _, want := range []string{" backup_time_format=.2006-01-02T1504-05 ", " Archiver=<set> ", " BackupNameParsers=<set> ", " WriteHooks=<set> ", " IsRotationDay=<set>}"} {
+		testutils.TrueOrError(t, strings.Contains(got, want), "File.String() = %s, want it to contain %q", got, want)
+	}
+	testutils.TrueOrError(t, !strings.Contains(got, "secret") && !strings.Contains(got, "0x"), "File.String() = %s, want values that may hold secrets redacted", got)
+	testutils.TrueOrError(t, !strings.Contains(got, "every") && !strings.Contains(got, "\n"), "File.String() = %s, want empty fields omitted on one line", got)
+	testutils.TrueOrError(t, f.When == "" && f.initErr == nil && f.timeRotationSchedule == nil, "File.String() should not initialize the File")
+
+	gotGo := fmt.Sprintf("%#v", f)
+	testutils.TrueOrError(t, strings.HasPrefix(gotGo, `&logfeller.File{Filename:"/var/log/app name.log", RotationSchedule:[]string{"0100:00"}, Backups:14, `),
+		"File.GoString() = %s, want the leading fields", gotGo)
+	for _, want := range []string{"Archiver:(logfeller.Archiver)(<set>)", "BackupNameParsers:([]func(string) (time.Time, bool))(<set>)", "WriteHooks:([]logfeller.WriteHook)(<set>)", "IsRotationDay:(func(time.Time) bool)(<set>)"} {
+		testutils.TrueOrError(t, strings.Contains(gotGo, want), "File.GoString() = %s, want it to contain %q", gotGo, want)
+	}
+	testutils.TrueOrError(t, !strings.Contains(gotGo, "secret") && !strings.Contains(gotGo, "0x"), "File.GoString() = %s, want values that may hold secrets redacted", gotGo)
+
+	var events []Event
+	warned := &File{Filename: "app.log", BackupTimeFormat: "Jan _2 15:04:05", OnEvent: func(e Event) { events = append(events, e) }}
+	got = warned.String()
+	testutils.TrueOrError(t, strings.Contains(got, " OnEvent=<set>"), "File.String() = %s, want OnEvent shown as set", got)
+	testutils.TrueOrError(t, len(events) == 0, "File.String() emitted %v, want the configuration warnings left to init", events)
+
+	invalid := &File{Filename: "app.log", When: "x"}
+	got = invalid.String()
+	testutils.TrueOrError(t, strings.Contains(got, "init_error="), "File.String() = %s, want init_error", got)
+	testutils.TrueOrError(t, invalid.initErr == nil, "File.String() should not initialize the File")
+}
@@ -0,0 +1,70 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"time"
+)
+
+// Search returns a reader over the lines that match reports true for, in
+// the backups of f and the active file written from from until to. Either
+// bound may be zero for none. Files are picked by the periods they hold, and
+// their time indexes, if any, narrow down the part of each file searched;
+// timestamps within lines are not parsed. match is given each line without
+// its trailing newline. Reading returns ctx.Err() once ctx is done.
+func (f *File) Search(ctx context.Context, from, to time.Time, match func(line []byte) bool) (io.ReadCloser, error) {
+	segments, err := f.readSegments(from, to)
+	if err != nil {
+		return nil, err
+	}
+	if active := f.readActive(from, to, len(segments) == 0); active != nil {
+		segments = append(segments, active)
+	}
+	cr := newChainReader(segments)
+	return &searchReader{ctx: ctx, r: bufio.NewReader(cr), closer: cr, match: match}, nil
+}
+
+// SearchRegexp is like Search, returning the lines that match re.
+func (f *File) SearchRegexp(ctx context.Context, from, to time.Time, re *regexp.Regexp) (io.ReadCloser, error) {
+	return f.Search(ctx, from, to, re.Match)
+}
+
+// searchReader reads the lines of r that match.
+type searchReader struct {
+	ctx    context.Context
+	r      *bufio.Reader
+	closer io.Closer
+	match  func(line []byte) bool
+	// pending holds the rest of a matched line not read yet.
+	pending []byte
+	err     error
+}
+
+func (sr *searchReader) Read(p []byte) (int, error) {
+	for len(sr.pending) == 0 {
+		if sr.err != nil {
+			return 0, sr.err
+		}
+		if err := sr.ctx.Err(); err != nil {
+			return 0, err
+		}
+		line, err := sr.r.ReadBytes('\n')
+		sr.err = err
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+		if (len(line) > 0 || err == nil) && sr.match(line) {
+			sr.pending = append(line, '\n')
+		}
+	}
+	n := copy(p, sr.pending)
+	sr.pending = sr.pending[n:]
+	return n, nil
+}
+
+func (sr *searchReader) Close() error { return sr.closer.Close() }
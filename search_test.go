@@ -0,0 +1,60 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_Search(t *testing.T) {
+	dirname, err := testutils.MkTestDir("Search")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), IndexInterval: Duration(time.Minute)}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+	for _, line := range []string{"ERROR one", "INFO two", "ERROR three", "ERROR four", "INFO five", "ERROR six"} {
+		_, err := f.Write([]byte(line + "\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		now = now.Add(12 * time.Hour)
+	}
+	errorsOnly := regexp.MustCompile(`^ERROR`)
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     string
+	}{
+		{name: "all", want: "ERROR one\nERROR three\nERROR four\nERROR six\n"},
+		{name: "from", from: time.Date(2021, time.March, 5, 23, 0, 0, 0, time.UTC), want: "ERROR four\nERROR six\n"},
+		{name: "to", to: time.Date(2021, time.March, 5, 11, 0, 0, 0, time.UTC), want: "ERROR one\nERROR three\n"},
+		{name: "from_to", from: time.Date(2021, time.March, 5, 9, 0, 0, 0, time.UTC), to: time.Date(2021, time.March, 5, 23, 0, 0, 0, time.UTC), want: "ERROR three\nERROR four\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := f.SearchRegexp(context.Background(), tt.from, tt.to, errorsOnly)
+			testutils.TrueOrFatal(t, err == nil, "File.SearchRegexp() error = %v", err)
+			defer rc.Close()
+			got, err := ioutil.ReadAll(rc)
+			testutils.TrueOrError(t, err == nil && string(got) == tt.want, "File.SearchRegexp() read = %q, %v, want %q", got, err, tt.want)
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rc, err := f.Search(ctx, time.Time{}, time.Time{}, func([]byte) bool { return true })
+	testutils.TrueOrFatal(t, err == nil, "File.Search() error = %v", err)
+	defer rc.Close()
+	_, err = ioutil.ReadAll(rc)
+	testutils.TrueOrError(t, err == context.Canceled, "File.Search() with cancelled context error = %v, want %v", err, context.Canceled)
+}
@@ -0,0 +1,272 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultShardFlushInterval is used when ShardFlushInterval is not set.
+	defaultShardFlushInterval = 100 * time.Millisecond
+	// shardFlushSize is the size of a shard that wakes the flusher early.
+	shardFlushSize = 256 * 1024
+)
+
+// shardRecord marks the end of a single write in a shard's buffer.
+type shardRecord struct {
+	seq uint64
+	end int
+}
+
+type shard struct {
+	mu   sync.Mutex
+	buf  []byte
+	recs []shardRecord
+	// spare holds the buffers of the last take, to be reused.
+	spare    []byte
+	spareRec []shardRecord
+	// pad keeps shards on separate cache lines.
+	_ [64]byte
+}
+
+// shardedWriter spreads writes over shards with their own locks, so that
+// concurrent writers do not contend on File.mu. Every write is given a
+// sequence number, and a single flusher writes them out in that order.
+type shardedWriter struct {
+	// seq is the sequence number of the last write, heldWrites and
+	// heldBytes count the writes held that are not written out yet. They
+	// are accessed atomically and kept first for 64-bit alignment.
+	seq        uint64
+	heldWrites int64
+	heldBytes  int64
+	shards     []shard
+	kick       chan struct{}
+	// running is 1 while the flusher runs, it is accessed atomically.
+	running int32
+
+	// flusherMu protects stop and done, which stop the flusher and are
+	// closed once it stopped, nil while it is not running.
+	flusherMu sync.Mutex
+	stop      chan struct{}
+	done      chan struct{}
+
+	// drainMu protects the fields below.
+	drainMu sync.Mutex
+	// next is the sequence number of the next write to write out.
+	next uint64
+	// pending holds, per shard, the writes taken from it that have not been
+	// written out yet, as an earlier write had not reached its shard.
+	pending [][]pendingWrite
+	batch   []byte
+}
+
+// pendingWrite is a write taken from a shard.
+type pendingWrite struct {
+	seq uint64
+	p   []byte
+}
+
+func newShardedWriter(n int) *shardedWriter {
+	return &shardedWriter{
+		shards:  make([]shard, n),
+		kick:    make(chan struct{}, 1),
+		next:    1,
+		pending: make([][]pendingWrite, n),
+	}
+}
+
+// write adds a copy of p to a shard.
+func (sw *shardedWriter) write(p []byte) {
+	atomic.AddInt64(&sw.heldWrites, 1)
+	atomic.AddInt64(&sw.heldBytes, int64(len(p)))
+	seq := atomic.AddUint64(&sw.seq, 1)
+	s := &sw.shards[seq%uint64(len(sw.shards))]
+	s.mu.Lock()
+	s.buf = append(s.buf, p...)
+	s.recs = append(s.recs, shardRecord{seq: seq, end: len(s.buf)})
+	full := len(s.buf) >= shardFlushSize
+	s.mu.Unlock()
+	if full {
+		select {
+		case sw.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// take returns the writes that can be written out in order, emptying the
+// shards, and how many writes the batch holds. The returned batch is only
+// valid until the next take.
+func (sw *shardedWriter) take() (batch []byte, writes int64) {
+	n := uint64(len(sw.shards))
+	for i := range sw.shards {
+		s := &sw.shards[i]
+		s.mu.Lock()
+		buf, recs := s.buf, s.recs
+		s.buf, s.recs = s.spare[:0], s.spareRec[:0]
+		s.mu.Unlock()
+		pending := sw.pending[i]
+		start := 0
+		for _, r := range recs {
+			pending = append(pending, pendingWrite{seq: r.seq, p: buf[start:r.end]})
+			start = r.end
+		}
+		// writers may reach a shard out of order, but rarely by much, so an
+		// insertion sort is cheap here
+		for j := 1; j < len(pending); j++ {
+			for k := j; k > 0 && pending[k].seq < pending[k-1].seq; k-- {
+				pending[k], pending[k-1] = pending[k-1], pending[k]
+			}
+		}
+		sw.pending[i] = pending
+		s.spare, s.spareRec = buf, recs
+	}
+	// every sequence number belongs to a single shard, so the writes are
+	// merged by walking the shards round robin
+	sw.batch = sw.batch[:0]
+	heads := make([]int, n)
+	for {
+		i := sw.next % n
+		h := heads[i]
+		if h == len(sw.pending[i]) || sw.pending[i][h].seq != sw.next {
+			break
+		}
+		sw.batch = append(sw.batch, sw.pending[i][h].p...)
+		heads[i]++
+		sw.next++
+		writes++
+	}
+	// writes left pending still point into the spare buffers, copy them
+	// before those are reused
+	for i, h := range heads {
+		rest := sw.pending[i][h:]
+		for j := range rest {
+			rest[j].p = append([]byte(nil), rest[j].p...)
+		}
+		sw.pending[i] = append(sw.pending[i][:0], rest...)
+	}
+	return sw.batch, writes
+}
+
+// held returns the number of writes held and their size.
+func (sw *shardedWriter) held() (writes, bytes int64) {
+	if sw == nil {
+		return 0, 0
+	}
+	return atomic.LoadInt64(&sw.heldWrites), atomic.LoadInt64(&sw.heldBytes)
+}
+
+// writeShards adds p to the sharded writer, after writing out the writes
+// held if p would take them over ShardMaxBytes.
+func (f *File) writeShards(p []byte) {
+	if f.ShardMaxBytes > 0 {
+		if _, held := f.shards.held(); held+int64(len(p)) > int64(f.ShardMaxBytes) {
+			if err := f.drainShards(); err != nil {
+				f.emit(Event{Type: EventWriteError, Filename: f.Filename, Message: "unable to write sharded writes", Err: err})
+			}
+		}
+	}
+	f.shards.write(p)
+	if atomic.LoadInt32(&f.shards.running) == 0 {
+		// written after Close, which stopped the flusher
+		f.startShardFlusher()
+	}
+}
+
+// startShards starts the flusher of the sharded writer if Shards is set.
+func (f *File) startShards() {
+	if f.Shards <= 0 {
+		return
+	}
+	f.shards = newShardedWriter(f.Shards)
+	f.startShardFlusher()
+}
+
+// startShardFlusher starts the goroutine writing out the writes held by the
+// sharded writer every ShardFlushInterval, unless it is running already.
+func (f *File) startShardFlusher() {
+	sw := f.shards
+	sw.flusherMu.Lock()
+	defer sw.flusherMu.Unlock()
+	if sw.stop != nil {
+		return
+	}
+	interval := time.Duration(f.ShardFlushInterval)
+	if interval <= 0 {
+		interval = defaultShardFlushInterval
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	sw.stop, sw.done = stop, done
+	atomic.StoreInt32(&sw.running, 1)
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			case <-sw.kick:
+			}
+			if err := f.drainShards(); err != nil {
+				f.emit(Event{Type: EventWriteError, Filename: f.Filename, Message: "unable to write sharded writes", Err: err})
+			}
+		}
+	}()
+}
+
+// stopShards stops the flusher of the sharded writer and waits for it to
+// return, the writes it held are left for drainShards.
+func (f *File) stopShards() {
+	if f.shards == nil {
+		return
+	}
+	sw := f.shards
+	sw.flusherMu.Lock()
+	stop, done := sw.stop, sw.done
+	sw.stop, sw.done = nil, nil
+	atomic.StoreInt32(&sw.running, 0)
+	sw.flusherMu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+// drainShards writes out the writes held by the sharded writer, if any.
+func (f *File) drainShards() error {
+	if f.shards == nil {
+		return nil
+	}
+	f.shards.drainMu.Lock()
+	defer f.shards.drainMu.Unlock()
+	batch, writes := f.shards.take()
+	if len(batch) == 0 {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err := f.writeLocked(batch)
+	// the writes are no longer held whether they were written or not
+	atomic.AddInt64(&f.shards.heldWrites, -writes)
+	atomic.AddInt64(&f.shards.heldBytes, -int64(len(batch)))
+	return err
+}
+
+// discardShards drops the writes held by the sharded writer, if any. It must
+// be called with the drainMu of the sharded writer held.
+func (f *File) discardShards() {
+	if f.shards == nil {
+		return
+	}
+	batch, writes := f.shards.take()
+	atomic.AddInt64(&f.shards.heldWrites, -writes)
+	atomic.AddInt64(&f.shards.heldBytes, -int64(len(batch)))
+}
@@ -0,0 +1,139 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_Shards(t *testing.T) {
+	dirname, err := testutils.MkTestDir("Shards")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), Shards: 4}
+
+	const writers, perWriter = 8, 500
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				_, _ = fmt.Fprintf(f, "%d %d\n", w, i)
+			}
+		}(w)
+	}
+	wg.Wait()
+	testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+
+	fh, err := os.Open(f.Filename)
+	testutils.TrueOrFatal(t, err == nil, "failed to open file: %v", err)
+	defer fh.Close()
+	// every write is there, and each writer's writes are in order
+	last := make([]int, writers)
+	for i := range last {
+		last[i] = -1
+	}
+	var lines int
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		w, _ := strconv.Atoi(fields[0])
+		i, _ := strconv.Atoi(fields[1])
+		testutils.TrueOrFatal(t, i == last[w]+1, "writer %d wrote %d after %d", w, i, last[w])
+		last[w] = i
+		lines++
+	}
+	testutils.TrueOrError(t, lines == writers*perWriter, "lines = %d, want %d", lines, writers*perWriter)
+}
+
+func TestFile_ShardMaxBytes(t *testing.T) {
+	dirname, err := testutils.MkTestDir("ShardMaxBytes")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	// a long interval so that only ShardMaxBytes writes them out
+	f := &File{Filename: filepath.Join(dirname, "app.log"), Shards: 2, ShardFlushInterval: Duration(time.Hour), ShardMaxBytes: 16}
+	defer f.Close()
+
+	for i := 0; i < 3; i++ {
+		_, err := f.Write([]byte("line\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	}
+	s := f.Stats()
+	testutils.TrueOrError(t, s.QueuedWrites == 3 && s.QueuedBytes == 15, "want 3 writes of 15 bytes queued, got %d writes of %d bytes", s.QueuedWrites, s.QueuedBytes)
+	_, err = f.Write([]byte("line\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	s = f.Stats()
+	testutils.TrueOrError(t, s.QueuedWrites == 1 && s.QueuedBytes == 5, "want the writes over ShardMaxBytes written out, got %d writes of %d bytes queued", s.QueuedWrites, s.QueuedBytes)
+	b, err := ioutil.ReadFile(f.Filename)
+	testutils.TrueOrError(t, err == nil && string(b) == "line\nline\nline\n", "file = %q, err = %v", b, err)
+
+	testutils.TrueOrFatal(t, f.Flush() == nil, "File.Flush() should not fail")
+	s = f.Stats()
+	testutils.TrueOrError(t, s.QueuedWrites == 0 && s.QueuedBytes == 0, "want nothing queued after Flush, got %d writes of %d bytes", s.QueuedWrites, s.QueuedBytes)
+}
+
+func TestFile_Shards_Close(t *testing.T) {
+	dirname, err := testutils.MkTestDir("Shards_Close")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), Shards: 2, ShardFlushInterval: Duration(time.Hour)}
+
+	_, err = f.Write([]byte("one\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	done := f.shards.done
+	testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+	select {
+	case <-done:
+	default:
+		t.Fatal("want the shard flusher stopped by Close")
+	}
+
+	// writes after Close start it again
+	_, err = f.Write([]byte("two\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrError(t, atomic.LoadInt32(&f.shards.running) == 1, "want the shard flusher started again")
+	testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+	b, err := ioutil.ReadFile(f.Filename)
+	testutils.TrueOrError(t, err == nil && string(b) == "one\ntwo\n", "file = %q, err = %v", b, err)
+}
+
+func benchmarkFileWrite(b *testing.B, shards int, singleWriter bool) {
+	dirname, err := testutils.MkTestDir(fmt.Sprintf("BenchmarkWrite%d", shards))
+	testutils.TrueOrFatal(b, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), Shards: shards, BufferSize: 64 * 1024, SingleWriter: singleWriter}
+	defer f.Close()
+	line := []byte("2021-03-04T10:00:00Z INFO a typical log line of moderate length\n")
+	b.SetBytes(int64(len(line)))
+	b.ReportAllocs()
+	if singleWriter {
+		for i := 0; i < b.N; i++ {
+			_, _ = f.Write(line)
+		}
+		return
+	}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = f.Write(line)
+		}
+	})
+}
+
+func BenchmarkFile_Write(b *testing.B)              { benchmarkFileWrite(b, 0, false) }
+func BenchmarkFile_Write_Shards8(b *testing.B)      { benchmarkFileWrite(b, 8, false) }
+func BenchmarkFile_Write_SingleWriter(b *testing.B) { benchmarkFileWrite(b, 0, true) }
@@ -0,0 +1,158 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultShutdownTimeout is the time given to Shutdown by
+// ShutdownOnTermination if TerminationOptions.Timeout is not set, well within
+// the default grace period of 30s given to terminating Kubernetes pods.
+const defaultShutdownTimeout = 10 * time.Second
+
+// Shutdowner is shut down by ShutdownOnTermination, it is implemented by
+// File and Manager.
+type Shutdowner interface {
+	Shutdown(ctx context.Context, rotate bool) error
+}
+
+// TerminationOptions configures ShutdownOnTermination.
+type TerminationOptions struct {
+	// Signals that start the shutdown, SIGTERM and SIGINT if empty.
+	Signals []os.Signal
+	// Timeout is the deadline of the shutdown once started, 10s if not set.
+	Timeout time.Duration
+	// Rotate, if true, rotates the files into their backups on shutdown, so
+	// the last of their output is in a backup for whatever picks them up.
+	Rotate bool
+}
+
+// ShutdownOnTermination shuts s down the first time one of opts.Signals is
+// received or ctx is done, within opts.Timeout. The returned channel receives
+// the result of the shutdown and is closed after, so a program can wait for
+// it before exiting:
+//
+//	done := logfeller.ShutdownOnTermination(ctx, f, logfeller.TerminationOptions{Rotate: true})
+//	// ...
+//	if err := <-done; err != nil {
+//		fmt.Fprintln(os.Stderr, err)
+//	}
+//
+// The signals are no longer handled by logfeller once the shutdown starts.
+// A File with SingleWriter set cannot be shut down from another goroutine
+// than its writer, the channel receives an error for it instead, and its
+// writer is to call Shutdown itself.
+func ShutdownOnTermination(ctx context.Context, s Shutdowner, opts TerminationOptions) <-chan error {
+	done := make(chan error, 1)
+	if f, ok := s.(*File); ok && f.SingleWriter {
+		done <- fmt.Errorf("shutdown of %s on termination: single_writer files are shut down by their writer", f.Filename)
+		close(done)
+		return done
+	}
+	signals := opts.Signals
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, signals...)
+	go func() {
+		defer close(done)
+		select {
+		case <-sig:
+		case <-ctx.Done():
+		}
+		signal.Stop(sig)
+		// ctx may be done already, the deadline is counted from now
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		done <- s.Shutdown(shutdownCtx, opts.Rotate)
+	}()
+	return done
+}
+
+// Shutdown flushes any buffered data and commits it to stable storage,
+// rotates the file into its backup if rotate is true, waits for any
+// BackgroundBackup and trims, see WaitForMaintenance, and closes the file,
+// in that order. It gives up waiting
+// once ctx is done, returning an error, while the shutdown goes on in the
+// background. With SingleWriter the shutdown runs on the calling goroutine,
+// which must be the writer, and ctx is only checked before it starts.
+func (f *File) Shutdown(ctx context.Context, rotate bool) error {
+	if f.SingleWriter {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("shutdown of %s not done: %v", f.Filename, err)
+		}
+		return f.shutdown(rotate)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- f.shutdown(rotate)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("shutdown of %s not done: %v", f.Filename, ctx.Err())
+	}
+}
+
+func (f *File) shutdown(rotate bool) error {
+	if err := f.init(); err != nil {
+		return err
+	}
+	var errs multipleErrors
+	if err := f.Sync(); err != nil {
+		errs = append(errs, fmt.Errorf("sync error: %v", err))
+	}
+	if rotate {
+		if err := f.rotateNow(false, TriggerShutdown); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	// Shutdown gives up on this once its ctx is done
+	if err := f.WaitForMaintenance(context.Background()); err != nil {
+		errs = append(errs, err)
+	}
+	if err := f.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs.err()
+}
+
+// Shutdown shuts down every managed file at once as with File.Shutdown.
+func (m *Manager) Shutdown(ctx context.Context, rotate bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var (
+		wg     sync.WaitGroup
+		errsMu sync.Mutex
+		errs   multipleErrors
+	)
+	for name, f := range m.Files {
+		wg.Add(1)
+		go func(name string, f *File) {
+			defer wg.Done()
+			if err := f.Shutdown(ctx, rotate); err != nil {
+				errsMu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %v", name, err))
+				errsMu.Unlock()
+			}
+		}(name, f)
+	}
+	wg.Wait()
+	m.recent, m.open = nil, nil
+	return errs.err()
+}
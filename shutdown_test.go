@@ -0,0 +1,91 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestShutdownOnTermination(t *testing.T) {
+	dirname, err := testutils.MkTestDir("ShutdownOnTermination")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+
+	m := &Manager{New: func(name string) (*File, error) {
+		return &File{Filename: filepath.Join(dirname, name+".log"), When: "h", BufferSize: 4096, BackgroundBackup: true}, nil
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := ShutdownOnTermination(ctx, m, TerminationOptions{Rotate: true, Timeout: time.Minute})
+	for _, name := range []string{"a", "b"} {
+		_, err := m.Write(name, []byte(name+"\n"))
+		testutils.TrueOrFatal(t, err == nil, "Manager.Write(%s) error = %v", name, err)
+	}
+	cancel()
+	err = <-done
+	testutils.TrueOrFatal(t, err == nil, "shutdown error = %v", err)
+	_, ok := <-done
+	testutils.TrueOrError(t, !ok, "channel should be closed after the shutdown")
+	for _, name := range []string{"a", "b"} {
+		backups, err := m.Files[name].ListBackups()
+		testutils.TrueOrFatal(t, err == nil && len(backups) == 1, "%s: want the buffered output rotated into a backup, got %v, err = %v", name, backups, err)
+		b, err := ioutil.ReadFile(backups[0].Name)
+		testutils.TrueOrError(t, err == nil && string(b) == name+"\n", "%s: backup = %q, err = %v", name, b, err)
+	}
+}
+
+func TestFile_ShutdownDeadline(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_ShutdownDeadline")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+
+	f := &File{Filename: filepath.Join(dirname, "app.log")}
+	_, err = f.Write([]byte("line\n"))
+	testutils.TrueOrFatal(t, err == nil, "Write() error = %v", err)
+	// hold the lock so the shutdown cannot finish
+	f.mu.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = f.Shutdown(ctx, false)
+	testutils.TrueOrError(t, err != nil, "Shutdown() should fail once its deadline passes")
+	f.mu.Unlock()
+	f.WaitBackups()
+}
+
+func TestFile_Shutdown_SingleWriter(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_Shutdown_SingleWriter")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+
+	f := &File{Filename: filepath.Join(dirname, "app.log"), SingleWriter: true, OnEvent: func(e Event) {
+		if e.Type == EventRotation {
+			// outlast the deadline of the shutdown
+			time.Sleep(50 * time.Millisecond)
+		}
+	}}
+	defer f.Close()
+	_, err = f.Write([]byte("line\n"))
+	testutils.TrueOrFatal(t, err == nil, "Write() error = %v", err)
+
+	done := ShutdownOnTermination(context.Background(), f, TerminationOptions{})
+	testutils.TrueOrError(t, <-done != nil, "ShutdownOnTermination() should refuse a SingleWriter file")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	// the shutdown is done by the time it returns, so writing right after
+	// does not race with it
+	err = f.Shutdown(ctx, true)
+	testutils.TrueOrError(t, err == nil, "Shutdown() error = %v", err)
+	_, err = f.Write([]byte("after\n"))
+	testutils.TrueOrError(t, err == nil, "Write() after Shutdown() error = %v", err)
+	backups, err := f.ListBackups()
+	testutils.TrueOrError(t, err == nil && len(backups) == 1, "want the file rotated on shutdown, got %v, err = %v", backups, err)
+}
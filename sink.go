@@ -0,0 +1,121 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// SinkFactory opens the writer of a Sink for the rotation period starting at
+// period.
+type SinkFactory func(period time.Time) (io.WriteCloser, error)
+
+// Sink is an io.WriteCloser that rotates the writers opened by Open on the
+// rotation schedule of a File. It lets destinations that are not plain files,
+// such as gzip streams, network connections or object store uploads, be
+// rotated with the same schedules as a File.
+type Sink struct {
+	// Rotation configures when the sink rotates. Only the fields that
+	// schedule rotations are used: When, RotationSchedule, Every,
+	// EveryAnchor, AnchorToCreation, UseLocal, WeekdaysOnly, IsRotationDay,
+	// DayOverflow, BlackoutWindows and OnClockRegression, along with
+	// OnEvent. Filename and the fields about backups are ignored.
+	Rotation File
+	// Open opens the writer for a rotation period. It is called on the first
+	// write of each period, and the writer of the previous period is closed
+	// before that.
+	Open SinkFactory
+
+	mu     sync.Mutex
+	w      io.WriteCloser
+	period time.Time
+}
+
+func (s *Sink) init() error {
+	if s.Open == nil {
+		errs := ConfigError{}
+		errs.add("open", "", fmt.Errorf("sink factory must be set"))
+		return errs.err()
+	}
+	// the schedule is only used to calculate rotation times
+	s.Rotation.NoGoroutines = true
+	return s.Rotation.init()
+}
+
+// Write implements io.Writer, Write rotates the writer first if its period
+// has ended.
+func (s *Sink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.init(); err != nil {
+		return 0, err
+	}
+	now := s.Rotation.now()
+	if s.w != nil && s.Rotation.shouldRotate(now) {
+		s.Rotation.regressionRotate = false
+		if err := s.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	if s.w == nil {
+		if err := s.open(now); err != nil {
+			return 0, err
+		}
+	}
+	return s.w.Write(p)
+}
+
+// Rotate closes the current writer, the next write opens a writer for the
+// current period.
+func (s *Sink) Rotate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.init(); err != nil {
+		return err
+	}
+	return s.rotate()
+}
+
+// Close closes the current writer.
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.w == nil {
+		return nil
+	}
+	err := s.w.Close()
+	s.w = nil
+	return err
+}
+
+// open opens the writer for the period now falls in.
+func (s *Sink) open(now time.Time) error {
+	s.Rotation.updateRotateAt(s.Rotation.calcRotationTimes(now))
+	w, err := s.Open(s.Rotation.prevRotateAt)
+	if err != nil {
+		return fmt.Errorf("unable to open sink for period %s: %v", s.Rotation.prevRotateAt.Format(time.RFC3339), err)
+	}
+	s.w, s.period = w, s.Rotation.prevRotateAt
+	return nil
+}
+
+// rotate closes the current writer, if any.
+func (s *Sink) rotate() error {
+	if s.w == nil {
+		return nil
+	}
+	err := s.w.Close()
+	s.w = nil
+	e := Event{Type: EventRotation, Message: fmt.Sprintf("rotated sink for period %s", s.period.Format(time.RFC3339))}
+	if err != nil {
+		e.Err = err
+		err = fmt.Errorf("rotate close error: %v", err)
+	}
+	s.Rotation.emit(e)
+	return err
+}
@@ -0,0 +1,69 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+type testSinkWriter struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (w *testSinkWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestSink(t *testing.T) {
+	now := time.Date(2021, 3, 4, 10, 10, 0, 0, time.UTC)
+	periods := map[time.Time]*testSinkWriter{}
+	var events []Event
+	s := &Sink{
+		Rotation: File{When: Hour, OnEvent: func(e Event) { events = append(events, e) }},
+		Open: func(period time.Time) (io.WriteCloser, error) {
+			w := &testSinkWriter{}
+			periods[period] = w
+			return w, nil
+		},
+	}
+	s.Rotation.setNowFunc(func() time.Time { return now })
+	for _, step := range []struct {
+		after time.Duration
+		line  string
+	}{{0, "one\n"}, {10 * time.Minute, "two\n"}, {45 * time.Minute, "three\n"}} {
+		now = now.Add(step.after)
+		_, err := s.Write([]byte(step.line))
+		testutils.TrueOrFatal(t, err == nil, "Sink.Write() error = %v", err)
+	}
+	first, second := periods[time.Date(2021, 3, 4, 10, 0, 0, 0, time.UTC)], periods[time.Date(2021, 3, 4, 11, 0, 0, 0, time.UTC)]
+	testutils.TrueOrFatal(t, len(periods) == 2 && first != nil && second != nil, "sink should be opened for 2 periods, got %v", periods)
+	testutils.TrueOrError(t, first.String() == "one\ntwo\n" && first.closed, "first period = %q, closed = %v", first.String(), first.closed)
+	testutils.TrueOrError(t, second.String() == "three\n" && !second.closed, "second period = %q, closed = %v", second.String(), second.closed)
+	testutils.TrueOrError(t, len(events) == 1 && events[0].Type == EventRotation, "want 1 rotation event, got %v", events)
+
+	testutils.TrueOrError(t, s.Rotate() == nil && second.closed, "Sink.Rotate() should close the writer")
+	_, err := s.Write([]byte("four\n"))
+	testutils.TrueOrError(t, err == nil && periods[time.Date(2021, 3, 4, 11, 0, 0, 0, time.UTC)].String() == "four\n",
+		"Sink.Write() after Rotate() should reopen the period, err = %v", err)
+	testutils.TrueOrError(t, s.Close() == nil, "Sink.Close() should not fail")
+}
+
+func TestSink_errors(t *testing.T) {
+	_, err := (&Sink{}).Write([]byte("line\n"))
+	var cerr *ConfigError
+	testutils.TrueOrError(t, errors.As(err, &cerr), "Sink.Write() without Open should give a *ConfigError, got %v", err)
+
+	s := &Sink{Open: func(time.Time) (io.WriteCloser, error) { return nil, errors.New("unreachable") }}
+	_, err = s.Write([]byte("line\n"))
+	testutils.TrueOrError(t, err != nil, "Sink.Write() should fail when the sink cannot be opened")
+}
@@ -0,0 +1,187 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// metadataSuffix is appended to a backup filename to get the filename of its
+// metadata sidecar.
+const metadataSuffix = ".meta.json"
+
+// Stats is a snapshot of the activity of File in the current rotation period.
+type Stats struct {
+	// Filename is the file being written to.
+	Filename string `json:"filename"`
+	// PeriodStart and PeriodEnd are the bounds of the current rotation
+	// period, they are zero until the file is first opened.
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	// Bytes and Lines are the number of bytes and lines written since the
+	// last rotation, or since the file was opened.
+	Bytes int64 `json:"bytes"`
+	Lines int64 `json:"lines"`
+	// ContentHash is the SHA-256 of the bytes counted in Bytes in hex, if
+	// File.ContentHash is set. It is empty for a backup appended to, see
+	// BackupMetadata.ChainedContentHash.
+	ContentHash string `json:"content_hash,omitempty"`
+	// LastWrite is when File was last written to successfully, zero if it
+	// was not written to.
+	LastWrite time.Time `json:"last_write"`
+	// QueuedWrites and QueuedBytes are the writes held by Shards that are
+	// not written out yet, and their size, see ShardMaxBytes.
+	QueuedWrites int64 `json:"queued_writes,omitempty"`
+	QueuedBytes  int64 `json:"queued_bytes,omitempty"`
+	// QuotaUsed and QuotaDropped are the bytes written and dropped today,
+	// see DailyQuotaBytes.
+	QuotaUsed    int64 `json:"quota_used,omitempty"`
+	QuotaDropped int64 `json:"quota_dropped,omitempty"`
+	// Rotations is the number of rotations so far, see RotationCounter.
+	Rotations uint64 `json:"rotations,omitempty"`
+	// MissedRotations and ExtraRotations are the scheduled rotations missed
+	// and the rotations made off the schedule so far, see
+	// RotationAnomalies.
+	MissedRotations uint64 `json:"missed_rotations,omitempty"`
+	ExtraRotations  uint64 `json:"extra_rotations,omitempty"`
+}
+
+// BackupMetadata is the content of the metadata sidecar written next to each
+// backup when File.BackupMetadata is set.
+type BackupMetadata struct {
+	Stats
+	// Backup is the filename of the backup.
+	Backup string `json:"backup"`
+	// RotatedAt is when the backup was rotated out.
+	RotatedAt time.Time `json:"rotated_at"`
+	// Rotation is the number of the rotation, see RotationCounter. It is
+	// the latest if the backup was appended to.
+	Rotation uint64 `json:"rotation,omitempty"`
+	// ChainedContentHash replaces ContentHash once the backup is appended
+	// to. It is a chained digest rather than the hash of the content: the
+	// SHA-256 in hex of the ContentHash, or ChainedContentHash, the backup
+	// had before followed by the ContentHash of the part appended.
+	ChainedContentHash string `json:"chained_content_hash,omitempty"`
+}
+
+// Stats returns the activity of f in the current rotation period.
+func (f *File) Stats() Stats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.stats()
+	s.QueuedWrites, s.QueuedBytes = f.shards.held()
+	s.QuotaUsed, s.QuotaDropped = f.quotaStats()
+	s.Rotations = f.rotations
+	s.MissedRotations, s.ExtraRotations = f.missedRotations, f.extraRotations
+	return s
+}
+
+func (f *File) stats() Stats {
+	return Stats{
+		Filename:    f.Filename,
+		PeriodStart: f.prevRotateAt,
+		PeriodEnd:   f.rotateAt,
+		Bytes:       f.fileBytes,
+		Lines:       f.fileLines,
+		ContentHash: f.contentHashString(),
+		LastWrite:   f.liveness.last(),
+	}
+}
+
+// ActiveFileInfo describes the active file of File.
+type ActiveFileInfo struct {
+	// Path is the path of the active file.
+	Path string
+	// Open is true if File has the active file open.
+	Open bool
+	// OpenedAt is when the active file was opened, zero if it is not open.
+	OpenedAt time.Time
+	// Size is the size of the active file on disk, and Buffered the number
+	// of bytes written to File that are not on disk yet.
+	Size     int64
+	Buffered int
+	// Valid is true if the open file descriptor still refers to the file at
+	// Path, it is false if the file was deleted or moved by another process.
+	Valid bool
+}
+
+// CurrentFileInfo returns information on the active file, taken while no
+// writes or rotations are in progress.
+func (f *File) CurrentFileInfo() ActiveFileInfo {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	info := ActiveFileInfo{Path: f.Filename, Open: f.file != nil}
+	if f.buf != nil {
+		info.Buffered = f.buf.Buffered()
+	}
+	if f.file == nil {
+		if fi, err := os.Stat(f.Filename); err == nil {
+			info.Size = fi.Size()
+		}
+		return info
+	}
+	info.OpenedAt = f.openedAt
+	fdInfo, err := f.file.Stat()
+	if err != nil {
+		return info
+	}
+	info.Size = fdInfo.Size()
+	pathInfo, err := os.Stat(f.Filename)
+	info.Valid = err == nil && os.SameFile(fdInfo, pathInfo)
+	return info
+}
+
+// MetadataFilename returns the filename of the metadata sidecar of backup.
+func MetadataFilename(backup string) string { return backup + metadataSuffix }
+
+// ReadBackupMetadata reads the metadata sidecar of backup.
+func ReadBackupMetadata(backup string) (BackupMetadata, error) {
+	var md BackupMetadata
+	b, err := ioutil.ReadFile(MetadataFilename(backup))
+	if err != nil {
+		return md, err
+	}
+	if err := json.Unmarshal(b, &md); err != nil {
+		return md, fmt.Errorf("invalid backup metadata %s: %v", MetadataFilename(backup), err)
+	}
+	return md, nil
+}
+
+// writeMetadata writes the metadata sidecar for backup. If backup was
+// appended to, the counts are added to those of the existing sidecar.
+func (f *File) writeMetadata(backup string, s Stats, rotatedAt time.Time, appended bool, rotation uint64) error {
+	md := BackupMetadata{Stats: s, Backup: backup, RotatedAt: rotatedAt, Rotation: rotation}
+	if prev, err := ReadBackupMetadata(backup); err == nil && appended {
+		md.Bytes += prev.Bytes
+		md.Lines += prev.Lines
+		prevHash := prev.ChainedContentHash
+		if prevHash == "" {
+			prevHash = prev.ContentHash
+		}
+		md.ChainedContentHash = chainContentHash(prevHash, md.ContentHash)
+		md.ContentHash = ""
+		if !prev.PeriodStart.IsZero() && prev.PeriodStart.Before(md.PeriodStart) {
+			md.PeriodStart = prev.PeriodStart
+		}
+	}
+	b, err := json.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(MetadataFilename(backup), append(b, '\n'), fileOpenMode)
+}
+
+// removeMetadata removes the metadata sidecar of backup if there is one.
+func removeMetadata(backup string) error {
+	err := os.Remove(MetadataFilename(backup))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
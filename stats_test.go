@@ -0,0 +1,171 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_Stats(t *testing.T) {
+	dirname, err := testutils.MkTestDir("Stats")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	var rotations []Event
+	f := &File{
+		Filename:       filepath.Join(dirname, "app.log"),
+		BackupMetadata: true,
+		OnEvent: func(e Event) {
+			if e.Type == EventRotation {
+				rotations = append(rotations, e)
+			}
+		},
+	}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+
+	_, err = f.Write([]byte("one\ntwo\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	got := f.Stats()
+	want := Stats{
+		Filename:    f.Filename,
+		PeriodStart: time.Date(2021, time.March, 4, 0, 0, 0, 0, time.UTC),
+		PeriodEnd:   time.Date(2021, time.March, 5, 0, 0, 0, 0, time.UTC),
+		Bytes:       8,
+		Lines:       2,
+		LastWrite:   now,
+	}
+	testutils.TrueOrError(t, got == want, "File.Stats() = %+v, want %+v", got, want)
+
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	backup := filepath.Join(dirname, "app.2021-03-04T0000-00.log")
+	testutils.TrueOrFatal(t, len(rotations) == 1, "rotation events = %v, want 1", rotations)
+	e := rotations[0]
+	testutils.TrueOrError(t, e.Filename == backup && e.Bytes == 8 && e.Lines == 2 && e.Err == nil,
+		"rotation event = %+v, want backup %s with 8 bytes and 2 lines", e, backup)
+	got = f.Stats()
+	testutils.TrueOrError(t, got.Bytes == 0 && got.Lines == 0, "File.Stats() after rotation = %+v, want zero counts", got)
+
+	md, err := ReadBackupMetadata(backup)
+	testutils.TrueOrFatal(t, err == nil, "ReadBackupMetadata() error = %v", err)
+	wantMD := BackupMetadata{Stats: want, Backup: backup, RotatedAt: now}
+	testutils.TrueOrError(t, md.Stats == wantMD.Stats && md.Backup == wantMD.Backup && md.RotatedAt.Equal(now),
+		"ReadBackupMetadata() = %+v, want %+v", md, wantMD)
+}
+
+func TestFile_CurrentFileInfo(t *testing.T) {
+	dirname, err := testutils.MkTestDir("CurrentFileInfo")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), BufferSize: 64}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+
+	got := f.CurrentFileInfo()
+	testutils.TrueOrError(t, got == ActiveFileInfo{Path: f.Filename}, "File.CurrentFileInfo() before writing = %+v", got)
+	_, err = f.Write([]byte("flushed\n"))
+	testutils.TrueOrFatal(t, err == nil && f.Flush() == nil, "File.Write() and Flush() should not fail, err = %v", err)
+	_, err = f.Write([]byte("buf\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	got = f.CurrentFileInfo()
+	want := ActiveFileInfo{Path: f.Filename, Open: true, OpenedAt: now, Size: 8, Buffered: 4, Valid: true}
+	testutils.TrueOrError(t, got == want, "File.CurrentFileInfo() = %+v, want %+v", got, want)
+
+	testutils.TrueOrFatal(t, os.Remove(f.Filename) == nil, "failed to remove the active file")
+	got = f.CurrentFileInfo()
+	testutils.TrueOrError(t, got.Open && !got.Valid, "File.CurrentFileInfo() after removal = %+v, want open and not valid", got)
+}
+
+func TestFile_StaleAfter(t *testing.T) {
+	dirname, err := testutils.MkTestDir("StaleAfter")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	var stale int
+	f := &File{
+		Filename:     filepath.Join(dirname, "app.log"),
+		StaleAfter:   Duration(10 * time.Minute),
+		NoGoroutines: true,
+		OnEvent: func(e Event) {
+			if e.Type == EventStale {
+				stale++
+			}
+		},
+	}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+	testutils.TrueOrError(t, f.Stats().LastWrite.IsZero(), "LastWrite should be zero before any write")
+	_, err = f.Write([]byte("line\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrError(t, f.Stats().LastWrite.Equal(now), "LastWrite = %v, want %v", f.Stats().LastWrite, now)
+
+	for _, step := range []struct {
+		after time.Duration
+		write bool
+		want  int
+	}{
+		{5 * time.Minute, false, 0},
+		{6 * time.Minute, false, 1},
+		// reported once until writes resume
+		{time.Hour, false, 1},
+		{0, true, 1},
+		{11 * time.Minute, false, 2},
+	} {
+		now = now.Add(step.after)
+		if step.write {
+			_, err = f.Write([]byte("line\n"))
+			testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		}
+		testutils.TrueOrFatal(t, f.Maintain() == nil, "File.Maintain() should not fail")
+		testutils.TrueOrError(t, stale == step.want, "after %s, stale events = %d, want %d", now, stale, step.want)
+	}
+}
+
+func TestFile_StaleAfter_timer(t *testing.T) {
+	dirname, err := testutils.MkTestDir("StaleAfter_timer")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	stale := make(chan Event, 1)
+	f := &File{
+		Filename:   filepath.Join(dirname, "app.log"),
+		StaleAfter: Duration(20 * time.Millisecond),
+		OnEvent: func(e Event) {
+			if e.Type == EventStale {
+				select {
+				case stale <- e:
+				default:
+				}
+			}
+		},
+	}
+	_, err = f.Write([]byte("line\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	select {
+	case <-stale:
+	case <-time.After(5 * time.Second):
+		t.Error("EventStale should be emitted without writes")
+	}
+	testutils.TrueOrError(t, f.Close() == nil, "File.Close() should not fail")
+
+	// the checks stopped by Close resume with the file
+	select {
+	case <-stale:
+	default:
+	}
+	_, err = f.Write([]byte("line\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	select {
+	case <-stale:
+	case <-time.After(5 * time.Second):
+		t.Error("EventStale should be emitted after a write following Close")
+	}
+	testutils.TrueOrError(t, f.Close() == nil, "File.Close() should not fail")
+}
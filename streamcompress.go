@@ -0,0 +1,92 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/golang/snappy"
+)
+
+// ActiveCompression decides how the active file is compressed as it is
+// written.
+type ActiveCompression string
+
+const (
+	ActiveCompressionNone   ActiveCompression = "none"
+	ActiveCompressionSnappy ActiveCompression = "snappy"
+)
+
+func (c ActiveCompression) lower() ActiveCompression {
+	return ActiveCompression(strings.ToLower(string(c)))
+}
+
+// valid returns an error if its not valid
+func (c ActiveCompression) valid() error {
+	switch c {
+	case ActiveCompressionNone, ActiveCompressionSnappy:
+		return nil
+	default:
+		return fmt.Errorf("invalid active compression specified: %s, accepted values are %v",
+			c, []ActiveCompression{ActiveCompressionNone, ActiveCompressionSnappy})
+	}
+}
+
+// snappyMagic is the stream identifier the snappy framing format starts with,
+// it is repeated where streams are concatenated.
+const snappyMagic = "\xff\x06\x00\x00sNaPpY"
+
+func decodeSnappy(r io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(snappy.NewReader(r)), nil
+}
+
+// snappyFrames writes each write as snappy frames of its own, so that the
+// file can be read up to the last write while it is being written.
+type snappyFrames struct {
+	w *snappy.Writer
+}
+
+func (s snappyFrames) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, s.w.Flush()
+}
+
+// resetStream starts a new compressed stream on fh if ActiveCompression is
+// set, writes are compressed into it from then on.
+func (f *File) resetStream(fh *os.File) {
+	if f.ActiveCompression != ActiveCompressionSnappy {
+		return
+	}
+	w := f.rawFileWriter(fh)
+	if f.stream == nil {
+		f.stream = &snappyFrames{w: snappy.NewBufferedWriter(w)}
+		return
+	}
+	f.stream.w.Reset(w)
+}
+
+// writeFrames writes ps to the compressed stream of the current file as one
+// write, so that they are compressed together.
+func (f *File) writeFrames(ps [][]byte) (int, error) {
+	bp := bufPool.Get().(*[]byte)
+	b := (*bp)[:0]
+	for _, p := range ps {
+		b = append(b, p...)
+	}
+	n, err := f.stream.Write(b)
+	// do not hold on to buffers from unusually large batches
+	if cap(b) <= maxPooledBuf {
+		*bp = b[:0]
+		bufPool.Put(bp)
+	}
+	return n, err
+}
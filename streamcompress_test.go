@@ -0,0 +1,65 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_ActiveCompression(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_ActiveCompression")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	newFile := func(bufferSize int) *File {
+		f := &File{Filename: filepath.Join(dirname, "app.log"), ActiveCompression: "Snappy", BufferSize: bufferSize}
+		f.setNowFunc(func() time.Time { return now })
+		return f
+	}
+	write := func(f *File, lines ...string) {
+		for _, line := range lines {
+			_, err := f.Write([]byte(line + "\n"))
+			testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		}
+	}
+	readAll := func(f *File) string {
+		r, err := f.NewReader(time.Time{})
+		testutils.TrueOrFatal(t, err == nil, "File.NewReader() error = %v", err)
+		defer r.Close()
+		b, err := ioutil.ReadAll(r)
+		testutils.TrueOrFatal(t, err == nil, "failed to read: %v", err)
+		return string(b)
+	}
+
+	long := strings.Repeat("verbose ", 100)
+	f := newFile(0)
+	write(f, long, "two")
+	raw, err := ioutil.ReadFile(f.Filename)
+	testutils.TrueOrFatal(t, err == nil, "failed to read active file: %v", err)
+	testutils.TrueOrError(t, bytes.HasPrefix(raw, []byte(snappyMagic)) && len(raw) < len(long), "active file = %q, want it compressed as it is written", raw)
+	testutils.TrueOrError(t, readAll(f) == long+"\ntwo\n", "want the active file decompressed, got %q", readAll(f))
+
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	write(f, "three")
+	testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+	// a new stream is appended to the existing file
+	f = newFile(1024)
+	defer f.Close()
+	write(f, "four")
+	testutils.TrueOrFatal(t, f.Sync() == nil, "File.Sync() should not fail")
+	testutils.TrueOrError(t, readAll(f) == long+"\ntwo\nthree\nfour\n", "want the backup and active file decompressed, got %q", readAll(f))
+
+	_, err = f.Follow(context.Background(), time.Time{})
+	testutils.TrueOrError(t, err != nil, "File.Follow() should fail for a compressed file")
+}
@@ -0,0 +1,92 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"strings"
+)
+
+// strftimeLayouts maps strftime conversion specifications to Go layouts.
+var strftimeLayouts = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'e': "_2",
+	'j': "002",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'p': "PM",
+	'b': "Jan",
+	'h': "Jan",
+	'B': "January",
+	'a': "Mon",
+	'A': "Monday",
+	'Z': "MST",
+	'z': "-0700",
+	'F': "2006-01-02",
+	'T': "15:04:05",
+	'R': "15:04",
+	'D': "01/02/06",
+}
+
+// goLayoutTokens are the parts of literal text that Go would take for a
+// layout element, which a converted pattern cannot contain.
+var goLayoutTokens = []string{"Jan", "Mon", "MST", "PM", "pm", "Z07"}
+
+// StrftimeLayout converts a strftime pattern such as "%Y-%m-%d_%H%M", as used
+// by Apache's rotatelogs, to the equivalent Go time layout. "%%" is a literal
+// "%". It returns an error for conversions it does not support, and for
+// literal text that Go would read as part of the layout, such as digits.
+func StrftimeLayout(pattern string) (string, error) {
+	var b strings.Builder
+	// literal is the literal text since the last conversion
+	var literal strings.Builder
+	for i := 0; i <= len(pattern); i++ {
+		if i < len(pattern) && pattern[i] != '%' {
+			literal.WriteByte(pattern[i])
+			continue
+		}
+		if i < len(pattern)-1 && pattern[i+1] == '%' {
+			literal.WriteByte('%')
+			i++
+			continue
+		}
+		if ambiguousLiteral(literal.String()) {
+			return "", fmt.Errorf("strftime pattern %q has literal text %q that cannot be kept apart from the time", pattern, literal.String())
+		}
+		b.WriteString(literal.String())
+		literal.Reset()
+		if i == len(pattern) {
+			break
+		}
+		if i++; i == len(pattern) {
+			return "", fmt.Errorf("strftime pattern %q ends with %%", pattern)
+		}
+		layout, ok := strftimeLayouts[pattern[i]]
+		if !ok {
+			return "", fmt.Errorf("strftime conversion %%%c in %q is not supported", pattern[i], pattern)
+		}
+		b.WriteString(layout)
+	}
+	return b.String(), nil
+}
+
+// ambiguousLiteral reports if Go would read part of the literal text as a
+// layout element.
+func ambiguousLiteral(literal string) bool {
+	if strings.ContainsAny(literal, "0123456789") {
+		return true
+	}
+	for _, token := range goLayoutTokens {
+		if strings.Contains(literal, token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestStrftimeLayout(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+		wantErr bool
+	}{
+		{pattern: "%Y-%m-%d_%H%M", want: "2006-01-02_1504"},
+		{pattern: ".%F.%T", want: ".2006-01-02.15:04:05"},
+		{pattern: "-%y%j %I%p %Z", want: "-06002 03PM MST"},
+		{pattern: "_%a_%b_%e", want: "_Mon_Jan__2"},
+		{pattern: "100%%-%Y", want: "", wantErr: true},
+		{pattern: "%%-%Y", want: "%-2006"},
+		{pattern: "%Y%Q", wantErr: true},
+		{pattern: "%Y%", wantErr: true},
+		{pattern: "v2-%Y", wantErr: true},
+		{pattern: "Monthly-%m", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got, err := StrftimeLayout(tt.pattern)
+			testutils.TrueOrError(t, (err != nil) == tt.wantErr, "StrftimeLayout() error = %v, wantErr %v", err, tt.wantErr)
+			testutils.TrueOrError(t, got == tt.want, "StrftimeLayout() = %q, want %q", got, tt.want)
+		})
+	}
+}
+
+func TestFile_BackupTimeFormat_strftime(t *testing.T) {
+	dirname, err := testutils.MkTestDir("BackupTimeFormat_strftime")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), BackupTimeFormat: "-%Y%m%d"}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+	_, err = f.Write([]byte("line\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	backups, err := f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil && len(backups) == 1, "File.ListBackups() = %v, %v, want 1 backup", backups, err)
+	testutils.TrueOrError(t, filepath.Base(backups[0].Name) == "app-20210304.log", "backup = %s, want app-20210304.log", backups[0].Name)
+}
@@ -0,0 +1,94 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"os"
+	"time"
+)
+
+// periodCheckSlack is how long after a period is over the file is checked
+// for rotation, as it is only due once the time is past the period.
+const periodCheckSlack = 100 * time.Millisecond
+
+// startPeriodChecks starts rotating the file as each period is over if
+// OneFilePerPeriod is set, so that periods without writes get their backup
+// when they are over rather than at the next write. A SingleWriter file is
+// only locked by its writer, so it is left to the next write.
+func (f *File) startPeriodChecks() {
+	if !f.OneFilePerPeriod || f.NoGoroutines || f.SingleWriter {
+		return
+	}
+	now := f.nowFunc()
+	_, next := f.calcRotationTimes(now)
+	f.periodChecks = startPeriodic(next.Sub(now)+periodCheckSlack, f.checkPeriodOver)
+}
+
+// checkPeriodOver rotates the file if its period is over, filling in the
+// periods that passed without a write, and returns how long until the
+// current period is over.
+func (f *File) checkPeriodOver() time.Duration {
+	if err := f.drainShards(); err != nil {
+		f.emit(Event{Type: EventWriteError, Filename: f.Filename, Message: "unable to drain shards", Err: err})
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file != nil && !f.fifo {
+		if err := f.checkAndRotate(); err != nil {
+			f.emit(Event{Type: EventBackupError, Filename: f.Filename, Message: "unable to rotate file at the end of its period", Err: err})
+		}
+	}
+	now := f.now()
+	next := f.rotateAt
+	if next.IsZero() {
+		_, next = f.calcRotationTimes(now)
+	}
+	if d := next.Sub(now); d > 0 {
+		return d + periodCheckSlack
+	}
+	// the rotation did not go through, such as on an error, retry shortly
+	return time.Second
+}
+
+// fillIdlePeriods creates empty backups for the periods from f.rotateAt up to
+// the one holding now, which passed without a write, if OneFilePerPeriod is
+// set. It must be called with f.mu held, before the next rotation time is
+// worked out.
+func (f *File) fillIdlePeriods(now time.Time) error {
+	if !f.OneFilePerPeriod || f.rotateAt.IsZero() {
+		return nil
+	}
+	current, _ := f.calcRotationTimes(now)
+	start := f.rotateAt
+	for n := 0; start.Before(current) && n < maxMissedRotations; n++ {
+		if err := f.createEmptyBackup(start); err != nil {
+			return err
+		}
+		f.periodsOver(start)
+		_, next := f.calcRotationTimes(start)
+		if !next.After(start) {
+			break
+		}
+		start = next
+	}
+	return nil
+}
+
+// createEmptyBackup creates an empty backup for the period starting at
+// period, unless it already has one.
+func (f *File) createEmptyBackup(period time.Time) error {
+	name := f.filenameWithTimestamp(period)
+	if _, err := os.Stat(name); err == nil || f.compressedExists(name) {
+		return nil
+	}
+	fh, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, fileOpenMode)
+	if os.IsExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fh.Close()
+}
@@ -0,0 +1,100 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_OneFilePerPeriod(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_OneFilePerPeriod")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+
+	f := &File{Filename: filepath.Join(dirname, "app.log"), When: "h", BackupTimeFormat: ".2006-01-02T15", OneFilePerPeriod: true}
+	defer f.Close()
+	now := time.Date(2021, 3, 4, 10, 15, 0, 0, time.UTC)
+	f.setNowFunc(func() time.Time { return now })
+	write := func(line string) {
+		_, err := f.Write([]byte(line + "\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	}
+
+	write("a")
+	testutils.TrueOrFatal(t, f.ForceRotate() == nil, "File.ForceRotate() should not fail")
+	write("b")
+	testutils.TrueOrFatal(t, f.ForceRotate() == nil, "File.ForceRotate() should not fail")
+	// the rotation due at 11:00 comes at 13:15, 11:00 and 12:00 were idle
+	now = now.Add(3 * time.Hour)
+	write("c")
+
+	backups, err := f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil && len(backups) == 3, "want a backup for each of 3 periods, got %v, err = %v", backups, err)
+	wants := []string{"a\nb\n", "", ""}
+	for i, b := range backups {
+		wantTime := time.Date(2021, 3, 4, 10+i, 0, 0, 0, time.UTC)
+		content, err := ioutil.ReadFile(b.Name)
+		testutils.TrueOrError(t, err == nil && b.Time.Equal(wantTime) && b.Seq == 0 && string(content) == wants[i],
+			"want backup %d of %s holding %q, got %+v holding %q, err = %v", i, wantTime, wants[i], b, content, err)
+	}
+}
+
+func TestFile_OneFilePerPeriod_periodChecks(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_OneFilePerPeriod_periodChecks")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+
+	f := &File{Filename: filepath.Join(dirname, "app.log"), When: "h", BackupTimeFormat: ".2006-01-02T15", OneFilePerPeriod: true}
+	defer f.Close()
+	// the period is over a moment after the write
+	base, start := time.Date(2021, 3, 4, 10, 59, 59, 700000000, time.UTC), time.Now()
+	f.setNowFunc(func() time.Time { return base.Add(time.Since(start)) })
+	_, err = f.Write([]byte("a\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+
+	backup := filepath.Join(dirname, "app.2021-03-04T10.log")
+	var content []byte
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if content, err = ioutil.ReadFile(backup); err == nil {
+			break
+		}
+	}
+	testutils.TrueOrError(t, err == nil && string(content) == "a\n", "want the period backed up when it is over without another write, got %q, err = %v", content, err)
+}
+
+func TestFile_OneFilePerPeriod_lowDiskSpace(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_OneFilePerPeriod_lowDiskSpace")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	free := uint64(1 << 30)
+	diskFree = func(dir string) (uint64, error) { return free, nil }
+	defer func() { diskFree = freeSpace }()
+
+	f := &File{Filename: filepath.Join(dirname, "app.log"), When: "h", BackupTimeFormat: ".2006-01-02T15", OneFilePerPeriod: true, NoGoroutines: true}
+	defer f.Close()
+	f.setNowFunc(func() time.Time { return time.Date(2021, 3, 4, 10, 15, 0, 0, time.UTC) })
+	for _, line := range []string{"a\n", "b\n"} {
+		_, err = f.Write([]byte(line))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		if line == "b\n" {
+			free = 0
+		}
+		err = f.ForceRotate()
+	}
+	testutils.TrueOrError(t, err != nil, "File.ForceRotate() should fail without room to append to the period backup")
+
+	backups, err := f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil && len(backups) == 1, "want the period kept to a single backup, got %v, err = %v", backups, err)
+	content, err := ioutil.ReadFile(backups[0].Name)
+	testutils.TrueOrError(t, err == nil && string(content) == "a\n", "backup = %q, want %q, err = %v", content, "a\n", err)
+	content, err = ioutil.ReadFile(f.Filename)
+	testutils.TrueOrError(t, err == nil && string(content) == "b\n", "file = %q, want %q left to retry, err = %v", content, "b\n", err)
+}
@@ -0,0 +1,141 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// String returns the effective configuration of f on a single line, such as
+// `logfeller.File{filename=/var/log/app.log when=day backups=14}`, for debug
+// logging. Fields left empty are omitted, and hooks, Archiver and other
+// values that may hold secrets are only shown as set. The defaults init
+// fills in are shown without initializing f, along with the error init
+// would return.
+func (f *File) String() string {
+	c, err := f.effectiveConfig()
+	var sb strings.Builder
+	sb.WriteString("logfeller.File{")
+	first := true
+	c.eachConfigField(func(name string, v reflect.Value) {
+		if !first {
+			sb.WriteByte(' ')
+		}
+		first = false
+		sb.WriteString(name)
+		sb.WriteByte('=')
+		sb.WriteString(formatConfigValue(v))
+	})
+	if err != nil {
+		fmt.Fprintf(&sb, " init_error=%q", err.Error())
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// effectiveConfig returns a File with the exported fields of f and the
+// defaults init fills in, and the configuration error init would return,
+// leaving f as it is. The configuration warnings are not emitted again.
+func (f *File) effectiveConfig() (*File, error) {
+	c := &File{Filename: f.Filename}
+	inheritFields(c, f)
+	c.OnEvent = nil
+	c.nowFunc = time.Now
+	c.applyDefaults()
+	err := c.configure()
+	c.OnEvent = f.OnEvent
+	return c, err
+}
+
+// GoString returns the configuration of f in Go syntax, fields left empty
+// are omitted and hooks, Archiver and other values that may hold secrets are
+// only shown as set.
+func (f *File) GoString() string {
+	var sb strings.Builder
+	sb.WriteString("&logfeller.File{")
+	first := true
+	v := reflect.ValueOf(f).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || v.Field(i).IsZero() {
+			continue
+		}
+		if !first {
+			sb.WriteString(", ")
+		}
+		first = false
+		sb.WriteString(field.Name)
+		sb.WriteByte(':')
+		if redacted(field.Type) {
+			fmt.Fprintf(&sb, "(%s)(<set>)", field.Type)
+			continue
+		}
+		fmt.Fprintf(&sb, "%#v", v.Field(i).Interface())
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// eachConfigField calls fn with the name and value of every exported field
+// of f that is not empty. Fields are named after their JSON tags, falling
+// back to their Go name for fields not in JSON.
+func (f *File) eachConfigField(fn func(name string, v reflect.Value)) {
+	v := reflect.ValueOf(f).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || v.Field(i).IsZero() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			name = field.Name
+		}
+		fn(name, v.Field(i))
+	}
+}
+
+// redacted reports if values of t are only shown as set by File.String and
+// File.GoString: functions, interfaces and pointers, which may print
+// secrets or addresses, and collections of them.
+func redacted(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Func, reflect.Interface, reflect.Ptr, reflect.Chan, reflect.UnsafePointer:
+		return true
+	case reflect.Slice, reflect.Array:
+		return redacted(t.Elem())
+	case reflect.Map:
+		return redacted(t.Key()) || redacted(t.Elem())
+	default:
+		return false
+	}
+}
+
+// formatConfigValue formats a configuration value for File.String.
+func formatConfigValue(v reflect.Value) string {
+	if redacted(v.Type()) {
+		return "<set>"
+	}
+	switch val := v.Interface().(type) {
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return val.String()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		s := v.String()
+		if strings.ContainsAny(s, " \t\n\"") {
+			return fmt.Sprintf("%q", s)
+		}
+		return s
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
@@ -0,0 +1,9 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+// syncDir does nothing on Windows, where directories cannot be synced and
+// renames are committed by the filesystem.
+func syncDir(dir string) error { return nil }
@@ -0,0 +1,16 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+// tee writes p to RecentFile and TeeWriter if they are set.
+func (f *File) tee(p []byte) {
+	f.writeRecent(p)
+	if f.TeeWriter == nil || len(p) == 0 {
+		return
+	}
+	if _, err := f.TeeWriter.Write(p); err != nil {
+		f.emit(Event{Type: EventWriteError, Filename: f.Filename, Message: "unable to write to tee writer", Err: err})
+	}
+}
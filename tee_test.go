@@ -0,0 +1,44 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errors.New("closed") }
+
+func TestFile_TeeWriter(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_TeeWriter")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+
+	var tee bytes.Buffer
+	f := &File{Filename: filepath.Join(dirname, "app.log"), TeeWriter: &tee, Footer: "=== {reason} ==="}
+	_, err = f.Write([]byte("first\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	_, err = f.WriteBatch([][]byte{[]byte("second "), []byte("line\n")})
+	testutils.TrueOrFatal(t, err == nil, "File.WriteBatch() error = %v", err)
+	testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+	testutils.TrueOrError(t, tee.String() == "first\nsecond line\n", "tee = %q, want the writes only", tee.String())
+
+	var events []Event
+	f = &File{Filename: filepath.Join(dirname, "other.log"), TeeWriter: failingWriter{}, OnEvent: func(e Event) { events = append(events, e) }}
+	defer f.Close()
+	_, err = f.Write([]byte("line\n"))
+	testutils.TrueOrError(t, err == nil, "a failing tee writer should not fail the write, got %v", err)
+	testutils.TrueOrError(t, len(events) == 1 && events[0].Type == EventWriteError, "want an EventWriteError, got %v", events)
+	b, err := ioutil.ReadFile(f.Filename)
+	testutils.TrueOrError(t, err == nil && string(b) == "line\n", "file = %q, err = %v", b, err)
+}
@@ -0,0 +1,99 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reasons a file is finished, used for the {reason} placeholder in Footer.
+const (
+	footerReasonRotated = "rotated"
+	footerReasonClosed  = "closed"
+)
+
+// markerFormat is the format of the lines written with RotationMarkers.
+const markerFormat = "--- logfeller: continued %s %s ---\n"
+
+// write writes p to the current file, through the buffer if there is one,
+// and counts the bytes and lines written.
+func (f *File) write(p []byte) (int, error) {
+	f.checkpoint()
+	n, err := f.writeRaw(p)
+	if err == nil && n > 0 {
+		f.liveness.wrote(f.nowFunc())
+	}
+	f.tee(p[:n])
+	f.fileBytes += int64(n)
+	f.fileLines += int64(bytes.Count(p[:n], []byte{'\n'}))
+	f.hashContent(p[:n])
+	if err == nil {
+		err = f.syncWrite()
+	}
+	return n, err
+}
+
+// writeRaw writes p to the current file without counting it.
+func (f *File) writeRaw(p []byte) (n int, err error) {
+	if f.buf != nil {
+		n, err = f.bufWrite(p)
+	} else {
+		n, err = f.fileWriter(f.file).Write(p)
+	}
+	f.fileOffset += int64(n)
+	return n, err
+}
+
+// hasOutput reports if the current file holds anything besides the start
+// marker, so that files without output are still taken as empty.
+func (f *File) hasOutput() bool {
+	return f.fileOffset > f.markerBytes
+}
+
+// writeFooter writes Footer to the end of the current file if both are set,
+// and the file has output.
+func (f *File) writeFooter(reason string) error {
+	if f.Footer == "" || f.file == nil || !f.hasOutput() {
+		return nil
+	}
+	footer := strings.NewReplacer(
+		"{time}", f.time(f.nowFunc()).Format(time.RFC3339),
+		"{reason}", reason,
+		"{bytes}", strconv.FormatInt(f.fileBytes, 10),
+		"{lines}", strconv.FormatInt(f.fileLines, 10),
+		"{rotation}", strconv.FormatUint(f.rotations+1, 10),
+	).Replace(f.Footer)
+	if !strings.HasSuffix(footer, "\n") {
+		footer += "\n"
+	}
+	_, err := f.writeRaw([]byte(footer))
+	return err
+}
+
+// writeEndMarker writes a marker naming the file that continues the current
+// file, if RotationMarkers is set and the file has output.
+func (f *File) writeEndMarker() error {
+	if !f.RotationMarkers || f.file == nil || !f.hasOutput() {
+		return nil
+	}
+	_, err := f.writeRaw([]byte(fmt.Sprintf(markerFormat, "in", filepath.Base(f.Filename))))
+	return err
+}
+
+// writeStartMarker writes a marker naming the backup the current file
+// continues from, if RotationMarkers is set and there is one.
+func (f *File) writeStartMarker() error {
+	if !f.RotationMarkers || f.file == nil || f.lastBackup == "" {
+		return nil
+	}
+	_, err := f.writeRaw([]byte(fmt.Sprintf(markerFormat, "from", filepath.Base(f.lastBackup))))
+	f.markerBytes = f.fileOffset
+	return err
+}
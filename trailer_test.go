@@ -0,0 +1,132 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_Footer(t *testing.T) {
+	dirname, err := testutils.MkTestDir("Footer")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{
+		Filename: filepath.Join(dirname, "app.log"),
+		Footer:   "=== {reason} at {time}, {bytes} bytes, {lines} lines ===",
+	}
+	f.setNowFunc(func() time.Time { return now })
+
+	_, err = f.Write([]byte("one\ntwo\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	_, err = f.Write([]byte("three\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+
+	backup := filepath.Join(dirname, "app.2021-03-04T0000-00.log")
+	b, err := ioutil.ReadFile(backup)
+	testutils.TrueOrFatal(t, err == nil, "failed to read backup: %v", err)
+	want := "one\ntwo\n=== rotated at 2021-03-04T10:00:00Z, 8 bytes, 2 lines ===\n"
+	testutils.TrueOrError(t, string(b) == want, "backup content = %q, want %q", b, want)
+
+	b, err = ioutil.ReadFile(f.Filename)
+	testutils.TrueOrFatal(t, err == nil, "failed to read file: %v", err)
+	want = "three\n=== closed at 2021-03-04T10:00:00Z, 6 bytes, 1 lines ===\n"
+	testutils.TrueOrError(t, string(b) == want, "file content = %q, want %q", b, want)
+}
+
+func TestFile_Footer_emptyFile(t *testing.T) {
+	dirname, err := testutils.MkTestDir("Footer_emptyFile")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), Footer: "=== {reason} ==="}
+	f.setNowFunc(func() time.Time { return now })
+
+	_, err = f.Write([]byte("one\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	// the new file is empty, it is reused without a footer
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+
+	b, err := ioutil.ReadFile(filepath.Join(dirname, "app.2021-03-04T0000-00.log"))
+	testutils.TrueOrFatal(t, err == nil, "failed to read backup: %v", err)
+	want := "one\n=== rotated ===\n"
+	testutils.TrueOrError(t, string(b) == want, "backup content = %q, want %q", b, want)
+	info, err := os.Stat(f.Filename)
+	testutils.TrueOrError(t, err == nil && info.Size() == 0, "want the file left empty, got %v, err = %v", info, err)
+}
+
+func TestFile_RotationMarkers(t *testing.T) {
+	dirname, err := testutils.MkTestDir("RotationMarkers")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{
+		Filename:        filepath.Join(dirname, "app.log"),
+		RotationMarkers: true,
+		Footer:          "=== {reason} ===",
+	}
+	f.setNowFunc(func() time.Time { return now })
+
+	_, err = f.Write([]byte("one\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	_, err = f.Write([]byte("two\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+
+	b, err := ioutil.ReadFile(filepath.Join(dirname, "app.2021-03-04T0000-00.log"))
+	testutils.TrueOrFatal(t, err == nil, "failed to read backup: %v", err)
+	want := "one\n--- logfeller: continued in app.log ---\n=== rotated ===\n"
+	testutils.TrueOrError(t, string(b) == want, "backup content = %q, want %q", b, want)
+
+	b, err = ioutil.ReadFile(f.Filename)
+	testutils.TrueOrFatal(t, err == nil, "failed to read file: %v", err)
+	want = "--- logfeller: continued from app.2021-03-04T0000-00.log ---\ntwo\n=== closed ===\n"
+	testutils.TrueOrError(t, string(b) == want, "file content = %q, want %q", b, want)
+}
+
+func TestFile_RotationMarkers_emptyFile(t *testing.T) {
+	dirname, err := testutils.MkTestDir("RotationMarkers_emptyFile")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{
+		Filename:        filepath.Join(dirname, "app.log"),
+		RotationMarkers: true,
+		Footer:          "=== {reason} ===",
+	}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+
+	_, err = f.Write([]byte("one\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	// the new file only holds the start marker, it is reused
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+
+	backups, err := f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil, "File.ListBackups() error = %v", err)
+	testutils.TrueOrFatal(t, len(backups) == 1, "File.ListBackups() = %v, want 1 backup", backups)
+	b, err := ioutil.ReadFile(backups[0].Name)
+	testutils.TrueOrFatal(t, err == nil, "failed to read backup: %v", err)
+	want := "one\n--- logfeller: continued in app.log ---\n=== rotated ===\n"
+	testutils.TrueOrError(t, string(b) == want, "backup content = %q, want %q", b, want)
+
+	b, err = ioutil.ReadFile(f.Filename)
+	testutils.TrueOrFatal(t, err == nil, "failed to read file: %v", err)
+	want = "--- logfeller: continued from app.2021-03-04T0000-00.log ---\n"
+	testutils.TrueOrError(t, string(b) == want, "file content = %q, want %q", b, want)
+}
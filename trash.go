@@ -0,0 +1,93 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// trashDirName is the name of the directory backups are moved to when
+// TrashRetention is set.
+const trashDirName = ".trash"
+
+// trashDir returns the trash directory of f.
+func (f *File) trashDir() string { return filepath.Join(f.backupDirectory, trashDirName) }
+
+// moveToTrash moves the backup name and its sidecars to the trash directory.
+// Their modification times are set to now so that TrashRetention counts from
+// when they were trashed.
+func (f *File) moveToTrash(name string) error {
+	if err := os.MkdirAll(f.trashDir(), dirCreateMode); err != nil {
+		return err
+	}
+	now := f.nowFunc()
+	var errs multipleErrors
+	for i, src := range []string{name, MetadataFilename(name), IndexFilename(name)} {
+		dst := filepath.Join(f.trashDir(), filepath.Base(src))
+		err := os.Rename(src, dst)
+		if os.IsNotExist(err) && i > 0 {
+			// sidecars are optional
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := os.Chtimes(dst, now, now); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.err()
+}
+
+// purgeTrash deletes the backups of f and their sidecars that have been in
+// the trash directory for longer than TrashRetention.
+func (f *File) purgeTrash() error {
+	if f.TrashRetention <= 0 {
+		return nil
+	}
+	return f.removeTrash(f.nowFunc().Add(-time.Duration(f.TrashRetention)))
+}
+
+// removeTrash deletes the backups of f and their sidecars that were moved to
+// the trash directory before cutoff, or all of them if cutoff is zero.
+func (f *File) removeTrash(cutoff time.Time) error {
+	entries, err := ioutil.ReadDir(f.trashDir())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var errs multipleErrors
+	for _, entry := range entries {
+		if entry.IsDir() || (!cutoff.IsZero() && !entry.ModTime().Before(cutoff)) {
+			continue
+		}
+		backup := strings.TrimSuffix(strings.TrimSuffix(entry.Name(), metadataSuffix), indexSuffix)
+		backup, _ = trimEncodedExts(backup)
+		if _, _, ok := f.parseBackupName(backup); !ok {
+			// belongs to another File sharing the directory
+			continue
+		}
+		name := filepath.Join(f.trashDir(), entry.Name())
+		err := os.Remove(name)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if entry.Name() != filepath.Base(MetadataFilename(backup)) && entry.Name() != filepath.Base(IndexFilename(backup)) {
+			trigger := TriggerRetention
+			if cutoff.IsZero() {
+				trigger = TriggerRemoveAll
+			}
+			f.audit(AuditEntry{Action: AuditPurge, Trigger: trigger, Backup: name, Error: errString(err)})
+		}
+	}
+	return errs.err()
+}
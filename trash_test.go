@@ -0,0 +1,47 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_TrashRetention(t *testing.T) {
+	dirname, err := testutils.MkTestDir("TrashRetention")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	old := filepath.Join(dirname, "app.2021-03-01T0000-00.log")
+	for _, name := range []string{old, MetadataFilename(old), filepath.Join(dirname, "app.2021-03-02T0000-00.log")} {
+		testutils.TrueOrFatal(t, ioutil.WriteFile(name, []byte("x\n"), 0600) == nil, "failed to write %s", name)
+	}
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), Backups: 1, TrashRetention: Duration(24 * time.Hour)}
+	f.setNowFunc(func() time.Time { return now })
+	testutils.TrueOrFatal(t, f.init() == nil, "File.init() should not fail")
+
+	testutils.TrueOrFatal(t, f.trim() == nil, "File.trim() should not fail")
+	_, err = os.Stat(old)
+	testutils.TrueOrError(t, os.IsNotExist(err), "trimmed backup should have been moved, err = %v", err)
+	for _, name := range []string{old, MetadataFilename(old)} {
+		_, err = os.Stat(filepath.Join(dirname, ".trash", filepath.Base(name)))
+		testutils.TrueOrError(t, err == nil, "%s should be in the trash, err = %v", name, err)
+	}
+
+	now = now.Add(23 * time.Hour)
+	testutils.TrueOrFatal(t, f.trim() == nil, "File.trim() should not fail")
+	_, err = os.Stat(filepath.Join(dirname, ".trash", filepath.Base(old)))
+	testutils.TrueOrError(t, err == nil, "trashed backup should be kept until TrashRetention, err = %v", err)
+
+	now = now.Add(2 * time.Hour)
+	testutils.TrueOrFatal(t, f.trim() == nil, "File.trim() should not fail")
+	entries, err := ioutil.ReadDir(filepath.Join(dirname, ".trash"))
+	testutils.TrueOrError(t, err == nil && len(entries) == 0, "trash should be purged after TrashRetention, entries = %v, err = %v", entries, err)
+}
@@ -0,0 +1,60 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// defaultTriggerInterval is how often TriggerFile is checked for by default.
+const defaultTriggerInterval = time.Second
+
+// triggerWatch checks for TriggerFile every TriggerInterval.
+type triggerWatch struct {
+	// checks runs checkTrigger if goroutines are used.
+	checks *periodic
+}
+
+// startTrigger starts checking for TriggerFile if it is set.
+func (f *File) startTrigger() {
+	if f.TriggerFile == "" || f.NoGoroutines {
+		return
+	}
+	interval := time.Duration(f.TriggerInterval)
+	f.trigger = &triggerWatch{checks: startPeriodic(interval, func() time.Duration {
+		f.checkTrigger()
+		return interval
+	})}
+}
+
+// stopTrigger stops the checks started by startTrigger.
+func (f *File) stopTrigger() {
+	if f.trigger != nil {
+		f.trigger.checks.stop()
+	}
+}
+
+// checkTrigger rotates the file if TriggerFile exists. TriggerFile is
+// removed first, so that a failed rotation is not retried over and over.
+func (f *File) checkTrigger() {
+	if f.TriggerFile == "" {
+		return
+	}
+	if _, err := os.Stat(f.TriggerFile); err != nil {
+		if !os.IsNotExist(err) {
+			f.emit(Event{Type: EventBackupError, Filename: f.Filename, Message: "unable to check trigger file", Err: err})
+		}
+		return
+	}
+	if err := os.Remove(f.TriggerFile); err != nil && !os.IsNotExist(err) {
+		f.emit(Event{Type: EventBackupError, Filename: f.Filename, Message: "unable to remove trigger file", Err: err})
+		return
+	}
+	if err := f.rotateNow(false, TriggerFileTouched); err != nil {
+		f.emit(Event{Type: EventBackupError, Filename: f.Filename, Message: fmt.Sprintf("unable to rotate on trigger file %s", f.TriggerFile), Err: err})
+	}
+}
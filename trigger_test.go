@@ -0,0 +1,67 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_TriggerFile(t *testing.T) {
+	for _, noGoroutines := range []bool{false, true} {
+		dirname, err := testutils.MkTestDir(fmt.Sprintf("File_TriggerFile_%v", noGoroutines))
+		testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+		defer os.RemoveAll(dirname)
+		filename := filepath.Join(dirname, "app.log")
+		trigger := filepath.Join(dirname, "app.log.rotate")
+		f := &File{Filename: filename, TriggerFile: "app.log.rotate", TriggerInterval: Duration(10 * time.Millisecond), NoGoroutines: noGoroutines}
+
+		_, err = f.Write([]byte("line\n"))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		testutils.TrueOrFatal(t, ioutil.WriteFile(trigger, nil, 0o644) == nil, "should not fail at touching the trigger file")
+		if noGoroutines {
+			testutils.TrueOrFatal(t, f.Maintain() == nil, "File.Maintain() should not fail")
+		}
+		var backups []Backup
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			if backups, err = f.ListBackups(); err == nil && len(backups) > 0 {
+				break
+			}
+		}
+		testutils.TrueOrError(t, len(backups) == 1, "noGoroutines = %v, want the file rotated once, got %d backups, err = %v", noGoroutines, len(backups), err)
+		_, err = os.Stat(trigger)
+		testutils.TrueOrError(t, os.IsNotExist(err), "noGoroutines = %v, want the trigger file removed, got error = %v", noGoroutines, err)
+		testutils.TrueOrError(t, f.Close() == nil, "File.Close() should not fail")
+	}
+}
+
+func TestFile_TriggerFile_afterClose(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_TriggerFile_afterClose")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	f := &File{Filename: filepath.Join(dirname, "app.log"), TriggerFile: "app.log.rotate", TriggerInterval: Duration(10 * time.Millisecond)}
+	_, err = f.Write([]byte("line\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+
+	// the checks stopped by Close resume with the file
+	_, err = f.Write([]byte("again\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, ioutil.WriteFile(filepath.Join(dirname, "app.log.rotate"), nil, 0o644) == nil, "should not fail at touching the trigger file")
+	var backups []Backup
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if backups, err = f.ListBackups(); err == nil && len(backups) > 0 {
+			break
+		}
+	}
+	testutils.TrueOrError(t, len(backups) == 1, "want the file rotated after Close, got %d backups, err = %v", len(backups), err)
+	testutils.TrueOrError(t, f.Close() == nil, "File.Close() should not fail")
+}
@@ -0,0 +1,144 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// VerifyBackups checks that the backups compressed by Compress read through
+// to their end, and repairs those that do not, such as after a crash while
+// one was appended to: the part that can still be read is compressed again
+// and replaces the backup. Temporary files left by compressions that were
+// cut short are removed. Every backup repaired is reported with an
+// EventBackupError, and returned.
+func (f *File) VerifyBackups() ([]string, error) {
+	if err := f.init(); err != nil {
+		return nil, err
+	}
+	f.trimMu.Lock()
+	defer f.trimMu.Unlock()
+	return f.verifyBackups()
+}
+
+func (f *File) verifyBackups() ([]string, error) {
+	var errs multipleErrors
+	tmps, err := filepath.Glob(f.backupPrefix + "*" + compressExt + compressTmpExt)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, tmp := range tmps {
+		if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	backups, err := f.localBackups()
+	if err != nil {
+		return nil, append(errs, err)
+	}
+	var repaired []string
+	for _, b := range backups {
+		if b.Encoded != compressExt {
+			continue
+		}
+		corrupt, err := gzipCorrupt(b.Name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if corrupt == nil {
+			continue
+		}
+		salvaged, err := f.salvageGzip(b.Name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to repair corrupt backup %s: %v", b.Name, err))
+			continue
+		}
+		repaired = append(repaired, b.Name)
+		f.emit(Event{Type: EventBackupError, Filename: b.Name,
+			Message: fmt.Sprintf("repaired corrupt compressed backup, salvaged %d bytes", salvaged), Err: corrupt})
+	}
+	return repaired, errs.err()
+}
+
+// repairBackups runs VerifyBackups for RepairBackups, reporting failures with
+// an EventBackupError.
+func (f *File) repairBackups() {
+	f.trimMu.Lock()
+	defer f.trimMu.Unlock()
+	if _, err := f.verifyBackups(); err != nil {
+		f.emit(Event{Type: EventBackupError, Filename: f.Filename, Message: "unable to verify backups", Err: err})
+	}
+}
+
+// gzipCorrupt returns why the gzip file name cannot be read through, nil if
+// it can. The error returned is for failing to open name.
+func gzipCorrupt(name string) (corrupt, err error) {
+	fh, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	zr, err := gzip.NewReader(fh)
+	if err != nil {
+		return err, nil
+	}
+	_, err = io.Copy(ioutil.Discard, zr)
+	return err, nil
+}
+
+// salvageGzip compresses what can be read of the gzip file name again, and
+// replaces name with it. It returns the number of bytes salvaged.
+func (f *File) salvageGzip(name string) (int64, error) {
+	fh, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer fh.Close()
+	info, err := fh.Stat()
+	if err != nil {
+		return 0, err
+	}
+	sr := &salvageReader{}
+	if zr, err := gzip.NewReader(fh); err == nil {
+		sr.r = zr
+	}
+	tmp := name + compressTmpExt
+	if err := gzipTo(tmp, sr, info.Mode(), f.CopyBufferSize); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	fh.Close()
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return sr.n, nil
+}
+
+// salvageReader reads r up to its first error, which it reports as the end
+// of r, so that what could be read is kept.
+type salvageReader struct {
+	r io.Reader
+	n int64
+}
+
+func (s *salvageReader) Read(p []byte) (int, error) {
+	if s.r == nil {
+		return 0, io.EOF
+	}
+	n, err := s.r.Read(p)
+	s.n += int64(n)
+	if err != nil {
+		s.r = nil
+		err = io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,57 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_VerifyBackups(t *testing.T) {
+	dirname, err := testutils.MkTestDir("File_VerifyBackups")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	now := time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)
+	var events []Event
+	f := &File{Filename: filepath.Join(dirname, "app.log"), Compress: true, NoGoroutines: true, OnEvent: func(e Event) { events = append(events, e) }}
+	f.setNowFunc(func() time.Time { return now })
+	defer f.Close()
+	for _, line := range []string{"first\n", "second\n"} {
+		_, err := f.Write([]byte(line))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+		testutils.TrueOrFatal(t, f.Rotate() == nil, "File.Rotate() should not fail")
+	}
+	backups, err := f.ListBackups()
+	testutils.TrueOrFatal(t, err == nil && len(backups) == 1, "File.ListBackups() = %v, error = %v", backups, err)
+	name := backups[0].Name
+	// cut the second gzip member short, as a crash while appending would
+	info, err := os.Stat(name)
+	testutils.TrueOrFatal(t, err == nil, "failed to stat %s: %v", name, err)
+	testutils.TrueOrFatal(t, os.Truncate(name, info.Size()-6) == nil, "failed to truncate %s", name)
+	tmp := name + compressTmpExt
+	testutils.TrueOrFatal(t, ioutil.WriteFile(tmp, []byte("partial"), 0o644) == nil, "failed to write %s", tmp)
+
+	events = nil
+	repaired, err := f.VerifyBackups()
+	testutils.TrueOrFatal(t, err == nil, "File.VerifyBackups() error = %v", err)
+	testutils.TrueOrError(t, len(repaired) == 1 && repaired[0] == name, "File.VerifyBackups() = %v, want %s", repaired, name)
+	testutils.TrueOrError(t, len(events) == 1 && events[0].Type == EventBackupError, "want a backup error event, got %v", events)
+	_, err = os.Stat(tmp)
+	testutils.TrueOrError(t, os.IsNotExist(err), "temporary file should be removed, got error = %v", err)
+
+	rc, err := OpenBackup(name)
+	testutils.TrueOrFatal(t, err == nil, "OpenBackup() error = %v", err)
+	b, err := ioutil.ReadAll(rc)
+	rc.Close()
+	testutils.TrueOrError(t, err == nil && len(b) >= len("first\n") && string(b[:6]) == "first\n", "repaired backup = %q, error = %v", b, err)
+
+	repaired, err = f.VerifyBackups()
+	testutils.TrueOrError(t, err == nil && len(repaired) == 0, "verifying again = %v, error = %v, want nothing repaired", repaired, err)
+}
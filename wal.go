@@ -0,0 +1,218 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	// writeAheadExt is appended to Filename for its write-ahead file.
+	writeAheadExt = ".wal"
+	// writeAheadMagic starts every write-ahead file, followed by the length
+	// of the data after the header as a little endian uint64.
+	writeAheadMagic      = "LFWAL\x00\x00\x01"
+	writeAheadHeaderSize = len(writeAheadMagic) + 8
+)
+
+// WriteAheadFilename returns the name of the write-ahead file of the active
+// file filename, see File.WriteAhead.
+func WriteAheadFilename(filename string) string {
+	return filename + writeAheadExt
+}
+
+// writeAhead mirrors the contents of the write buffer in a file, so that they
+// can be recovered if the process dies before the buffer is flushed. Where
+// the platform supports it the file is memory-mapped, so mirroring a write is
+// just a copy into memory that the OS writes back on its own.
+type writeAhead struct {
+	fh *os.File
+	// mapped is the mapped file, nil if the platform cannot map it, in which
+	// case fh is written to instead.
+	mapped []byte
+	// n is the length of the data mirrored.
+	n int
+}
+
+// openWriteAhead opens the write-ahead file of f if WriteAhead is set, after
+// replaying whatever it holds from a previous run into Filename.
+func (f *File) openWriteAhead() error {
+	if !f.WriteAhead || f.writeAhead != nil {
+		return nil
+	}
+	name := WriteAheadFilename(f.Filename)
+	if err := f.replayWriteAhead(name); err != nil {
+		return fmt.Errorf("unable to replay write-ahead file %s: %v", name, err)
+	}
+	fh, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, fileOpenMode)
+	if err != nil {
+		return fmt.Errorf("unable to open write-ahead file %s: %v", name, err)
+	}
+	size := writeAheadHeaderSize + f.BufferSize
+	if err := fh.Truncate(int64(size)); err != nil {
+		fh.Close()
+		return fmt.Errorf("unable to size write-ahead file %s: %v", name, err)
+	}
+	w := &writeAhead{fh: fh}
+	if w.mapped, err = mapFile(fh, size); err != nil {
+		fh.Close()
+		return fmt.Errorf("unable to map write-ahead file %s: %v", name, err)
+	}
+	if err := w.writeAt([]byte(writeAheadMagic), 0); err != nil {
+		w.close()
+		return fmt.Errorf("unable to write write-ahead file %s: %v", name, err)
+	}
+	if err := w.reset(); err != nil {
+		w.close()
+		return fmt.Errorf("unable to write write-ahead file %s: %v", name, err)
+	}
+	f.writeAhead = w
+	return nil
+}
+
+// replayWriteAhead appends the data held by the write-ahead file name to
+// Filename, keeping Filename's modification time so that its rotation is not
+// put off.
+func (f *File) replayWriteAhead(name string) error {
+	b, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(b) < writeAheadHeaderSize || !bytes.HasPrefix(b, []byte(writeAheadMagic)) {
+		return nil
+	}
+	n := binary.LittleEndian.Uint64(b[len(writeAheadMagic):writeAheadHeaderSize])
+	if n == 0 || n > uint64(len(b)-writeAheadHeaderSize) {
+		return nil
+	}
+	info, statErr := os.Stat(f.Filename)
+	fh, err := os.OpenFile(f.Filename, fileWriteCreateAppendFlag, fileOpenMode)
+	if err != nil {
+		return err
+	}
+	if _, err := fh.Write(b[writeAheadHeaderSize : writeAheadHeaderSize+int(n)]); err != nil {
+		fh.Close()
+		return err
+	}
+	if err := fh.Sync(); err != nil {
+		fh.Close()
+		return err
+	}
+	if err := fh.Close(); err != nil {
+		return err
+	}
+	f.emit(Event{
+		Type:     EventWriteAheadReplay,
+		Filename: f.Filename,
+		Bytes:    int64(n),
+		Message:  fmt.Sprintf("replayed %d bytes from write-ahead file %s into %s", n, name, f.Filename),
+	})
+	if statErr != nil {
+		return nil
+	}
+	return os.Chtimes(f.Filename, info.ModTime(), info.ModTime())
+}
+
+// append mirrors p, which must fit in the space left.
+func (w *writeAhead) append(p []byte) error {
+	if err := w.writeAt(p, writeAheadHeaderSize+w.n); err != nil {
+		return err
+	}
+	// the length is updated after the data, so that a crash in between
+	// loses p rather than replaying garbage
+	return w.setLen(w.n + len(p))
+}
+
+// reset empties the mirrored data, after the buffer was flushed or dropped.
+func (w *writeAhead) reset() error {
+	return w.setLen(0)
+}
+
+func (w *writeAhead) setLen(n int) error {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(n))
+	if err := w.writeAt(b[:], len(writeAheadMagic)); err != nil {
+		return err
+	}
+	w.n = n
+	return nil
+}
+
+func (w *writeAhead) writeAt(p []byte, off int) error {
+	if w.mapped != nil {
+		copy(w.mapped[off:], p)
+		return nil
+	}
+	_, err := w.fh.WriteAt(p, int64(off))
+	return err
+}
+
+func (w *writeAhead) close() error {
+	var errs multipleErrors
+	if w.mapped != nil {
+		if err := unmapFile(w.mapped); err != nil {
+			errs = append(errs, err)
+		}
+		w.mapped = nil
+	}
+	if err := w.fh.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs.err()
+}
+
+// closeWriteAhead closes the write-ahead file if it is open. Whatever it
+// still holds, if the buffer could not be flushed, is kept to be replayed.
+func (f *File) closeWriteAhead() error {
+	if f.writeAhead == nil {
+		return nil
+	}
+	err := f.writeAhead.close()
+	f.writeAhead = nil
+	if err != nil {
+		return fmt.Errorf("write-ahead close error: %v", err)
+	}
+	return nil
+}
+
+// bufWrite writes p to the write buffer, mirroring it into the write-ahead
+// file if there is one. Writes that do not fit in the buffer go straight to
+// the file, as with bufio.Writer.
+func (f *File) bufWrite(p []byte) (int, error) {
+	if f.writeAhead == nil {
+		return f.buf.Write(p)
+	}
+	if len(p) > f.buf.Available() {
+		// flush here rather than let the buffer do it, so that the
+		// write-ahead file is emptied along with it
+		if err := f.flush(); err != nil {
+			return 0, err
+		}
+	}
+	if len(p) > f.buf.Available() {
+		return f.fileWriter(f.file).Write(p)
+	}
+	if err := f.writeAhead.append(p); err != nil {
+		f.emit(Event{Type: EventWriteError, Filename: WriteAheadFilename(f.Filename), Message: "unable to write to write-ahead file", Err: err})
+	}
+	return f.buf.Write(p)
+}
+
+// resetWriteAhead empties the write-ahead file if there is one.
+func (f *File) resetWriteAhead() {
+	if f.writeAhead == nil {
+		return
+	}
+	if err := f.writeAhead.reset(); err != nil {
+		f.emit(Event{Type: EventWriteError, Filename: WriteAheadFilename(f.Filename), Message: "unable to reset write-ahead file", Err: err})
+	}
+}
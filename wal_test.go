@@ -0,0 +1,57 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lohvht/logfeller/internal/testutils"
+)
+
+func TestFile_WriteAhead(t *testing.T) {
+	dirname, err := testutils.MkTestDir("WriteAhead")
+	testutils.TrueOrFatal(t, err == nil, "should not fail at creating test dir; dir=%s, error = %v", dirname, err)
+	defer os.RemoveAll(dirname)
+	filename := filepath.Join(dirname, "app.log")
+
+	f := &File{Filename: filename, BufferSize: 64, WriteAhead: true}
+	_, err = f.Write([]byte("flushed\n"))
+	testutils.TrueOrFatal(t, err == nil && f.Flush() == nil, "File.Write() and Flush() should not fail, err = %v", err)
+	for _, line := range []string{"one\n", "two\n", "a line longer than the buffer, which goes straight to the file\n", "three\n"} {
+		_, err := f.Write([]byte(line))
+		testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	}
+	// the process dies without flushing
+	testutils.TrueOrFatal(t, f.writeAhead.close() == nil, "writeAhead.close() should not fail")
+	b, err := ioutil.ReadFile(filename)
+	testutils.TrueOrFatal(t, err == nil, "failed to read file: %v", err)
+	want := "flushed\none\ntwo\na line longer than the buffer, which goes straight to the file\n"
+	testutils.TrueOrFatal(t, string(b) == want, "file content before replay = %q, want %q", b, want)
+
+	var events []Event
+	f = &File{Filename: filename, BufferSize: 64, WriteAhead: true, OnEvent: func(e Event) { events = append(events, e) }}
+	_, err = f.Write([]byte("after\n"))
+	testutils.TrueOrFatal(t, err == nil, "File.Write() error = %v", err)
+	testutils.TrueOrFatal(t, f.Close() == nil, "File.Close() should not fail")
+	b, err = ioutil.ReadFile(filename)
+	testutils.TrueOrFatal(t, err == nil, "failed to read file: %v", err)
+	want += "three\nafter\n"
+	testutils.TrueOrError(t, string(b) == want, "file content after replay = %q, want %q", b, want)
+	testutils.TrueOrError(t, len(events) == 1 && events[0].Type == EventWriteAheadReplay && events[0].Bytes == 6,
+		"events = %v, want 1 %s event of 6 bytes", events, EventWriteAheadReplay)
+
+	// a clean Close leaves nothing to replay
+	events = nil
+	f = &File{Filename: filename, BufferSize: 64, WriteAhead: true, OnEvent: func(e Event) { events = append(events, e) }}
+	_, err = f.Write([]byte("last\n"))
+	testutils.TrueOrFatal(t, err == nil && f.Close() == nil, "File.Write() and Close() should not fail, err = %v", err)
+	b, err = ioutil.ReadFile(filename)
+	testutils.TrueOrFatal(t, err == nil, "failed to read file: %v", err)
+	testutils.TrueOrError(t, string(b) == want+"last\n", "file content = %q, want %q", b, want+"last\n")
+	testutils.TrueOrError(t, len(events) == 0, "events = %v, want none", events)
+}
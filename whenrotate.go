@@ -7,6 +7,7 @@ package logfeller
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -20,25 +21,68 @@ const (
 	// instead
 	approxOneMonth = 30 * oneDay
 	oneYear        = 365 * oneDay
+	oneWeek        = 7 * oneDay
+	// shortestMonthDays is the number of days in the shortest month.
+	shortestMonthDays = 28
 )
 
 // WhenRotate helps reason about logic related to rotation of the file.
 type WhenRotate string
 
 const (
-	Hour  WhenRotate = "h"
-	Day   WhenRotate = "d"
-	Month WhenRotate = "m"
-	Year  WhenRotate = "y"
+	Hour    WhenRotate = "h"
+	Day     WhenRotate = "d"
+	Week    WhenRotate = "w"
+	Month   WhenRotate = "m"
+	Quarter WhenRotate = "q"
+	Year    WhenRotate = "y"
 )
 
+// monthsInQuarter is the number of months in a quarter.
+const monthsInQuarter = 3
+
+// validWhenRotates lists the accepted WhenRotate values for error messages.
+var validWhenRotates = []string{string(Hour), string(Day), string(Week), string(Month), string(Quarter), string(Year)}
+
+// whenRotateNames maps WhenRotate values to their names.
+var whenRotateNames = map[WhenRotate]string{
+	Hour:    "Hour",
+	Day:     "Day",
+	Week:    "Week",
+	Month:   "Month",
+	Quarter: "Quarter",
+	Year:    "Year",
+}
+
+// String returns the name of the interval, such as "hour" for Hour. Values
+// that are not valid are returned as is.
+func (r WhenRotate) String() string {
+	if name, ok := whenRotateNames[r.lower()]; ok {
+		return strings.ToLower(name)
+	}
+	return string(r)
+}
+
+// GoString returns the Go syntax of r, such as "logfeller.Hour".
+func (r WhenRotate) GoString() string {
+	if name, ok := whenRotateNames[r]; ok {
+		return "logfeller." + name
+	}
+	return fmt.Sprintf("logfeller.WhenRotate(%q)", string(r))
+}
+
 var (
-	hourOffsetRegex  = regexp.MustCompile(`^(?P<minutes>\d{2}):(?P<seconds>\d{2})$`)
-	dayOffsetRegex   = regexp.MustCompile(`^(?P<hours>\d{2})(?P<minutes>\d{2}):(?P<seconds>\d{2})$`)
-	monthOffsetRegex = regexp.MustCompile(`^(?P<days>\d{2}) (?P<hours>\d{2})(?P<minutes>\d{2}):(?P<seconds>\d{2})$`)
-	yearOffsetRegex  = regexp.MustCompile(`^(?P<months>\d{2})(?P<days>\d{2}) (?P<hours>\d{2})(?P<minutes>\d{2}):(?P<seconds>\d{2})$`)
+	hourOffsetRegex  = regexp.MustCompile(`^(?P<minutes>\d{2}):(?P<seconds>\d{2})` + fractionRegexStr + `$`)
+	dayOffsetRegex   = regexp.MustCompile(`^(?P<hours>\d{2})(?P<minutes>\d{2}):(?P<seconds>\d{2})` + fractionRegexStr + `$`)
+	weekOffsetRegex  = regexp.MustCompile(`^(?P<weekday>\d) (?P<hours>\d{2})(?P<minutes>\d{2}):(?P<seconds>\d{2})` + fractionRegexStr + `$`)
+	monthOffsetRegex = regexp.MustCompile(`^(?P<days>\d{2}) (?P<hours>\d{2})(?P<minutes>\d{2}):(?P<seconds>\d{2})` + fractionRegexStr + `$`)
+	yearOffsetRegex  = regexp.MustCompile(`^(?P<months>\d{2})(?P<days>\d{2}) (?P<hours>\d{2})(?P<minutes>\d{2}):(?P<seconds>\d{2})` + fractionRegexStr + `$`)
 )
 
+// fractionRegexStr matches the optional fractional seconds of a schedule,
+// up to nanosecond precision.
+const fractionRegexStr = `(?:\.(?P<fraction>\d{1,9}))?`
+
 func (r WhenRotate) lower() WhenRotate { return WhenRotate(strings.ToLower(string(r))) }
 
 // interval returns the duration of an interval in whenRotate, given the time
@@ -48,8 +92,13 @@ func (r WhenRotate) interval(t time.Time) time.Duration {
 		return 1 * time.Hour
 	case Day:
 		return oneDay
+	case Week:
+		return oneWeek
 	case Month:
 		return time.Duration(daysIn(t.Month(), t.Year())) * oneDay
+	case Quarter:
+		start := Quarter.periodStart(t)
+		return start.AddDate(0, monthsInQuarter, 0).Sub(start)
 	case Year:
 		return oneYear
 	default:
@@ -66,10 +115,10 @@ func daysIn(m time.Month, year int) int {
 // valid returns an error if its not valid
 func (r WhenRotate) valid() error {
 	switch r {
-	case Hour, Day, Month, Year:
+	case Hour, Day, Week, Month, Quarter, Year:
 		return nil
 	default:
-		return fmt.Errorf("invalid when rotate value specified: %s, accepted values are %v", r, []WhenRotate{Hour, Day, Month, Year})
+		return fmt.Errorf("invalid when rotate value specified: %s, accepted values are %v", string(r), validWhenRotates)
 	}
 }
 
@@ -79,10 +128,10 @@ func (r WhenRotate) baseRotateTime() timeSchedule {
 	switch r {
 	case Hour, Day:
 		return off
-	case Month:
+	case Week, Month:
 		off.day = 1
 		return off
-	case Year:
+	case Quarter, Year:
 		off.day = 1
 		off.month = 1
 		return off
@@ -100,6 +149,7 @@ func (r WhenRotate) baseRotateTime() timeSchedule {
 // This does not handle year offset specifically for the month,
 // it just takes an upper bound of the max number of days a month has (i.e. 31 days),
 // so for When = "y", "0231 1504:05" will still be considered valid.
+// Use scheduleAlwaysExists to reject days that do not exist in every period.
 func (r WhenRotate) parseTimeSchedule(offsetStr string) (timeSchedule, error) { //nolint:gocyclo // Let cyclo err here go
 	var offsetRegex *regexp.Regexp
 	when := r
@@ -108,28 +158,43 @@ func (r WhenRotate) parseTimeSchedule(offsetStr string) (timeSchedule, error) {
 		offsetRegex = hourOffsetRegex
 	case Day:
 		offsetRegex = dayOffsetRegex
+	case Week:
+		offsetRegex = weekOffsetRegex
 	case Month:
 		offsetRegex = monthOffsetRegex
-	case Year:
+	case Quarter, Year:
 		offsetRegex = yearOffsetRegex
 	default:
-		return timeSchedule{}, fmt.Errorf("invalid rotation interval specified: %s, expected %v", r, [...]WhenRotate{Hour, Day, Month, Year})
+		return timeSchedule{}, fmt.Errorf("invalid rotation interval specified: %s, expected %v", string(r), validWhenRotates)
+	}
+	if strings.HasPrefix(offsetStr, "+") {
+		return r.parseRelativeSchedule(offsetStr)
 	}
 	match := offsetRegex.FindStringSubmatch(offsetStr)
 	if len(match) != len(offsetRegex.SubexpNames()) {
 		validFormatMsg := map[WhenRotate]string{
-			Hour:  `"04:05" (MM:SS)`,
-			Day:   `"1504:05" (HHMM:SS)`,
-			Month: `"02 1504:05" (DD HHMM:SS)`,
-			Year:  `"0102 1504:05" (mmDD HHMM:SS)`,
+			Hour:    `"04:05" (MM:SS)`,
+			Day:     `"1504:05" (HHMM:SS)`,
+			Week:    `"1 1504:05" (D HHMM:SS) where D is the ISO weekday, 1 for Monday to 7 for Sunday`,
+			Month:   `"02 1504:05" (DD HHMM:SS)`,
+			Quarter: `"0102 1504:05" (mmDD HHMM:SS) where mm is the month of the quarter`,
+			Year:    `"0102 1504:05" (mmDD HHMM:SS)`,
 		}
-		return timeSchedule{}, fmt.Errorf("invalid offset passed in for 'when' value '%s', expected value of format %s, got '%s'", r, validFormatMsg[when], offsetStr)
+		validFormatMsg[when] += " with optional fractional seconds (e.g. .5 or .000250)"
+		return timeSchedule{}, fmt.Errorf("invalid offset passed in for 'when' value '%s', expected value of format %s, got '%s'", string(r), validFormatMsg[when], offsetStr)
 	}
 	var off timeSchedule
 	for i, name := range offsetRegex.SubexpNames() {
 		if i == 0 {
 			continue
 		}
+		if name == "fraction" {
+			if match[i] != "" {
+				// right pad to nanoseconds, "5" is 500000000ns
+				off.nanosecond, _ = strconv.Atoi(match[i] + strings.Repeat("0", 9-len(match[i])))
+			}
+			continue
+		}
 		// Ignore the error here, the regex should have handled it properly here
 		res, _ := strconv.Atoi(match[i])
 		switch name {
@@ -137,12 +202,20 @@ func (r WhenRotate) parseTimeSchedule(offsetStr string) (timeSchedule, error) {
 			if res < 1 || res > 12 {
 				return timeSchedule{}, fmt.Errorf("invalid month offset %d, month must be between 1-12", res)
 			}
+			if when == Quarter && res > monthsInQuarter {
+				return timeSchedule{}, fmt.Errorf("invalid month offset %d, month of the quarter must be between 1-%d", res, monthsInQuarter)
+			}
 			off.month = res
 		case "days":
 			if res < 1 || res > 31 {
 				return timeSchedule{}, fmt.Errorf("invalid day offset %d, day must be between 1-31", res)
 			}
 			off.day = res
+		case "weekday":
+			if res < 1 || res > 7 {
+				return timeSchedule{}, fmt.Errorf("invalid weekday offset %d, weekday must be between 1-7", res)
+			}
+			off.day = res
 		case "hours":
 			if res < 0 || res > 23 {
 				return timeSchedule{}, fmt.Errorf("invalid hour offset %d, hour must be between 0-23", res)
@@ -163,36 +236,166 @@ func (r WhenRotate) parseTimeSchedule(offsetStr string) (timeSchedule, error) {
 	return off, nil
 }
 
+// parseRelativeSchedule parses a schedule given as an offset from the start
+// of the period, such as "+6h". The offsets of months, quarters and years are
+// from the start of their first day, and within the 28 days of February, so
+// that the day they fall on is the same in every period.
+func (r WhenRotate) parseRelativeSchedule(offsetStr string) (timeSchedule, error) {
+	d, err := time.ParseDuration(offsetStr[1:])
+	if err != nil {
+		return timeSchedule{}, fmt.Errorf("invalid relative offset '%s': %v", offsetStr, err)
+	}
+	limit := 28 * oneDay
+	switch r {
+	case Hour:
+		limit = time.Hour
+	case Day:
+		limit = oneDay
+	case Week:
+		limit = oneWeek
+	}
+	if d < 0 || d >= limit {
+		return timeSchedule{}, fmt.Errorf("invalid relative offset '%s', offset must be at least 0 and less than %s", offsetStr, limit)
+	}
+	var off timeSchedule
+	switch r {
+	case Week, Month:
+		off.day = 1
+	case Quarter, Year:
+		off.month, off.day = 1, 1
+	}
+	off.day += int(d / oneDay)
+	d %= oneDay
+	off.hour = int(d / time.Hour)
+	d %= time.Hour
+	off.minute = int(d / time.Minute)
+	d %= time.Minute
+	off.second = int(d / time.Second)
+	off.nanosecond = int(d % time.Second)
+	return off, nil
+}
+
 // nearestScheduledTime takes current time passed in and a schedule and returns
 // the closest by the time schedule given. The behaviour of the time schedule
 // the value of when.
+// Days that do not exist in the month are clamped to the last day of the month.
 func (r WhenRotate) nearestScheduledTime(currentTime time.Time, sch timeSchedule) time.Time {
 	year, month, day := currentTime.Date()
 	hour := currentTime.Hour()
 	loc := currentTime.Location()
 	switch r {
 	case Hour:
-		return time.Date(year, month, day, hour, sch.minute, sch.second, 0, loc)
+		return time.Date(year, month, day, hour, sch.minute, sch.second, sch.nanosecond, loc)
 	case Day:
-		return time.Date(year, month, day, sch.hour, sch.minute, sch.second, 0, loc)
+		return time.Date(year, month, day, sch.hour, sch.minute, sch.second, sch.nanosecond, loc)
+	case Week:
+		year, month, day = Week.periodStart(currentTime).AddDate(0, 0, sch.day-1).Date()
+		return time.Date(year, month, day, sch.hour, sch.minute, sch.second, sch.nanosecond, loc)
 	case Month:
-		return time.Date(year, month, sch.day, sch.hour, sch.minute, sch.second, 0, loc)
+		return time.Date(year, month, clampDay(sch.day, month, year), sch.hour, sch.minute, sch.second, sch.nanosecond, loc)
+	case Quarter:
+		month = quarterStartMonth(month) + time.Month(sch.month-1)
+		return time.Date(year, month, clampDay(sch.day, month, year), sch.hour, sch.minute, sch.second, sch.nanosecond, loc)
 	case Year:
-		return time.Date(year, time.Month(sch.month), sch.day, sch.hour, sch.minute, sch.second, 0, loc)
+		month = time.Month(sch.month)
+		return time.Date(year, month, clampDay(sch.day, month, year), sch.hour, sch.minute, sch.second, sch.nanosecond, loc)
 	default:
 		return currentTime
 	}
 }
 
-// addTime adds n Hours/Days/Months/Years depending on WhenRotate
+// quarterStartMonth returns the first month of the quarter m is in.
+func quarterStartMonth(m time.Month) time.Month {
+	return (m-1)/monthsInQuarter*monthsInQuarter + 1
+}
+
+// clampDay returns day, or the last day of the month if day is beyond it.
+func clampDay(day int, m time.Month, year int) int {
+	if last := daysIn(m, year); day > last {
+		return last
+	}
+	return day
+}
+
+// scheduleExists reports if the day of the schedule exists in the period
+// containing currentTime.
+func (r WhenRotate) scheduleExists(currentTime time.Time, sch timeSchedule) bool {
+	switch r {
+	case Month:
+		return sch.day <= daysIn(currentTime.Month(), currentTime.Year())
+	case Quarter:
+		return sch.day <= daysIn(quarterStartMonth(currentTime.Month())+time.Month(sch.month-1), currentTime.Year())
+	case Year:
+		return sch.day <= daysIn(time.Month(sch.month), currentTime.Year())
+	default:
+		return true
+	}
+}
+
+// scheduleAlwaysExists returns an error if the day of the schedule does not
+// exist in every period, such as the 31st for monthly rotations or the 29th
+// of February for yearly rotations.
+func (r WhenRotate) scheduleAlwaysExists(sch timeSchedule) error {
+	switch r {
+	case Month:
+		if sch.day > shortestMonthDays {
+			return fmt.Errorf("day %d does not exist in every month, day must be between 1-%d", sch.day, shortestMonthDays)
+		}
+	case Quarter:
+		// 2001 is not a leap year, check the month in every quarter
+		for m := time.Month(sch.month); m <= time.December; m += monthsInQuarter {
+			if last := daysIn(m, 2001); sch.day > last {
+				return fmt.Errorf("day %d does not exist in month %d of every quarter, day must be between 1-%d", sch.day, sch.month, last)
+			}
+		}
+	case Year:
+		// 2001 is not a leap year, every other month has the same number of days
+		if last := daysIn(time.Month(sch.month), 2001); sch.day > last {
+			return fmt.Errorf("day %d does not exist in %s every year, day must be between 1-%d", sch.day, time.Month(sch.month), last)
+		}
+	}
+	return nil
+}
+
+// periodStart returns the start of the Hour/Day/Week/Month/Quarter/Year
+// containing t. Weeks are ISO weeks, which start on Monday.
+func (r WhenRotate) periodStart(t time.Time) time.Time {
+	year, month, day := t.Date()
+	loc := t.Location()
+	switch r {
+	case Hour:
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, loc)
+	case Day:
+		return time.Date(year, month, day, 0, 0, 0, 0, loc)
+	case Week:
+		// days since Monday
+		since := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-since, 0, 0, 0, 0, loc)
+	case Month:
+		return time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	case Quarter:
+		return time.Date(year, quarterStartMonth(month), 1, 0, 0, 0, 0, loc)
+	case Year:
+		return time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+	default:
+		return t
+	}
+}
+
+// addTime adds n Hours/Days/Weeks/Months/Quarters/Years depending on
+// WhenRotate. Adding weeks keeps the weekday, so ISO weeks stay aligned.
 func (r WhenRotate) addTime(t time.Time, n int) time.Time {
 	switch r {
 	case Hour:
 		return t.Add(time.Duration(n) * time.Hour)
 	case Day:
 		return t.AddDate(0, 0, n)
+	case Week:
+		return t.AddDate(0, 0, 7*n)
 	case Month:
 		return t.AddDate(0, n, 0)
+	case Quarter:
+		return t.AddDate(0, n*monthsInQuarter, 0)
 	case Year:
 		return t.AddDate(n, 0, 0)
 	default:
@@ -200,14 +403,117 @@ func (r WhenRotate) addTime(t time.Time, n int) time.Time {
 	}
 }
 
+// Next returns the first rotation time after t of a File with a When of r
+// and a RotationSchedule of schedule, so that other work can be aligned with
+// its rotations. The default schedule of r is used if schedule is empty.
+// Times are in the location of t, pass t in UTC unless the File has
+// UseLocal set. Schedules are clamped as with a DayOverflow of "clamp", and
+// WeekdaysOnly, WeekParity and IsRotationDay are not taken into account.
+func (r WhenRotate) Next(t time.Time, schedule []string) (time.Time, error) {
+	_, next, err := r.rotationTimes(t, schedule)
+	return next, err
+}
+
+// Prev returns the last rotation time at or before t, as with Next.
+func (r WhenRotate) Prev(t time.Time, schedule []string) (time.Time, error) {
+	prev, _, err := r.rotationTimes(t, schedule)
+	return prev, err
+}
+
+// rotationTimes parses schedule and returns the rotation times around t.
+func (r WhenRotate) rotationTimes(t time.Time, schedule []string) (prev, next time.Time, err error) {
+	r = r.lower()
+	if err := r.valid(); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	times := make([]timeSchedule, 0, len(schedule))
+	for _, s := range schedule {
+		sch, err := r.parseTimeSchedule(s)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid rotation schedule %s: %v", s, err)
+		}
+		times = append(times, sch)
+	}
+	if len(times) == 0 {
+		times = append(times, r.baseRotateTime())
+	}
+	sort.Sort(timeSchedules(times))
+	prev, next = r.scheduledTimes(times, t, false, nil)
+	return prev, next, nil
+}
+
+// DayOverflowPolicy decides how schedules whose day does not exist in every
+// month are handled.
+type DayOverflowPolicy string
+
+const (
+	DayOverflowClamp DayOverflowPolicy = "clamp"
+	DayOverflowSkip  DayOverflowPolicy = "skip"
+	DayOverflowError DayOverflowPolicy = "error"
+)
+
+func (p DayOverflowPolicy) lower() DayOverflowPolicy {
+	return DayOverflowPolicy(strings.ToLower(string(p)))
+}
+
+// valid returns an error if its not valid
+func (p DayOverflowPolicy) valid() error {
+	switch p {
+	case DayOverflowClamp, DayOverflowSkip, DayOverflowError:
+		return nil
+	default:
+		return fmt.Errorf("invalid day overflow policy specified: %s, accepted values are %v",
+			p, []DayOverflowPolicy{DayOverflowClamp, DayOverflowSkip, DayOverflowError})
+	}
+}
+
+// WeekParity restricts rotations to ISO weeks with even or odd week
+// numbers.
+type WeekParity string
+
+const (
+	WeekParityAny  WeekParity = "any"
+	WeekParityEven WeekParity = "even"
+	WeekParityOdd  WeekParity = "odd"
+)
+
+func (p WeekParity) lower() WeekParity {
+	return WeekParity(strings.ToLower(string(p)))
+}
+
+// valid returns an error if its not valid
+func (p WeekParity) valid() error {
+	switch p {
+	case WeekParityAny, WeekParityEven, WeekParityOdd:
+		return nil
+	default:
+		return fmt.Errorf("invalid week parity specified: %s, accepted values are %v",
+			p, []WeekParity{WeekParityAny, WeekParityEven, WeekParityOdd})
+	}
+}
+
+// matches reports if t falls in an ISO week of parity p.
+func (p WeekParity) matches(t time.Time) bool {
+	_, week := t.ISOWeek()
+	switch p {
+	case WeekParityEven:
+		return week%2 == 0
+	case WeekParityOdd:
+		return week%2 == 1
+	default:
+		return true
+	}
+}
+
 // timeSchedule is the rough schedule of when to rotate. By itself this struct
 // has no meaning, it needs to be paired with WhenRotate.
 type timeSchedule struct {
-	month  int
-	day    int
-	hour   int
-	minute int
-	second int
+	month      int
+	day        int
+	hour       int
+	minute     int
+	second     int
+	nanosecond int
 }
 
 func (t *timeSchedule) approxDuration() time.Duration {
@@ -215,7 +521,8 @@ func (t *timeSchedule) approxDuration() time.Duration {
 		time.Duration(t.day)*oneDay +
 		time.Duration(t.hour)*time.Hour +
 		time.Duration(t.minute)*time.Minute +
-		time.Duration(t.second)*time.Second
+		time.Duration(t.second)*time.Second +
+		time.Duration(t.nanosecond)
 }
 
 // timeSchedules is a slice of timeSchedules, it satisfies sort.Interface
@@ -18,7 +18,9 @@ func TestWhenRotate_valid(t *testing.T) {
 	}{
 		{name: "hourly_lower", r: "h"},
 		{name: "daily_lower", r: "d"},
+		{name: "weekly_lower", r: "w"},
 		{name: "monthly_lower", r: "m"},
+		{name: "quarterly_lower", r: "q"},
 		{name: "yearly_lower", r: "y"},
 		{name: "invalid_singlechar", r: "a", wantErr: true},
 		{name: "invalid_multiplechar", r: "HOUR", wantErr: true},
@@ -40,7 +42,9 @@ func TestWhenRotate_baseRotateTime(t *testing.T) {
 	}{
 		{name: "hourly_lower", r: "h", want: timeSchedule{}},
 		{name: "daily_lower", r: "d", want: timeSchedule{}},
+		{name: "weekly_lower", r: "w", want: timeSchedule{day: 1}},
 		{name: "monthly_lower", r: "m", want: timeSchedule{day: 1}},
+		{name: "quarterly_lower", r: "q", want: timeSchedule{day: 1, month: 1}},
 		{name: "yearly_lower", r: "y", want: timeSchedule{day: 1, month: 1}},
 		{name: "invalid_singlechar", r: "a", want: timeSchedule{day: 1, month: 1}},
 		{name: "invalid_multiplechar", r: "hour", want: timeSchedule{day: 1, month: 1}},
@@ -67,9 +71,30 @@ func TestWhenRotate_parsetimeSchedule(t *testing.T) {
 	}{
 		{name: "hourly", r: "h", args: args{offsetStr: "14:45"}, want: timeSchedule{minute: 14, second: 45}},
 		{name: "daily", r: "d", args: args{offsetStr: "1914:45"}, want: timeSchedule{hour: 19, minute: 14, second: 45}},
+		{name: "weekly", r: "w", args: args{offsetStr: "5 1914:45"}, want: timeSchedule{day: 5, hour: 19, minute: 14, second: 45}},
+		{name: "weekly_weekday_exceed", r: "w", args: args{offsetStr: "8 1914:45"}, wantErr: true},
+		{name: "weekly_weekday_too_low", r: "w", args: args{offsetStr: "0 1914:45"}, wantErr: true},
+		{name: "weekly_relative", r: "w", args: args{offsetStr: "+30h"}, want: timeSchedule{day: 2, hour: 6}},
 		{name: "monthly", r: "m", args: args{offsetStr: "15 1914:45"}, want: timeSchedule{day: 15, hour: 19, minute: 14, second: 45}},
 		{name: "yearly", r: "y", args: args{offsetStr: "0615 1914:45"}, want: timeSchedule{month: 6, day: 15, hour: 19, minute: 14, second: 45}},
+		{name: "quarterly", r: "q", args: args{offsetStr: "0215 1914:45"}, want: timeSchedule{month: 2, day: 15, hour: 19, minute: 14, second: 45}},
+		{name: "quarterly_month_exceed", r: "q", args: args{offsetStr: "0415 1914:45"}, wantErr: true},
+		{name: "hourly_fraction", r: "h", args: args{offsetStr: "14:45.5"}, want: timeSchedule{minute: 14, second: 45, nanosecond: 500000000}},
+		{name: "daily_fraction_nanoseconds", r: "d", args: args{offsetStr: "1914:45.000000250"}, want: timeSchedule{hour: 19, minute: 14, second: 45, nanosecond: 250}},
+		{name: "fraction_too_precise", r: "h", args: args{offsetStr: "14:45.0000000001"}, wantErr: true},
+		{name: "fraction_empty", r: "h", args: args{offsetStr: "14:45."}, wantErr: true},
 		{name: "when_error", r: "hour", wantErr: true},
+		{name: "hourly_relative", r: "h", args: args{offsetStr: "+30m"}, want: timeSchedule{minute: 30}},
+		{name: "daily_relative", r: "d", args: args{offsetStr: "+6h30m1.5s"}, want: timeSchedule{hour: 6, minute: 30, second: 1, nanosecond: 500000000}},
+		{name: "monthly_relative", r: "m", args: args{offsetStr: "+36h"}, want: timeSchedule{day: 2, hour: 12}},
+		{name: "yearly_relative", r: "y", args: args{offsetStr: "+0s"}, want: timeSchedule{month: 1, day: 1}},
+		{name: "monthly_relative_last", r: "m", args: args{offsetStr: "+671h"}, want: timeSchedule{day: 28, hour: 23}},
+		{name: "monthly_relative_february", r: "m", args: args{offsetStr: "+672h"}, wantErr: true},
+		{name: "monthly_relative_30_days", r: "m", args: args{offsetStr: "+720h"}, wantErr: true},
+		{name: "quarterly_relative_30_days", r: "q", args: args{offsetStr: "+720h"}, wantErr: true},
+		{name: "hourly_relative_exceed", r: "h", args: args{offsetStr: "+1h"}, wantErr: true},
+		{name: "daily_relative_negative", r: "d", args: args{offsetStr: "+-1h"}, wantErr: true},
+		{name: "relative_invalid", r: "d", args: args{offsetStr: "+6 hours"}, wantErr: true},
 		{name: "hourly_format_invalid", r: "h", args: args{offsetStr: "114451"}, wantErr: true},
 		{name: "daily_format_invalid", r: "D", args: args{offsetStr: "1 114451"}, wantErr: true},
 		{name: "monthly_format_invalid", r: "m", args: args{offsetStr: "111 114451"}, wantErr: true},
@@ -96,6 +121,73 @@ func TestWhenRotate_parsetimeSchedule(t *testing.T) {
 	}
 }
 
+func TestWhenRotate_scheduleAlwaysExists(t *testing.T) {
+	tests := []struct {
+		name    string
+		r       WhenRotate
+		sch     timeSchedule
+		wantErr bool
+	}{
+		{name: "daily", r: "d", sch: timeSchedule{hour: 23}},
+		{name: "monthly_28th", r: "m", sch: timeSchedule{day: 28}},
+		{name: "monthly_29th", r: "m", sch: timeSchedule{day: 29}, wantErr: true},
+		{name: "monthly_31st", r: "m", sch: timeSchedule{day: 31}, wantErr: true},
+		{name: "quarterly_first_month_30th", r: "q", sch: timeSchedule{month: 1, day: 30}},
+		{name: "quarterly_first_month_31st", r: "q", sch: timeSchedule{month: 1, day: 31}, wantErr: true},
+		{name: "quarterly_second_month_31st", r: "q", sch: timeSchedule{month: 2, day: 31}, wantErr: true},
+		{name: "quarterly_third_month_30th", r: "q", sch: timeSchedule{month: 3, day: 30}},
+		{name: "yearly_january_31st", r: "y", sch: timeSchedule{month: 1, day: 31}},
+		{name: "yearly_february_29th", r: "y", sch: timeSchedule{month: 2, day: 29}, wantErr: true},
+		{name: "yearly_april_31st", r: "y", sch: timeSchedule{month: 4, day: 31}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.r.scheduleAlwaysExists(tt.sch); (err != nil) != tt.wantErr {
+				t.Errorf("WhenRotate.scheduleAlwaysExists() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWhenRotate_relativeScheduleShortMonths(t *testing.T) {
+	sch, err := Month.parseRelativeSchedule("+671h")
+	if err != nil {
+		t.Fatalf("WhenRotate.parseRelativeSchedule() error = %v", err)
+	}
+	if err := Month.scheduleAlwaysExists(sch); err != nil {
+		t.Errorf("WhenRotate.scheduleAlwaysExists() error = %v, want the offset on a day of every month", err)
+	}
+	for _, month := range []time.Month{time.February, time.April} {
+		got := Month.nearestScheduledTime(time.Date(2021, month, 10, 0, 0, 0, 0, time.UTC), sch)
+		if want := time.Date(2021, month, 1, 0, 0, 0, 0, time.UTC).Add(671 * time.Hour); !got.Equal(want) {
+			t.Errorf("%s: WhenRotate.nearestScheduledTime() = %v, want %v", month, got, want)
+		}
+	}
+}
+
+func TestWhenRotate_periodStart(t *testing.T) {
+	current := time.Date(2010, 8, 20, 20, 59, 10, 5, time.Local)
+	tests := []struct {
+		name string
+		r    WhenRotate
+		want time.Time
+	}{
+		{name: "hourly", r: "h", want: time.Date(2010, 8, 20, 20, 0, 0, 0, time.Local)},
+		{name: "daily", r: "d", want: time.Date(2010, 8, 20, 0, 0, 0, 0, time.Local)},
+		{name: "weekly", r: "w", want: time.Date(2010, 8, 16, 0, 0, 0, 0, time.Local)},
+		{name: "monthly", r: "m", want: time.Date(2010, 8, 1, 0, 0, 0, 0, time.Local)},
+		{name: "quarterly", r: "q", want: time.Date(2010, 7, 1, 0, 0, 0, 0, time.Local)},
+		{name: "yearly", r: "y", want: time.Date(2010, 1, 1, 0, 0, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.r.periodStart(current); !got.Equal(tt.want) {
+				t.Errorf("WhenRotate.periodStart() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestWhenRotate_nearestScheduledTime(t *testing.T) {
 	type args struct {
 		currentTime time.Time
@@ -107,6 +199,15 @@ func TestWhenRotate_nearestScheduledTime(t *testing.T) {
 		args args
 		want time.Time
 	}{
+		{
+			name: "schedule_on_sunday_weekly",
+			r:    "w",
+			args: args{
+				currentTime: time.Date(2010, 8, 20, 20, 59, 0, 0, time.Local),
+				sch:         timeSchedule{day: 7, hour: 23, minute: 30},
+			},
+			want: time.Date(2010, 8, 22, 23, 30, 0, 0, time.Local),
+		},
 		{
 			name: "schedule_at_30min45s_hourly_currtime_before",
 			r:    "h",
@@ -188,6 +289,24 @@ func TestWhenRotate_nearestScheduledTime(t *testing.T) {
 			},
 			want: time.Date(2010, 1, 1, 0, 0, 0, 0, time.Local),
 		},
+		{
+			name: "schedule_at_2nd_month_15thday_quarterly_currtime_before",
+			r:    "q",
+			args: args{
+				currentTime: time.Date(2010, 10, 2, 5, 59, 0, 0, time.Local),
+				sch:         timeSchedule{month: 2, day: 15, hour: 12},
+			},
+			want: time.Date(2010, 11, 15, 12, 0, 0, 0, time.Local),
+		},
+		{
+			name: "schedule_at_1st_quarterly_currtime_after",
+			r:    "q",
+			args: args{
+				currentTime: time.Date(2010, 6, 20, 23, 59, 0, 0, time.Local),
+				sch:         timeSchedule{month: 1, day: 1},
+			},
+			want: time.Date(2010, 4, 1, 0, 0, 0, 0, time.Local),
+		},
 		{
 			name: "schedule_at_october_15thday_1230:20_yearly_currtime_before",
 			r:    "y",
@@ -206,6 +325,24 @@ func TestWhenRotate_nearestScheduledTime(t *testing.T) {
 			},
 			want: time.Date(2010, 1, 7, 9, 30, 22, 0, time.Local),
 		},
+		{
+			name: "schedule_at_31st_monthly_clamped_in_february",
+			r:    "m",
+			args: args{
+				currentTime: time.Date(2010, 2, 20, 23, 59, 0, 0, time.Local),
+				sch:         timeSchedule{day: 31, hour: 9},
+			},
+			want: time.Date(2010, 2, 28, 9, 0, 0, 0, time.Local),
+		},
+		{
+			name: "schedule_at_february_29th_yearly_clamped_in_non_leap_year",
+			r:    "y",
+			args: args{
+				currentTime: time.Date(2010, 1, 20, 23, 59, 0, 0, time.Local),
+				sch:         timeSchedule{month: 2, day: 29},
+			},
+			want: time.Date(2010, 2, 28, 0, 0, 0, 0, time.Local),
+		},
 		{
 			name: "schedule_at_january_1st_yearly_currtime",
 			r:    "y",
@@ -236,6 +373,15 @@ func TestWhenRotate_AddTime(t *testing.T) {
 		args args
 		want time.Time
 	}{
+		{
+			name: "add_2_weeks_across_year",
+			r:    "w",
+			args: args{
+				t: time.Date(2020, 12, 28, 0, 0, 0, 0, time.Local),
+				n: 2,
+			},
+			want: time.Date(2021, 1, 11, 0, 0, 0, 0, time.Local),
+		},
 		{
 			name: "add_1_hour",
 			r:    "h",
@@ -344,6 +490,24 @@ func TestWhenRotate_AddTime(t *testing.T) {
 			},
 			want: time.Date(2009, 12, 1, 0, 59, 0, 0, time.Local),
 		},
+		{
+			name: "add_1_quarter_to_next_year",
+			r:    "q",
+			args: args{
+				t: time.Date(2010, 11, 20, 20, 59, 0, 0, time.Local),
+				n: 1,
+			},
+			want: time.Date(2011, 2, 20, 20, 59, 0, 0, time.Local),
+		},
+		{
+			name: "minus_1_quarter",
+			r:    "q",
+			args: args{
+				t: time.Date(2010, 8, 20, 20, 59, 0, 0, time.Local),
+				n: -1,
+			},
+			want: time.Date(2010, 5, 20, 20, 59, 0, 0, time.Local),
+		},
 		{
 			name: "add_1_year",
 			r:    "y",
@@ -371,3 +535,34 @@ func TestWhenRotate_AddTime(t *testing.T) {
 		})
 	}
 }
+
+func TestWhenRotate_NextPrev(t *testing.T) {
+	current := time.Date(2021, 3, 4, 10, 15, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		r        WhenRotate
+		schedule []string
+		wantPrev time.Time
+		wantNext time.Time
+		wantErr  bool
+	}{
+		{name: "hourly_default", r: "h", wantPrev: time.Date(2021, 3, 4, 10, 0, 0, 0, time.UTC), wantNext: time.Date(2021, 3, 4, 11, 0, 0, 0, time.UTC)},
+		{name: "daily_schedules", r: "D", schedule: []string{"1800:00", "0600:00"}, wantPrev: time.Date(2021, 3, 4, 6, 0, 0, 0, time.UTC), wantNext: time.Date(2021, 3, 4, 18, 0, 0, 0, time.UTC)},
+		{name: "at_rotation", r: "d", schedule: []string{"1015:00"}, wantPrev: current, wantNext: time.Date(2021, 3, 5, 10, 15, 0, 0, time.UTC)},
+		{name: "monthly_clamped", r: "m", schedule: []string{"31 0000:00"}, wantPrev: time.Date(2021, 2, 28, 0, 0, 0, 0, time.UTC), wantNext: time.Date(2021, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{name: "when_invalid", r: "x", wantErr: true},
+		{name: "schedule_invalid", r: "d", schedule: []string{"2500:00"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, err := tt.r.Next(current, tt.schedule)
+			if (err != nil) != tt.wantErr || !next.Equal(tt.wantNext) {
+				t.Errorf("WhenRotate.Next() = %v, error = %v, want %v, wantErr %v", next, err, tt.wantNext, tt.wantErr)
+			}
+			prev, err := tt.r.Prev(current, tt.schedule)
+			if (err != nil) != tt.wantErr || !prev.Equal(tt.wantPrev) {
+				t.Errorf("WhenRotate.Prev() = %v, error = %v, want %v, wantErr %v", prev, err, tt.wantPrev, tt.wantErr)
+			}
+		})
+	}
+}
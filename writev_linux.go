@@ -0,0 +1,73 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// maxIovecs is the most buffers passed to a single writev call, IOV_MAX on
+// linux.
+const maxIovecs = 1024
+
+// writev writes ps to fh with as few writev calls as possible.
+func writev(fh *os.File, ps [][]byte) (int, error) {
+	rc, err := fh.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var total int
+	// off is how much of ps[0] was written already
+	var off int
+	iovs := make([]syscall.Iovec, 0, maxIovecs)
+	for {
+		iovs = iovs[:0]
+		for i, p := range ps {
+			if i == 0 {
+				p = p[off:]
+			}
+			if len(iovs) == maxIovecs {
+				break
+			}
+			if len(p) == 0 {
+				continue
+			}
+			iov := syscall.Iovec{Base: &p[0]}
+			iov.SetLen(len(p))
+			iovs = append(iovs, iov)
+		}
+		if len(iovs) == 0 {
+			return total, nil
+		}
+		var n uintptr
+		var errno syscall.Errno
+		err := rc.Write(func(fd uintptr) bool {
+			n, _, errno = syscall.Syscall(syscall.SYS_WRITEV, fd, uintptr(unsafe.Pointer(&iovs[0])), uintptr(len(iovs)))
+			return errno != syscall.EAGAIN
+		})
+		if err != nil {
+			return total, err
+		}
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return total, &os.PathError{Op: "writev", Path: fh.Name(), Err: errno}
+		}
+		if n == 0 {
+			return total, io.ErrShortWrite
+		}
+		total += int(n)
+		// drop what was written
+		off += int(n)
+		for len(ps) > 0 && off >= len(ps[0]) {
+			off -= len(ps[0])
+			ps = ps[1:]
+		}
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !linux
+// +build !linux
+
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package logfeller
+
+import (
+	"os"
+)
+
+// writev writes ps to fh, coalesced into a single buffer so that it takes a
+// single write.
+func writev(fh *os.File, ps [][]byte) (int, error) {
+	bp := bufPool.Get().(*[]byte)
+	b := (*bp)[:0]
+	for _, p := range ps {
+		b = append(b, p...)
+	}
+	n, err := fh.Write(b)
+	// do not hold on to buffers from unusually large batches
+	if cap(b) <= maxPooledBuf {
+		*bp = b[:0]
+		bufPool.Put(bp)
+	}
+	return n, err
+}
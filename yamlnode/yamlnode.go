@@ -0,0 +1,94 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+// Package yamlnode decodes logfeller Files from yaml.v3 nodes, with the
+// positions of the offending fields in configuration errors. It is kept
+// apart from logfeller so that only its users depend on yaml.v3.
+package yamlnode
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/lohvht/logfeller"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Unmarshal decodes f from a yaml.v3 node and initialises it, as
+// File.UnmarshalYAML does for yaml.v2. The FieldErrors of the ConfigError
+// returned have the Line and Column of the offending field in the node.
+//
+// A method cannot have both the yaml.v2 and yaml.v3 forms of UnmarshalYAML,
+// and yaml.v3 decodes File with the yaml.v2 form, without positions. Types
+// that embed File can implement the yaml.v3 form with Unmarshal:
+//
+//	func (c *Config) UnmarshalYAML(n *yaml.Node) error {
+//		return yamlnode.Unmarshal(n, &c.File)
+//	}
+func Unmarshal(n *yamlv3.Node, f *logfeller.File) error {
+	type alias logfeller.File
+	// Replace f with tmp and decode there to skip its yaml.v2 UnmarshalYAML
+	tmp := (*alias)(f)
+	if err := n.Decode(tmp); err != nil {
+		return err
+	}
+	err := f.Validate()
+	var cerr *logfeller.ConfigError
+	if errors.As(err, &cerr) {
+		for _, fe := range cerr.Errors {
+			if pos := yamlFieldNode(n, fe.Field); pos != nil {
+				fe.Line, fe.Column = pos.Line, pos.Column
+			}
+		}
+	}
+	return err
+}
+
+// yamlFieldNode returns the node of field in n, such as
+// "extra_schedules[0].rotation_schedule[1]", or of the deepest part of field
+// found. It returns nil if none of field is found.
+func yamlFieldNode(n *yamlv3.Node, field string) *yamlv3.Node {
+	if n.Kind == yamlv3.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	var found *yamlv3.Node
+	for _, part := range strings.Split(field, ".") {
+		name, index := part, -1
+		if i := strings.IndexByte(part, '['); i >= 0 && strings.HasSuffix(part, "]") {
+			name = part[:i]
+			if idx, err := strconv.Atoi(part[i+1 : len(part)-1]); err == nil {
+				index = idx
+			}
+		}
+		n = yamlMappingValue(n, name)
+		if n == nil {
+			break
+		}
+		found = n
+		if index < 0 {
+			continue
+		}
+		if n.Kind != yamlv3.SequenceNode || index >= len(n.Content) {
+			break
+		}
+		n = n.Content[index]
+		found = n
+	}
+	return found
+}
+
+// yamlMappingValue returns the value of the key in the mapping node n that
+// is name in either its JSON or YAML form, nil if there is none.
+func yamlMappingValue(n *yamlv3.Node, name string) *yamlv3.Node {
+	if n.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if strings.ReplaceAll(n.Content[i].Value, "-", "_") == name {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package yamlnode
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lohvht/logfeller"
+	"github.com/lohvht/logfeller/internal/testutils"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+func TestUnmarshal(t *testing.T) {
+	var n yamlv3.Node
+	err := yamlv3.Unmarshal([]byte("filename: app.log\nwhen: h\nmin-rotation-interval: 1m\nrotation-schedule: [\"30:00\"]\n"), &n)
+	testutils.TrueOrFatal(t, err == nil, "yaml.Unmarshal() error = %v", err)
+	f := &logfeller.File{}
+	err = Unmarshal(&n, f)
+	testutils.TrueOrFatal(t, err == nil, "Unmarshal() error = %v", err)
+	testutils.TrueOrError(t, f.When == logfeller.Hour && f.MinRotationInterval == logfeller.Duration(time.Minute) && len(f.RotationSchedule) == 1,
+		"Unmarshal() = %#v", f)
+
+	err = yamlv3.Unmarshal([]byte("filename: app.log\nwhen: d\nrotation-schedule:\n  - \"0100:00\"\n  - \"2500:00\"\nextra-schedules:\n  - when: x\n"), &n)
+	testutils.TrueOrFatal(t, err == nil, "yaml.Unmarshal() error = %v", err)
+	err = Unmarshal(&n, &logfeller.File{})
+	var cerr *logfeller.ConfigError
+	testutils.TrueOrFatal(t, errors.As(err, &cerr) && len(cerr.Errors) == 2, "Unmarshal() error = %v, want 2 field errors", err)
+	for i, want := range [][2]int{{5, 5}, {7, 11}} {
+		fe := cerr.Errors[i]
+		testutils.TrueOrError(t, fe.Line == want[0] && fe.Column == want[1], "%s at line %d, column %d, want line %d, column %d", fe.Field, fe.Line, fe.Column, want[0], want[1])
+	}
+}